@@ -5,20 +5,40 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"frappuccino/internal/dal"
 	"frappuccino/internal/handler"
 	"frappuccino/internal/middleware"
+	"frappuccino/internal/models"
 	"frappuccino/internal/service"
 
 	_ "github.com/lib/pq"
 )
 
+// apiVersions lists the supported API versions and the routes scheduled for removal
+var apiVersions = models.APIVersionsResponse{
+	CurrentVersion: "v1",
+	SupportedVersions: []models.APIVersion{
+		{Version: "v1", Status: "current", BasePath: "/"},
+	},
+	DeprecatedRoutes: []models.DeprecatedRoute{
+		{
+			Method:      http.MethodGet,
+			Path:        "/orders/numberOfOrderedItems",
+			Sunset:      time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC),
+			Replacement: "/reports/popular-items",
+		},
+	},
+}
+
 func main() {
 	// Initialize database connection
 	db, err := initDB()
@@ -27,42 +47,91 @@ func main() {
 	}
 	defer db.Close()
 
+	usageRounding, err := dal.NewUsageRounding(
+		os.Getenv("INVENTORY_ROUNDING"),
+		getEnvInt("INVENTORY_ROUNDING_PRECISION", dal.DefaultUsageRounding.Precision),
+	)
+	if err != nil {
+		log.Fatalf("Invalid inventory rounding: %v", err)
+	}
+
+	deductOn, err := dal.ParseDeductionTrigger(os.Getenv("INVENTORY_DEDUCTION"))
+	if err != nil {
+		log.Fatalf("Invalid inventory deduction: %v", err)
+	}
+
 	// Initialize repositories
-	orderRepo := dal.NewOrderRepository(db)
+	orderRepo := dal.NewOrderRepository(db, usageRounding, deductOn, getEnvBool("AUTO_REORDER_REQUESTS", false))
 	reportRepo := dal.NewReportRepository(db)
 	inventoryRepo := dal.NewInventoryRepository(db)
 	menuRepo := dal.NewMenuRepository(db)
+	customerRepo := dal.NewCustomerRepository(db)
+	locationRepo := dal.NewLocationRepository(db)
 
 	// Initialize services
-	orderService := service.NewOrderService(orderRepo)
-	reportService := service.NewReportService(reportRepo)
+	orderService := service.NewOrderService(orderRepo, service.OrderServiceConfig{
+		JSONLimits: service.JSONLimits{
+			MaxBytes: getEnvInt("MAX_JSON_BYTES", service.DefaultJSONLimits.MaxBytes),
+			MaxDepth: getEnvInt("MAX_JSON_DEPTH", service.DefaultJSONLimits.MaxDepth),
+		},
+		PrepStations:           getEnvInt("PREP_STATIONS", service.DefaultOrderServiceConfig.PrepStations),
+		DefaultPrepMinutes:     service.DefaultOrderServiceConfig.DefaultPrepMinutes,
+		RejectClientTimestamps: getEnvBool("REJECT_CLIENT_TIMESTAMPS", false),
+		YellowAfterSeconds:     getEnvInt("URGENCY_YELLOW_SECONDS", service.DefaultOrderServiceConfig.YellowAfterSeconds),
+		RedAfterSeconds:        getEnvInt("URGENCY_RED_SECONDS", service.DefaultOrderServiceConfig.RedAfterSeconds),
+	})
+	reportService := service.NewReportService(reportRepo, time.Duration(getEnvInt("POPULAR_ITEMS_CACHE_TTL_SECONDS", 300))*time.Second)
 	inventoryService := service.NewInventoryService(inventoryRepo)
-	menuService := service.NewMenuService(menuRepo)
+	menuService := service.NewMenuService(menuRepo, time.Duration(getEnvInt("MENU_CACHE_TTL_SECONDS", 60))*time.Second)
+	customerService := service.NewCustomerService(customerRepo, service.CustomerServiceConfig{
+		AtRiskAfterDays: getEnvInt("CUSTOMER_AT_RISK_DAYS", service.DefaultCustomerServiceConfig.AtRiskAfterDays),
+	})
 
 	// Initialize handlers
 	orderHandler := handler.NewOrderHandler(orderService)
 	reportHandler := handler.NewReportHandler(reportService)
 	inventoryHandler := handler.NewInventoryHandler(inventoryService)
 	menuHandler := handler.NewMenuHandler(menuService)
+	customerHandler := handler.NewCustomerHandler(customerService)
+
+	apiHandler := handler.NewAPIHandler(apiVersions)
+	healthHandler := handler.NewHealthHandler(db)
+
+	accessLogger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	apiKeys := parseAPIKeys(os.Getenv("API_KEYS"))
+	if len(apiKeys) == 0 {
+		log.Println("API_KEYS is not set, every request except /health and /livez will be rejected")
+	}
+
+	// A rate of 0 turns rate limiting off
+	var rateLimits middleware.RateLimitStore
+	if rps := getEnvInt("RATE_LIMIT_RPS", 20); rps > 0 {
+		rateLimits = middleware.NewMemoryRateLimitStore(float64(rps), getEnvInt("RATE_LIMIT_BURST", 40), getEnvInt("RATE_LIMIT_MAX_CLIENTS", 10000))
+	}
 
 	// Create router
-	router := NewRouter(orderHandler, reportHandler, inventoryHandler, menuHandler)
+	router := NewRouter(orderHandler, reportHandler, inventoryHandler, menuHandler, customerHandler, apiHandler, healthHandler, locationRepo, accessLogger, apiKeys, rateLimits)
 
 	// Configure server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	port, err := resolvePort(os.Getenv("PORT"))
+	if err != nil {
+		log.Fatalf("Invalid PORT: %v", err)
 	}
-	port = "9090"
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%s", port),
 		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  getEnvDuration("READ_TIMEOUT", 10*time.Second),
+		WriteTimeout: getEnvDuration("WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:  getEnvDuration("IDLE_TIMEOUT", 60*time.Second),
 	}
 
+	// Keep seasonal menu items in sync with their season windows
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go service.RunSeasonScheduler(jobsCtx, menuService, time.Hour, time.Now)
+
 	// Start server in a goroutine
 	go func() {
 		log.Printf("Server starting on port %s", port)
@@ -77,6 +146,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -111,41 +181,145 @@ func initDB() (*sql.DB, error) {
 	return db, nil
 }
 
+// getEnvInt reads an integer environment variable, falling back to the default when unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// parseAPIKeys splits a comma separated list of API keys, ignoring blanks
+func parseAPIKeys(value string) []string {
+	var keys []string
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// resolvePort validates the PORT setting, defaulting to 8080 when it is unset
+func resolvePort(value string) (string, error) {
+	if value == "" {
+		return "8080", nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("%q is not a port number between 1 and 65535", value)
+	}
+	return strconv.Itoa(port), nil
+}
+
+// getEnvDuration reads a duration environment variable such as 30s, falling back to the default when unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool reads a boolean environment variable, falling back to the default when unset or invalid
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 func NewRouter(
 	orderHandler *handler.OrderHandler,
 	reportHandler *handler.ReportHandler,
 	inventoryHanlder *handler.InventoryHandler,
 	menuHandler *handler.MenuHandler,
+	customerHandler *handler.CustomerHandler,
+	apiHandler *handler.APIHandler,
+	healthHandler *handler.HealthHandler,
+	locationRepo dal.LocationRepository,
+	accessLogger *slog.Logger,
+	apiKeys []string,
+	rateLimits middleware.RateLimitStore,
 ) http.Handler {
 	mux := http.NewServeMux()
 
 	// Middleware chain
-	handler := middleware.Logging(mux)
+	handler := middleware.Deprecation(apiVersions.DeprecatedRoutes)(mux)
+	handler = middleware.Location(locationRepo.LocationExists)(handler)
+	if rateLimits != nil {
+		handler = middleware.RateLimit(rateLimits)(handler)
+	}
+	handler = middleware.APIKeyAuth(apiKeys)(handler)
 	handler = middleware.Recovery(handler)
+	handler = middleware.AccessLog(accessLogger)(handler)
+	handler = middleware.RequestID(handler)
+	handler = middleware.Tracing(handler)
 
 	// Order routes
 	mux.HandleFunc("POST /orders", orderHandler.CreateOrder)
+	mux.HandleFunc("GET /orders/stale", orderHandler.GetStaleOrders)
 	mux.HandleFunc("GET /orders/{id}", orderHandler.GetOrder)
+	mux.HandleFunc("GET /orders/{id}/queue-eta", orderHandler.GetQueueETA)
 	mux.HandleFunc("PUT /orders/{id}", orderHandler.UpdateOrder)
 	mux.HandleFunc("DELETE /orders/{id}", orderHandler.DeleteOrder)
 	mux.HandleFunc("POST /orders/{id}/close", orderHandler.CloseOrder)
+	mux.HandleFunc("POST /orders/{id}/cancel", orderHandler.CancelOrder)
+	mux.HandleFunc("PATCH /orders/{id}/status", orderHandler.UpdateOrderStatus)
+	mux.HandleFunc("GET /orders/{id}/status-history", orderHandler.GetOrderStatusHistory)
+	mux.HandleFunc("GET /orders/{id}/inventory-transactions", orderHandler.GetOrderInventoryTransactions)
 	mux.HandleFunc("GET /orders", orderHandler.ListOrders)
-	mux.HandleFunc("POST /orders/batch-process", orderHandler.ProcessBatchOrders)
+	batchLimit := middleware.ConcurrencyLimit(getEnvInt("MAX_CONCURRENT_BATCHES", 4), getEnvDuration("BATCH_QUEUE_WAIT", 5*time.Second))
+	mux.Handle("POST /orders/batch-process", batchLimit(http.HandlerFunc(orderHandler.ProcessBatchOrders)))
+	mux.HandleFunc("POST /orders/batch-feasibility", orderHandler.CheckBatchFeasibility)
+	mux.HandleFunc("POST /orders/bulk-status", orderHandler.BulkUpdateStatus)
+	mux.HandleFunc("POST /orders/batch-get", orderHandler.BatchGetOrders)
 	mux.HandleFunc("GET /orders/numberOfOrderedItems", orderHandler.GetOrderedItemsReport)
 
 	// Report routes
 	mux.HandleFunc("GET /reports/orderedItemsByPeriod", reportHandler.GetOrderedItemsByPeriod)
 	mux.HandleFunc("GET /reports/search", reportHandler.Search)
 	mux.HandleFunc("GET /reports/total-sales", reportHandler.GetTotalSales)
+	mux.HandleFunc("GET /reports/sales-by-payment", reportHandler.GetSalesByPaymentMethod)
+	mux.HandleFunc("GET /reports/repeat-rate", reportHandler.GetRepeatRate)
+	mux.HandleFunc("GET /reports/discount-summary", reportHandler.GetDiscountSummary)
 	mux.HandleFunc("GET /reports/popular-items", reportHandler.GetPopularItems)
+	mux.HandleFunc("GET /reports/order-rate", reportHandler.GetOrderRate)
+	mux.HandleFunc("GET /reports/cost-variance", reportHandler.GetCostVariance)
+	mux.HandleFunc("GET /reports/restock-history", reportHandler.GetRestockHistory)
+	mux.HandleFunc("POST /reports/sales-per-labor-hour", reportHandler.GetSalesPerLaborHour)
+	mux.HandleFunc("POST /reports/target-attainment", reportHandler.GetTargetAttainment)
+	mux.HandleFunc("GET /reports/sales-trend", reportHandler.GetSalesTrend)
+	mux.HandleFunc("GET /reports/refund-trend", reportHandler.GetRefundTrend)
+	mux.HandleFunc("GET /reports/low-margin", reportHandler.GetLowMarginItems)
+	mux.HandleFunc("GET /reports/staffing-recommendation", reportHandler.GetStaffingRecommendation)
+	mux.HandleFunc("GET /reports/anomalies", reportHandler.GetSalesAnomalies)
+	mux.HandleFunc("GET /reports/profitable-hours", reportHandler.GetProfitableHours)
+	mux.HandleFunc("GET /reports/menu-contribution", reportHandler.GetMenuContribution)
+	mux.HandleFunc("GET /reports/order-size-distribution", reportHandler.GetOrderSizeDistribution)
+	mux.HandleFunc("GET /reports/customers/{id}/spending", reportHandler.GetCustomerSpending)
 
 	// Inventory routes
 	mux.HandleFunc("POST /inventory", inventoryHanlder.CreateIngredient)
+	mux.HandleFunc("POST /inventory/import", inventoryHanlder.ImportIngredients)
 	mux.HandleFunc("GET /inventory/{id}", inventoryHanlder.GetIngredient)
 	mux.HandleFunc("PUT /inventory/{id}", inventoryHanlder.UpdateIngredient)
+	mux.HandleFunc("PATCH /inventory/{id}", inventoryHanlder.PatchIngredient)
 	mux.HandleFunc("DELETE /inventory/{id}", inventoryHanlder.DeleteIngredient)
 	mux.HandleFunc("GET /inventory", inventoryHanlder.ListIngredients)
 	mux.HandleFunc("GET /inventory/getLeftOvers", inventoryHanlder.GetLeftOversWithPagination)
+	mux.HandleFunc("GET /inventory/shopping-list", inventoryHanlder.GetShoppingList)
+	mux.HandleFunc("GET /inventory/transactions/export", inventoryHanlder.ExportTransactions)
+	mux.HandleFunc("GET /inventory/unused", inventoryHanlder.GetUnusedIngredients)
+	mux.HandleFunc("GET /inventory/alerts", inventoryHanlder.GetLowStockAlerts)
+	mux.HandleFunc("GET /inventory/reorder-priority", inventoryHanlder.GetReorderPriority)
+	mux.HandleFunc("GET /inventory/reorder-requests", inventoryHanlder.GetReorderRequests)
+	mux.HandleFunc("GET /inventory/coverage", inventoryHanlder.GetStockCoverage)
+	mux.HandleFunc("GET /inventory/expiry-risk", inventoryHanlder.GetExpiryRisk)
+	mux.HandleFunc("POST /inventory/{id}/restock", inventoryHanlder.RestockIngredient)
+	mux.HandleFunc("GET /inventory/{id}/revenue-at-risk", inventoryHanlder.GetRevenueAtRisk)
 
 	// Menu routes
 	mux.HandleFunc("POST /menu", menuHandler.CreateMenuItem)
@@ -153,12 +327,36 @@ func NewRouter(
 	mux.HandleFunc("PUT /menu/{id}", menuHandler.UpdateMenuItem)
 	mux.HandleFunc("DELETE /menu/{id}", menuHandler.DeleteMenuItem)
 	mux.HandleFunc("GET /menu", menuHandler.ListMenuItems)
+	mux.HandleFunc("GET /menu/unavailable", menuHandler.GetUnavailableMenuItems)
+	mux.HandleFunc("GET /menu/tree", menuHandler.GetMenuTree)
+	mux.HandleFunc("POST /menu/ingredients/bulk-assign", menuHandler.BulkAssignIngredient)
+	mux.HandleFunc("GET /menu/{id}/ingredient-tree", menuHandler.GetIngredientTree)
+	mux.HandleFunc("POST /menu/{id}/price-whatif", menuHandler.PreviewPriceChange)
+	mux.HandleFunc("GET /menu/{id}/break-even", menuHandler.GetBreakEven)
+	mux.HandleFunc("GET /menu/{id}/removal-impact", menuHandler.GetRemovalImpact)
+	mux.HandleFunc("GET /menu/{id}/modifier-groups", menuHandler.GetModifierGroups)
+	mux.HandleFunc("GET /menu/{id}/price-history", menuHandler.GetPriceHistory)
+	mux.HandleFunc("POST /menu/{id}/modifier-groups", menuHandler.CreateModifierGroup)
+	mux.HandleFunc("PUT /menu/{id}/modifier-groups/{groupID}", menuHandler.UpdateModifierGroup)
+	mux.HandleFunc("DELETE /menu/{id}/modifier-groups/{groupID}", menuHandler.DeleteModifierGroup)
 
-	// Health check
-	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+	// Customer routes
+	mux.HandleFunc("GET /customers/{id}/frequency", customerHandler.GetVisitFrequency)
+	mux.HandleFunc("GET /customers/{id}/recommendations", customerHandler.GetRecommendations)
+
+	// Admin routes
+	mux.HandleFunc("POST /admin/menu/cache/warm", menuHandler.WarmMenuCache)
+	mux.HandleFunc("POST /admin/menu/normalize-categories", menuHandler.NormalizeCategories)
+	mux.HandleFunc("GET /admin/menu/no-recipe", menuHandler.GetMenuItemsWithoutRecipe)
+	mux.HandleFunc("GET /admin/orders/price-audit", reportHandler.GetPriceAudit)
+	mux.HandleFunc("GET /admin/orders/total-mismatches", reportHandler.GetTotalMismatches)
+
+	// API metadata
+	mux.HandleFunc("GET /api/versions", apiHandler.GetVersions)
+
+	// Health checks
+	mux.HandleFunc("GET /health", healthHandler.Health)
+	mux.HandleFunc("GET /livez", healthHandler.Livez)
 
 	return handler
 }
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestResolvePort(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "8080", false},
+		{"9090", "9090", false},
+		{"1", "1", false},
+		{"65535", "65535", false},
+		{"0", "", true},
+		{"65536", "", true},
+		{"-80", "", true},
+		{"http", "", true},
+		{":8080", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolvePort(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolvePort(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolvePort(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
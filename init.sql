@@ -31,31 +31,49 @@ CREATE TYPE transaction_type AS ENUM (
     'order_usage',
     'order_deletion',
     'adjustment',
-    'order_update'
+    'order_update',
+    'restock',
+    'order_cancellation'
 );
 
 -- ========================
 -- 2. Create Core Tables
 -- ========================
+-- Cafe locations; menus, inventory and orders belong to one of them
+CREATE TABLE locations (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
 CREATE TABLE menu_items (
     id SERIAL PRIMARY KEY,
+    location_id INTEGER NOT NULL DEFAULT 1 REFERENCES locations(id),
     name TEXT NOT NULL,
     description TEXT,
     price DECIMAL(10,2) NOT NULL CHECK (price > 0),
     category TEXT[],
     is_active BOOLEAN DEFAULT TRUE,
+    prep_time_minutes DECIMAL(5,2) CHECK (prep_time_minutes >= 0), -- NULL falls back to the configured default
+    season_start DATE, -- Seasonal items are only active between season_start and season_end
+    season_end DATE,
+    stock_tracked BOOLEAN NOT NULL DEFAULT FALSE, -- Pre-packaged goods: stock_quantity is decremented instead of ingredients
+    stock_quantity INTEGER NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
     created_at TIMESTAMPTZ DEFAULT NOW(),
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
 CREATE TABLE inventory (
     id SERIAL PRIMARY KEY,
+    location_id INTEGER NOT NULL DEFAULT 1 REFERENCES locations(id),
     name TEXT NOT NULL,
     quantity DECIMAL(10,3) NOT NULL,
     unit unit_type NOT NULL,
     cost_per_unit DECIMAL(10,2),
     reorder_level DECIMAL(10,3),
     supplier_info JSONB,
+    unlimited BOOLEAN NOT NULL DEFAULT FALSE, -- e.g. tap water, never blocks or deducts on orders
     created_at TIMESTAMPTZ DEFAULT NOW(),
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
@@ -68,6 +86,7 @@ CREATE TABLE customers (
     email TEXT UNIQUE,
     loyalty_points INTEGER DEFAULT 0,
     preferences JSONB, -- e.g., {"favorite_drink": "latte", "milk_preference": "oat"}
+    is_active BOOLEAN NOT NULL DEFAULT TRUE, -- FALSE once deactivated or soft-deleted; no new orders are accepted
     created_at TIMESTAMPTZ DEFAULT NOW()
 );
 
@@ -78,24 +97,57 @@ CREATE TABLE menu_item_ingredients (
     PRIMARY KEY (menu_item_id, ingredient_id)
 );
 
+-- Structured customization options of a menu item, e.g. Size: S/M/L. An order item selects a
+-- modifier by setting the group name to the modifier name in its customizations.
+CREATE TABLE modifier_groups (
+    id SERIAL PRIMARY KEY,
+    menu_item_id INTEGER NOT NULL REFERENCES menu_items(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (menu_item_id, name)
+);
+
+CREATE TABLE modifiers (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES modifier_groups(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    price_delta DECIMAL(10,2) NOT NULL DEFAULT 0, -- Added to the menu item price when selected
+    UNIQUE (group_id, name)
+);
+
 CREATE TABLE orders (
     id SERIAL PRIMARY KEY,
+    location_id INTEGER NOT NULL DEFAULT 1 REFERENCES locations(id),
     customer_id INTEGER REFERENCES customers(id) ON DELETE SET NULL,
     status order_status NOT NULL DEFAULT 'pending',
     payment_method payment_method,
     total_price DECIMAL(10,2) NOT NULL CHECK (total_price >= 0),
+    discount_amount DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (discount_amount >= 0), -- already taken off total_price
     special_instructions JSONB,
+    location_code TEXT,
+    order_code TEXT UNIQUE, -- e.g. NYC-20240615-0042
+    inventory_deducted BOOLEAN NOT NULL DEFAULT TRUE, -- FALSE until preparing when deduction is deferred
     created_at TIMESTAMPTZ DEFAULT NOW(),
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Per-location daily counters behind order codes
+CREATE TABLE order_code_sequences (
+    location_code TEXT NOT NULL,
+    day DATE NOT NULL,
+    last_value INTEGER NOT NULL,
+    PRIMARY KEY (location_code, day)
+);
+
 CREATE TABLE order_items (
     id SERIAL PRIMARY KEY,
     order_id INTEGER REFERENCES orders(id) ON DELETE CASCADE,
     menu_item_id INTEGER REFERENCES menu_items(id),
     quantity INTEGER NOT NULL CHECK (quantity > 0),
     customizations JSONB,
-    price_at_order DECIMAL(10,2) NOT NULL CHECK (price_at_order >= 0)
+    price_at_order DECIMAL(10,2) NOT NULL CHECK (price_at_order >= 0),
+    modifier_delta DECIMAL(10,2) NOT NULL DEFAULT 0 -- part of price_at_order added by modifiers
 );
 
 
@@ -110,6 +162,13 @@ CREATE TABLE order_status_history (
     changed_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Idempotency-Key headers of POST /orders, so a retried request returns the order it created
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
 CREATE TABLE price_history (
     id SERIAL PRIMARY KEY,
     menu_item_id INTEGER REFERENCES menu_items(id) ON DELETE CASCADE,
@@ -118,6 +177,14 @@ CREATE TABLE price_history (
     changed_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+CREATE TABLE ingredient_cost_history (
+    id SERIAL PRIMARY KEY,
+    ingredient_id INTEGER REFERENCES inventory(id) ON DELETE CASCADE,
+    old_cost DECIMAL(10,2),
+    new_cost DECIMAL(10,2),
+    changed_at TIMESTAMPTZ DEFAULT NOW()
+);
+
 CREATE TABLE inventory_transactions (
     id SERIAL PRIMARY KEY,
     ingredient_id INTEGER REFERENCES inventory(id) ON DELETE CASCADE,
@@ -128,12 +195,46 @@ CREATE TABLE inventory_transactions (
     created_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Restocks with an expiry date; the newest lots are assumed to make up the stock on hand
+CREATE TABLE inventory_lots (
+    id SERIAL PRIMARY KEY,
+    ingredient_id INTEGER NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    quantity DECIMAL(10,3) NOT NULL CHECK (quantity > 0),
+    expires_on DATE NOT NULL,
+    received_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE refunds (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER REFERENCES orders(id) ON DELETE CASCADE,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    reason TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Purchase requests raised when an order takes an ingredient below its reorder level
+CREATE TABLE reorder_requests (
+    id SERIAL PRIMARY KEY,
+    ingredient_id INTEGER NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+    quantity DECIMAL(10,3) NOT NULL, -- Stock when the request was raised
+    reorder_level DECIMAL(10,3) NOT NULL,
+    order_id INTEGER REFERENCES orders(id) ON DELETE SET NULL, -- Order that took the stock below the level
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'fulfilled')),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    fulfilled_at TIMESTAMPTZ
+);
+
 -- ========================
 -- 4. Create Indexes
 -- ========================
 -- For performance on frequently queried columns
 CREATE INDEX idx_orders_status ON orders(status);
 CREATE INDEX idx_orders_created_at ON orders(created_at);
+CREATE INDEX idx_orders_location ON orders(location_id);
+CREATE INDEX idx_refunds_created_at ON refunds(created_at);
+CREATE INDEX idx_inventory_lots_ingredient ON inventory_lots(ingredient_id);
+-- At most one open reorder request per ingredient
+CREATE UNIQUE INDEX idx_reorder_requests_open ON reorder_requests(ingredient_id) WHERE status = 'open';
 CREATE INDEX idx_menu_items_category ON menu_items USING GIN(category);
 
 -- For full-text search
@@ -175,10 +276,29 @@ CREATE TRIGGER trg_log_price_change
 AFTER UPDATE OF price ON menu_items
 FOR EACH ROW EXECUTE FUNCTION log_price_change();
 
+-- Track ingredient cost changes
+CREATE OR REPLACE FUNCTION log_cost_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.cost_per_unit IS DISTINCT FROM OLD.cost_per_unit THEN
+        INSERT INTO ingredient_cost_history (ingredient_id, old_cost, new_cost)
+        VALUES (OLD.id, OLD.cost_per_unit, NEW.cost_per_unit);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_log_cost_change
+AFTER UPDATE OF cost_per_unit ON inventory
+FOR EACH ROW EXECUTE FUNCTION log_cost_change();
+
 -- ========================
 -- 6. Insert Sample Data
 -- ========================
 
+-- The default location every row belongs to unless scoped otherwise
+INSERT INTO locations (code, name) VALUES
+('MAIN', 'Main Street');
+
 -- Insert 20 inventory items
 INSERT INTO inventory (name, quantity, unit, cost_per_unit, reorder_level, supplier_info) VALUES
 ('Espresso Beans', 5000, 'g', 0.02, 1000, '{"supplier": "Bean Co", "contact": "555-1001"}'),
@@ -203,17 +323,17 @@ INSERT INTO inventory (name, quantity, unit, cost_per_unit, reorder_level, suppl
 ('Biscotti', 200, 'items', 0.25, 50, '{"supplier": "Bakery Co", "contact": "555-10001"}');
 
 -- Insert 10 menu items with different categories
-INSERT INTO menu_items (name, description, price, category, is_active) VALUES
-('Espresso', 'Strong black coffee made from premium beans', 2.50, ARRAY['coffee', 'hot'], true),
-('Double Espresso', 'Twice the coffee, twice the energy', 3.50, ARRAY['coffee', 'hot'], true),
-('Americano', 'Espresso with hot water', 3.00, ARRAY['coffee', 'hot'], true),
-('Latte', 'Espresso with steamed milk', 3.75, ARRAY['coffee', 'hot', 'milk'], true),
-('Cappuccino', 'Espresso with equal parts steamed milk and foam', 4.00, ARRAY['coffee', 'hot', 'milk'], true),
-('Iced Coffee', 'Cold brewed coffee served over ice', 3.50, ARRAY['coffee', 'cold'], true),
-('Iced Latte', 'Espresso with cold milk over ice', 4.25, ARRAY['coffee', 'cold', 'milk'], true),
-('Hot Chocolate', 'Rich chocolate drink with steamed milk', 3.75, ARRAY['hot', 'chocolate'], true),
-('Chocolate Cake', 'Rich chocolate dessert with layers of ganache', 5.50, ARRAY['food', 'dessert'], true),
-('Blueberry Muffin', 'Fresh muffin with blueberries', 3.25, ARRAY['food', 'bakery'], false);  -- One inactive item for testing
+INSERT INTO menu_items (name, description, price, category, is_active, prep_time_minutes) VALUES
+('Espresso', 'Strong black coffee made from premium beans', 2.50, ARRAY['coffee', 'hot'], true, 2),
+('Double Espresso', 'Twice the coffee, twice the energy', 3.50, ARRAY['coffee', 'hot'], true, 2.5),
+('Americano', 'Espresso with hot water', 3.00, ARRAY['coffee', 'hot'], true, 3),
+('Latte', 'Espresso with steamed milk', 3.75, ARRAY['coffee', 'hot', 'milk'], true, 4),
+('Cappuccino', 'Espresso with equal parts steamed milk and foam', 4.00, ARRAY['coffee', 'hot', 'milk'], true, 4),
+('Iced Coffee', 'Cold brewed coffee served over ice', 3.50, ARRAY['coffee', 'cold'], true, 3),
+('Iced Latte', 'Espresso with cold milk over ice', 4.25, ARRAY['coffee', 'cold', 'milk'], true, 4),
+('Hot Chocolate', 'Rich chocolate drink with steamed milk', 3.75, ARRAY['hot', 'chocolate'], true, 4),
+('Chocolate Cake', 'Rich chocolate dessert with layers of ganache', 5.50, ARRAY['food', 'dessert'], true, 1),
+('Blueberry Muffin', 'Fresh muffin with blueberries', 3.25, ARRAY['food', 'bakery'], false, 1);  -- One inactive item for testing
 
 -- Insert menu item ingredients
 INSERT INTO menu_item_ingredients VALUES
@@ -423,6 +543,13 @@ INSERT INTO price_history (menu_item_id, old_price, new_price, changed_at) VALUE
 -- Cappuccino price changes
 (5, 3.75, 4.00, NOW() - INTERVAL '2 months');
 
+-- Insert ingredient cost history (supplier price changes)
+INSERT INTO ingredient_cost_history (ingredient_id, old_cost, new_cost, changed_at) VALUES
+(1, 0.01, 0.02, NOW() - INTERVAL '4 months'),
+(4, 0.01, 0.02, NOW() - INTERVAL '2 months'),
+(4, 0.02, 0.01, NOW() - INTERVAL '3 weeks'),
+(9, 0.02, 0.03, NOW() - INTERVAL '1 month');
+
 -- Insert inventory transactions (stock movements)
 INSERT INTO inventory_transactions (ingredient_id, delta, transaction_type, reference_id, notes) VALUES
 -- Order usage
@@ -433,8 +560,8 @@ INSERT INTO inventory_transactions (ingredient_id, delta, transaction_type, refe
 (1, -7, 'order_usage', 2, 'Order #2 - 1 double espresso'),
 (4, -400, 'order_usage', 2, 'Order #2 - 2 lattes'),
 -- Adjustments
-(4, 5000, 'adjustment', NULL, 'Milk delivery'),
-(1, 2000, 'adjustment', NULL, 'Beans delivery'),
+(4, 5000, 'restock', NULL, 'Milk delivery'),
+(1, 2000, 'restock', NULL, 'Beans delivery'),
 -- Order deletion (cancelled order)
 (1, 14, 'order_deletion', 23, 'Order #23 cancelled'),
 (4, 400, 'order_deletion', 23, 'Order #23 cancelled'),
@@ -445,6 +572,24 @@ INSERT INTO inventory_transactions (ingredient_id, delta, transaction_type, refe
 (7, -30, 'order_usage', 9, 'Order #9 - 1 chocolate cake'),
 (4, -50, 'order_usage', 9, 'Order #9 - 1 chocolate cake');
 
+-- Earlier restocks from suppliers
+INSERT INTO inventory_transactions (ingredient_id, delta, transaction_type, reference_id, notes, created_at) VALUES
+(1, 2000, 'restock', NULL, 'Beans delivery', NOW() - INTERVAL '2 months'),
+(1, 2500, 'restock', NULL, 'Beans delivery', NOW() - INTERVAL '1 month'),
+(3, 1500, 'restock', NULL, 'Beans delivery', NOW() - INTERVAL '3 weeks'),
+(4, 5000, 'restock', NULL, 'Milk delivery', NOW() - INTERVAL '2 weeks'),
+(4, 4000, 'restock', NULL, 'Milk delivery', NOW() - INTERVAL '1 week'),
+(13, 1000, 'restock', NULL, 'Whipped cream delivery', NOW() - INTERVAL '1 week'),
+(15, 500, 'restock', NULL, 'Cups delivery', NOW() - INTERVAL '10 days');
+
+-- Insert refunds on delivered orders
+INSERT INTO refunds (order_id, amount, reason, created_at) VALUES
+(2, 3.50, 'Wrong milk', NOW() - INTERVAL '5 months' + INTERVAL '3 days'),
+(6, 12.25, 'Order arrived cold', NOW() - INTERVAL '3 months' + INTERVAL '4 days'),
+(10, 2.75, 'Missing caramel drizzle', NOW() - INTERVAL '1 month' + INTERVAL '3 days'),
+(12, 6.75, 'Spilled in delivery', NOW() - INTERVAL '2 weeks'),
+(26, 4.00, 'Cake missing from order', NOW() - INTERVAL '20 hours');
+
 -- ========================
 -- 7. Update Search Vectors
 -- ========================
@@ -0,0 +1,156 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"frappuccino/internal/models"
+)
+
+type CustomerRepository interface {
+	GetOrderDates(ctx context.Context, customerID int) ([]time.Time, error)
+	GetSimilarCustomerItems(ctx context.Context, customerID int, limit int) ([]models.RecommendedItem, error)
+	GetPopularItemsNotOrdered(ctx context.Context, customerID int, limit int) ([]models.RecommendedItem, error)
+}
+
+type customerRepository struct {
+	*Repository
+}
+
+func NewCustomerRepository(db *sql.DB) CustomerRepository {
+	return &customerRepository{NewRepository(db)}
+}
+
+// GetOrderDates returns the creation times of a customer's non-cancelled orders, oldest first
+func (r *customerRepository) GetOrderDates(ctx context.Context, customerID int) ([]time.Time, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM customers WHERE id = $1)`, customerID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check customer: %w", err)
+	}
+	if !exists {
+		return nil, models.ErrCustomerNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT created_at
+        FROM orders
+        WHERE customer_id = $1
+        AND status <> 'cancelled'
+        ORDER BY created_at`, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer orders: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	for rows.Next() {
+		var createdAt time.Time
+		if err := rows.Scan(&createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan order date: %w", err)
+		}
+		dates = append(dates, createdAt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning order dates: %w", err)
+	}
+
+	return dates, nil
+}
+
+// GetSimilarCustomerItems returns active menu items of the location the customer hasn't ordered, scored by the customers
+// who share ordered items with them: each such customer adds the number of items they have in common.
+func (r *customerRepository) GetSimilarCustomerItems(ctx context.Context, customerID int, limit int) ([]models.RecommendedItem, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM customers WHERE id = $1)`, customerID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check customer: %w", err)
+	}
+	if !exists {
+		return nil, models.ErrCustomerNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        WITH ordered AS (
+            SELECT DISTINCT o.customer_id, oi.menu_item_id
+            FROM orders o
+            JOIN order_items oi ON oi.order_id = o.id
+            WHERE o.status <> 'cancelled'
+        ),
+        mine AS (
+            SELECT menu_item_id FROM ordered WHERE customer_id = $1
+        ),
+        similar AS (
+            SELECT customer_id, COUNT(*) AS shared
+            FROM ordered
+            WHERE menu_item_id IN (SELECT menu_item_id FROM mine)
+            AND customer_id <> $1
+            GROUP BY customer_id
+        )
+        SELECT m.id, m.name, m.price, SUM(s.shared)
+        FROM similar s
+        JOIN ordered od ON od.customer_id = s.customer_id
+        JOIN menu_items m ON m.id = od.menu_item_id
+        WHERE m.is_active
+        AND m.location_id = $3
+        AND m.id NOT IN (SELECT menu_item_id FROM mine)
+        GROUP BY m.id, m.name, m.price
+        ORDER BY SUM(s.shared) DESC, m.id
+        LIMIT $2`, customerID, limit, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get similar customer items: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRecommendedItems(rows)
+}
+
+// GetPopularItemsNotOrdered returns active menu items of the location the customer hasn't ordered,
+// scored by how many customers ordered them
+func (r *customerRepository) GetPopularItemsNotOrdered(ctx context.Context, customerID int, limit int) ([]models.RecommendedItem, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT m.id, m.name, m.price, COUNT(DISTINCT o.customer_id)
+        FROM menu_items m
+        JOIN order_items oi ON oi.menu_item_id = m.id
+        JOIN orders o ON o.id = oi.order_id
+        WHERE m.is_active
+        AND m.location_id = $3
+        AND o.status <> 'cancelled'
+        AND m.id NOT IN (
+            SELECT oi2.menu_item_id
+            FROM order_items oi2
+            JOIN orders o2 ON o2.id = oi2.order_id
+            WHERE o2.customer_id = $1 AND o2.status <> 'cancelled'
+        )
+        GROUP BY m.id, m.name, m.price
+        ORDER BY COUNT(DISTINCT o.customer_id) DESC, m.id
+        LIMIT $2`, customerID, limit, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get popular items: %w", err)
+	}
+	defer rows.Close()
+
+	return scanRecommendedItems(rows)
+}
+
+func scanRecommendedItems(rows *sql.Rows) ([]models.RecommendedItem, error) {
+	var items []models.RecommendedItem
+	for rows.Next() {
+		var item models.RecommendedItem
+		if err := rows.Scan(&item.MenuItemID, &item.Name, &item.Price, &item.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan recommended item: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning recommended items: %w", err)
+	}
+
+	return items, nil
+}
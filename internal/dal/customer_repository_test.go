@@ -0,0 +1,85 @@
+package dal
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"frappuccino/internal/models"
+)
+
+func TestRecommendationsExcludeOrderedItems(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewCustomerRepository(db)
+	location := createTestLocation(t, db, "RECS")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	latte := createTestMenuItem(t, db, location, "test recs latte", 4, nil)
+	mocha := createTestMenuItem(t, db, location, "test recs mocha", 5, nil)
+	tea := createTestMenuItem(t, db, location, "test recs tea", 2, nil)
+	muffin := createTestMenuItem(t, db, location, "test recs muffin", 3, nil)
+	scone := createTestMenuItem(t, db, location, "test recs scone", 3, nil)
+
+	order := func(customerID int, menuItemIDs ...int) {
+		t.Helper()
+		id := createTestOrder(t, db, location, time.Now(), 0)
+		if _, err := db.Exec(`UPDATE orders SET customer_id = $2 WHERE id = $1`, id, customerID); err != nil {
+			t.Fatalf("failed to set customer of order %d: %v", id, err)
+		}
+		for _, menuItemID := range menuItemIDs {
+			createTestOrderItem(t, db, id, menuItemID, 1, 4)
+		}
+	}
+	ana := createTestCustomer(t, db, "Ana")
+	order(ana, latte)
+	// Ben and Cal share the latte with Ana, Dee shares nothing
+	ben := createTestCustomer(t, db, "Ben")
+	order(ben, latte, mocha, muffin)
+	cal := createTestCustomer(t, db, "Cal")
+	order(cal, latte)
+	order(cal, mocha)
+	dee := createTestCustomer(t, db, "Dee")
+	order(dee, tea, scone)
+	eve := createTestCustomer(t, db, "Eve")
+
+	ids := func(items []models.RecommendedItem) []int {
+		ids := make([]int, len(items))
+		for i, item := range items {
+			ids[i] = item.MenuItemID
+		}
+		return ids
+	}
+
+	similar, err := repo.GetSimilarCustomerItems(ctx, ana, 10)
+	if err != nil {
+		t.Fatalf("GetSimilarCustomerItems: %v", err)
+	}
+	if want := []int{mocha, muffin}; !reflect.DeepEqual(ids(similar), want) || similar[0].Score != 2 {
+		t.Errorf("similar customer items = %+v, want the mocha of Ben and Cal, then Ben's muffin", similar)
+	}
+
+	// Eve hasn't ordered, so nobody is similar and every item is new to her
+	if similar, err := repo.GetSimilarCustomerItems(ctx, eve, 10); err != nil || len(similar) != 0 {
+		t.Errorf("similar customer items of a new customer = %+v, %v, want none", similar, err)
+	}
+	popular, err := repo.GetPopularItemsNotOrdered(ctx, eve, 3)
+	if err != nil {
+		t.Fatalf("GetPopularItemsNotOrdered: %v", err)
+	}
+	if want := []int{latte, mocha, tea}; !reflect.DeepEqual(ids(popular), want) || popular[0].Score != 3 {
+		t.Errorf("popular items = %+v, want the latte of three customers, then mocha and tea", popular)
+	}
+
+	popular, err = repo.GetPopularItemsNotOrdered(ctx, ana, 10)
+	if err != nil {
+		t.Fatalf("GetPopularItemsNotOrdered: %v", err)
+	}
+	if want := []int{mocha, tea, muffin, scone}; !reflect.DeepEqual(ids(popular), want) {
+		t.Errorf("popular items not ordered by Ana = %+v, want all but her latte", popular)
+	}
+
+	if _, err := repo.GetSimilarCustomerItems(ctx, -1, 10); err != models.ErrCustomerNotFound {
+		t.Errorf("GetSimilarCustomerItems of an unknown customer error = %v, want ErrCustomerNotFound", err)
+	}
+}
@@ -0,0 +1,186 @@
+package dal
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"frappuccino/internal/models"
+)
+
+// openTestDB connects to the database named by TEST_DATABASE_URL, which must have been created
+// with init.sql, and skips the test when it is not set. Tests create their own rows and delete
+// them when they finish.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestLocation inserts a location with a code unique to the test run. Its orders and order
+// code sequences are deleted with it.
+func createTestLocation(t *testing.T, db *sql.DB, code string) int {
+	t.Helper()
+	code = fmt.Sprintf("%s%d", code, time.Now().UnixNano()%1e6)
+	var id int
+	err := db.QueryRow(`
+        INSERT INTO locations (code, name) VALUES ($1, $1)
+        RETURNING id`, code).Scan(&id)
+	if err != nil {
+		t.Fatalf("failed to create location %s: %v", code, err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM orders WHERE location_id = $1`, id)
+		db.Exec(`DELETE FROM order_code_sequences WHERE location_code = $1`, code)
+		db.Exec(`DELETE FROM locations WHERE id = $1`, id)
+	})
+	return id
+}
+
+// createTestOrder inserts a delivered order without items placed at createdAt
+func createTestOrder(t *testing.T, db *sql.DB, locationID int, createdAt time.Time, total models.Money) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(`
+        INSERT INTO orders (location_id, status, total_price, created_at, updated_at)
+        VALUES ($1, 'delivered', $2, $3, $3)
+        RETURNING id`, locationID, total, createdAt).Scan(&id)
+	if err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+	return id
+}
+
+// setTestOrderStatus moves an order to status, keeping its updated_at
+func setTestOrderStatus(t *testing.T, db *sql.DB, orderID int, status string) {
+	t.Helper()
+	if _, err := db.Exec(`UPDATE orders SET status = $2 WHERE id = $1`, orderID, status); err != nil {
+		t.Fatalf("failed to set status of order %d: %v", orderID, err)
+	}
+}
+
+// createTestRefund records a refund of amount for an order at createdAt
+func createTestRefund(t *testing.T, db *sql.DB, orderID int, amount models.Money, createdAt time.Time) {
+	t.Helper()
+	if _, err := db.Exec(`
+        INSERT INTO refunds (order_id, amount, created_at) VALUES ($1, $2, $3)`, orderID, amount, createdAt); err != nil {
+		t.Fatalf("failed to refund order %d: %v", orderID, err)
+	}
+}
+
+// createTestOrderItem adds quantity of a menu item at price to an order
+func createTestOrderItem(t *testing.T, db *sql.DB, orderID, menuItemID, quantity int, price models.Money) {
+	t.Helper()
+	if _, err := db.Exec(`
+        INSERT INTO order_items (order_id, menu_item_id, quantity, price_at_order)
+        VALUES ($1, $2, $3, $4)`, orderID, menuItemID, quantity, price); err != nil {
+		t.Fatalf("failed to add menu item %d to order %d: %v", menuItemID, orderID, err)
+	}
+}
+
+// createTestIngredient inserts an ingredient at the location
+func createTestIngredient(t *testing.T, db *sql.DB, locationID int, name string, quantity float64, unlimited bool) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(`
+        INSERT INTO inventory (location_id, name, quantity, unit, cost_per_unit, reorder_level, unlimited)
+        VALUES ($1, $2, $3, 'ml', 0.01, 0, $4)
+        RETURNING id`, locationID, name, quantity, unlimited).Scan(&id)
+	if err != nil {
+		t.Fatalf("failed to create ingredient %s: %v", name, err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM inventory WHERE id = $1`, id) })
+	return id
+}
+
+// createTestMenuItem inserts an active menu item at the location made of recipe, ingredient ID to
+// quantity per unit. Orders of the item are deleted with it.
+func createTestMenuItem(t *testing.T, db *sql.DB, locationID int, name string, price models.Money, recipe map[int]float64) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(`
+        INSERT INTO menu_items (location_id, name, price, category, is_active)
+        VALUES ($1, $2, $3, '{test}', TRUE)
+        RETURNING id`, locationID, name, price).Scan(&id)
+	if err != nil {
+		t.Fatalf("failed to create menu item %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM orders WHERE id IN (SELECT order_id FROM order_items WHERE menu_item_id = $1)`, id)
+		db.Exec(`DELETE FROM menu_items WHERE id = $1`, id)
+	})
+
+	for ingredientID, quantity := range recipe {
+		if _, err := db.Exec(`
+            INSERT INTO menu_item_ingredients (menu_item_id, ingredient_id, quantity)
+            VALUES ($1, $2, $3)`, id, ingredientID, quantity); err != nil {
+			t.Fatalf("failed to add ingredient %d to %s: %v", ingredientID, name, err)
+		}
+	}
+	return id
+}
+
+// createTestTransaction records an inventory transaction of an ingredient at createdAt
+func createTestTransaction(t *testing.T, db *sql.DB, ingredientID int, delta float64, transactionType string, createdAt time.Time) {
+	t.Helper()
+	if _, err := db.Exec(`
+        INSERT INTO inventory_transactions (ingredient_id, delta, transaction_type, created_at)
+        VALUES ($1, $2, $3, $4)`, ingredientID, delta, transactionType, createdAt); err != nil {
+		t.Fatalf("failed to record %s of ingredient %d: %v", transactionType, ingredientID, err)
+	}
+}
+
+// setTestSupplier sets the supplier in the supplier_info of an ingredient
+func setTestSupplier(t *testing.T, db *sql.DB, ingredientID int, supplier string) {
+	t.Helper()
+	if _, err := db.Exec(`
+        UPDATE inventory SET supplier_info = jsonb_build_object('supplier', $2::text)
+        WHERE id = $1`, ingredientID, supplier); err != nil {
+		t.Fatalf("failed to set supplier of ingredient %d: %v", ingredientID, err)
+	}
+}
+
+// createTestCustomer inserts an active customer. Their orders are deleted with them.
+func createTestCustomer(t *testing.T, db *sql.DB, firstName string) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(`
+        INSERT INTO customers (first_name, last_name) VALUES ($1, 'Test')
+        RETURNING id`, firstName).Scan(&id)
+	if err != nil {
+		t.Fatalf("failed to create customer %s: %v", firstName, err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM orders WHERE customer_id = $1`, id)
+		db.Exec(`DELETE FROM customers WHERE id = $1`, id)
+	})
+	return id
+}
+
+// ingredientQuantity returns the stock of an ingredient
+func ingredientQuantity(t *testing.T, db *sql.DB, id int) float64 {
+	t.Helper()
+	var quantity float64
+	if err := db.QueryRow(`SELECT quantity FROM inventory WHERE id = $1`, id).Scan(&quantity); err != nil {
+		t.Fatalf("failed to get quantity of ingredient %d: %v", id, err)
+	}
+	return quantity
+}
+
+// newTestOrderRepository returns an order repository deducting inventory when orders are created
+func newTestOrderRepository(db *sql.DB) *orderRepository {
+	return NewOrderRepository(db, DefaultUsageRounding, DeductOnCreate, false).(*orderRepository)
+}
@@ -0,0 +1,21 @@
+package dal
+
+import "fmt"
+
+// Points at which an order's ingredients are deducted from inventory
+const (
+	DeductOnCreate  = "create"
+	DeductOnPrepare = "prepare"
+)
+
+// ParseDeductionTrigger validates when orders deduct inventory; an empty value means on create
+func ParseDeductionTrigger(value string) (string, error) {
+	switch value {
+	case "":
+		return DeductOnCreate, nil
+	case DeductOnCreate, DeductOnPrepare:
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid inventory deduction trigger %q, must be create or prepare", value)
+	}
+}
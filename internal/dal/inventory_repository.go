@@ -5,8 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"frappuccino/internal/models"
+
+	"github.com/lib/pq"
 )
 
 type InventoryRepository interface {
@@ -14,8 +18,20 @@ type InventoryRepository interface {
 	GetAllIngredients(ctx context.Context) ([]models.Inventory, error)
 	GetIngredientByID(ctx context.Context, id int) (models.Inventory, error)
 	UpdateIngredient(ctx context.Context, id int, ingredient models.Inventory) error
+	PatchIngredient(ctx context.Context, id int, update models.InventoryUpdateRequest) error
 	DeleteIngredient(ctx context.Context, id int) error
 	GetLeftOversWithPagination(ctx context.Context, sortBy string, page int, pageSize int) (models.PaginatedInventoryResponse, error)
+	GetShoppingList(ctx context.Context, forecastDays int, lookbackDays int) ([]models.ShoppingListItem, error)
+	GetRevenueAtRisk(ctx context.Context, id int, days int) (models.RevenueAtRiskResponse, error)
+	GetUnusedIngredients(ctx context.Context) ([]models.Inventory, error)
+	RestockIngredient(ctx context.Context, id int, quantity float64, notes string, expiresOn *time.Time) (float64, error)
+	GetLowStockItems(ctx context.Context, usageDays int) ([]models.InventoryAlert, error)
+	GetReorderCandidates(ctx context.Context, usageDays int, defaultLeadTimeDays float64) ([]models.ReorderPriority, error)
+	GetStockCoverage(ctx context.Context, usageDays int) ([]models.StockCoverage, error)
+	GetInventoryLots(ctx context.Context, usageDays int) ([]models.ExpiringLot, error)
+	StreamTransactions(ctx context.Context, startDate, endDate time.Time, fn func(models.InventoryTransaction) error) error
+	ImportIngredients(ctx context.Context, rows []models.InventoryImportRow) (created, updated int, failures []models.InventoryImportFailure, err error)
+	GetReorderRequests(ctx context.Context, status string) ([]models.ReorderRequest, error)
 }
 
 type inventoryRepository struct {
@@ -33,13 +49,14 @@ func (r *inventoryRepository) CreateIngredient(ctx context.Context, ingredient m
 		supplier_info = ingredient.SupplierInfo
 	}
 	err := r.db.QueryRowContext(ctx, `
-		INSERT INTO inventory (name, quantity, unit, cost_per_unit, reorder_level, supplier_info) 
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO inventory (name, quantity, unit, cost_per_unit, reorder_level, supplier_info, unlimited, location_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id`,
-		ingredient.Name, ingredient.Quantity, ingredient.Unit, ingredient.CostPerUnit, ingredient.ReOrderLevel, supplier_info,
+		ingredient.Name, ingredient.Quantity, ingredient.Unit, ingredient.CostPerUnit, ingredient.ReOrderLevel, supplier_info, ingredient.Unlimited,
+		models.LocationIDFromContext(ctx),
 	).Scan(&id)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("failed to insert ingredient: %w", err)
 	}
 
 	return id, nil
@@ -47,17 +64,19 @@ func (r *inventoryRepository) CreateIngredient(ctx context.Context, ingredient m
 
 func (r *inventoryRepository) GetAllIngredients(ctx context.Context) ([]models.Inventory, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT 
-			id,
+        SELECT 
+            id,
             name,
             quantity,
             unit,
-			cost_per_unit,
+            cost_per_unit,
             reorder_level,
             supplier_info,
+            unlimited,
             created_at, 
             updated_at
-		FROM inventory`)
+        FROM inventory
+        WHERE location_id = $1`, models.LocationIDFromContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query inventory: %w", err)
 	}
@@ -66,12 +85,17 @@ func (r *inventoryRepository) GetAllIngredients(ctx context.Context) ([]models.I
 	var inventory []models.Inventory
 	for rows.Next() {
 		var ingredient models.Inventory
-		err := rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.Quantity, &ingredient.Unit, &ingredient.CostPerUnit, &ingredient.ReOrderLevel, &ingredient.SupplierInfo, &ingredient.CreatedAt, &ingredient.UpdatedAt)
+		err := rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.Quantity, &ingredient.Unit, &ingredient.CostPerUnit, &ingredient.ReOrderLevel, &ingredient.SupplierInfo, &ingredient.Unlimited, &ingredient.CreatedAt, &ingredient.UpdatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan ingredient: %w", err)
 		}
 		inventory = append(inventory, ingredient)
 	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning inventory: %w", err)
+	}
+
 	return inventory, nil
 }
 
@@ -85,13 +109,14 @@ func (r *inventoryRepository) GetIngredientByID(ctx context.Context, id int) (mo
             name,
             quantity,
             unit,
-			cost_per_unit,
+            cost_per_unit,
             reorder_level,
             supplier_info,
+            unlimited,
             created_at, 
             updated_at
         FROM inventory 
-        WHERE id = $1`, id).Scan(
+        WHERE id = $1 AND location_id = $2`, id, models.LocationIDFromContext(ctx)).Scan(
 		&ingredient.ID,
 		&ingredient.Name,
 		&ingredient.Quantity,
@@ -99,12 +124,13 @@ func (r *inventoryRepository) GetIngredientByID(ctx context.Context, id int) (mo
 		&ingredient.CostPerUnit,
 		&ingredient.ReOrderLevel,
 		&ingredient.SupplierInfo,
+		&ingredient.Unlimited,
 		&ingredient.CreatedAt,
 		&ingredient.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.Inventory{}, fmt.Errorf("ingredient not found: %w", err)
+			return models.Inventory{}, models.ErrIngredientNotFound
 		}
 		return models.Inventory{}, fmt.Errorf("failed to get ingredient: %w", err)
 	}
@@ -135,15 +161,18 @@ func (r *inventoryRepository) UpdateIngredient(ctx context.Context, id int, ingr
             cost_per_unit = $4,
             reorder_level = $5,
 			supplier_info = $6,
+            unlimited = $7,
             updated_at = NOW()
-        WHERE id = $7`,
+        WHERE id = $8 AND location_id = $9`,
 		ingredient.Name,
 		ingredient.Quantity,
 		ingredient.Unit,
 		ingredient.CostPerUnit,
 		ingredient.ReOrderLevel,
 		supplier_info,
+		ingredient.Unlimited,
 		id,
+		models.LocationIDFromContext(ctx),
 	)
 	if err != nil {
 		return err
@@ -166,6 +195,64 @@ func (r *inventoryRepository) UpdateIngredient(ctx context.Context, id int, ingr
 	return nil
 }
 
+// PatchIngredient changes only the columns whose fields are set in update
+func (r *inventoryRepository) PatchIngredient(ctx context.Context, id int, update models.InventoryUpdateRequest) error {
+	var args []interface{}
+	setClauses := []string{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if update.Name != nil {
+		set("name", *update.Name)
+	}
+	if update.Quantity != nil {
+		set("quantity", *update.Quantity)
+	}
+	if update.Unit != nil {
+		set("unit", *update.Unit)
+	}
+	if update.CostPerUnit != nil {
+		set("cost_per_unit", *update.CostPerUnit)
+	}
+	if update.ReOrderLevel != nil {
+		set("reorder_level", *update.ReOrderLevel)
+	}
+	if update.SupplierInfo != nil {
+		set("supplier_info", []byte(*update.SupplierInfo))
+	}
+	if update.Unlimited != nil {
+		set("unlimited", *update.Unlimited)
+	}
+	if len(setClauses) == 0 {
+		return models.ErrEmptyUpdate
+	}
+
+	args = append(args, id, models.LocationIDFromContext(ctx))
+	query := fmt.Sprintf(`
+        UPDATE inventory 
+        SET %s, updated_at = NOW()
+        WHERE id = $%d AND location_id = $%d`,
+		strings.Join(setClauses, ", "), len(args)-1, len(args))
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update ingredient: %w", err)
+	}
+
+	// Verify exactly one row was updated
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 func (r *inventoryRepository) DeleteIngredient(ctx context.Context, id int) error {
 	// Begin transaction
 	tx, err := r.db.BeginTx(ctx, nil)
@@ -177,7 +264,7 @@ func (r *inventoryRepository) DeleteIngredient(ctx context.Context, id int) erro
 	// Delete the ingredient
 	result, err := tx.ExecContext(ctx, `
         DELETE FROM inventory 
-        WHERE id = $1`, id)
+        WHERE id = $1 AND location_id = $2`, id, models.LocationIDFromContext(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to delete ingredient: %w", err)
 	}
@@ -209,12 +296,15 @@ func (r *inventoryRepository) GetLeftOversWithPagination(ctx context.Context, so
 		orderBy = "cost_per_unit DESC"
 	case "quantity":
 		orderBy = "quantity ASC"
+	case "value":
+		orderBy = "total_value DESC"
 	}
 
 	// Get total count of items with positive quantity
 	var totalCount int
+	locationID := models.LocationIDFromContext(ctx)
 	err := r.db.QueryRowContext(ctx,
-		"SELECT COUNT(*) FROM inventory WHERE quantity > 0").Scan(&totalCount)
+		"SELECT COUNT(*) FROM inventory WHERE quantity > 0 AND location_id = $1", locationID).Scan(&totalCount)
 	if err != nil {
 		return models.PaginatedInventoryResponse{}, fmt.Errorf("failed to get total count: %w", err)
 	}
@@ -229,12 +319,13 @@ func (r *inventoryRepository) GetLeftOversWithPagination(ctx context.Context, so
 			name,
 			quantity,
 			unit,
-			cost_per_unit
+			cost_per_unit,
+			quantity * COALESCE(cost_per_unit, 0) AS total_value
 		FROM inventory
-		WHERE quantity > 0
+		WHERE quantity > 0 AND location_id = $3
 		ORDER BY %s
 		LIMIT $1 OFFSET $2`, orderBy),
-		pageSize, offset)
+		pageSize, offset, locationID)
 	if err != nil {
 		return models.PaginatedInventoryResponse{}, fmt.Errorf("failed to query leftovers: %w", err)
 	}
@@ -249,6 +340,7 @@ func (r *inventoryRepository) GetLeftOversWithPagination(ctx context.Context, so
 			&item.Quantity,
 			&item.Unit,
 			&item.CostPerUnit,
+			&item.TotalValue,
 		); err != nil {
 			return models.PaginatedInventoryResponse{}, fmt.Errorf("failed to scan inventory item: %w", err)
 		}
@@ -272,3 +364,693 @@ func (r *inventoryRepository) GetLeftOversWithPagination(ctx context.Context, so
 		HasNext:     page < totalPages,
 	}, nil
 }
+
+func (r *inventoryRepository) GetShoppingList(ctx context.Context, forecastDays int, lookbackDays int) ([]models.ShoppingListItem, error) {
+	// Project usage from the average daily consumption over the lookback window
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT 
+			i.id,
+			i.name,
+			i.unit,
+			i.quantity,
+			COALESCE(NULLIF(i.supplier_info->>'supplier', ''), 'Unknown Supplier') AS supplier,
+			COALESCE(SUM(-t.delta), 0) / $2::int * $1::int AS projected_usage
+		FROM inventory i
+		LEFT JOIN inventory_transactions t 
+			ON t.ingredient_id = i.id
+			AND t.transaction_type = 'order_usage'
+			AND t.created_at >= NOW() - make_interval(days => $2::int)
+		WHERE NOT i.unlimited
+		AND i.location_id = $3
+		GROUP BY i.id, i.name, i.unit, i.quantity, i.supplier_info
+		ORDER BY supplier, i.name`,
+		forecastDays, lookbackDays, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shopping list: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.ShoppingListItem
+	for rows.Next() {
+		var item models.ShoppingListItem
+		if err := rows.Scan(
+			&item.IngredientID,
+			&item.Name,
+			&item.Unit,
+			&item.CurrentStock,
+			&item.Supplier,
+			&item.ProjectedUsage,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan shopping list item: %w", err)
+		}
+
+		// Only ingredients whose projected usage exceeds the stock have to be bought
+		item.QuantityToBuy = item.ProjectedUsage - item.CurrentStock
+		if item.QuantityToBuy <= 0 {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during rows iteration: %w", err)
+	}
+
+	return items, nil
+}
+
+func (r *inventoryRepository) GetRevenueAtRisk(ctx context.Context, id int, days int) (models.RevenueAtRiskResponse, error) {
+	response := models.RevenueAtRiskResponse{
+		PeriodDays: days,
+		MenuItems:  []models.MenuItemRevenue{},
+	}
+
+	var reorderLevel sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT id, name, quantity, reorder_level
+        FROM inventory
+        WHERE id = $1 AND location_id = $2`, id, models.LocationIDFromContext(ctx)).Scan(
+		&response.IngredientID,
+		&response.Name,
+		&response.Quantity,
+		&reorderLevel,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RevenueAtRiskResponse{}, models.ErrIngredientNotFound
+		}
+		return models.RevenueAtRiskResponse{}, fmt.Errorf("failed to get ingredient: %w", err)
+	}
+	response.ReOrderLevel = reorderLevel.Float64
+	response.LowStock = reorderLevel.Valid && response.Quantity <= reorderLevel.Float64
+
+	// Recent revenue of every menu item that needs this ingredient
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            mi.id,
+            mi.name,
+            COALESCE(SUM(oi.quantity), 0) AS quantity_sold,
+            COALESCE(SUM(oi.quantity * oi.price_at_order), 0) AS revenue
+        FROM menu_item_ingredients mii
+        JOIN menu_items mi ON mi.id = mii.menu_item_id
+        LEFT JOIN (
+            order_items oi
+            JOIN orders o ON o.id = oi.order_id
+                AND o.status <> 'cancelled'
+                AND o.created_at >= NOW() - make_interval(days => $2)
+                AND o.location_id = $3
+        ) ON oi.menu_item_id = mi.id
+        WHERE mii.ingredient_id = $1
+        GROUP BY mi.id, mi.name
+        ORDER BY revenue DESC`, id, days, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return models.RevenueAtRiskResponse{}, fmt.Errorf("failed to query dependent menu items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.MenuItemRevenue
+		if err := rows.Scan(&item.MenuItemID, &item.Name, &item.Quantity, &item.Revenue); err != nil {
+			return models.RevenueAtRiskResponse{}, fmt.Errorf("failed to scan menu item revenue: %w", err)
+		}
+		response.MenuItems = append(response.MenuItems, item)
+		response.RevenueAtRisk += item.Revenue
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.RevenueAtRiskResponse{}, fmt.Errorf("error during rows iteration: %w", err)
+	}
+
+	return response, nil
+}
+
+// RestockIngredient adds quantity to an ingredient's stock and records a restock transaction, and a lot
+// when expiresOn is set, returning the new on-hand amount
+func (r *inventoryRepository) RestockIngredient(ctx context.Context, id int, quantity float64, notes string, expiresOn *time.Time) (float64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var onHand float64
+	err = tx.QueryRowContext(ctx, `
+        UPDATE inventory 
+        SET quantity = quantity + $1, 
+            updated_at = NOW()
+        WHERE id = $2 AND location_id = $3
+        RETURNING quantity`, quantity, id, models.LocationIDFromContext(ctx)).Scan(&onHand)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrIngredientNotFound
+		}
+		return 0, fmt.Errorf("failed to restock ingredient: %w", err)
+	}
+
+	var transactionNotes interface{} = nil
+	if notes != "" {
+		transactionNotes = notes
+	}
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO inventory_transactions (ingredient_id, delta, transaction_type, notes)
+        VALUES ($1, $2, 'restock', $3)`, id, quantity, transactionNotes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record restock transaction: %w", err)
+	}
+
+	if expiresOn != nil {
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO inventory_lots (ingredient_id, quantity, expires_on)
+            VALUES ($1, $2, $3)`, id, quantity, *expiresOn)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record inventory lot: %w", err)
+		}
+	}
+
+	if err := fulfillReorderRequests(ctx, tx, id); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return onHand, nil
+}
+
+// ImportIngredients upserts stocktake rows in a single transaction. A row whose name matches one
+// ingredient (case-insensitively) sets its quantity, cost and reorder level, recording the stock
+// change as an adjustment; a row matching none inserts a new ingredient. Rows matching several
+// ingredients, or one with a different unit, are returned as failures and change nothing.
+func (r *inventoryRepository) ImportIngredients(ctx context.Context, rows []models.InventoryImportRow) (int, int, []models.InventoryImportFailure, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	locationID := models.LocationIDFromContext(ctx)
+	var created, updated int
+	var failures []models.InventoryImportFailure
+	for _, row := range rows {
+		var ids []int64
+		var units []string
+		var quantities []float64
+		err := tx.QueryRowContext(ctx, `
+            SELECT 
+                COALESCE(array_agg(id ORDER BY id), '{}'),
+                COALESCE(array_agg(unit::text ORDER BY id), '{}'),
+                COALESCE(array_agg(quantity ORDER BY id), '{}')
+            FROM (
+                SELECT id, unit, quantity FROM inventory 
+                WHERE location_id = $1 AND lower(name) = lower($2)
+                FOR UPDATE
+            ) matched`, locationID, row.Name).Scan(pq.Array(&ids), pq.Array(&units), pq.Array(&quantities))
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("line %d: failed to match ingredient: %w", row.Line, err)
+		}
+
+		switch {
+		case len(ids) == 0:
+			_, err = tx.ExecContext(ctx, `
+                INSERT INTO inventory (name, quantity, unit, cost_per_unit, reorder_level, location_id)
+                VALUES ($1, $2, $3, $4, $5, $6)`,
+				row.Name, row.Quantity, row.Unit, row.CostPerUnit, row.ReOrderLevel, locationID)
+			if err != nil {
+				return 0, 0, nil, fmt.Errorf("line %d: failed to insert ingredient: %w", row.Line, err)
+			}
+			created++
+		case len(ids) > 1:
+			failures = append(failures, models.InventoryImportFailure{
+				Line:   row.Line,
+				Name:   row.Name,
+				Reason: fmt.Sprintf("name matches %d ingredients", len(ids)),
+			})
+		case units[0] != row.Unit:
+			failures = append(failures, models.InventoryImportFailure{
+				Line:   row.Line,
+				Name:   row.Name,
+				Reason: fmt.Sprintf("unit %s does not match the ingredient's unit %s", row.Unit, units[0]),
+			})
+		default:
+			_, err = tx.ExecContext(ctx, `
+                UPDATE inventory 
+                SET quantity = $1, 
+                    cost_per_unit = $2, 
+                    reorder_level = $3, 
+                    updated_at = NOW()
+                WHERE id = $4`, row.Quantity, row.CostPerUnit, row.ReOrderLevel, ids[0])
+			if err != nil {
+				return 0, 0, nil, fmt.Errorf("line %d: failed to update ingredient: %w", row.Line, err)
+			}
+			if delta := row.Quantity - quantities[0]; delta != 0 {
+				_, err = tx.ExecContext(ctx, `
+                    INSERT INTO inventory_transactions (ingredient_id, delta, transaction_type, notes)
+                    VALUES ($1, $2, 'adjustment', 'stocktake import')`, ids[0], delta)
+				if err != nil {
+					return 0, 0, nil, fmt.Errorf("line %d: %w: %w", row.Line, models.ErrInventoryTransaction, err)
+				}
+			}
+			if err := fulfillReorderRequests(ctx, tx, int(ids[0])); err != nil {
+				return 0, 0, nil, fmt.Errorf("line %d: %w", row.Line, err)
+			}
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return created, updated, failures, nil
+}
+
+// fulfillReorderRequests closes the open reorder request of an ingredient once its stock is back
+// at or above the reorder level
+func fulfillReorderRequests(ctx context.Context, tx *sql.Tx, ingredientID int) error {
+	_, err := tx.ExecContext(ctx, `
+        UPDATE reorder_requests rr
+        SET status = 'fulfilled', 
+            fulfilled_at = NOW()
+        FROM inventory i
+        WHERE i.id = rr.ingredient_id
+        AND rr.ingredient_id = $1
+        AND rr.status = 'open'
+        AND i.quantity >= rr.reorder_level`, ingredientID)
+	if err != nil {
+		return fmt.Errorf("failed to fulfill reorder requests: %w", err)
+	}
+	return nil
+}
+
+// GetReorderRequests returns the reorder requests of the location's ingredients with the given
+// status, or all of them for an empty status, newest first
+func (r *inventoryRepository) GetReorderRequests(ctx context.Context, status string) ([]models.ReorderRequest, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            rr.id,
+            i.id,
+            i.name,
+            i.unit,
+            rr.quantity,
+            rr.reorder_level,
+            i.quantity,
+            COALESCE(rr.order_id, 0),
+            rr.status,
+            rr.created_at,
+            rr.fulfilled_at
+        FROM reorder_requests rr
+        JOIN inventory i ON i.id = rr.ingredient_id
+        WHERE i.location_id = $1
+        AND ($2 = '' OR rr.status = $2)
+        ORDER BY rr.created_at DESC, rr.id DESC`, models.LocationIDFromContext(ctx), status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reorder requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []models.ReorderRequest{}
+	for rows.Next() {
+		var request models.ReorderRequest
+		var fulfilledAt sql.NullTime
+		if err := rows.Scan(
+			&request.ID,
+			&request.IngredientID,
+			&request.Name,
+			&request.Unit,
+			&request.Quantity,
+			&request.ReorderLevel,
+			&request.OnHand,
+			&request.OrderID,
+			&request.Status,
+			&request.CreatedAt,
+			&fulfilledAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan reorder request: %w", err)
+		}
+		if fulfilledAt.Valid {
+			request.FulfilledAt = &fulfilledAt.Time
+		}
+		requests = append(requests, request)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning reorder requests: %w", err)
+	}
+
+	return requests, nil
+}
+
+// GetUnusedIngredients returns ingredients that no menu item uses
+func (r *inventoryRepository) GetUnusedIngredients(ctx context.Context) ([]models.Inventory, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT 
+			i.id,
+            i.name,
+            i.quantity,
+            i.unit,
+			i.cost_per_unit,
+            i.reorder_level,
+            i.supplier_info,
+            i.unlimited,
+            i.created_at, 
+            i.updated_at
+		FROM inventory i
+		WHERE NOT EXISTS (
+			SELECT 1 FROM menu_item_ingredients mii WHERE mii.ingredient_id = i.id
+		)
+		AND i.location_id = $1
+		ORDER BY i.name`, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unused ingredients: %w", err)
+	}
+	defer rows.Close()
+
+	inventory := []models.Inventory{}
+	for rows.Next() {
+		var ingredient models.Inventory
+		err := rows.Scan(&ingredient.ID, &ingredient.Name, &ingredient.Quantity, &ingredient.Unit, &ingredient.CostPerUnit, &ingredient.ReOrderLevel, &ingredient.SupplierInfo, &ingredient.Unlimited, &ingredient.CreatedAt, &ingredient.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ingredient: %w", err)
+		}
+		inventory = append(inventory, ingredient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning unused ingredients: %w", err)
+	}
+
+	return inventory, nil
+}
+
+// GetLowStockItems returns tracked ingredients at or below their reorder level, lowest stock
+// relative to reorder level first. Average daily usage over the last usageDays estimates how
+// many days the stock lasts; ingredients without usage in that window get no estimate.
+func (r *inventoryRepository) GetLowStockItems(ctx context.Context, usageDays int) ([]models.InventoryAlert, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH usage AS (
+            SELECT ingredient_id, -SUM(delta) / $1::int AS daily_usage
+            FROM inventory_transactions
+            WHERE transaction_type = 'order_usage'
+            AND created_at >= NOW() - make_interval(days => $1::int)
+            GROUP BY ingredient_id
+        )
+        SELECT 
+            i.id,
+            i.name,
+            i.unit,
+            i.quantity,
+            i.reorder_level,
+            CASE WHEN u.daily_usage > 0 THEN i.quantity / u.daily_usage ELSE 0 END AS days_remaining
+        FROM inventory i
+        LEFT JOIN usage u ON u.ingredient_id = i.id
+        WHERE NOT i.unlimited
+        AND i.quantity <= i.reorder_level
+        AND i.location_id = $2
+        ORDER BY i.quantity / NULLIF(i.reorder_level, 0) NULLS FIRST, i.name`, usageDays, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get low stock items: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []models.InventoryAlert{}
+	for rows.Next() {
+		var alert models.InventoryAlert
+		if err := rows.Scan(
+			&alert.IngredientID,
+			&alert.Name,
+			&alert.Unit,
+			&alert.CurrentStock,
+			&alert.ReorderLevel,
+			&alert.DaysRemaining,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan low stock item: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning low stock items: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// GetStockCoverage returns the days of stock of tracked ingredients at their average daily order usage
+// over the last usageDays, lowest coverage first and unused ingredients last
+func (r *inventoryRepository) GetStockCoverage(ctx context.Context, usageDays int) ([]models.StockCoverage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH usage AS (
+            SELECT ingredient_id, -SUM(delta) / $1::int AS daily_usage
+            FROM inventory_transactions
+            WHERE transaction_type = 'order_usage'
+            AND created_at >= NOW() - make_interval(days => $1::int)
+            GROUP BY ingredient_id
+        )
+        SELECT 
+            i.id,
+            i.name,
+            i.unit,
+            i.quantity,
+            COALESCE(round(u.daily_usage::numeric, 3), 0),
+            CASE WHEN u.daily_usage > 0 THEN round((i.quantity / u.daily_usage)::numeric, 1) END AS coverage_days
+        FROM inventory i
+        LEFT JOIN usage u ON u.ingredient_id = i.id
+        WHERE NOT i.unlimited
+        AND i.location_id = $2
+        ORDER BY coverage_days ASC NULLS LAST, i.id`, usageDays, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var coverage []models.StockCoverage
+	for rows.Next() {
+		var item models.StockCoverage
+		var days sql.NullFloat64
+		if err := rows.Scan(
+			&item.IngredientID,
+			&item.Name,
+			&item.Unit,
+			&item.CurrentStock,
+			&item.DailyUsage,
+			&days,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan stock coverage: %w", err)
+		}
+		if days.Valid {
+			item.CoverageDays = &days.Float64
+		}
+		coverage = append(coverage, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning stock coverage: %w", err)
+	}
+
+	return coverage, nil
+}
+
+// GetInventoryLots returns the lots of the location's tracked ingredients, newest first per ingredient,
+// with the ingredient's stock, cost and average daily order usage over the last usageDays
+func (r *inventoryRepository) GetInventoryLots(ctx context.Context, usageDays int) ([]models.ExpiringLot, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH usage AS (
+            SELECT ingredient_id, -SUM(delta) / $1::int AS daily_usage
+            FROM inventory_transactions
+            WHERE transaction_type = 'order_usage'
+            AND created_at >= NOW() - make_interval(days => $1::int)
+            GROUP BY ingredient_id
+        )
+        SELECT 
+            l.id,
+            i.id,
+            i.name,
+            i.unit,
+            l.quantity,
+            l.expires_on,
+            l.expires_on - CURRENT_DATE,
+            COALESCE(round(u.daily_usage::numeric, 3), 0),
+            i.quantity,
+            i.cost_per_unit
+        FROM inventory_lots l
+        JOIN inventory i ON i.id = l.ingredient_id
+        LEFT JOIN usage u ON u.ingredient_id = i.id
+        WHERE NOT i.unlimited
+        AND i.location_id = $2
+        ORDER BY i.id, l.received_at DESC, l.id DESC`, usageDays, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory lots: %w", err)
+	}
+	defer rows.Close()
+
+	var lots []models.ExpiringLot
+	for rows.Next() {
+		var lot models.ExpiringLot
+		var expiresOn time.Time
+		var costPerUnit sql.NullFloat64
+		if err := rows.Scan(
+			&lot.LotID,
+			&lot.IngredientID,
+			&lot.Name,
+			&lot.Unit,
+			&lot.Quantity,
+			&expiresOn,
+			&lot.DaysUntilExpiry,
+			&lot.DailyUsage,
+			&lot.OnHand,
+			&costPerUnit,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory lot: %w", err)
+		}
+		lot.ExpiresOn = expiresOn.Format("2006-01-02")
+		if costPerUnit.Valid {
+			lot.CostPerUnit = &costPerUnit.Float64
+		}
+		lots = append(lots, lot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning inventory lots: %w", err)
+	}
+
+	return lots, nil
+}
+
+// GetReorderCandidates returns tracked ingredients at or below their reorder level with their days of
+// stock remaining at the average daily usage of the last usageDays, their supplier lead time and the
+// revenue of the menu items using them over the same days
+func (r *inventoryRepository) GetReorderCandidates(ctx context.Context, usageDays int, defaultLeadTimeDays float64) ([]models.ReorderPriority, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH usage AS (
+            SELECT ingredient_id, -SUM(delta) / $1::int AS daily_usage
+            FROM inventory_transactions
+            WHERE transaction_type = 'order_usage'
+            AND created_at >= NOW() - make_interval(days => $1::int)
+            GROUP BY ingredient_id
+        ),
+        revenue AS (
+            SELECT mii.ingredient_id, SUM(oi.quantity * oi.price_at_order) AS revenue
+            FROM menu_item_ingredients mii
+            JOIN order_items oi ON oi.menu_item_id = mii.menu_item_id
+            JOIN orders o ON o.id = oi.order_id
+            WHERE o.status <> 'cancelled'
+            AND o.created_at >= NOW() - make_interval(days => $1::int)
+            AND o.location_id = $3
+            GROUP BY mii.ingredient_id
+        )
+        SELECT 
+            i.id,
+            i.name,
+            i.unit,
+            i.quantity,
+            i.reorder_level,
+            CASE WHEN u.daily_usage > 0 THEN i.quantity / u.daily_usage ELSE 0 END AS days_remaining,
+            CASE 
+                WHEN i.supplier_info->>'lead_time_days' ~ '^[0-9]+(\.[0-9]+)?$'
+                THEN (i.supplier_info->>'lead_time_days')::numeric
+                ELSE $2
+            END AS lead_time_days,
+            COALESCE(rv.revenue, 0)
+        FROM inventory i
+        LEFT JOIN usage u ON u.ingredient_id = i.id
+        LEFT JOIN revenue rv ON rv.ingredient_id = i.id
+        WHERE NOT i.unlimited
+        AND i.quantity <= i.reorder_level
+        AND i.location_id = $3
+        ORDER BY i.id`, usageDays, defaultLeadTimeDays, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reorder candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []models.ReorderPriority
+	for rows.Next() {
+		var candidate models.ReorderPriority
+		if err := rows.Scan(
+			&candidate.IngredientID,
+			&candidate.Name,
+			&candidate.Unit,
+			&candidate.CurrentStock,
+			&candidate.ReorderLevel,
+			&candidate.DaysRemaining,
+			&candidate.LeadTimeDays,
+			&candidate.RevenueAtRisk,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan reorder candidate: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning reorder candidates: %w", err)
+	}
+
+	return candidates, nil
+}
+
+// StreamTransactions calls fn for each inventory transaction between the dates, oldest first,
+// without loading the ledger into memory. Zero dates leave that side of the range open.
+func (r *inventoryRepository) StreamTransactions(ctx context.Context, startDate, endDate time.Time, fn func(models.InventoryTransaction) error) error {
+	query := `
+        SELECT 
+            t.id,
+            t.ingredient_id,
+            i.name,
+            t.transaction_type,
+            t.delta,
+            t.reference_id,
+            COALESCE(t.notes, ''),
+            t.created_at
+        FROM inventory_transactions t
+        JOIN inventory i ON i.id = t.ingredient_id`
+
+	// Transactions of deleted ingredients can't be attributed to a location and are left out
+	args := []interface{}{models.LocationIDFromContext(ctx)}
+	whereClauses := []string{"i.location_id = $1"}
+	if !startDate.IsZero() {
+		whereClauses = append(whereClauses, fmt.Sprintf("t.created_at >= $%d", len(args)+1))
+		args = append(args, startDate)
+	}
+	if !endDate.IsZero() {
+		whereClauses = append(whereClauses, fmt.Sprintf("t.created_at <= $%d", len(args)+1))
+		args = append(args, endDate)
+	}
+	query += " WHERE " + strings.Join(whereClauses, " AND ")
+	query += " ORDER BY t.created_at, t.id"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query inventory transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction models.InventoryTransaction
+		var ingredientID, referenceID sql.NullInt64
+		if err := rows.Scan(
+			&transaction.ID,
+			&ingredientID,
+			&transaction.IngredientName,
+			&transaction.TransactionType,
+			&transaction.Delta,
+			&referenceID,
+			&transaction.Notes,
+			&transaction.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("failed to scan inventory transaction: %w", err)
+		}
+		transaction.IngredientID = int(ingredientID.Int64)
+		transaction.ReferenceID = int(referenceID.Int64)
+
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error after scanning inventory transactions: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"frappuccino/internal/models"
+)
+
+func TestGetShoppingListProjectsRecentUsage(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewInventoryRepository(db)
+	location := createTestLocation(t, db, "SHOP")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	// 300 ml of milk used over the last 30 days is 10 a day, 140 over the 14 forecast days
+	milk := createTestIngredient(t, db, location, "test shopping milk", 100, false)
+	setTestSupplier(t, db, milk, "Dairy Co")
+	createTestTransaction(t, db, milk, -100, "order_usage", now.AddDate(0, 0, -20))
+	createTestTransaction(t, db, milk, -200, "order_usage", now.AddDate(0, 0, -5))
+	// Usage before the lookback window and restocks don't count
+	createTestTransaction(t, db, milk, -900, "order_usage", now.AddDate(0, 0, -40))
+	createTestTransaction(t, db, milk, 500, "restock", now.AddDate(0, 0, -3))
+
+	sugar := createTestIngredient(t, db, location, "test shopping sugar", 0, false)
+	setTestSupplier(t, db, sugar, "Sweet Ltd")
+	createTestTransaction(t, db, sugar, -60, "order_usage", now.AddDate(0, 0, -1))
+
+	// Enough beans for the forecast are left off the list
+	beans := createTestIngredient(t, db, location, "test shopping beans", 500, false)
+	setTestSupplier(t, db, beans, "Dairy Co")
+	createTestTransaction(t, db, beans, -30, "order_usage", now.AddDate(0, 0, -1))
+
+	items, err := repo.GetShoppingList(ctx, 14, 30)
+	if err != nil {
+		t.Fatalf("GetShoppingList: %v", err)
+	}
+
+	want := []models.ShoppingListItem{
+		{IngredientID: milk, Supplier: "Dairy Co", CurrentStock: 100, ProjectedUsage: 140, QuantityToBuy: 40},
+		{IngredientID: sugar, Supplier: "Sweet Ltd", CurrentStock: 0, ProjectedUsage: 28, QuantityToBuy: 28},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("GetShoppingList = %+v, want milk and sugar", items)
+	}
+	for i, item := range items {
+		w := want[i]
+		if item.IngredientID != w.IngredientID || item.Supplier != w.Supplier || item.CurrentStock != w.CurrentStock ||
+			item.ProjectedUsage != w.ProjectedUsage || item.QuantityToBuy != w.QuantityToBuy {
+			t.Errorf("item %d = %+v, want %+v", i, item, w)
+		}
+	}
+}
+
+func TestGetRevenueAtRiskSumsDependentItems(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewInventoryRepository(db)
+	location := createTestLocation(t, db, "RISK")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	vanilla := createTestIngredient(t, db, location, "test risk vanilla", 5, false)
+	if _, err := db.Exec(`UPDATE inventory SET reorder_level = 10 WHERE id = $1`, vanilla); err != nil {
+		t.Fatalf("failed to set reorder level: %v", err)
+	}
+	latte := createTestMenuItem(t, db, location, "test risk latte", 6, map[int]float64{vanilla: 10})
+	cake := createTestMenuItem(t, db, location, "test risk cake", 4, map[int]float64{vanilla: 5})
+	// An item without the ingredient isn't at risk
+	tea := createTestMenuItem(t, db, location, "test risk tea", 3, nil)
+
+	recent := createTestOrder(t, db, location, now.AddDate(0, 0, -2), 0)
+	createTestOrderItem(t, db, recent, latte, 10, 6)
+	createTestOrderItem(t, db, recent, cake, 2, 4)
+	createTestOrderItem(t, db, recent, tea, 5, 3)
+	// Sales before the period and cancelled orders don't count
+	old := createTestOrder(t, db, location, now.AddDate(0, 0, -30), 0)
+	createTestOrderItem(t, db, old, latte, 100, 6)
+	cancelled := createTestOrder(t, db, location, now.AddDate(0, 0, -1), 0)
+	createTestOrderItem(t, db, cancelled, cake, 100, 4)
+	if _, err := db.Exec(`UPDATE orders SET status = 'cancelled' WHERE id = $1`, cancelled); err != nil {
+		t.Fatalf("failed to cancel order: %v", err)
+	}
+
+	response, err := repo.GetRevenueAtRisk(ctx, vanilla, 7)
+	if err != nil {
+		t.Fatalf("GetRevenueAtRisk: %v", err)
+	}
+	if !response.LowStock {
+		t.Error("LowStock = false, want true at 5 of a reorder level of 10")
+	}
+	if response.RevenueAtRisk != 68 {
+		t.Errorf("RevenueAtRisk = %v, want 68", response.RevenueAtRisk)
+	}
+	if len(response.MenuItems) != 2 || response.MenuItems[0].MenuItemID != latte || response.MenuItems[0].Revenue != 60 ||
+		response.MenuItems[1].MenuItemID != cake || response.MenuItems[1].Revenue != 8 {
+		t.Errorf("MenuItems = %+v, want the latte at 60 then the cake at 8", response.MenuItems)
+	}
+}
+
+func TestGetLeftOversSortsByValue(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewInventoryRepository(db)
+	location := createTestLocation(t, db, "VALUE")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	// Value is quantity times cost, so the least stocked ingredient can be worth the most
+	stock := []struct {
+		name     string
+		quantity float64
+		cost     float64
+	}{
+		{"test value milk", 1000, 0.01}, // 10
+		{"test value saffron", 2, 25},   // 50
+		{"test value beans", 400, 0.05}, // 20
+	}
+	ids := make([]int, len(stock))
+	for i, s := range stock {
+		ids[i] = createTestIngredient(t, db, location, s.name, s.quantity, false)
+		if _, err := db.Exec(`UPDATE inventory SET cost_per_unit = $2 WHERE id = $1`, ids[i], s.cost); err != nil {
+			t.Fatalf("failed to set cost of %s: %v", s.name, err)
+		}
+	}
+
+	response, err := repo.GetLeftOversWithPagination(ctx, "value", 1, 10)
+	if err != nil {
+		t.Fatalf("GetLeftOversWithPagination: %v", err)
+	}
+	want := []int{ids[1], ids[2], ids[0]}
+	if len(response.Items) != len(want) {
+		t.Fatalf("items = %+v, want saffron, beans, milk", response.Items)
+	}
+	for i, item := range response.Items {
+		if item.ID != want[i] {
+			t.Errorf("item %d = %s worth %v, want ingredient %d", i, item.Name, item.TotalValue, want[i])
+		}
+	}
+}
+
+func TestGetUnusedIngredientsLeavesOutRecipeIngredients(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewInventoryRepository(db)
+	location := createTestLocation(t, db, "UNUSED")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	milk := createTestIngredient(t, db, location, "test unused milk", 100, false)
+	saffron := createTestIngredient(t, db, location, "test unused saffron", 5, false)
+	createTestMenuItem(t, db, location, "test unused latte", 4, map[int]float64{milk: 200})
+
+	unused, err := repo.GetUnusedIngredients(ctx)
+	if err != nil {
+		t.Fatalf("GetUnusedIngredients: %v", err)
+	}
+	if len(unused) != 1 || unused[0].ID != saffron {
+		t.Errorf("GetUnusedIngredients = %+v, want only the saffron", unused)
+	}
+}
+
+func TestCreateIngredientRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewInventoryRepository(db)
+	location := createTestLocation(t, db, "ROUND")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	want := models.Inventory{
+		Name:         "test round trip oat milk",
+		Quantity:     2500.5,
+		Unit:         "ml",
+		CostPerUnit:  0.02,
+		ReOrderLevel: 500,
+		SupplierInfo: json.RawMessage(`{"supplier": "Oat Co", "lead_time_days": 3}`),
+	}
+	id, err := repo.CreateIngredient(ctx, want)
+	if err != nil {
+		t.Fatalf("CreateIngredient: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM inventory WHERE id = $1`, id) })
+
+	got, err := repo.GetIngredientByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetIngredientByID: %v", err)
+	}
+	if got.ID != id || got.Name != want.Name || got.Quantity != want.Quantity || got.Unit != want.Unit ||
+		got.CostPerUnit != want.CostPerUnit || got.ReOrderLevel != want.ReOrderLevel || got.Unlimited {
+		t.Errorf("GetIngredientByID = %+v, want %+v", got, want)
+	}
+	var gotSupplier, wantSupplier map[string]interface{}
+	json.Unmarshal(got.SupplierInfo, &gotSupplier)
+	json.Unmarshal(want.SupplierInfo, &wantSupplier)
+	if !reflect.DeepEqual(gotSupplier, wantSupplier) {
+		t.Errorf("supplier_info = %s, want %s", got.SupplierInfo, want.SupplierInfo)
+	}
+	if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() {
+		t.Errorf("timestamps = %v, %v, want them set by the database", got.CreatedAt, got.UpdatedAt)
+	}
+
+	// The ingredient belongs to its location only
+	if _, err := repo.GetIngredientByID(context.Background(), id); err != models.ErrIngredientNotFound {
+		t.Errorf("GetIngredientByID at another location error = %v, want ErrIngredientNotFound", err)
+	}
+}
+
+func TestGetStockCoverageOfSteadyUsage(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewInventoryRepository(db)
+	location := createTestLocation(t, db, "COVER")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	// 20 ml of milk a day over the last 30 days leaves 300 ml for 15 days
+	milk := createTestIngredient(t, db, location, "test coverage milk", 300, false)
+	for day := 0; day < 30; day++ {
+		createTestTransaction(t, db, milk, -20, "order_usage", now.AddDate(0, 0, -day).Add(-time.Hour))
+	}
+	// 30 g of beans over the 30 days is 1 a day, covering 600 days
+	beans := createTestIngredient(t, db, location, "test coverage beans", 600, false)
+	createTestTransaction(t, db, beans, -30, "order_usage", now.AddDate(0, 0, -2))
+	// Unused ingredients have infinite coverage and come last; unlimited ones are left out
+	sugar := createTestIngredient(t, db, location, "test coverage sugar", 50, false)
+	createTestIngredient(t, db, location, "test coverage water", 0, true)
+
+	coverage, err := repo.GetStockCoverage(ctx, 30)
+	if err != nil {
+		t.Fatalf("GetStockCoverage: %v", err)
+	}
+	if len(coverage) != 3 {
+		t.Fatalf("coverage = %+v, want milk, beans and sugar", coverage)
+	}
+	want := []struct {
+		id         int
+		dailyUsage float64
+		days       float64
+	}{
+		{milk, 20, 15},
+		{beans, 1, 600},
+	}
+	for i, w := range want {
+		got := coverage[i]
+		if got.IngredientID != w.id || got.DailyUsage != w.dailyUsage || got.CoverageDays == nil || *got.CoverageDays != w.days {
+			t.Errorf("coverage %d = %+v, want %v a day lasting %v days", i, got, w.dailyUsage, w.days)
+		}
+	}
+	if got := coverage[2]; got.IngredientID != sugar || got.DailyUsage != 0 || got.CoverageDays != nil {
+		t.Errorf("coverage 2 = %+v, want unused sugar without coverage days", got)
+	}
+}
+
+func TestPatchIngredientChangesOnlySetFields(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewInventoryRepository(db)
+	location := createTestLocation(t, db, "PATCH")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	milk := createTestIngredient(t, db, location, "test patch milk", 1000, false)
+	setTestSupplier(t, db, milk, "Dairy Co")
+
+	quantity := 750.0
+	if err := repo.PatchIngredient(ctx, milk, models.InventoryUpdateRequest{Quantity: &quantity}); err != nil {
+		t.Fatalf("PatchIngredient: %v", err)
+	}
+
+	got, err := repo.GetIngredientByID(ctx, milk)
+	if err != nil {
+		t.Fatalf("GetIngredientByID: %v", err)
+	}
+	if got.Quantity != 750 {
+		t.Errorf("quantity = %v, want 750", got.Quantity)
+	}
+	if got.Name != "test patch milk" || got.Unit != "ml" || got.CostPerUnit != 0.01 {
+		t.Errorf("ingredient = %+v, want its name, unit and cost untouched", got)
+	}
+	var supplier map[string]interface{}
+	if err := json.Unmarshal(got.SupplierInfo, &supplier); err != nil || supplier["supplier"] != "Dairy Co" {
+		t.Errorf("supplier_info = %s, want it untouched", got.SupplierInfo)
+	}
+
+	if err := repo.PatchIngredient(ctx, milk, models.InventoryUpdateRequest{}); err != models.ErrEmptyUpdate {
+		t.Errorf("empty PatchIngredient error = %v, want ErrEmptyUpdate", err)
+	}
+	// The ingredient belongs to its location only
+	if err := repo.PatchIngredient(context.Background(), milk, models.InventoryUpdateRequest{Quantity: &quantity}); err != sql.ErrNoRows {
+		t.Errorf("PatchIngredient at another location error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestCostPerUnitSurvivesBothGets(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewInventoryRepository(db)
+	location := createTestLocation(t, db, "COST")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	id, err := repo.CreateIngredient(ctx, models.Inventory{
+		Name:         "test cost vanilla",
+		Quantity:     500,
+		Unit:         "ml",
+		CostPerUnit:  0.125,
+		ReOrderLevel: 100,
+	})
+	if err != nil {
+		t.Fatalf("CreateIngredient: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM inventory WHERE id = $1`, id) })
+
+	single, err := repo.GetIngredientByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetIngredientByID: %v", err)
+	}
+	if single.CostPerUnit != 0.125 {
+		t.Errorf("GetIngredientByID cost per unit = %v, want 0.125", single.CostPerUnit)
+	}
+
+	all, err := repo.GetAllIngredients(ctx)
+	if err != nil {
+		t.Fatalf("GetAllIngredients: %v", err)
+	}
+	if len(all) != 1 || all[0].ID != id || all[0].CostPerUnit != 0.125 {
+		t.Errorf("GetAllIngredients = %+v, want the vanilla at 0.125 per unit", all)
+	}
+}
@@ -0,0 +1,29 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type LocationRepository interface {
+	LocationExists(ctx context.Context, id int) (bool, error)
+}
+
+type locationRepository struct {
+	*Repository
+}
+
+func NewLocationRepository(db *sql.DB) LocationRepository {
+	return &locationRepository{NewRepository(db)}
+}
+
+func (r *locationRepository) LocationExists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM locations WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check location: %w", err)
+	}
+	return exists, nil
+}
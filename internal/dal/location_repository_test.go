@@ -0,0 +1,144 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"frappuccino/internal/models"
+)
+
+func TestLocationIsolation(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderRepository(db)
+	menu := NewMenuRepository(db)
+	inventory := NewInventoryRepository(db)
+
+	north := createTestLocation(t, db, "NORTH")
+	south := createTestLocation(t, db, "SOUTH")
+	northCtx := models.WithLocationID(context.Background(), north)
+	southCtx := models.WithLocationID(context.Background(), south)
+
+	milk := createTestIngredient(t, db, north, "test north milk", 1000, false)
+	latte := createTestMenuItem(t, db, north, "test north latte", 3.50, map[int]float64{milk: 200})
+	orderID, _, err := orders.CreateOrder(northCtx, models.Order{
+		Items: []models.OrderItem{{MenuItemID: latte, Quantity: 1}},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateOrder at north: %v", err)
+	}
+
+	// The north location sees its own data
+	if _, err := orders.GetOrderByID(northCtx, orderID); err != nil {
+		t.Errorf("GetOrderByID at north: %v", err)
+	}
+
+	// The south location sees none of it
+	if _, err := orders.GetOrderByID(southCtx, orderID); !errors.Is(err, models.ErrOrderNotFound) {
+		t.Errorf("GetOrderByID at south error = %v, want ErrOrderNotFound", err)
+	}
+	list, err := orders.GetAllOrders(southCtx, models.OrderFilters{})
+	if err != nil {
+		t.Fatalf("GetAllOrders at south: %v", err)
+	}
+	for _, order := range list.Orders {
+		if order.ID == orderID {
+			t.Errorf("GetAllOrders at south lists north order %d", orderID)
+		}
+	}
+	if err := orders.CancelOrder(southCtx, orderID); !errors.Is(err, models.ErrOrderNotFound) {
+		t.Errorf("CancelOrder at south error = %v, want ErrOrderNotFound", err)
+	}
+
+	if _, err := menu.GetMenuItemByID(southCtx, latte); !errors.Is(err, models.ErrMenuItemNotFound) {
+		t.Errorf("GetMenuItemByID at south error = %v, want ErrMenuItemNotFound", err)
+	}
+	items, _, err := menu.GetAllMenu(southCtx)
+	if err != nil {
+		t.Fatalf("GetAllMenu at south: %v", err)
+	}
+	if len(items) != 0 {
+		t.Errorf("GetAllMenu at south = %d items, want none", len(items))
+	}
+	if _, _, err := orders.CreateOrder(southCtx, models.Order{
+		Items: []models.OrderItem{{MenuItemID: latte, Quantity: 1}},
+	}, ""); !errors.Is(err, models.ErrInvalidMenuItemID) {
+		t.Errorf("CreateOrder at south of a north menu item error = %v, want ErrInvalidMenuItemID", err)
+	}
+	if err := orders.UpdateOrder(northCtx, orderID, models.Order{
+		Items: []models.OrderItem{{MenuItemID: latte + 1000000, Quantity: 1}},
+	}); !errors.Is(err, models.ErrInvalidMenuItemID) {
+		t.Errorf("UpdateOrder to a missing menu item error = %v, want ErrInvalidMenuItemID", err)
+	}
+	tree, err := menu.GetIngredientTree(southCtx, latte)
+	if err != nil {
+		t.Fatalf("GetIngredientTree at south: %v", err)
+	}
+	if len(tree) != 0 {
+		t.Errorf("GetIngredientTree at south = %d ingredients, want none", len(tree))
+	}
+	if _, known, err := menu.GetUnitCost(southCtx, latte); err != nil || known {
+		t.Errorf("GetUnitCost at south = known %v, %v, want unknown", known, err)
+	}
+
+	if _, err := inventory.GetIngredientByID(southCtx, milk); !errors.Is(err, models.ErrIngredientNotFound) {
+		t.Errorf("GetIngredientByID at south error = %v, want ErrIngredientNotFound", err)
+	}
+	ingredients, err := inventory.GetAllIngredients(southCtx)
+	if err != nil {
+		t.Fatalf("GetAllIngredients at south: %v", err)
+	}
+	if len(ingredients) != 0 {
+		t.Errorf("GetAllIngredients at south = %d ingredients, want none", len(ingredients))
+	}
+}
+
+func TestRecommendationsStayAtLocation(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderRepository(db)
+	customers := NewCustomerRepository(db)
+
+	north := createTestLocation(t, db, "NORTH")
+	south := createTestLocation(t, db, "SOUTH")
+	northCtx := models.WithLocationID(context.Background(), north)
+	southCtx := models.WithLocationID(context.Background(), south)
+
+	ann := createTestCustomer(t, db, "Ann")
+	bob := createTestCustomer(t, db, "Bob")
+	northLatte := createTestMenuItem(t, db, north, "test north rec latte", 3.50, nil)
+	northMuffin := createTestMenuItem(t, db, north, "test north rec muffin", 2.00, nil)
+	southTea := createTestMenuItem(t, db, south, "test south rec tea", 2.50, nil)
+
+	// Ann and Bob share the latte; Bob also had a muffin up north and tea down south
+	place := func(ctx context.Context, customerID, menuItemID int) {
+		t.Helper()
+		if _, _, err := orders.CreateOrder(ctx, models.Order{
+			CustomerID: customerID,
+			Items:      []models.OrderItem{{MenuItemID: menuItemID, Quantity: 1}},
+		}, ""); err != nil {
+			t.Fatalf("CreateOrder: %v", err)
+		}
+	}
+	place(northCtx, ann, northLatte)
+	place(northCtx, bob, northLatte)
+	place(northCtx, bob, northMuffin)
+	place(southCtx, bob, southTea)
+
+	similar, err := customers.GetSimilarCustomerItems(southCtx, ann, 10)
+	if err != nil {
+		t.Fatalf("GetSimilarCustomerItems at south: %v", err)
+	}
+	if len(similar) != 1 || similar[0].MenuItemID != southTea {
+		t.Errorf("GetSimilarCustomerItems at south = %+v, want only the south tea", similar)
+	}
+
+	popular, err := customers.GetPopularItemsNotOrdered(southCtx, ann, 100)
+	if err != nil {
+		t.Fatalf("GetPopularItemsNotOrdered at south: %v", err)
+	}
+	for _, item := range popular {
+		if item.MenuItemID == northMuffin || item.MenuItemID == northLatte {
+			t.Errorf("GetPopularItemsNotOrdered at south recommends north item %d", item.MenuItemID)
+		}
+	}
+}
@@ -5,18 +5,51 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"frappuccino/internal/models"
 
 	"github.com/lib/pq"
 )
 
+// menuItemAvailableSQL is true when one unit of the menu_items row can be made from current stock.
+// Stock tracked items need their own stock; others need every tracked ingredient, so items without
+// ingredients are available.
+const menuItemAvailableSQL = `
+            CASE WHEN menu_items.stock_tracked THEN menu_items.stock_quantity > 0
+            ELSE NOT EXISTS (
+                SELECT 1
+                FROM menu_item_ingredients mii
+                JOIN inventory i ON i.id = mii.ingredient_id
+                WHERE mii.menu_item_id = menu_items.id
+                AND NOT i.unlimited
+                AND i.quantity < mii.quantity
+            ) END`
+
 type MenuRepository interface {
 	CreateMenuItem(ctx context.Context, menuitem models.MenuItems) (int, error)
-	GetAllMenu(ctx context.Context) ([]models.MenuItems, error)
+	GetAllMenu(ctx context.Context) ([]models.MenuItems, []string, error)
+	GetMenuFiltered(ctx context.Context, filters models.MenuFilters) ([]models.MenuItems, []string, error)
 	GetMenuItemByID(ctx context.Context, id int) (models.MenuItems, error)
 	UpdateMenuItem(ctx context.Context, id int, menuitem models.MenuItems) error
 	DeleteMenuItem(ctx context.Context, id int) error
+	GetUnavailableMenuItems(ctx context.Context) ([]models.UnavailableMenuItem, error)
+	GetMenuAvailability(ctx context.Context) (map[int]bool, error)
+	ApplySeasonWindows(ctx context.Context, today time.Time) ([]models.SeasonalChange, error)
+	GetIngredientTree(ctx context.Context, menuItemID int) ([]models.IngredientTreeNode, error)
+	GetItemSales(ctx context.Context, menuItemID int, days int) (int, models.Money, error)
+	GetUnitCost(ctx context.Context, menuItemID int) (float64, bool, error)
+	RewriteCategories(ctx context.Context, rewrite func(categories []string) []string) (int, error)
+	GetMenuItemsWithoutRecipe(ctx context.Context) ([]models.MenuItemWithoutRecipe, error)
+	GetModifierGroups(ctx context.Context, menuItemID int) ([]models.ModifierGroup, error)
+	GetPriceHistory(ctx context.Context, menuItemID int) ([]models.PriceHistory, error)
+	GetRemovalImpact(ctx context.Context, menuItemID int, days int) (models.RemovalImpactResponse, error)
+	CreateModifierGroup(ctx context.Context, group models.ModifierGroup) (int, error)
+	UpdateModifierGroup(ctx context.Context, group models.ModifierGroup) error
+	DeleteModifierGroup(ctx context.Context, menuItemID, groupID int) error
+	BulkAssignIngredient(ctx context.Context, ingredientID int, quantity float64, menuItemIDs []int) ([]int, error)
 }
 
 type menuRepository struct {
@@ -36,16 +69,27 @@ func (r *menuRepository) CreateMenuItem(ctx context.Context, menuitem models.Men
 
 	// Insert menuitem
 	var id int
+	var prepTime interface{} = nil
+	if menuitem.PrepTime > 0 {
+		prepTime = menuitem.PrepTime
+	}
 	err = tx.QueryRowContext(ctx, `
-		INSERT INTO menu_items (name, description, price, category) 
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO menu_items (name, description, price, category, prep_time_minutes, season_start, season_end, location_id,
+			stock_tracked, stock_quantity) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id`,
-		menuitem.Name, menuitem.Description, menuitem.Price, pq.Array(menuitem.Category),
+		menuitem.Name, menuitem.Description, menuitem.Price, pq.Array(menuitem.Category), prepTime,
+		nullableDate(menuitem.SeasonStart), nullableDate(menuitem.SeasonEnd), models.LocationIDFromContext(ctx),
+		menuitem.StockTracked, menuitem.StockQuantity,
 	).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create menu item: %w", err)
 	}
 
+	if err := checkRecipeIngredients(ctx, tx, menuitem.Ingredients); err != nil {
+		return 0, err
+	}
+
 	// Insert menuitem ingredients
 	for _, ingredient := range menuitem.Ingredients {
 		_, err := tx.ExecContext(ctx, `
@@ -65,19 +109,56 @@ func (r *menuRepository) CreateMenuItem(ctx context.Context, menuitem models.Men
 	return id, nil
 }
 
-func (r *menuRepository) GetAllMenu(ctx context.Context) ([]models.MenuItems, error) {
+// GetAllMenu returns every menu item with its ingredients. A failure to load the
+// ingredients of an item does not fail the listing: the item is returned with an
+// empty ingredient list and a warning describing the failure.
+func (r *menuRepository) GetAllMenu(ctx context.Context) ([]models.MenuItems, []string, error) {
+	return r.GetMenuFiltered(ctx, models.MenuFilters{})
+}
+
+// GetMenuFiltered returns the menu items matching every set filter, with their ingredients
+// loaded like GetAllMenu. Empty filters return the whole menu.
+func (r *menuRepository) GetMenuFiltered(ctx context.Context, filters models.MenuFilters) ([]models.MenuItems, []string, error) {
+	args := []interface{}{models.LocationIDFromContext(ctx)}
+	whereClauses := []string{"location_id = $1"}
+
+	if filters.Category != "" {
+		whereClauses = append(whereClauses, fmt.Sprintf("category @> $%d", len(args)+1))
+		args = append(args, pq.Array([]string{filters.Category}))
+	}
+	if filters.Active != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("is_active = $%d", len(args)+1))
+		args = append(args, *filters.Active)
+	}
+	if filters.MinPrice != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("price >= $%d", len(args)+1))
+		args = append(args, *filters.MinPrice)
+	}
+	if filters.MaxPrice != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("price <= $%d", len(args)+1))
+		args = append(args, *filters.MaxPrice)
+	}
+	if filters.Query != "" {
+		whereClauses = append(whereClauses, fmt.Sprintf("(name ILIKE $%[1]d OR description ILIKE $%[1]d)", len(args)+1))
+		args = append(args, "%"+likeEscaper.Replace(filters.Query)+"%")
+	}
+
 	// Execute query
 	rows, err := r.db.QueryContext(ctx, `
-        SELECT id, name, description, price, category, is_active, created_at, updated_at
-        FROM menu_items`)
+        SELECT id, name, description, price, category, is_active, prep_time_minutes, season_start, season_end,
+            stock_tracked, stock_quantity, `+menuItemAvailableSQL+`, created_at, updated_at
+        FROM menu_items
+        WHERE `+strings.Join(whereClauses, " AND "), args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query menu items: %w", err)
+		return nil, nil, fmt.Errorf("failed to query menu items: %w", err)
 	}
 	defer rows.Close()
 
 	var menuItems []models.MenuItems
 	for rows.Next() {
 		var item models.MenuItems
+		var prepTime sql.NullFloat64
+		var seasonStart, seasonEnd sql.NullTime
 		err := rows.Scan(
 			&item.ID,
 			&item.Name,
@@ -85,55 +166,91 @@ func (r *menuRepository) GetAllMenu(ctx context.Context) ([]models.MenuItems, er
 			&item.Price,
 			pq.Array(&item.Category),
 			&item.IsActive,
+			&prepTime,
+			&seasonStart,
+			&seasonEnd,
+			&item.StockTracked,
+			&item.StockQuantity,
+			&item.Available,
 			&item.CreatedAt,
 			&item.UpdatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan menu item: %w", err)
+			return nil, nil, fmt.Errorf("failed to scan menu item: %w", err)
 		}
+		item.PrepTime = prepTime.Float64
+		item.SeasonStart = formatNullDate(seasonStart)
+		item.SeasonEnd = formatNullDate(seasonEnd)
+		menuItems = append(menuItems, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error after scanning menu items: %w", err)
+	}
 
-		addrows, err := r.db.QueryContext(ctx, `
-        	SELECT 
-            	ingredient_id,
-            	quantity
-        	FROM menu_item_ingredients
-        	WHERE menu_item_id = $1`, item.ID)
+	ids := make([]int64, len(menuItems))
+	for i, item := range menuItems {
+		ids[i] = int64(item.ID)
+	}
+
+	var warnings []string
+	ingredients, err := r.getMenuItemsIngredients(ctx, ids)
+	for i := range menuItems {
 		if err != nil {
-			return []models.MenuItems{}, fmt.Errorf("failed to get ingredients: %w", err)
-		}
-		defer addrows.Close()
-
-		var ingredients []models.MenuItemIngredients
-		for addrows.Next() {
-			var ingredient models.MenuItemIngredients
-			if err := addrows.Scan(
-				&ingredient.IngredientID,
-				&ingredient.Quantity,
-			); err != nil {
-				return []models.MenuItems{}, fmt.Errorf("failed to scan ingredient: %w", err)
-			}
-			ingredients = append(ingredients, ingredient)
+			warnings = append(warnings, fmt.Sprintf("ingredients for menu item %d could not be loaded: %v", menuItems[i].ID, err))
+			menuItems[i].Ingredients = []models.MenuItemIngredients{}
+			continue
 		}
+		menuItems[i].Ingredients = ingredients[menuItems[i].ID]
+	}
 
-		if err = addrows.Err(); err != nil {
-			return []models.MenuItems{}, fmt.Errorf("error after scanning order items: %w", err)
-		}
+	return menuItems, warnings, nil
+}
 
-		item.Ingredients = ingredients
+// getMenuItemsIngredients loads the recipes of several menu items in one query, keyed by menu item id
+func (r *menuRepository) getMenuItemsIngredients(ctx context.Context, menuItemIDs []int64) (map[int][]models.MenuItemIngredients, error) {
+	ingredients := make(map[int][]models.MenuItemIngredients, len(menuItemIDs))
+	if len(menuItemIDs) == 0 {
+		return ingredients, nil
+	}
 
-		menuItems = append(menuItems, item)
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            menu_item_id,
+            ingredient_id,
+            quantity
+        FROM menu_item_ingredients
+        WHERE menu_item_id = ANY($1)`, pq.Array(menuItemIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingredients: %w", err)
 	}
+	defer rows.Close()
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error after scanning menu items: %w", err)
+	for rows.Next() {
+		var menuItemID int
+		var ingredient models.MenuItemIngredients
+		if err := rows.Scan(
+			&menuItemID,
+			&ingredient.IngredientID,
+			&ingredient.Quantity,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan ingredient: %w", err)
+		}
+		ingredients[menuItemID] = append(ingredients[menuItemID], ingredient)
 	}
 
-	return menuItems, nil
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning ingredients: %w", err)
+	}
+
+	return ingredients, nil
 }
 
 func (r *menuRepository) GetMenuItemByID(ctx context.Context, id int) (models.MenuItems, error) {
 	// Initialize empty order
 	var menuitem models.MenuItems
+	var prepTime sql.NullFloat64
+	var seasonStart, seasonEnd sql.NullTime
 
 	// 1. Get basic order info
 	err := r.db.QueryRowContext(ctx, `
@@ -144,25 +261,40 @@ func (r *menuRepository) GetMenuItemByID(ctx context.Context, id int) (models.Me
             price,
             category, 
             is_active, 
+            prep_time_minutes,
+            season_start,
+            season_end,
+            stock_tracked,
+            stock_quantity,
+            `+menuItemAvailableSQL+`,
             created_at, 
             updated_at
         FROM menu_items 
-        WHERE id = $1`, id).Scan(
+        WHERE id = $1 AND location_id = $2`, id, models.LocationIDFromContext(ctx)).Scan(
 		&menuitem.ID,
 		&menuitem.Name,
 		&menuitem.Description,
 		&menuitem.Price,
 		pq.Array(&menuitem.Category),
 		&menuitem.IsActive,
+		&prepTime,
+		&seasonStart,
+		&seasonEnd,
+		&menuitem.StockTracked,
+		&menuitem.StockQuantity,
+		&menuitem.Available,
 		&menuitem.CreatedAt,
 		&menuitem.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.MenuItems{}, fmt.Errorf("menu item not found: %w", err)
+			return models.MenuItems{}, models.ErrMenuItemNotFound
 		}
 		return models.MenuItems{}, fmt.Errorf("failed to get menu item: %w", err)
 	}
+	menuitem.PrepTime = prepTime.Float64
+	menuitem.SeasonStart = formatNullDate(seasonStart)
+	menuitem.SeasonEnd = formatNullDate(seasonEnd)
 
 	// 2. Get order items
 	rows, err := r.db.QueryContext(ctx, `
@@ -204,17 +336,19 @@ func (r *menuRepository) UpdateMenuItem(ctx context.Context, id int, item models
 	}
 	defer tx.Rollback()
 
-	// Record price change history if the price has changed
-	var oldPrice float64
-	err = r.db.QueryRowContext(ctx, `SELECT price FROM menu_items WHERE id = $1`, id).Scan(&oldPrice)
-	if err != nil {
-		return fmt.Errorf("failed to get old price: %v", err)
+	// A price change is recorded in price_history by the trg_log_price_change trigger, inside
+	// this transaction, so a rollback leaves no history behind
+	var prepTime interface{} = nil
+	if item.PrepTime > 0 {
+		prepTime = item.PrepTime
 	}
-
 	res, err := tx.ExecContext(ctx, `
-		UPDATE menu_items SET name = $1, description = $2, price = $3, category = $4, is_active = $5, updated_at = NOW()
-		WHERE id = $6`,
-		item.Name, item.Description, item.Price, pq.Array(item.Category), item.IsActive, id)
+		UPDATE menu_items SET name = $1, description = $2, price = $3, category = $4, is_active = $5, prep_time_minutes = $6,
+			season_start = $7, season_end = $8, stock_tracked = $9, stock_quantity = $10, updated_at = NOW()
+		WHERE id = $11 AND location_id = $12`,
+		item.Name, item.Description, item.Price, pq.Array(item.Category), item.IsActive, prepTime,
+		nullableDate(item.SeasonStart), nullableDate(item.SeasonEnd), item.StockTracked, item.StockQuantity,
+		id, models.LocationIDFromContext(ctx))
 	if err != nil {
 		return fmt.Errorf("failed update menu item: %w", err)
 	}
@@ -226,6 +360,10 @@ func (r *menuRepository) UpdateMenuItem(ctx context.Context, id int, item models
 		return fmt.Errorf("menu item not found")
 	}
 
+	if err := checkRecipeIngredients(ctx, tx, item.Ingredients); err != nil {
+		return err
+	}
+
 	_, err = tx.ExecContext(ctx, `DELETE FROM menu_item_ingredients WHERE menu_item_id = $1`, id)
 	if err != nil {
 		return fmt.Errorf("clear ingredients: %w", err)
@@ -241,16 +379,6 @@ func (r *menuRepository) UpdateMenuItem(ctx context.Context, id int, item models
 		}
 	}
 
-	if oldPrice != item.Price {
-		_, err = r.db.Exec(`
-            INSERT INTO price_history (menu_item_id, old_price, new_price, changed_at)
-            VALUES ($1, $2, $3, NOW())`,
-			id, oldPrice, item.Price)
-		if err != nil {
-			return fmt.Errorf("failed to log price history: %v", err)
-		}
-	}
-
 	return tx.Commit()
 }
 
@@ -272,7 +400,8 @@ func (r *menuRepository) DeleteMenuItem(ctx context.Context, id int) error {
 		return fmt.Errorf("cannot delete menu item in use")
 	}
 
-	result, err := r.db.ExecContext(ctx, `DELETE FROM menu_items WHERE id = $1`, id)
+	result, err := r.db.ExecContext(ctx, `
+        DELETE FROM menu_items WHERE id = $1 AND location_id = $2`, id, models.LocationIDFromContext(ctx))
 	if err != nil {
 		return fmt.Errorf("delete menu item: %w", err)
 	}
@@ -292,3 +421,735 @@ func (r *menuRepository) DeleteMenuItem(ctx context.Context, id int) error {
 
 	return nil
 }
+
+// GetMenuAvailability returns whether one unit of each menu item can be made from current stock,
+// by menu item ID
+func (r *menuRepository) GetMenuAvailability(ctx context.Context) (map[int]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, `+menuItemAvailableSQL+`
+        FROM menu_items
+        WHERE location_id = $1`, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query menu availability: %w", err)
+	}
+	defer rows.Close()
+
+	availability := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		var available bool
+		if err := rows.Scan(&id, &available); err != nil {
+			return nil, fmt.Errorf("failed to scan menu availability: %w", err)
+		}
+		availability[id] = available
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning menu availability: %w", err)
+	}
+
+	return availability, nil
+}
+
+// GetUnavailableMenuItems returns active menu items for which at least one
+// tracked ingredient has less stock than a single serving requires
+func (r *menuRepository) GetUnavailableMenuItems(ctx context.Context) ([]models.UnavailableMenuItem, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT mi.id, mi.name, i.id, i.name, mii.quantity, i.quantity
+        FROM menu_items mi
+        JOIN menu_item_ingredients mii ON mii.menu_item_id = mi.id
+        JOIN inventory i ON i.id = mii.ingredient_id
+        WHERE mi.is_active
+        AND NOT i.unlimited
+        AND i.quantity < mii.quantity
+        AND mi.location_id = $1
+        ORDER BY mi.id, i.id`, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unavailable menu items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.UnavailableMenuItem{}
+	itemIndex := make(map[int]int)
+	for rows.Next() {
+		var menuItemID int
+		var menuItemName string
+		var shortfall models.IngredientShortfall
+		if err := rows.Scan(
+			&menuItemID,
+			&menuItemName,
+			&shortfall.IngredientID,
+			&shortfall.Name,
+			&shortfall.Required,
+			&shortfall.Available,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan unavailable menu item: %w", err)
+		}
+		shortfall.Shortfall = shortfall.Required - shortfall.Available
+
+		idx, ok := itemIndex[menuItemID]
+		if !ok {
+			idx = len(items)
+			itemIndex[menuItemID] = idx
+			items = append(items, models.UnavailableMenuItem{MenuItemID: menuItemID, Name: menuItemName})
+		}
+		items[idx].LimitingIngredients = append(items[idx].LimitingIngredients, shortfall)
+		if missing := shortfall.Shortfall / shortfall.Required; missing > items[idx].MissingFraction {
+			items[idx].MissingFraction = missing
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning unavailable menu items: %w", err)
+	}
+
+	return items, nil
+}
+
+// ApplySeasonWindows activates seasonal menu items whose window contains today and
+// deactivates those outside it, returning the items whose state changed
+func (r *menuRepository) ApplySeasonWindows(ctx context.Context, today time.Time) ([]models.SeasonalChange, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH seasonal AS (
+            SELECT 
+                id,
+                (season_start IS NULL OR season_start <= $1::date)
+                AND (season_end IS NULL OR $1::date <= season_end) AS in_season
+            FROM menu_items
+            WHERE season_start IS NOT NULL OR season_end IS NOT NULL
+        )
+        UPDATE menu_items mi
+        SET is_active = s.in_season,
+            updated_at = NOW()
+        FROM seasonal s
+        WHERE mi.id = s.id
+        AND mi.is_active IS DISTINCT FROM s.in_season
+        RETURNING mi.id, mi.name, mi.is_active`, today.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply season windows: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []models.SeasonalChange
+	for rows.Next() {
+		var change models.SeasonalChange
+		if err := rows.Scan(&change.MenuItemID, &change.Name, &change.IsActive); err != nil {
+			return nil, fmt.Errorf("failed to scan seasonal change: %w", err)
+		}
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning seasonal changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// GetIngredientTree returns the ingredients of a menu item with their current stock status
+func (r *menuRepository) GetIngredientTree(ctx context.Context, menuItemID int) ([]models.IngredientTreeNode, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            i.id,
+            i.name,
+            mii.quantity,
+            i.unit,
+            i.quantity,
+            i.reorder_level,
+            i.unlimited,
+            NOT i.unlimited AND i.quantity < i.reorder_level AS below_reorder
+        FROM menu_item_ingredients mii
+        JOIN menu_items m ON m.id = mii.menu_item_id
+        JOIN inventory i ON i.id = mii.ingredient_id
+        WHERE mii.menu_item_id = $1
+        AND m.location_id = $2
+        ORDER BY i.name`, menuItemID, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingredient tree: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := []models.IngredientTreeNode{}
+	for rows.Next() {
+		var node models.IngredientTreeNode
+		if err := rows.Scan(
+			&node.IngredientID,
+			&node.Name,
+			&node.Quantity,
+			&node.Unit,
+			&node.Stock,
+			&node.ReorderLevel,
+			&node.Unlimited,
+			&node.BelowReorder,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan ingredient tree node: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning ingredient tree: %w", err)
+	}
+
+	return nodes, nil
+}
+
+// GetItemSales returns the quantity sold and revenue of a menu item in non-cancelled orders of the last days
+func (r *menuRepository) GetItemSales(ctx context.Context, menuItemID int, days int) (int, models.Money, error) {
+	var quantity int
+	var revenue models.Money
+	err := r.db.QueryRowContext(ctx, `
+        SELECT 
+            COALESCE(SUM(oi.quantity), 0),
+            COALESCE(SUM(oi.quantity * oi.price_at_order), 0)
+        FROM order_items oi
+        JOIN orders o ON o.id = oi.order_id
+        WHERE oi.menu_item_id = $1
+        AND o.status <> 'cancelled'
+        AND o.created_at >= NOW() - make_interval(days => $2)
+        AND o.location_id = $3`,
+		menuItemID, days, models.LocationIDFromContext(ctx),
+	).Scan(&quantity, &revenue)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get menu item sales: %w", err)
+	}
+
+	return quantity, revenue, nil
+}
+
+// GetRemovalImpact returns the recent non-cancelled sales of a menu item over the last days, the open
+// orders containing it and the ingredients no other active menu item uses. Name and Days are left to the caller.
+func (r *menuRepository) GetRemovalImpact(ctx context.Context, menuItemID int, days int) (models.RemovalImpactResponse, error) {
+	impact := models.RemovalImpactResponse{MenuItemID: menuItemID, UnusedIngredients: []models.UnusedIngredient{}}
+
+	var openOrderIDs []int64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT 
+            COUNT(DISTINCT o.id) FILTER (WHERE o.status <> 'cancelled' AND o.created_at >= NOW() - make_interval(days => $2)),
+            COALESCE(SUM(oi.quantity) FILTER (WHERE o.status <> 'cancelled' AND o.created_at >= NOW() - make_interval(days => $2)), 0),
+            COALESCE(SUM(oi.quantity * oi.price_at_order) FILTER (WHERE o.status <> 'cancelled' AND o.created_at >= NOW() - make_interval(days => $2)), 0),
+            COALESCE(array_agg(DISTINCT o.id) FILTER (WHERE o.status NOT IN ('delivered', 'cancelled')), '{}')
+        FROM order_items oi
+        JOIN orders o ON o.id = oi.order_id
+        WHERE oi.menu_item_id = $1
+        AND o.location_id = $3`, menuItemID, days, models.LocationIDFromContext(ctx),
+	).Scan(&impact.RecentOrderCount, &impact.RecentQuantity, &impact.RecentRevenue, pq.Array(&openOrderIDs))
+	if err != nil {
+		return models.RemovalImpactResponse{}, fmt.Errorf("failed to get menu item orders: %w", err)
+	}
+	impact.OpenOrderIDs = make([]int, len(openOrderIDs))
+	for i, id := range openOrderIDs {
+		impact.OpenOrderIDs[i] = int(id)
+	}
+	impact.Blocked = len(impact.OpenOrderIDs) > 0
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT i.id, i.name
+        FROM menu_item_ingredients mii
+        JOIN inventory i ON i.id = mii.ingredient_id
+        WHERE mii.menu_item_id = $1
+        AND i.location_id = $2
+        AND NOT EXISTS (
+            SELECT 1 
+            FROM menu_item_ingredients other
+            JOIN menu_items m ON m.id = other.menu_item_id
+            WHERE other.ingredient_id = mii.ingredient_id
+            AND other.menu_item_id <> $1
+            AND m.is_active
+        )
+        ORDER BY i.id`, menuItemID, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return models.RemovalImpactResponse{}, fmt.Errorf("failed to get unused ingredients: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ingredient models.UnusedIngredient
+		if err := rows.Scan(&ingredient.IngredientID, &ingredient.Name); err != nil {
+			return models.RemovalImpactResponse{}, fmt.Errorf("failed to scan unused ingredient: %w", err)
+		}
+		impact.UnusedIngredients = append(impact.UnusedIngredients, ingredient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.RemovalImpactResponse{}, fmt.Errorf("error after scanning unused ingredients: %w", err)
+	}
+
+	return impact, nil
+}
+
+// GetUnitCost returns the production cost of one menu item at current ingredient costs.
+// known is false if the item has no ingredients or uses an ingredient without a cost.
+func (r *menuRepository) GetUnitCost(ctx context.Context, menuItemID int) (float64, bool, error) {
+	var cost float64
+	var known sql.NullBool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT 
+            COALESCE(SUM(mii.quantity * i.cost_per_unit), 0),
+            COUNT(*) > 0 AND bool_and(i.cost_per_unit IS NOT NULL)
+        FROM menu_item_ingredients mii
+        JOIN menu_items m ON m.id = mii.menu_item_id
+        JOIN inventory i ON i.id = mii.ingredient_id
+        WHERE mii.menu_item_id = $1
+        AND m.location_id = $2`, menuItemID, models.LocationIDFromContext(ctx)).Scan(&cost, &known)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get unit cost: %w", err)
+	}
+
+	return cost, known.Bool, nil
+}
+
+// GetMenuItemsWithoutRecipe returns active menu items that have no menu_item_ingredients rows
+func (r *menuRepository) GetMenuItemsWithoutRecipe(ctx context.Context) ([]models.MenuItemWithoutRecipe, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT mi.id, mi.name, mi.price, mi.created_at
+        FROM menu_items mi
+        WHERE mi.is_active
+        AND mi.location_id = $1
+        AND NOT EXISTS (
+            SELECT 1 FROM menu_item_ingredients mii WHERE mii.menu_item_id = mi.id
+        )
+        ORDER BY mi.id`, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get menu items without recipe: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.MenuItemWithoutRecipe{}
+	for rows.Next() {
+		var item models.MenuItemWithoutRecipe
+		if err := rows.Scan(&item.MenuItemID, &item.Name, &item.Price, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan menu item without recipe: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning menu items without recipe: %w", err)
+	}
+
+	return items, nil
+}
+
+// RewriteCategories replaces the categories of every menu item of the location with rewrite's result in a single
+// transaction, returning how many items changed
+func (r *menuRepository) RewriteCategories(ctx context.Context, rewrite func(categories []string) []string) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, category FROM menu_items 
+        WHERE location_id = $1 
+        ORDER BY id FOR UPDATE`, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get menu item categories: %w", err)
+	}
+
+	updates := make(map[int][]string)
+	var ids []int
+	for rows.Next() {
+		var id int
+		var categories []string
+		if err := rows.Scan(&id, pq.Array(&categories)); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan menu item categories: %w", err)
+		}
+
+		rewritten := rewrite(categories)
+		if !equalStrings(categories, rewritten) {
+			updates[id] = rewritten
+			ids = append(ids, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("error after scanning menu item categories: %w", err)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		_, err := tx.ExecContext(ctx, `
+            UPDATE menu_items SET category = $1, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $2`,
+			pq.Array(updates[id]), id,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update categories of menu item %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(ids), nil
+}
+
+// BulkAssignIngredient adds the ingredient to the recipes of the menu items that don't use it yet, in one
+// transaction, and returns the ids of the menu items it was added to
+func (r *menuRepository) BulkAssignIngredient(ctx context.Context, ingredientID int, quantity float64, menuItemIDs []int) ([]int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkRecipeIngredients(ctx, tx, []models.MenuItemIngredients{{IngredientID: ingredientID}}); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(menuItemIDs))
+	for i, id := range menuItemIDs {
+		ids[i] = int64(id)
+	}
+
+	var missing []int64
+	err = tx.QueryRowContext(ctx, `
+        SELECT COALESCE(array_agg(DISTINCT wanted.id ORDER BY wanted.id), '{}')
+        FROM unnest($1::int[]) AS wanted(id)
+        LEFT JOIN menu_items m ON m.id = wanted.id AND m.location_id = $2
+        WHERE m.id IS NULL`, pq.Array(ids), models.LocationIDFromContext(ctx)).Scan(pq.Array(&missing))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check menu items: %w", err)
+	}
+	if len(missing) > 0 {
+		names := make([]string, len(missing))
+		for i, id := range missing {
+			names[i] = strconv.FormatInt(id, 10)
+		}
+		return nil, fmt.Errorf("%w: menu_item_id %s", models.ErrMenuItemNotFound, strings.Join(names, ", "))
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+        INSERT INTO menu_item_ingredients (menu_item_id, ingredient_id, quantity)
+        SELECT DISTINCT wanted.id, $2::int, $3::numeric
+        FROM unnest($1::int[]) AS wanted(id)
+        ON CONFLICT (menu_item_id, ingredient_id) DO NOTHING
+        RETURNING menu_item_id`, pq.Array(ids), ingredientID, quantity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign ingredient: %w", err)
+	}
+	defer rows.Close()
+
+	var assigned []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan assigned menu item: %w", err)
+		}
+		assigned = append(assigned, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning assigned menu items: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return assigned, nil
+}
+
+// checkRecipeIngredients makes sure every ingredient of a recipe exists in the inventory of the
+// request's location, naming the ones that don't
+func checkRecipeIngredients(ctx context.Context, tx *sql.Tx, ingredients []models.MenuItemIngredients) error {
+	if len(ingredients) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		ids = append(ids, int64(ingredient.IngredientID))
+	}
+
+	var missing []int64
+	err := tx.QueryRowContext(ctx, `
+        SELECT COALESCE(array_agg(DISTINCT wanted.id ORDER BY wanted.id), '{}')
+        FROM unnest($1::int[]) AS wanted(id)
+        LEFT JOIN inventory i ON i.id = wanted.id AND i.location_id = $2
+        WHERE i.id IS NULL`, pq.Array(ids), models.LocationIDFromContext(ctx)).Scan(pq.Array(&missing))
+	if err != nil {
+		return fmt.Errorf("failed to check recipe ingredients: %w", err)
+	}
+	if len(missing) > 0 {
+		names := make([]string, len(missing))
+		for i, id := range missing {
+			names[i] = strconv.FormatInt(id, 10)
+		}
+		return fmt.Errorf("%w: ingredient_id %s", models.ErrIngredientNotFound, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// nullableDate stores an empty YYYY-MM-DD string as NULL
+func nullableDate(date string) interface{} {
+	if date == "" {
+		return nil
+	}
+	return date
+}
+
+func formatNullDate(date sql.NullTime) string {
+	if !date.Valid {
+		return ""
+	}
+	return date.Time.Format("2006-01-02")
+}
+
+// GetPriceHistory returns the price changes of a menu item, newest first, or
+// models.ErrMenuItemNotFound if the menu item doesn't exist
+func (r *menuRepository) GetPriceHistory(ctx context.Context, menuItemID int) ([]models.PriceHistory, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM menu_items WHERE id = $1 AND location_id = $2)`,
+		menuItemID, models.LocationIDFromContext(ctx)).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check menu item: %w", err)
+	}
+	if !exists {
+		return nil, models.ErrMenuItemNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, menu_item_id, old_price, new_price, changed_at
+        FROM price_history
+        WHERE menu_item_id = $1
+        ORDER BY changed_at DESC, id DESC`, menuItemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []models.PriceHistory{}
+	for rows.Next() {
+		var change models.PriceHistory
+		if err := rows.Scan(&change.ID, &change.MenuItemID, &change.OldPrice, &change.NewPrice, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan price change: %w", err)
+		}
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning price history: %w", err)
+	}
+
+	return history, nil
+}
+
+// GetModifierGroups returns the modifier groups of a menu item with their modifiers, or sql.ErrNoRows
+// if the menu item doesn't exist
+func (r *menuRepository) GetModifierGroups(ctx context.Context, menuItemID int) ([]models.ModifierGroup, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM menu_items WHERE id = $1 AND location_id = $2)`,
+		menuItemID, models.LocationIDFromContext(ctx)).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check menu item: %w", err)
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	groups, err := loadModifierGroups(ctx, r.db, []int64{int64(menuItemID)})
+	if err != nil {
+		return nil, err
+	}
+	return groups[menuItemID], nil
+}
+
+func (r *menuRepository) CreateModifierGroup(ctx context.Context, group models.ModifierGroup) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM menu_items WHERE id = $1 AND location_id = $2)`,
+		group.MenuItemID, models.LocationIDFromContext(ctx)).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check menu item: %w", err)
+	}
+	if !exists {
+		return 0, sql.ErrNoRows
+	}
+	if err := checkModifierGroupName(ctx, tx, group); err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO modifier_groups (menu_item_id, name, required)
+        VALUES ($1, $2, $3)
+        RETURNING id`, group.MenuItemID, group.Name, group.Required).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create modifier group: %w", err)
+	}
+
+	if err := insertModifiers(ctx, tx, id, group.Modifiers); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return id, nil
+}
+
+// UpdateModifierGroup renames a modifier group and replaces its modifiers
+func (r *menuRepository) UpdateModifierGroup(ctx context.Context, group models.ModifierGroup) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkModifierGroupName(ctx, tx, group); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+        UPDATE modifier_groups g
+        SET name = $1, required = $2
+        FROM menu_items m
+        WHERE g.id = $3 AND g.menu_item_id = $4
+        AND m.id = g.menu_item_id AND m.location_id = $5`,
+		group.Name, group.Required, group.ID, group.MenuItemID, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to update modifier group: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return models.ErrModifierGroupNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM modifiers WHERE group_id = $1`, group.ID); err != nil {
+		return fmt.Errorf("failed to clear modifiers: %w", err)
+	}
+	if err := insertModifiers(ctx, tx, group.ID, group.Modifiers); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *menuRepository) DeleteModifierGroup(ctx context.Context, menuItemID, groupID int) error {
+	result, err := r.db.ExecContext(ctx, `
+        DELETE FROM modifier_groups g
+        USING menu_items m
+        WHERE g.id = $1 AND g.menu_item_id = $2
+        AND m.id = g.menu_item_id AND m.location_id = $3`,
+		groupID, menuItemID, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to delete modifier group: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return models.ErrModifierGroupNotFound
+	}
+	return nil
+}
+
+// checkModifierGroupName rejects a group whose name is already used by another group of the menu
+// item; names are matched case-insensitively like customization keys are
+func checkModifierGroupName(ctx context.Context, tx *sql.Tx, group models.ModifierGroup) error {
+	var taken bool
+	err := tx.QueryRowContext(ctx, `
+        SELECT EXISTS(
+            SELECT 1 FROM modifier_groups
+            WHERE menu_item_id = $1 AND lower(name) = lower($2) AND id <> $3
+        )`, group.MenuItemID, group.Name, group.ID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("failed to check modifier group name: %w", err)
+	}
+	if taken {
+		return fmt.Errorf("%w: menu item already has a %q group", models.ErrInvalidModifierGroup, group.Name)
+	}
+	return nil
+}
+
+func insertModifiers(ctx context.Context, tx *sql.Tx, groupID int, modifiers []models.Modifier) error {
+	for _, modifier := range modifiers {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO modifiers (group_id, name, price_delta)
+            VALUES ($1, $2, $3)`, groupID, modifier.Name, modifier.PriceDelta)
+		if err != nil {
+			return fmt.Errorf("failed to add modifier %q: %w", modifier.Name, err)
+		}
+	}
+	return nil
+}
+
+// loadModifierGroups returns the modifier groups of several menu items keyed by menu item id
+func loadModifierGroups(ctx context.Context, db *sql.DB, menuItemIDs []int64) (map[int][]models.ModifierGroup, error) {
+	rows, err := db.QueryContext(ctx, `
+        SELECT g.menu_item_id, g.id, g.name, g.required, m.id, m.name, m.price_delta
+        FROM modifier_groups g
+        LEFT JOIN modifiers m ON m.group_id = g.id
+        WHERE g.menu_item_id = ANY($1)
+        ORDER BY g.menu_item_id, g.id, m.id`, pq.Array(menuItemIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get modifier groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[int][]models.ModifierGroup)
+	for rows.Next() {
+		var group models.ModifierGroup
+		var modifierID sql.NullInt64
+		var modifierName sql.NullString
+		var priceDelta sql.NullFloat64
+		if err := rows.Scan(
+			&group.MenuItemID,
+			&group.ID,
+			&group.Name,
+			&group.Required,
+			&modifierID,
+			&modifierName,
+			&priceDelta,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan modifier: %w", err)
+		}
+
+		itemGroups := groups[group.MenuItemID]
+		if len(itemGroups) == 0 || itemGroups[len(itemGroups)-1].ID != group.ID {
+			group.Modifiers = []models.Modifier{}
+			itemGroups = append(itemGroups, group)
+		}
+		if modifierID.Valid {
+			last := &itemGroups[len(itemGroups)-1]
+			last.Modifiers = append(last.Modifiers, models.Modifier{
+				ID:         int(modifierID.Int64),
+				Name:       modifierName.String,
+				PriceDelta: models.Money(priceDelta.Float64),
+			})
+		}
+		groups[group.MenuItemID] = itemGroups
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning modifiers: %w", err)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,527 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"frappuccino/internal/models"
+
+	"github.com/lib/pq"
+)
+
+func TestApplySeasonWindowsActivatesWhenWindowOpens(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	ctx := context.Background()
+
+	pumpkin := createTestMenuItem(t, db, models.DefaultLocationID, "test pumpkin spice latte", 4.50, nil)
+	if _, err := db.Exec(`
+        UPDATE menu_items SET season_start = '2031-09-01', season_end = '2031-11-30', is_active = FALSE
+        WHERE id = $1`, pumpkin); err != nil {
+		t.Fatalf("failed to set season window: %v", err)
+	}
+	// Other seasonal items follow the fake clock too; put them back in line with today
+	t.Cleanup(func() { repo.ApplySeasonWindows(ctx, time.Now()) })
+
+	isActive := func() bool {
+		t.Helper()
+		var active bool
+		if err := db.QueryRow(`SELECT is_active FROM menu_items WHERE id = $1`, pumpkin).Scan(&active); err != nil {
+			t.Fatalf("failed to get is_active: %v", err)
+		}
+		return active
+	}
+
+	// A fake clock walking across the opening and the closing of the window
+	steps := []struct {
+		today  time.Time
+		active bool
+	}{
+		{time.Date(2031, 8, 31, 23, 0, 0, 0, time.UTC), false},
+		{time.Date(2031, 9, 1, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2031, 11, 30, 12, 0, 0, 0, time.UTC), true},
+		{time.Date(2031, 12, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, step := range steps {
+		if _, err := repo.ApplySeasonWindows(ctx, step.today); err != nil {
+			t.Fatalf("ApplySeasonWindows(%s): %v", step.today.Format("2006-01-02"), err)
+		}
+		if active := isActive(); active != step.active {
+			t.Errorf("on %s is_active = %v, want %v", step.today.Format("2006-01-02"), active, step.active)
+		}
+	}
+}
+
+func TestUpdateMenuItemRollbackWritesNoPriceHistory(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, db, models.DefaultLocationID, "test price history latte", 3.50, nil)
+	var missingIngredient int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) + 1000 FROM inventory`).Scan(&missingIngredient); err != nil {
+		t.Fatalf("failed to pick a missing ingredient: %v", err)
+	}
+
+	priceChanges := func() int {
+		t.Helper()
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM price_history WHERE menu_item_id = $1`, latte).Scan(&count); err != nil {
+			t.Fatalf("failed to count price history: %v", err)
+		}
+		return count
+	}
+
+	// The price is updated before the missing ingredient fails the transaction
+	err := repo.UpdateMenuItem(ctx, latte, models.MenuItems{
+		Name:        "test price history latte",
+		Price:       4.00,
+		Category:    []string{"test"},
+		IsActive:    true,
+		Ingredients: []models.MenuItemIngredients{{IngredientID: missingIngredient, Quantity: 1}},
+	})
+	if !errors.Is(err, models.ErrIngredientNotFound) {
+		t.Fatalf("UpdateMenuItem error = %v, want ErrIngredientNotFound", err)
+	}
+	var price models.Money
+	if err := db.QueryRow(`SELECT price FROM menu_items WHERE id = $1`, latte).Scan(&price); err != nil {
+		t.Fatalf("failed to get price: %v", err)
+	}
+	if price != 3.50 {
+		t.Errorf("price = %v after the rollback, want the untouched 3.50", price)
+	}
+	if count := priceChanges(); count != 0 {
+		t.Errorf("%d price history rows after the rollback, want 0", count)
+	}
+
+	// A committed price change is recorded once
+	if err := repo.UpdateMenuItem(ctx, latte, models.MenuItems{
+		Name:     "test price history latte",
+		Price:    4.00,
+		Category: []string{"test"},
+		IsActive: true,
+	}); err != nil {
+		t.Fatalf("UpdateMenuItem: %v", err)
+	}
+	if count := priceChanges(); count != 1 {
+		t.Errorf("%d price history rows after the update, want 1", count)
+	}
+}
+
+func TestGetUnavailableMenuItemsListsLimitingIngredients(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "SHORT")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	milk := createTestIngredient(t, db, location, "test short milk", 50, false)
+	beans := createTestIngredient(t, db, location, "test short beans", 10, false)
+	sugar := createTestIngredient(t, db, location, "test short sugar", 1000, false)
+	water := createTestIngredient(t, db, location, "test short water", 0, true)
+	latte := createTestMenuItem(t, db, location, "test short latte", 4, map[int]float64{milk: 200, sugar: 5})
+	espresso := createTestMenuItem(t, db, location, "test short espresso", 2, map[int]float64{beans: 18, water: 30})
+	// Items that can be made are left out
+	createTestMenuItem(t, db, location, "test short tea", 2, map[int]float64{sugar: 5, water: 250})
+
+	items, err := repo.GetUnavailableMenuItems(ctx)
+	if err != nil {
+		t.Fatalf("GetUnavailableMenuItems: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("GetUnavailableMenuItems = %+v, want the latte and the espresso", items)
+	}
+	tests := []struct {
+		item       models.UnavailableMenuItem
+		menuItemID int
+		ingredient int
+		shortfall  float64
+	}{
+		{items[0], latte, milk, 150},
+		{items[1], espresso, beans, 8},
+	}
+	for _, tt := range tests {
+		limiting := tt.item.LimitingIngredients
+		if tt.item.MenuItemID != tt.menuItemID || len(limiting) != 1 ||
+			limiting[0].IngredientID != tt.ingredient || limiting[0].Shortfall != tt.shortfall {
+			t.Errorf("item = %+v, want menu item %d short %v of ingredient %d", tt.item, tt.menuItemID, tt.shortfall, tt.ingredient)
+		}
+	}
+}
+
+func TestGetIngredientTreeReportsStockStatus(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "TREE")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	beans := createTestIngredient(t, db, location, "test tree beans", 500, false)
+	milk := createTestIngredient(t, db, location, "test tree milk", 50, false)
+	water := createTestIngredient(t, db, location, "test tree water", 0, true)
+	for _, id := range []int{beans, milk, water} {
+		if _, err := db.Exec(`UPDATE inventory SET reorder_level = 100 WHERE id = $1`, id); err != nil {
+			t.Fatalf("failed to set reorder level: %v", err)
+		}
+	}
+	latte := createTestMenuItem(t, db, location, "test tree latte", 4, map[int]float64{beans: 18, milk: 200, water: 30})
+
+	nodes, err := repo.GetIngredientTree(ctx, latte)
+	if err != nil {
+		t.Fatalf("GetIngredientTree: %v", err)
+	}
+	// Unlimited ingredients are never below their reorder level
+	want := []models.IngredientTreeNode{
+		{IngredientID: beans, Name: "test tree beans", Quantity: 18, Unit: "ml", Stock: 500, ReorderLevel: 100},
+		{IngredientID: milk, Name: "test tree milk", Quantity: 200, Unit: "ml", Stock: 50, ReorderLevel: 100, BelowReorder: true},
+		{IngredientID: water, Name: "test tree water", Quantity: 30, Unit: "ml", Stock: 0, ReorderLevel: 100, Unlimited: true},
+	}
+	if len(nodes) != len(want) {
+		t.Fatalf("GetIngredientTree = %+v, want beans, milk and water", nodes)
+	}
+	for i, node := range nodes {
+		if node != want[i] {
+			t.Errorf("node %d = %+v, want %+v", i, node, want[i])
+		}
+	}
+}
+
+func TestGetItemSalesOverPeriod(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "WHATIF")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	latte := createTestMenuItem(t, db, location, "test whatif latte", 4, nil)
+	recent := createTestOrder(t, db, location, now.AddDate(0, 0, -3), 0)
+	createTestOrderItem(t, db, recent, latte, 10, 3.50)
+	repriced := createTestOrder(t, db, location, now.AddDate(0, 0, -1), 0)
+	createTestOrderItem(t, db, repriced, latte, 5, 4)
+	// Sales before the period and of cancelled orders don't count
+	old := createTestOrder(t, db, location, now.AddDate(0, 0, -45), 0)
+	createTestOrderItem(t, db, old, latte, 100, 3)
+	cancelled := createTestOrder(t, db, location, now.AddDate(0, 0, -1), 0)
+	createTestOrderItem(t, db, cancelled, latte, 100, 4)
+	setTestOrderStatus(t, db, cancelled, "cancelled")
+
+	quantity, revenue, err := repo.GetItemSales(ctx, latte, 30)
+	if err != nil {
+		t.Fatalf("GetItemSales: %v", err)
+	}
+	if quantity != 15 || revenue != 55 {
+		t.Errorf("GetItemSales = %d for %v, want 15 for 55", quantity, revenue)
+	}
+}
+
+func TestGetUnitCostFromRecipe(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "UNIT")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	// createTestIngredient prices at 0.01 per unit
+	milk := createTestIngredient(t, db, location, "test unit milk", 1000, false)
+	beans := createTestIngredient(t, db, location, "test unit beans", 1000, false)
+	latte := createTestMenuItem(t, db, location, "test unit latte", 4, map[int]float64{milk: 200, beans: 25})
+	tea := createTestMenuItem(t, db, location, "test unit tea", 2, nil)
+
+	cost, known, err := repo.GetUnitCost(ctx, latte)
+	if err != nil {
+		t.Fatalf("GetUnitCost: %v", err)
+	}
+	if !known || cost != 2.25 {
+		t.Errorf("GetUnitCost = %v, %v, want 2.25", cost, known)
+	}
+
+	if _, known, err := repo.GetUnitCost(ctx, tea); err != nil || known {
+		t.Errorf("GetUnitCost of an item without a recipe = known %v, %v, want unknown", known, err)
+	}
+}
+
+func TestRewriteCategoriesUpdatesChangedItems(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "CATS")
+	other := createTestLocation(t, db, "CATSO")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	latte := createTestMenuItem(t, db, location, "test categories latte", 4, nil)
+	tea := createTestMenuItem(t, db, location, "test categories tea", 2, nil)
+	elsewhere := createTestMenuItem(t, db, other, "test categories mocha", 5, nil)
+	for id, categories := range map[int]string{latte: `{Coffee," HOT "}`, tea: `{tea}`, elsewhere: `{Coffee}`} {
+		if _, err := db.Exec(`UPDATE menu_items SET category = $2 WHERE id = $1`, id, categories); err != nil {
+			t.Fatalf("failed to set categories: %v", err)
+		}
+	}
+
+	updated, err := repo.RewriteCategories(ctx, func(categories []string) []string {
+		lower := make([]string, len(categories))
+		for i, category := range categories {
+			lower[i] = strings.ToLower(strings.TrimSpace(category))
+		}
+		return lower
+	})
+	if err != nil {
+		t.Fatalf("RewriteCategories: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("RewriteCategories updated %d items, want only the latte", updated)
+	}
+
+	categories := func(id int) string {
+		t.Helper()
+		var category string
+		if err := db.QueryRow(`SELECT category::text FROM menu_items WHERE id = $1`, id).Scan(&category); err != nil {
+			t.Fatalf("failed to get categories: %v", err)
+		}
+		return category
+	}
+	if got := categories(latte); got != "{coffee,hot}" {
+		t.Errorf("latte categories = %s, want {coffee,hot}", got)
+	}
+	if got := categories(elsewhere); got != "{Coffee}" {
+		t.Errorf("other location's categories = %s, want them untouched", got)
+	}
+}
+
+func TestGetMenuItemsWithoutRecipeFlagsItemWithNoIngredients(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "NORECIPE")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	milk := createTestIngredient(t, db, location, "test norecipe milk", 1000, false)
+	createTestMenuItem(t, db, location, "test norecipe latte", 4, map[int]float64{milk: 200})
+	tea := createTestMenuItem(t, db, location, "test norecipe tea", 2, nil)
+	// Inactive items can't be ordered, so they aren't flagged
+	retired := createTestMenuItem(t, db, location, "test norecipe retired", 3, nil)
+	if _, err := db.Exec(`UPDATE menu_items SET is_active = FALSE WHERE id = $1`, retired); err != nil {
+		t.Fatalf("failed to deactivate menu item: %v", err)
+	}
+
+	items, err := repo.GetMenuItemsWithoutRecipe(ctx)
+	if err != nil {
+		t.Fatalf("GetMenuItemsWithoutRecipe: %v", err)
+	}
+	if len(items) != 1 || items[0].MenuItemID != tea || items[0].Name != "test norecipe tea" || items[0].Price != 2 {
+		t.Errorf("items = %+v, want only the tea", items)
+	}
+}
+
+func TestGetAllMenuLoadsIngredientsOfEveryItem(t *testing.T) {
+	db := openTestDB(t)
+	location := createTestLocation(t, db, "ALLMENU")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	milk := createTestIngredient(t, db, location, "test allmenu milk", 1000, false)
+	beans := createTestIngredient(t, db, location, "test allmenu beans", 1000, false)
+	cocoa := createTestIngredient(t, db, location, "test allmenu cocoa", 1000, false)
+	latte := createTestMenuItem(t, db, location, "test allmenu latte", 4, map[int]float64{milk: 200, beans: 18})
+	mocha := createTestMenuItem(t, db, location, "test allmenu mocha", 5, map[int]float64{milk: 150, beans: 18, cocoa: 20})
+	water := createTestMenuItem(t, db, location, "test allmenu water", 1, nil)
+
+	pqConnector, err := pq.NewConnector(os.Getenv("TEST_DATABASE_URL"))
+	if err != nil {
+		t.Fatalf("failed to create connector: %v", err)
+	}
+	connector := &countingConnector{Connector: pqConnector}
+	counted := sql.OpenDB(connector)
+	t.Cleanup(func() { counted.Close() })
+	repo := NewMenuRepository(counted)
+
+	items, warnings, err := repo.GetAllMenu(ctx)
+	if err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+
+	want := map[int][]models.MenuItemIngredients{
+		latte: {{IngredientID: milk, Quantity: 200}, {IngredientID: beans, Quantity: 18}},
+		mocha: {{IngredientID: milk, Quantity: 150}, {IngredientID: beans, Quantity: 18}, {IngredientID: cocoa, Quantity: 20}},
+		water: nil,
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d menu items, want %d", len(items), len(want))
+	}
+	for _, item := range items {
+		sort.Slice(item.Ingredients, func(i, j int) bool {
+			return item.Ingredients[i].IngredientID < item.Ingredients[j].IngredientID
+		})
+		sort.Slice(want[item.ID], func(i, j int) bool {
+			return want[item.ID][i].IngredientID < want[item.ID][j].IngredientID
+		})
+		if !reflect.DeepEqual(item.Ingredients, want[item.ID]) {
+			t.Errorf("%s ingredients = %+v, want %+v", item.Name, item.Ingredients, want[item.ID])
+		}
+	}
+	// One recipe query for all the items, besides the availability subquery of the menu query
+	if n := connector.count("WHERE menu_item_id ="); n != 1 {
+		t.Errorf("ran %d recipe queries, want 1", n)
+	}
+}
+
+func TestBulkAssignIngredientSkipsItemsUsingIt(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "BULK")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	oat := createTestIngredient(t, db, location, "test bulk oat milk", 1000, false)
+	latte := createTestMenuItem(t, db, location, "test bulk latte", 4, map[int]float64{oat: 180})
+	mocha := createTestMenuItem(t, db, location, "test bulk mocha", 5, nil)
+	chai := createTestMenuItem(t, db, location, "test bulk chai", 4, nil)
+
+	recipe := func(menuItemID int) []float64 {
+		t.Helper()
+		rows, err := db.Query(`
+            SELECT quantity FROM menu_item_ingredients
+            WHERE menu_item_id = $1 AND ingredient_id = $2`, menuItemID, oat)
+		if err != nil {
+			t.Fatalf("failed to get recipe: %v", err)
+		}
+		defer rows.Close()
+		var quantities []float64
+		for rows.Next() {
+			var quantity float64
+			if err := rows.Scan(&quantity); err != nil {
+				t.Fatalf("failed to scan recipe: %v", err)
+			}
+			quantities = append(quantities, quantity)
+		}
+		return quantities
+	}
+
+	// An unknown menu item fails the whole assignment
+	if _, err := repo.BulkAssignIngredient(ctx, oat, 200, []int{mocha, -1}); !errors.Is(err, models.ErrMenuItemNotFound) {
+		t.Errorf("BulkAssignIngredient with an unknown item error = %v, want ErrMenuItemNotFound", err)
+	}
+	if got := recipe(mocha); len(got) != 0 {
+		t.Errorf("mocha oat milk after a failed assignment = %v, want none", got)
+	}
+
+	assigned, err := repo.BulkAssignIngredient(ctx, oat, 200, []int{latte, mocha, chai, mocha})
+	if err != nil {
+		t.Fatalf("BulkAssignIngredient: %v", err)
+	}
+	sort.Ints(assigned)
+	if want := []int{mocha, chai}; !reflect.DeepEqual(assigned, want) {
+		t.Errorf("assigned = %v, want the mocha and chai only", assigned)
+	}
+	// The latte keeps its own quantity, and no item gets the ingredient twice
+	for id, want := range map[int]float64{latte: 180, mocha: 200, chai: 200} {
+		if got := recipe(id); len(got) != 1 || got[0] != want {
+			t.Errorf("menu item %d oat milk = %v, want one row of %v", id, got, want)
+		}
+	}
+}
+
+func TestGetMenuFilteredCombinesFilters(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "FILTER")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	item := func(name string, price models.Money, categories, description string, active bool) int {
+		t.Helper()
+		id := createTestMenuItem(t, db, location, name, price, nil)
+		if _, err := db.Exec(`
+            UPDATE menu_items SET category = $2, description = $3, is_active = $4 WHERE id = $1`,
+			id, categories, description, active); err != nil {
+			t.Fatalf("failed to set up menu item %s: %v", name, err)
+		}
+		return id
+	}
+	latte := item("test filter latte", 4, "{coffee,hot}", "Espresso with steamed milk", true)
+	iced := item("test filter iced latte", 5, "{coffee,cold}", "", true)
+	mocha := item("test filter mocha", 6, "{coffee,hot}", "", false)
+	chai := item("test filter chai", 4, "{tea,hot}", "Spiced tea with milk", true)
+	espresso := item("test filter espresso", 2.50, "{coffee}", "", true)
+
+	active, inactive := true, false
+	price := func(p float64) *float64 { return &p }
+	tests := []struct {
+		name    string
+		filters models.MenuFilters
+		want    []int
+	}{
+		{"no filters", models.MenuFilters{}, []int{latte, iced, mocha, chai, espresso}},
+		{"active coffee", models.MenuFilters{Category: "coffee", Active: &active}, []int{latte, iced, espresso}},
+		{"coffee in a price band", models.MenuFilters{Category: "coffee", MinPrice: price(3), MaxPrice: price(5)}, []int{latte, iced}},
+		{"active items mentioning milk", models.MenuFilters{Query: "milk", Active: &active}, []int{latte, chai}},
+		{"cold lattes in any case", models.MenuFilters{Query: "LATTE", Category: "cold"}, []int{iced}},
+		{"inactive", models.MenuFilters{Active: &inactive}, []int{mocha}},
+		{"wildcards match literally", models.MenuFilters{Query: "%"}, nil},
+	}
+	for _, tt := range tests {
+		items, _, err := repo.GetMenuFiltered(ctx, tt.filters)
+		if err != nil {
+			t.Fatalf("%s: GetMenuFiltered: %v", tt.name, err)
+		}
+		var got []int
+		for _, item := range items {
+			got = append(got, item.ID)
+		}
+		sort.Ints(got)
+		sort.Ints(tt.want)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: items = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetRemovalImpactFindsNewlyUnusedIngredient(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMenuRepository(db)
+	location := createTestLocation(t, db, "REMOVE")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	milk := createTestIngredient(t, db, location, "test remove milk", 1000, false)
+	syrup := createTestIngredient(t, db, location, "test remove truffle syrup", 1000, false)
+	cocoa := createTestIngredient(t, db, location, "test remove cocoa", 1000, false)
+	truffle := createTestMenuItem(t, db, location, "test remove truffle latte", 5, map[int]float64{milk: 200, syrup: 20, cocoa: 10})
+	createTestMenuItem(t, db, location, "test remove latte", 4, map[int]float64{milk: 200})
+	// Cocoa's only other item is retired, so it becomes unused as well
+	mocha := createTestMenuItem(t, db, location, "test remove mocha", 5, map[int]float64{milk: 150, cocoa: 20})
+	if _, err := db.Exec(`UPDATE menu_items SET is_active = FALSE WHERE id = $1`, mocha); err != nil {
+		t.Fatalf("failed to deactivate menu item: %v", err)
+	}
+
+	delivered := createTestOrder(t, db, location, now.AddDate(0, 0, -2), 10)
+	createTestOrderItem(t, db, delivered, truffle, 2, 5)
+	open := createTestOrder(t, db, location, now.Add(-10*time.Minute), 5)
+	createTestOrderItem(t, db, open, truffle, 1, 5)
+	setTestOrderStatus(t, db, open, "preparing")
+	// Old and cancelled sales don't count
+	old := createTestOrder(t, db, location, now.AddDate(0, 0, -60), 5)
+	createTestOrderItem(t, db, old, truffle, 1, 5)
+	cancelled := createTestOrder(t, db, location, now.AddDate(0, 0, -1), 50)
+	createTestOrderItem(t, db, cancelled, truffle, 10, 5)
+	setTestOrderStatus(t, db, cancelled, "cancelled")
+
+	impact, err := repo.GetRemovalImpact(ctx, truffle, 30)
+	if err != nil {
+		t.Fatalf("GetRemovalImpact: %v", err)
+	}
+	if impact.RecentOrderCount != 2 || impact.RecentQuantity != 3 || impact.RecentRevenue != 15 {
+		t.Errorf("recent sales = %d orders of %d for %v, want 2 orders of 3 for 15", impact.RecentOrderCount, impact.RecentQuantity, impact.RecentRevenue)
+	}
+	if !impact.Blocked || !reflect.DeepEqual(impact.OpenOrderIDs, []int{open}) {
+		t.Errorf("open orders = %v, blocked %v, want the preparing order blocking removal", impact.OpenOrderIDs, impact.Blocked)
+	}
+	var unused []int
+	for _, ingredient := range impact.UnusedIngredients {
+		unused = append(unused, ingredient.IngredientID)
+	}
+	if want := []int{syrup, cocoa}; !reflect.DeepEqual(unused, want) {
+		t.Errorf("unused ingredients = %+v, want the syrup and the cocoa", impact.UnusedIngredients)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"frappuccino/internal/models"
 
@@ -14,56 +16,96 @@ import (
 )
 
 type OrderRepository interface {
-	CreateOrder(ctx context.Context, order models.Order) (int, error)
+	CreateOrder(ctx context.Context, order models.Order, idempotencyKey string) (int, bool, error)
 	GetOrderByID(ctx context.Context, id int) (models.Order, error)
-	GetAllOrders(ctx context.Context, filters models.OrderFilters) ([]models.Order, error)
+	GetAllOrders(ctx context.Context, filters models.OrderFilters) (models.OrderListResponse, error)
 	UpdateOrder(ctx context.Context, id int, order models.Order) error
 	DeleteOrder(ctx context.Context, id int) error
 	CloseOrder(ctx context.Context, id int) error
+	UpdateOrderStatus(ctx context.Context, id int, status string) (models.OrderStatusResponse, error)
+	CancelOrder(ctx context.Context, id int) error
+	GetOrderStatusHistory(ctx context.Context, id int) ([]models.OrderStatusHistory, error)
+	GetOrderInventoryTransactions(ctx context.Context, id int) ([]models.InventoryTransaction, error)
 	GetNumberOfOrderedItems(ctx context.Context, startDate, endDate string) (map[string]int, error)
 	BatchProcessOrders(ctx context.Context, orders []models.Order) (models.BatchOrderResponse, error)
+	CheckBatchFeasibility(ctx context.Context, orders []models.Order) (models.BatchFeasibilityResponse, error)
+	GetStaleOrders(ctx context.Context, status string, olderThan time.Duration) ([]models.Order, error)
+	GetOrdersByIDs(ctx context.Context, ids []int) ([]models.Order, error)
+	BulkUpdateStatus(ctx context.Context, status string, filters models.OrderFilters) (models.BulkStatusResponse, error)
+	GetQueuePosition(ctx context.Context, id int, defaultPrepMinutes float64) (models.QueueETAResponse, error)
 }
 
 type orderRepository struct {
 	*Repository
+	rounding    UsageRounding
+	deductOn    string // DeductOnCreate or DeductOnPrepare
+	autoReorder bool   // Raise reorder requests for ingredients orders take below their reorder level
 }
 
-func NewOrderRepository(db *sql.DB) OrderRepository {
-	return &orderRepository{NewRepository(db)}
+// NewOrderRepository creates an order repository that rounds ingredient usage with rounding and
+// deducts inventory when orders are created, or with DeductOnPrepare when they move to preparing.
+// With autoReorder, deductions that leave an ingredient below its reorder level raise a reorder request.
+func NewOrderRepository(db *sql.DB, rounding UsageRounding, deductOn string, autoReorder bool) OrderRepository {
+	return &orderRepository{Repository: NewRepository(db), rounding: rounding, deductOn: deductOn, autoReorder: autoReorder}
 }
 
-func (r *orderRepository) CreateOrder(ctx context.Context, order models.Order) (int, error) {
+// idempotencyKeyTTL is how long a repeated Idempotency-Key returns the order it first created
+const idempotencyKeyTTL = 24 * time.Hour
+
+// CreateOrder inserts an order and deducts its ingredients, unless deduction waits for preparing. With a non-empty idempotencyKey an order
+// created under the same key within idempotencyKeyTTL is returned instead, with replayed set.
+func (r *orderRepository) CreateOrder(ctx context.Context, order models.Order, idempotencyKey string) (int, bool, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// 1. Check inventory availability first
-	for _, item := range order.Items {
-		var sufficient bool
-		err := tx.QueryRowContext(ctx, `
-            SELECT (i.quantity >= (mi.quantity * $1)) 
-            FROM menu_item_ingredients mi
-            JOIN inventory i ON mi.ingredient_id = i.id
-            WHERE mi.menu_item_id = $2`,
-			item.Quantity, item.MenuItemID,
-		).Scan(&sufficient)
+	if idempotencyKey != "" {
+		// Requests with the same key wait for each other, so a retry racing the original sees its order
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, idempotencyKey); err != nil {
+			return 0, false, fmt.Errorf("failed to lock idempotency key: %w", err)
+		}
 
-		if err != nil || !sufficient {
-			return 0, fmt.Errorf("insufficient inventory for menu item %d: %w",
-				item.MenuItemID, err)
+		var existingID int
+		err := tx.QueryRowContext(ctx, `
+            SELECT order_id FROM idempotency_keys
+            WHERE key = $1 AND created_at > NOW() - make_interval(secs => $2)`,
+			idempotencyKey, idempotencyKeyTTL.Seconds(),
+		).Scan(&existingID)
+		if err == nil {
+			return existingID, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, false, fmt.Errorf("failed to check idempotency key: %w", err)
 		}
 	}
 
+	// Orders must belong to an existing, active customer unless they are guest orders
+	customerID, err := orderCustomer(ctx, tx, order.CustomerID)
+	if err != nil {
+		return 0, false, err
+	}
+
 	// Calculate total price based on items
 	totalPrice, err := r.calculateOrderTotal(ctx, order.Items)
+	if errors.Is(err, models.ErrMenuItemUnavailable) || errors.Is(err, models.ErrInvalidModifier) || errors.Is(err, models.ErrInvalidMenuItemID) {
+		return 0, false, err
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to calculate order total: %w", err)
+		return 0, false, fmt.Errorf("failed to calculate order total: %w", err)
+	}
+	// The client's total_price is ignored, the computed total is the one that must be positive
+	if totalPrice <= 0 {
+		return 0, false, models.ErrInvalidTotalPrice
 	}
-	order.TotalPrice = totalPrice
+	// The discount can take the total down to zero but not below
+	if order.DiscountAmount < 0 || order.DiscountAmount > totalPrice {
+		return 0, false, models.ErrInvalidDiscount
+	}
+	order.TotalPrice = totalPrice - order.DiscountAmount
 
-	// 2. Insert order
+	// 1. Insert order
 
 	var id int
 	var special_instructions interface{} = nil
@@ -74,79 +116,620 @@ func (r *orderRepository) CreateOrder(ctx context.Context, order models.Order) (
 	if len(order.PaymentMethod) > 0 {
 		paymentMethod = order.PaymentMethod
 	}
+	// Order codes are prefixed with the code of the order's location
+	var locationCode string
 	err = tx.QueryRowContext(ctx, `
-		INSERT INTO orders (customer_id, payment_method, total_price, special_instructions) 
-		VALUES ($1, $2, $3, $4)
+        SELECT code FROM locations WHERE id = $1`, models.LocationIDFromContext(ctx)).Scan(&locationCode)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get location code: %w", err)
+	}
+	orderCode, err := nextOrderCode(ctx, tx, locationCode)
+	if err != nil {
+		return 0, false, err
+	}
+	deductNow := r.deductOn != DeductOnPrepare
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO orders (customer_id, payment_method, total_price, discount_amount, special_instructions, location_code, order_code, location_id, inventory_deducted) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id`,
-		order.CustomerID, paymentMethod, order.TotalPrice, special_instructions,
+		customerID, paymentMethod, order.TotalPrice, order.DiscountAmount, special_instructions, locationCode, orderCode,
+		models.LocationIDFromContext(ctx), deductNow,
 	).Scan(&id)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create order: %w", err)
+		return 0, false, fmt.Errorf("failed to create order: %w", err)
 	}
 
-	// 3. Insert order items
+	// 2. Insert order items
 	for _, item := range order.Items {
 		var customizations interface{} = nil
 		if len(item.Customizations) > 0 {
 			customizations = item.Customizations
 		}
 		_, err := tx.ExecContext(ctx, `
-			INSERT INTO order_items (order_id, menu_item_id, quantity, price_at_order, customizations)
-			VALUES ($1, $2, $3, $4, $5)`,
-			id, item.MenuItemID, item.Quantity, item.PriceAtOrder, customizations,
+			INSERT INTO order_items (order_id, menu_item_id, quantity, price_at_order, modifier_delta, customizations)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			id, item.MenuItemID, item.Quantity, item.PriceAtOrder, item.ModifierDelta, customizations,
 		)
 		if err != nil {
-			return 0, fmt.Errorf("failed to add order item: %w", err)
+			return 0, false, fmt.Errorf("failed to add order item: %w", err)
 		}
 	}
 
-	// 4. Deduct inventory
-	for _, item := range order.Items {
+	// 3. Deduct inventory
+	if deductNow {
+		if err := r.deductOrderInventory(ctx, tx, id, order.Items); err != nil {
+			return 0, false, err
+		}
+	}
+
+	if idempotencyKey != "" {
+		// An expired key is taken over by the new order
 		_, err = tx.ExecContext(ctx, `
-            WITH ingredients AS (
-                SELECT ingredient_id, quantity 
-                FROM menu_item_ingredients 
-                WHERE menu_item_id = $1
-            )
-            UPDATE inventory i
-            SET quantity = i.quantity - (ing.quantity * $2)
-            FROM ingredients ing
-            WHERE i.id = ing.ingredient_id`,
-			item.MenuItemID, item.Quantity,
+            INSERT INTO idempotency_keys (key, order_id) VALUES ($1, $2)
+            ON CONFLICT (key) DO UPDATE SET order_id = EXCLUDED.order_id, created_at = NOW()`,
+			idempotencyKey, id,
 		)
 		if err != nil {
-			return 0, fmt.Errorf("failed to deduct ingredient from inventory: %w", err)
+			return 0, false, fmt.Errorf("failed to save idempotency key: %w", err)
 		}
 	}
 
-	// 5. Record inventory transactions
-	for _, item := range order.Items {
-		_, err = tx.ExecContext(ctx, `
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return id, false, nil
+}
+
+// deductOrderInventory deducts the ingredients of an order's items and records the usage as inventory
+// transactions. Availability is checked in the same statement as the deduction so concurrent orders
+// can't both pass a check and drive stock negative; on error the caller's transaction must be rolled back.
+func (r *orderRepository) deductOrderInventory(ctx context.Context, tx *sql.Tx, orderID int, items []models.OrderItem) error {
+	for _, item := range items {
+		if err := r.deductIngredients(ctx, tx, item); err != nil {
+			return err
+		}
+	}
+
+	// A failure here rolls back the deductions above with the rest of the transaction
+	for _, item := range items {
+		_, err := tx.ExecContext(ctx, `
             WITH ingredients AS (
-                SELECT ingredient_id, quantity 
-                FROM menu_item_ingredients 
-                WHERE menu_item_id = $1
+                SELECT mi.ingredient_id, mi.quantity 
+                FROM menu_item_ingredients mi
+                JOIN inventory i ON mi.ingredient_id = i.id
+                JOIN menu_items m ON m.id = mi.menu_item_id
+                WHERE mi.menu_item_id = $1 AND NOT i.unlimited AND NOT m.stock_tracked
             )
             INSERT INTO inventory_transactions
                 (ingredient_id, delta, transaction_type, reference_id)
             SELECT 
                 ingredient_id, 
-                -(quantity * $2), 
+                -`+r.rounding.sql("quantity * $2")+`, 
                 'order_usage', 
                 $3
             FROM ingredients`,
-			item.MenuItemID, item.Quantity, id,
+			item.MenuItemID, item.Quantity, orderID,
 		)
 		if err != nil {
-			return 0, fmt.Errorf("failed to record inventory transaction: %w", err)
+			return fmt.Errorf("%w: menu item %d: %w", models.ErrInventoryTransaction, item.MenuItemID, err)
+		}
+	}
+
+	if r.autoReorder {
+		return r.requestReorders(ctx, tx, orderID, items)
+	}
+	return nil
+}
+
+// requestReorders raises a reorder request for every ingredient of the items that is now below its
+// reorder level, unless the ingredient already has an open request
+func (r *orderRepository) requestReorders(ctx context.Context, tx *sql.Tx, orderID int, items []models.OrderItem) error {
+	menuItemIDs := make([]int64, len(items))
+	for i, item := range items {
+		menuItemIDs[i] = int64(item.MenuItemID)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO reorder_requests (ingredient_id, quantity, reorder_level, order_id)
+        SELECT i.id, i.quantity, i.reorder_level, $2
+        FROM inventory i
+        WHERE i.id IN (
+            SELECT mii.ingredient_id
+            FROM menu_item_ingredients mii
+            JOIN menu_items m ON m.id = mii.menu_item_id
+            WHERE mii.menu_item_id = ANY($1) AND NOT m.stock_tracked
+        )
+        AND NOT i.unlimited
+        AND i.quantity < i.reorder_level
+        ON CONFLICT (ingredient_id) WHERE status = 'open' DO NOTHING`,
+		pq.Array(menuItemIDs), orderID)
+	if err != nil {
+		return fmt.Errorf("failed to request reorders: %w", err)
+	}
+	return nil
+}
+
+// deductDeferredInventory deducts the inventory of an order created while deduction waits for
+// preparing; it does nothing for an order whose inventory is already deducted
+func (r *orderRepository) deductDeferredInventory(ctx context.Context, tx *sql.Tx, orderID int) error {
+	result, err := tx.ExecContext(ctx, `
+        UPDATE orders 
+        SET inventory_deducted = TRUE 
+        WHERE id = $1 AND NOT inventory_deducted`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to mark order inventory deducted: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to check deferred deduction: %w", err)
+	} else if updated == 0 {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT menu_item_id, quantity 
+        FROM order_items 
+        WHERE order_id = $1`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order items to deduct: %w", err)
+	}
+
+	var items []models.OrderItem
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.MenuItemID, &item.Quantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan order item: %w", err)
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error after scanning order items: %w", err)
+	}
+
+	return r.deductOrderInventory(ctx, tx, orderID, items)
+}
+
+// UpdateOrderStatus moves an order to status if the state machine allows it and records the change in history
+func (r *orderRepository) UpdateOrderStatus(ctx context.Context, id int, status string) (models.OrderStatusResponse, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.OrderStatusResponse{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 1. Lock the order and check the transition
+	var currentStatus string
+	err = tx.QueryRowContext(ctx, `
+        SELECT status FROM orders 
+        WHERE id = $1 AND location_id = $2 FOR UPDATE`, id, models.LocationIDFromContext(ctx)).Scan(&currentStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OrderStatusResponse{}, models.ErrOrderNotFound
+		}
+		return models.OrderStatusResponse{}, fmt.Errorf("failed to check order status: %w", err)
+	}
+
+	// 2. Move the order, recording the change and its inventory effects
+	if err := r.setOrderStatus(ctx, tx, id, currentStatus, status); err != nil {
+		return models.OrderStatusResponse{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.OrderStatusResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return models.OrderStatusResponse{
+		OrderID:        id,
+		PreviousStatus: currentStatus,
+		Status:         status,
+	}, nil
+}
+
+// setOrderStatus moves an order locked by the caller from currentStatus to status if the state machine
+// allows it and records the change in history. Cancelled orders give their ingredients back, orders
+// waiting for deferred deduction take them when preparing starts.
+func (r *orderRepository) setOrderStatus(ctx context.Context, tx *sql.Tx, id int, currentStatus, status string) error {
+	if !models.CanTransition(currentStatus, status) {
+		return fmt.Errorf("%w: order %d can not move from %s to %s",
+			models.ErrInvalidTransition, id, currentStatus, status)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        UPDATE orders 
+        SET status = $1, 
+            updated_at = NOW() 
+        WHERE id = $2`, status, id); err != nil {
+		return fmt.Errorf("failed to update order status: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+        INSERT INTO order_status_history (order_id, status) 
+        VALUES ($1, $2)`, id, status); err != nil {
+		return fmt.Errorf("failed to record status change: %w", err)
+	}
+
+	switch status {
+	case "cancelled":
+		return r.restoreOrderInventory(ctx, tx, id, "order_cancellation")
+	case "preparing":
+		return r.deductDeferredInventory(ctx, tx, id)
+	}
+	return nil
+}
+
+// CancelOrder cancels an order, keeping its record, and returns its ingredients to inventory
+func (r *orderRepository) CancelOrder(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 1. Lock the order and check it can still be cancelled
+	var currentStatus string
+	err = tx.QueryRowContext(ctx, `
+        SELECT status FROM orders 
+        WHERE id = $1 AND location_id = $2 FOR UPDATE`, id, models.LocationIDFromContext(ctx)).Scan(&currentStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrOrderNotFound
 		}
+		return fmt.Errorf("failed to check order status: %w", err)
+	}
+
+	if !models.CanTransition(currentStatus, "cancelled") {
+		return fmt.Errorf("%w: order %d is already %s", models.ErrInvalidTransition, id, currentStatus)
+	}
+
+	// 2. Cancel the order and restore its inventory
+	if err := r.setOrderStatus(ctx, tx, id, currentStatus, "cancelled"); err != nil {
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return id, nil
+	return nil
+}
+
+// restoreOrderInventory returns the ingredients of an order's items to inventory and records
+// the restored quantities as inventory transactions of the given type. Orders still waiting for
+// deferred deduction have nothing to restore.
+func (r *orderRepository) restoreOrderInventory(ctx context.Context, tx *sql.Tx, orderID int, transactionType string) error {
+	result, err := tx.ExecContext(ctx, `
+        UPDATE orders 
+        SET inventory_deducted = FALSE 
+        WHERE id = $1 AND inventory_deducted`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to mark order inventory restored: %w", err)
+	}
+	if restored, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to check order inventory: %w", err)
+	} else if restored == 0 {
+		return nil
+	}
+
+	// 1. Get all items first to restore inventory
+	var items []struct {
+		MenuItemID int
+		Quantity   int
+	}
+	rows, err := tx.QueryContext(ctx, `
+        SELECT menu_item_id, quantity 
+        FROM order_items 
+        WHERE order_id = $1`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order items to restore: %w", err)
+	}
+
+	for rows.Next() {
+		var item struct{ MenuItemID, Quantity int }
+		if err := rows.Scan(&item.MenuItemID, &item.Quantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan order item: %w", err)
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error after scanning order items: %w", err)
+	}
+
+	// 2. Restore inventory, or the item's own stock for stock tracked items
+	for _, item := range items {
+		_, err = tx.ExecContext(ctx, `
+            UPDATE menu_items 
+            SET stock_quantity = stock_quantity + $2 
+            WHERE id = $1 AND stock_tracked`, item.MenuItemID, item.Quantity)
+		if err != nil {
+			return fmt.Errorf("failed to restore menu item stock: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+            WITH ingredients AS (
+                SELECT mi.ingredient_id, mi.quantity 
+                FROM menu_item_ingredients mi
+                JOIN menu_items m ON m.id = mi.menu_item_id
+                WHERE mi.menu_item_id = $1 AND NOT m.stock_tracked
+            )
+            UPDATE inventory i
+            SET quantity = i.quantity + `+r.rounding.sql("ing.quantity * $2")+`
+            FROM ingredients ing
+            WHERE i.id = ing.ingredient_id AND NOT i.unlimited`,
+			item.MenuItemID, item.Quantity,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to restore inventory: %w", err)
+		}
+	}
+
+	// 3. Record inventory transactions (for restoring stock), noting how the order ended
+	ended := "cancelled"
+	if transactionType == "order_deletion" {
+		ended = "deleted"
+	}
+	for _, item := range items {
+		_, err = tx.ExecContext(ctx, `
+            WITH ingredients AS (
+                SELECT 
+                    mi.ingredient_id, 
+                    mi.quantity AS required_quantity
+                FROM menu_item_ingredients mi
+                JOIN inventory i ON mi.ingredient_id = i.id
+                JOIN menu_items m ON m.id = mi.menu_item_id
+                WHERE mi.menu_item_id = $1 AND NOT i.unlimited AND NOT m.stock_tracked
+            )
+            INSERT INTO inventory_transactions (
+                ingredient_id, 
+                delta, 
+                transaction_type, 
+                reference_id,
+                notes
+            )
+            SELECT 
+                ingredient_id,
+                `+r.rounding.sql("required_quantity * $2::numeric")+`,
+                $4::transaction_type,
+                $3::integer,                        -- Explicit cast
+                CONCAT('Restored ', `+r.rounding.sql("required_quantity * $2::numeric")+`, ' for ', $2::integer,
+                    ' x menu item #', $1::integer, ' from ', $5::text, ' order #', $3::integer)
+            FROM ingredients`,
+			item.MenuItemID,
+			item.Quantity,
+			orderID,
+			transactionType,
+			ended,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record inventory restoration for menu item %d: %w",
+				item.MenuItemID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetOrderStatusHistory returns the status changes of an order, oldest first
+func (r *orderRepository) GetOrderStatusHistory(ctx context.Context, id int) ([]models.OrderStatusHistory, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM orders WHERE id = $1 AND location_id = $2)`,
+		id, models.LocationIDFromContext(ctx)).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check order: %w", err)
+	}
+	if !exists {
+		return nil, models.ErrOrderNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, order_id, status, changed_at
+        FROM order_status_history
+        WHERE order_id = $1
+        ORDER BY changed_at, id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order status history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []models.OrderStatusHistory{}
+	for rows.Next() {
+		var entry models.OrderStatusHistory
+		if err := rows.Scan(&entry.ID, &entry.OrderID, &entry.Status, &entry.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan order status history: %w", err)
+		}
+		history = append(history, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning order status history: %w", err)
+	}
+
+	return history, nil
+}
+
+// GetOrderInventoryTransactions returns the inventory movements caused by an order, oldest first.
+// They outlive the order, so a deleted order still returns its usage and restoration.
+func (r *orderRepository) GetOrderInventoryTransactions(ctx context.Context, id int) ([]models.InventoryTransaction, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            t.id,
+            t.ingredient_id,
+            i.name,
+            t.transaction_type,
+            t.delta,
+            t.reference_id,
+            COALESCE(t.notes, ''),
+            t.created_at
+        FROM inventory_transactions t
+        JOIN inventory i ON i.id = t.ingredient_id
+        WHERE t.reference_id = $1
+        AND t.transaction_type IN ('order_usage', 'order_update', 'order_deletion', 'order_cancellation')
+        AND i.location_id = $2
+        ORDER BY t.created_at, t.id`, id, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order inventory transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.InventoryTransaction
+	for rows.Next() {
+		var t models.InventoryTransaction
+		if err := rows.Scan(
+			&t.ID,
+			&t.IngredientID,
+			&t.IngredientName,
+			&t.TransactionType,
+			&t.Delta,
+			&t.ReferenceID,
+			&t.Notes,
+			&t.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan order inventory transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning order inventory transactions: %w", err)
+	}
+
+	if len(transactions) == 0 {
+		var exists bool
+		err := r.db.QueryRowContext(ctx, `
+            SELECT EXISTS(SELECT 1 FROM orders WHERE id = $1 AND location_id = $2)`,
+			id, models.LocationIDFromContext(ctx)).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check order: %w", err)
+		}
+		if !exists {
+			return nil, models.ErrOrderNotFound
+		}
+	}
+
+	return transactions, nil
+}
+
+// nextOrderCode generates the next order code of a location, e.g. NYC-20240615-0042.
+// The sequence restarts daily and is counted separately per location.
+func nextOrderCode(ctx context.Context, tx *sql.Tx, locationCode string) (string, error) {
+	var day string
+	var sequence int
+	err := tx.QueryRowContext(ctx, `
+        INSERT INTO order_code_sequences (location_code, day, last_value)
+        VALUES ($1, CURRENT_DATE, 1)
+        ON CONFLICT (location_code, day)
+        DO UPDATE SET last_value = order_code_sequences.last_value + 1
+        RETURNING to_char(day, 'YYYYMMDD'), last_value`, locationCode).Scan(&day, &sequence)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate order code: %w", err)
+	}
+
+	return fmt.Sprintf("%s-%s-%04d", locationCode, day, sequence), nil
+}
+
+// orderCustomer checks that an order's customer exists and is active and returns the customer_id to
+// store, NULL for guest orders
+func orderCustomer(ctx context.Context, tx *sql.Tx, customerID int) (interface{}, error) {
+	if customerID == 0 {
+		return nil, nil
+	}
+	var customerActive bool
+	err := tx.QueryRowContext(ctx, `
+        SELECT is_active FROM customers WHERE id = $1`, customerID).Scan(&customerActive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrCustomerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check customer: %w", err)
+	}
+	if !customerActive {
+		return nil, models.ErrCustomerInactive
+	}
+	return customerID, nil
+}
+
+// deductIngredients subtracts the rounded ingredient usage of an order item from inventory (unlimited
+// ingredients are skipped), or the ordered quantity from the stock of a stock tracked item. The stock check is part of the UPDATE: the row lock makes a
+// concurrent order wait and re-check against the committed quantity, and if any ingredient
+// is short no row of it is deducted and the caller's transaction must be rolled back.
+func (r *orderRepository) deductIngredients(ctx context.Context, tx *sql.Tx, item models.OrderItem) error {
+	var stockTracked bool
+	err := tx.QueryRowContext(ctx, `
+        SELECT stock_tracked FROM menu_items WHERE id = $1`, item.MenuItemID).Scan(&stockTracked)
+	if err != nil {
+		return fmt.Errorf("failed to check stock mode of menu item %d: %w", item.MenuItemID, err)
+	}
+	if stockTracked {
+		result, err := tx.ExecContext(ctx, `
+            UPDATE menu_items 
+            SET stock_quantity = stock_quantity - $2 
+            WHERE id = $1 AND stock_quantity >= $2`, item.MenuItemID, item.Quantity)
+		if err != nil {
+			return fmt.Errorf("failed to deduct menu item stock: %w", err)
+		}
+		if deducted, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get deducted stock: %w", err)
+		} else if deducted == 0 {
+			return fmt.Errorf("%w: not enough stock of menu item %d", models.ErrInsufficientInventory, item.MenuItemID)
+		}
+		return nil
+	}
+
+	var expected int
+	err = tx.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM menu_item_ingredients mi
+        JOIN inventory i ON mi.ingredient_id = i.id
+        WHERE mi.menu_item_id = $1 AND NOT i.unlimited`, item.MenuItemID).Scan(&expected)
+	if err != nil {
+		return fmt.Errorf("failed to count ingredients of menu item %d: %w", item.MenuItemID, err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+        WITH ingredients AS (
+            SELECT ingredient_id, quantity 
+            FROM menu_item_ingredients 
+            WHERE menu_item_id = $1
+        )
+        UPDATE inventory i
+        SET quantity = i.quantity - `+r.rounding.sql("ing.quantity * $2")+`
+        FROM ingredients ing
+        WHERE i.id = ing.ingredient_id
+        AND NOT i.unlimited
+        AND i.quantity >= `+r.rounding.sql("ing.quantity * $2"),
+		item.MenuItemID, item.Quantity,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to deduct ingredient from inventory: %w", err)
+	}
+
+	deducted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get deducted ingredients: %w", err)
+	}
+	if int(deducted) == expected {
+		return nil
+	}
+
+	// Name the ingredient that ran out; rows already deducted are rolled back with the transaction
+	var name string
+	err = tx.QueryRowContext(ctx, `
+        SELECT i.name
+        FROM menu_item_ingredients mi
+        JOIN inventory i ON mi.ingredient_id = i.id
+        WHERE mi.menu_item_id = $1
+        AND NOT i.unlimited
+        AND i.quantity < `+r.rounding.sql("mi.quantity * $2")+`
+        ORDER BY i.name
+        LIMIT 1`, item.MenuItemID, item.Quantity).Scan(&name)
+	if err != nil {
+		return fmt.Errorf("%w for menu item %d", models.ErrInsufficientInventory, item.MenuItemID)
+	}
+	return fmt.Errorf("%w: not enough %s for menu item %d", models.ErrInsufficientInventory, name, item.MenuItemID)
 }
 
 func (r *orderRepository) GetOrderByID(ctx context.Context, id int) (models.Order, error) {
@@ -158,27 +741,33 @@ func (r *orderRepository) GetOrderByID(ctx context.Context, id int) (models.Orde
 	err := r.db.QueryRowContext(ctx, `
         SELECT 
             id, 
-            customer_id, 
+            COALESCE(customer_id, 0), 
             status, 
             payment_method,
             total_price, 
+            discount_amount,
             special_instructions, 
+            COALESCE(location_code, ''),
+            COALESCE(order_code, ''),
             created_at, 
             updated_at
         FROM orders 
-        WHERE id = $1`, id).Scan(
+        WHERE id = $1 AND location_id = $2`, id, models.LocationIDFromContext(ctx)).Scan(
 		&order.ID,
 		&order.CustomerID,
 		&order.Status,
 		&order.PaymentMethod,
 		&order.TotalPrice,
+		&order.DiscountAmount,
 		&specialInstructions,
+		&order.LocationCode,
+		&order.Code,
 		&order.CreatedAt,
 		&order.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return models.Order{}, fmt.Errorf("order not found: %w", err)
+			return models.Order{}, models.ErrOrderNotFound
 		}
 		return models.Order{}, fmt.Errorf("failed to get order: %w", err)
 	}
@@ -196,6 +785,7 @@ func (r *orderRepository) GetOrderByID(ctx context.Context, id int) (models.Orde
             menu_item_id,
             quantity,
             price_at_order,
+            modifier_delta,
             customizations,
 			order_id
         FROM order_items
@@ -214,6 +804,7 @@ func (r *orderRepository) GetOrderByID(ctx context.Context, id int) (models.Orde
 			&item.MenuItemID,
 			&item.Quantity,
 			&item.PriceAtOrder,
+			&item.ModifierDelta,
 			&customizations,
 			&item.OrderID,
 		); err != nil {
@@ -247,10 +838,36 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
 
 	// Calculate new total price
 	totalPrice, err := r.calculateOrderTotal(ctx, updatedOrder.Items)
+	if errors.Is(err, models.ErrMenuItemUnavailable) || errors.Is(err, models.ErrInvalidModifier) || errors.Is(err, models.ErrInvalidMenuItemID) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("failed to calculate order total: %w", err)
 	}
-	updatedOrder.TotalPrice = totalPrice
+	if totalPrice <= 0 {
+		return models.ErrInvalidTotalPrice
+	}
+	if updatedOrder.DiscountAmount < 0 || updatedOrder.DiscountAmount > totalPrice {
+		return models.ErrInvalidDiscount
+	}
+	updatedOrder.TotalPrice = totalPrice - updatedOrder.DiscountAmount
+
+	customerID, err := orderCustomer(ctx, tx, updatedOrder.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	var currentStatus string
+	var deducted bool
+	err = tx.QueryRowContext(ctx, `
+        SELECT status, inventory_deducted FROM orders 
+        WHERE id = $1 AND location_id = $2 FOR UPDATE`, id, models.LocationIDFromContext(ctx)).Scan(&currentStatus, &deducted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
+	}
 
 	// 1. Get current order items (to calculate inventory delta)
 	var currentItems []struct {
@@ -275,13 +892,15 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
 	}
 
 	// 2. Calculate net inventory changes
-	inventoryDeltas := make(map[int]int) // ingredient_id → delta
+	inventoryDeltas := make(map[int]float64) // ingredient_id → delta
 	for _, currItem := range currentItems {
 		// Subtract old quantities
 		ingredientRows, err := tx.QueryContext(ctx, `
-            SELECT ingredient_id, quantity 
-            FROM menu_item_ingredients 
-            WHERE menu_item_id = $1`, currItem.MenuItemID)
+            SELECT mi.ingredient_id, mi.quantity 
+            FROM menu_item_ingredients mi
+            JOIN inventory i ON mi.ingredient_id = i.id
+            JOIN menu_items m ON m.id = mi.menu_item_id
+            WHERE mi.menu_item_id = $1 AND NOT i.unlimited AND NOT m.stock_tracked`, currItem.MenuItemID)
 		if err != nil {
 			return fmt.Errorf("failed to get ingredients for menu item %d: %w", currItem.MenuItemID, err)
 		}
@@ -292,7 +911,7 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
 			if err := ingredientRows.Scan(&ingredientID, &quantityPerUnit); err != nil {
 				return fmt.Errorf("failed to scan ingredient: %w", err)
 			}
-			inventoryDeltas[ingredientID] -= int(quantityPerUnit * float64(currItem.Quantity))
+			inventoryDeltas[ingredientID] -= r.rounding.Apply(quantityPerUnit, currItem.Quantity)
 		}
 		ingredientRows.Close()
 	}
@@ -300,9 +919,11 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
 	for _, newItem := range updatedOrder.Items {
 		// Add new quantities
 		ingredientRows, err := tx.QueryContext(ctx, `
-            SELECT ingredient_id, quantity 
-            FROM menu_item_ingredients 
-            WHERE menu_item_id = $1`, newItem.MenuItemID)
+            SELECT mi.ingredient_id, mi.quantity 
+            FROM menu_item_ingredients mi
+            JOIN inventory i ON mi.ingredient_id = i.id
+            JOIN menu_items m ON m.id = mi.menu_item_id
+            WHERE mi.menu_item_id = $1 AND NOT i.unlimited AND NOT m.stock_tracked`, newItem.MenuItemID)
 		if err != nil {
 			return fmt.Errorf("failed to get ingredients for menu item %d: %w", newItem.MenuItemID, err)
 		}
@@ -313,15 +934,62 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
 			if err := ingredientRows.Scan(&ingredientID, &quantityPerUnit); err != nil {
 				return fmt.Errorf("failed to scan ingredient: %w", err)
 			}
-			inventoryDeltas[ingredientID] += int(quantityPerUnit * float64(newItem.Quantity))
+			inventoryDeltas[ingredientID] += r.rounding.Apply(quantityPerUnit, newItem.Quantity)
 		}
 		ingredientRows.Close()
 	}
 
+	// Usages are summed as floats, so net deltas are snapped back to the inventory scale
+	// to let unchanged ingredients cancel out exactly
+	for ingredientID, delta := range inventoryDeltas {
+		inventoryDeltas[ingredientID] = inventoryScale(delta)
+	}
+
+	// Stock tracked items change their own stock by the net number of units ordered
+	stockDeltas := make(map[int]int) // menu_item_id → units
+	for _, currItem := range currentItems {
+		stockDeltas[currItem.MenuItemID] -= currItem.Quantity
+	}
+	for _, newItem := range updatedOrder.Items {
+		stockDeltas[newItem.MenuItemID] += newItem.Quantity
+	}
+
+	// An order still waiting for deferred deduction holds no stock, so its new items
+	// are deducted in full once it moves to preparing
+	if !deducted {
+		inventoryDeltas = make(map[int]float64)
+		stockDeltas = make(map[int]int)
+	}
+	for menuItemID, delta := range stockDeltas {
+		if delta == 0 {
+			continue
+		}
+		var stock int
+		err := tx.QueryRowContext(ctx, `
+            SELECT stock_quantity FROM menu_items 
+            WHERE id = $1 AND stock_tracked FOR UPDATE`, menuItemID).Scan(&stock)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check stock of menu item %d: %w", menuItemID, err)
+		}
+		if stock < delta {
+			return fmt.Errorf("%w: menu item %d needs %d more, have %d",
+				models.ErrInsufficientInventory, menuItemID, delta, stock)
+		}
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE menu_items 
+            SET stock_quantity = stock_quantity - $1 
+            WHERE id = $2`, delta, menuItemID); err != nil {
+			return fmt.Errorf("failed to update stock of menu item %d: %w", menuItemID, err)
+		}
+	}
+
 	// 3. Verify inventory availability (for positive deltas)
 	for ingredientID, delta := range inventoryDeltas {
 		if delta > 0 { // Only check for new usage (not restocks)
-			var currentStock int
+			var currentStock float64
 			err := tx.QueryRowContext(ctx, `
                 SELECT quantity FROM inventory 
                 WHERE id = $1 FOR UPDATE`, ingredientID).Scan(&currentStock)
@@ -330,8 +998,8 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
 			}
 
 			if currentStock < delta {
-				return fmt.Errorf("insufficient stock for ingredient %d (need %d, have %d)",
-					ingredientID, delta, currentStock)
+				return fmt.Errorf("%w: ingredient %d needs %g more, have %g",
+					models.ErrInsufficientInventory, ingredientID, delta, currentStock)
 			}
 		}
 	}
@@ -355,12 +1023,12 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
                     $1, $2, 'order_update', $3
                 )`, ingredientID, -delta, id)
 			if err != nil {
-				return fmt.Errorf("failed to record inventory transaction: %w", err)
+				return fmt.Errorf("%w: ingredient %d: %w", models.ErrInventoryTransaction, ingredientID, err)
 			}
 		}
 	}
 
-	// 5. Update order metadata
+	// 5. Update order metadata; the status only changes through setOrderStatus below
 	var special_instructions interface{} = nil
 	if len(updatedOrder.SpecialInstructions) > 0 {
 		special_instructions = updatedOrder.SpecialInstructions
@@ -369,18 +1037,19 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
         UPDATE orders 
         SET 
             customer_id = $1,
-            status = $2,
-            payment_method = $3,
-            total_price = $4,
+            payment_method = $2,
+            total_price = $3,
+            discount_amount = $4,
             special_instructions = $5,
             updated_at = NOW()
-        WHERE id = $6`,
-		updatedOrder.CustomerID,
-		updatedOrder.Status,
+        WHERE id = $6 AND location_id = $7`,
+		customerID,
 		updatedOrder.PaymentMethod,
 		updatedOrder.TotalPrice,
+		updatedOrder.DiscountAmount,
 		special_instructions,
 		id,
+		models.LocationIDFromContext(ctx),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update order: %w", err)
@@ -392,7 +1061,7 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
 		return fmt.Errorf("failed to check rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return models.ErrOrderNotFound
 	}
 
 	// 6. Delete existing order items
@@ -415,12 +1084,14 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
                 menu_item_id, 
                 quantity, 
                 price_at_order, 
+                modifier_delta,
                 customizations
-            ) VALUES ($1, $2, $3, $4, $5)`,
+            ) VALUES ($1, $2, $3, $4, $5, $6)`,
 			id,
 			item.MenuItemID,
 			item.Quantity,
 			item.PriceAtOrder,
+			item.ModifierDelta,
 			customizations,
 		)
 		if err != nil {
@@ -428,6 +1099,14 @@ func (r *orderRepository) UpdateOrder(ctx context.Context, id int, updatedOrder
 		}
 	}
 
+	// 8. A new status goes through the state machine, after the items so that a cancellation
+	// restores and a deferred deduction takes the updated items
+	if updatedOrder.Status != "" && updatedOrder.Status != currentStatus {
+		if err := r.setOrderStatus(ctx, tx, id, currentStatus, updatedOrder.Status); err != nil {
+			return err
+		}
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
@@ -443,99 +1122,42 @@ func (r *orderRepository) DeleteOrder(ctx context.Context, id int) error {
 	}
 	defer tx.Rollback()
 
-	// 1. Get all items first to restore inventory
-	var items []struct {
-		MenuItemID int
-		Quantity   int
-	}
-	rows, err := tx.QueryContext(ctx, `
-        SELECT menu_item_id, quantity 
-        FROM order_items 
-        WHERE order_id = $1`, id)
+	// 1. Restore inventory, unless cancelling the order already did
+	var status string
+	err = tx.QueryRowContext(ctx, `
+        SELECT status FROM orders 
+        WHERE id = $1 AND location_id = $2 FOR UPDATE`, id, models.LocationIDFromContext(ctx)).Scan(&status)
 	if err != nil {
-		return fmt.Errorf("failed to get all items from deleting order: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var item struct{ MenuItemID, Quantity int }
-		if err := rows.Scan(&item.MenuItemID, &item.Quantity); err != nil {
-			return fmt.Errorf("failed to scan order item: %w", err)
-		}
-		items = append(items, item)
-	}
-
-	// 2. Restore inventory
-	for _, item := range items {
-		_, err = tx.ExecContext(ctx, `
-            WITH ingredients AS (
-                SELECT ingredient_id, quantity 
-                FROM menu_item_ingredients 
-                WHERE menu_item_id = $1
-            )
-            UPDATE inventory i
-            SET quantity = i.quantity + (ing.quantity * $2)
-            FROM ingredients ing
-            WHERE i.id = ing.ingredient_id`,
-			item.MenuItemID, item.Quantity,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to restore inventory: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrOrderNotFound
 		}
+		return fmt.Errorf("failed to check order status: %w", err)
 	}
-
-	// 3. Record inventory transactions (for restoring stock)
-	for _, item := range items {
-		_, err = tx.ExecContext(ctx, `
-            WITH ingredients AS (
-                SELECT 
-                    ingredient_id, 
-                    quantity AS required_quantity
-                FROM menu_item_ingredients 
-                WHERE menu_item_id = $1
-            )
-            INSERT INTO inventory_transactions (
-                ingredient_id, 
-                delta, 
-                transaction_type, 
-                reference_id,
-                notes
-            )
-            SELECT 
-                ingredient_id,
-                (required_quantity * $2::numeric),  -- Explicit cast
-                'order_deletion',
-                $3::integer,                        -- Explicit cast
-                CONCAT('Restored from cancelled order #', $3::integer, ' for menu item #', $1::integer)
-            FROM ingredients`,
-			item.MenuItemID,
-			item.Quantity,
-			id,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to record inventory restoration for menu item %d: %w",
-				item.MenuItemID, err)
+	if status != "cancelled" {
+		if err := r.restoreOrderInventory(ctx, tx, id, "order_deletion"); err != nil {
+			return err
 		}
 	}
 
-	// 4. Delete order items
+	// 2. Delete order items
 	if _, err = tx.ExecContext(ctx, `DELETE FROM order_items WHERE order_id = $1`, id); err != nil {
 		return fmt.Errorf("failed to delete order items: %w", err)
 	}
 
-	// 5. Delete the order
+	// 3. Delete the order
 	result, err := tx.ExecContext(ctx, `DELETE FROM orders WHERE id = $1`, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete order: %w", err)
 	}
 
 	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
-		return sql.ErrNoRows
+		return models.ErrOrderNotFound
 	}
 
 	return tx.Commit()
 }
 
+// CloseOrder delivers a ready order
 func (r *orderRepository) CloseOrder(ctx context.Context, id int) error {
 	// Begin transaction
 	tx, err := r.db.BeginTx(ctx, nil)
@@ -548,47 +1170,17 @@ func (r *orderRepository) CloseOrder(ctx context.Context, id int) error {
 	var currentStatus string
 	err = tx.QueryRowContext(ctx, `
         SELECT status FROM orders 
-        WHERE id = $1 FOR UPDATE`, id).Scan(&currentStatus)
+        WHERE id = $1 AND location_id = $2 FOR UPDATE`, id, models.LocationIDFromContext(ctx)).Scan(&currentStatus)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("order not found: %w", err)
+			return models.ErrOrderNotFound
 		}
 		return fmt.Errorf("failed to check order status: %w", err)
 	}
 
-	// Validate order can be closed
-	if currentStatus == "cancelled" {
-		return fmt.Errorf("cannot close already cancelled order")
-	}
-	if currentStatus == "delivered" {
-		return fmt.Errorf("order already closed")
-	}
-
-	// 2. Update order status to "delivered"
-	result, err := tx.ExecContext(ctx, `
-        UPDATE orders 
-        SET status = 'delivered', 
-            updated_at = NOW() 
-        WHERE id = $1`, id)
-	if err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
-	}
-
-	// Verify exactly one row was updated
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to check rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
-
-	// 3. Record status change in history
-	_, err = tx.ExecContext(ctx, `
-        INSERT INTO order_status_history (order_id, status) 
-        VALUES ($1, 'delivered')`, id)
-	if err != nil {
-		return fmt.Errorf("failed to record status change: %w", err)
+	// 2. Deliver the order; only ready orders can be closed
+	if err := r.setOrderStatus(ctx, tx, id, currentStatus, "delivered"); err != nil {
+		return err
 	}
 
 	// Commit transaction
@@ -599,16 +1191,22 @@ func (r *orderRepository) CloseOrder(ctx context.Context, id int) error {
 	return nil
 }
 
-func (r *orderRepository) GetAllOrders(ctx context.Context, filters models.OrderFilters) ([]models.Order, error) {
-	// Build base query
-	query := `
+// likeEscaper escapes the wildcards of LIKE patterns so user input matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ordersWithItemsQuery selects orders together with their items aggregated as JSON.
+// Callers append their own WHERE, GROUP BY o.id and ORDER BY clauses.
+const ordersWithItemsQuery = `
         SELECT 
             o.id,
-            o.customer_id,
+            COALESCE(o.customer_id, 0),
             o.status,
             o.payment_method,
             o.total_price,
+            o.discount_amount,
             o.special_instructions,
+            COALESCE(o.location_code, ''),
+            COALESCE(o.order_code, ''),
             o.created_at,
             o.updated_at,
             COALESCE(
@@ -618,6 +1216,7 @@ func (r *orderRepository) GetAllOrders(ctx context.Context, filters models.Order
                         'menu_item_id', oi.menu_item_id,
                         'quantity', oi.quantity,
                         'price_at_order', oi.price_at_order,
+                        'modifier_delta', oi.modifier_delta,
                         'customizations', oi.customizations,
 						'order_id', oi.order_id
                     )
@@ -628,9 +1227,146 @@ func (r *orderRepository) GetAllOrders(ctx context.Context, filters models.Order
         LEFT JOIN order_items oi ON o.id = oi.order_id
     `
 
+func (r *orderRepository) BulkUpdateStatus(ctx context.Context, status string, filters models.OrderFilters) (models.BulkStatusResponse, error) {
+	response := models.BulkStatusResponse{
+		TargetStatus:    status,
+		UpdatedOrderIDs: []int{},
+		SkippedOrders:   []models.SkippedOrder{},
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.BulkStatusResponse{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 1. Lock all orders matching the filters
+	query := `SELECT id, status FROM orders`
+	args := []interface{}{models.LocationIDFromContext(ctx)}
+	whereClauses := []string{"location_id = $1"}
+
+	if filters.Status != "" {
+		whereClauses = append(whereClauses, fmt.Sprintf("status = $%d", len(args)+1))
+		args = append(args, filters.Status)
+	}
+	if !filters.StartDate.IsZero() {
+		whereClauses = append(whereClauses, fmt.Sprintf("created_at >= $%d", len(args)+1))
+		args = append(args, filters.StartDate)
+	}
+	if !filters.EndDate.IsZero() {
+		whereClauses = append(whereClauses, fmt.Sprintf("created_at <= $%d", len(args)+1))
+		args = append(args, filters.EndDate)
+	}
+	if filters.CustomerID != 0 {
+		whereClauses = append(whereClauses, fmt.Sprintf("customer_id = $%d", len(args)+1))
+		args = append(args, filters.CustomerID)
+	}
+	query += " WHERE " + strings.Join(whereClauses, " AND ")
+	query += " ORDER BY id FOR UPDATE"
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return models.BulkStatusResponse{}, fmt.Errorf("failed to query matching orders: %w", err)
+	}
+
+	type matchedOrder struct {
+		ID     int
+		Status string
+	}
+	var matched []matchedOrder
+	for rows.Next() {
+		var order matchedOrder
+		if err := rows.Scan(&order.ID, &order.Status); err != nil {
+			rows.Close()
+			return models.BulkStatusResponse{}, fmt.Errorf("failed to scan matching order: %w", err)
+		}
+		matched = append(matched, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.BulkStatusResponse{}, fmt.Errorf("error after scanning matching orders: %w", err)
+	}
+
+	// 2. Transition every order the state machine allows, skipping the rest
+	for _, order := range matched {
+		if !models.CanTransition(order.Status, status) {
+			response.SkippedOrders = append(response.SkippedOrders, models.SkippedOrder{
+				OrderID:       order.ID,
+				CurrentStatus: order.Status,
+				Reason:        fmt.Sprintf("cannot transition from %s to %s", order.Status, status),
+			})
+			continue
+		}
+
+		if err := r.setOrderStatus(ctx, tx, order.ID, order.Status, status); err != nil {
+			return models.BulkStatusResponse{}, fmt.Errorf("order %d: %w", order.ID, err)
+		}
+
+		response.UpdatedOrderIDs = append(response.UpdatedOrderIDs, order.ID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.BulkStatusResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	response.Matched = len(matched)
+	response.Succeeded = len(response.UpdatedOrderIDs)
+	response.Skipped = len(response.SkippedOrders)
+	return response, nil
+}
+
+// GetQueuePosition returns the prep work of an order and of the active orders ahead of it
+// in the FIFO queue. Menu items without a prep time use defaultPrepMinutes.
+func (r *orderRepository) GetQueuePosition(ctx context.Context, id int, defaultPrepMinutes float64) (models.QueueETAResponse, error) {
+	response := models.QueueETAResponse{OrderID: id}
+
+	err := r.db.QueryRowContext(ctx, `
+        SELECT 
+            o.status,
+            o.created_at,
+            COALESCE(SUM(oi.quantity * COALESCE(mi.prep_time_minutes, $2)), 0)
+        FROM orders o
+        LEFT JOIN order_items oi ON oi.order_id = o.id
+        LEFT JOIN menu_items mi ON mi.id = oi.menu_item_id
+        WHERE o.id = $1 AND o.location_id = $3
+        GROUP BY o.id`, id, defaultPrepMinutes, models.LocationIDFromContext(ctx)).Scan(
+		&response.Status,
+		&response.CreatedAt,
+		&response.OwnPrepMinutes,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.QueueETAResponse{}, models.ErrOrderNotFound
+		}
+		return models.QueueETAResponse{}, fmt.Errorf("failed to get order prep time: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+        SELECT 
+            COUNT(DISTINCT o.id),
+            COALESCE(SUM(oi.quantity * COALESCE(mi.prep_time_minutes, $3)), 0)
+        FROM orders o
+        LEFT JOIN order_items oi ON oi.order_id = o.id
+        LEFT JOIN menu_items mi ON mi.id = oi.menu_item_id
+        WHERE o.status IN ('pending', 'accepted', 'preparing')
+        AND o.location_id = $4
+        AND (o.created_at, o.id) < ($1, $2)`, response.CreatedAt, id, defaultPrepMinutes, models.LocationIDFromContext(ctx)).Scan(
+		&response.OrdersAhead,
+		&response.MinutesAhead,
+	)
+	if err != nil {
+		return models.QueueETAResponse{}, fmt.Errorf("failed to get queue ahead of order: %w", err)
+	}
+
+	return response, nil
+}
+
+// GetAllOrders returns a page of orders matching the filters, newest first.
+// Pages are keyset paginated on (created_at, id) so inserts don't shift later pages.
+func (r *orderRepository) GetAllOrders(ctx context.Context, filters models.OrderFilters) (models.OrderListResponse, error) {
 	// Add filters (status, date range, etc.)
-	var args []interface{}
-	whereClauses := []string{}
+	args := []interface{}{models.LocationIDFromContext(ctx)}
+	whereClauses := []string{"o.location_id = $1"}
 
 	if filters.Status != "" {
 		whereClauses = append(whereClauses, fmt.Sprintf("o.status = $%d", len(args)+1))
@@ -647,24 +1383,121 @@ func (r *orderRepository) GetAllOrders(ctx context.Context, filters models.Order
 		args = append(args, filters.EndDate)
 	}
 
+	if filters.CustomerID != 0 {
+		whereClauses = append(whereClauses, fmt.Sprintf("o.customer_id = $%d", len(args)+1))
+		args = append(args, filters.CustomerID)
+	}
+
+	// Match keys and string values at any depth of the items' customizations
+	if filters.Customization != "" {
+		whereClauses = append(whereClauses, fmt.Sprintf(`EXISTS (
+            SELECT 1
+            FROM order_items ci,
+                jsonb_path_query(ci.customizations, 'strict $.** ? (@.type() == "object").keyvalue()') kv
+            WHERE ci.order_id = o.id
+            AND (kv->>'key' ILIKE $%[1]d OR (jsonb_typeof(kv->'value') = 'string' AND kv->>'value' ILIKE $%[1]d))
+        )`, len(args)+1))
+		args = append(args, "%"+likeEscaper.Replace(filters.Customization)+"%")
+	}
+
+	// Count all matching orders before narrowing down to the page
+	countQuery := `SELECT COUNT(*) FROM orders o`
+	if len(whereClauses) > 0 {
+		countQuery += " WHERE " + strings.Join(whereClauses, " AND ")
+	}
+
+	var response models.OrderListResponse
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&response.TotalCount); err != nil {
+		return models.OrderListResponse{}, fmt.Errorf("failed to count orders: %w", err)
+	}
+
+	if filters.Cursor != "" {
+		cursor, err := models.DecodeOrderCursor(filters.Cursor)
+		if err != nil {
+			return models.OrderListResponse{}, err
+		}
+		whereClauses = append(whereClauses, fmt.Sprintf("(o.created_at, o.id) < ($%d, $%d)", len(args)+1, len(args)+2))
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+
+	// Build base query
+	query := ordersWithItemsQuery
+
 	// Combine WHERE clauses
 	if len(whereClauses) > 0 {
 		query += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
 
-	// Group and order
-	query += `
+	// Group and order; one extra row tells whether another page follows
+	query += fmt.Sprintf(`
         GROUP BY o.id
-        ORDER BY o.created_at DESC
-    `
+        ORDER BY o.created_at DESC, o.id DESC
+        LIMIT $%d
+    `, len(args)+1)
+	args = append(args, filters.Limit+1)
 
 	// Execute query
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query orders: %w", err)
+		return models.OrderListResponse{}, fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders, err := scanOrdersWithItems(rows)
+	if err != nil {
+		return models.OrderListResponse{}, err
+	}
+
+	if len(orders) > filters.Limit {
+		orders = orders[:filters.Limit]
+		last := orders[len(orders)-1]
+		response.NextCursor = models.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	response.Orders = orders
+	if response.Orders == nil {
+		response.Orders = []models.Order{}
+	}
+
+	return response, nil
+}
+
+func (r *orderRepository) GetStaleOrders(ctx context.Context, status string, olderThan time.Duration) ([]models.Order, error) {
+	query := ordersWithItemsQuery + `
+        WHERE o.status = $1
+        AND o.updated_at < NOW() - make_interval(secs => $2)
+        AND o.location_id = $3
+        GROUP BY o.id
+        ORDER BY o.updated_at ASC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, status, olderThan.Seconds(), models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale orders: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOrdersWithItems(rows)
+}
+
+// GetOrdersByIDs returns the orders with the given IDs in a single query; missing IDs are skipped
+func (r *orderRepository) GetOrdersByIDs(ctx context.Context, ids []int) ([]models.Order, error) {
+	query := ordersWithItemsQuery + `
+        WHERE o.id = ANY($1) AND o.location_id = $2
+        GROUP BY o.id
+        ORDER BY o.id
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids), models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query orders by IDs: %w", err)
 	}
 	defer rows.Close()
 
+	return scanOrdersWithItems(rows)
+}
+
+// scanOrdersWithItems reads rows produced by ordersWithItemsQuery
+func scanOrdersWithItems(rows *sql.Rows) ([]models.Order, error) {
 	var orders []models.Order
 	var specialInstructions sql.NullString
 	var paymentMethod sql.NullString
@@ -678,7 +1511,10 @@ func (r *orderRepository) GetAllOrders(ctx context.Context, filters models.Order
 			&order.Status,
 			&paymentMethod,
 			&order.TotalPrice,
+			&order.DiscountAmount,
 			&specialInstructions,
+			&order.LocationCode,
+			&order.Code,
 			&order.CreatedAt,
 			&order.UpdatedAt,
 			&itemsJSON,
@@ -722,12 +1558,12 @@ func (r *orderRepository) GetNumberOfOrderedItems(ctx context.Context, startDate
         JOIN orders o ON oi.order_id = o.id
     `
 
-	var args []interface{}
-	var whereClauses []string
+	args := []interface{}{models.LocationIDFromContext(ctx)}
+	whereClauses := []string{"o.location_id = $1"}
 
 	// Handle date filtering
 	if startDate != "" {
-		whereClauses = append(whereClauses, "o.created_at >= $1")
+		whereClauses = append(whereClauses, fmt.Sprintf("o.created_at >= $%d", len(args)+1))
 		args = append(args, startDate)
 	}
 	if endDate != "" {
@@ -736,10 +1572,7 @@ func (r *orderRepository) GetNumberOfOrderedItems(ctx context.Context, startDate
 		args = append(args, endDate)
 	}
 
-	// Add WHERE clause if needed
-	if len(whereClauses) > 0 {
-		query += " WHERE " + strings.Join(whereClauses, " AND ")
-	}
+	query += " WHERE " + strings.Join(whereClauses, " AND ")
 
 	query += `
         GROUP BY mi.name
@@ -794,14 +1627,8 @@ func (r *orderRepository) BatchProcessOrders(ctx context.Context, orders []model
 			customerName = "Unknown Customer"
 		}
 
-		order.TotalPrice, err = r.calculateOrderTotal(ctx, order.Items)
-		if err != nil {
-			return models.BatchOrderResponse{}, fmt.Errorf("failed to calculate total price of the ordered item: %w", err)
-		}
-
 		processed := models.ProcessedOrder{
 			CustomerName: customerName,
-			Total:        order.TotalPrice,
 		}
 
 		if len(order.Items) == 0 {
@@ -813,8 +1640,24 @@ func (r *orderRepository) BatchProcessOrders(ctx context.Context, orders []model
 			continue
 		}
 
+		// An order with an unavailable or unknown item or an invalid modifier is rejected on its own
+		order.TotalPrice, err = r.calculateOrderTotal(ctx, order.Items)
+		if errors.Is(err, models.ErrMenuItemUnavailable) || errors.Is(err, models.ErrInvalidModifier) || errors.Is(err, models.ErrInvalidMenuItemID) {
+			processed.Status = "rejected"
+			processed.Rejected = true
+			processed.RejectReason = err.Error()
+			response.ProcessedOrders = append(response.ProcessedOrders, processed)
+			response.Summary.Rejected++
+			continue
+		}
+		if err != nil {
+			return models.BatchOrderResponse{}, fmt.Errorf("failed to calculate total price of the ordered item: %w", err)
+		}
+		order.TotalPrice -= order.DiscountAmount
+		processed.Total = order.TotalPrice
+
 		// Process order and track actual ingredient usage
-		orderID, err := r.CreateOrder(ctx, order)
+		orderID, _, err := r.CreateOrder(ctx, order, "")
 		if err != nil {
 			processed.Status = "rejected"
 			processed.Rejected = true
@@ -827,20 +1670,8 @@ func (r *orderRepository) BatchProcessOrders(ctx context.Context, orders []model
 			response.Summary.TotalRevenue += order.TotalPrice
 
 			// Get actual ingredient usage for this order from inventory_transactions
-			rows, err := r.db.QueryContext(ctx, `
-                SELECT ingredient_id, ABS(delta) as used 
-                FROM inventory_transactions 
-                WHERE reference_id = $1 AND transaction_type = 'order_usage'`,
-				orderID)
-			if err == nil {
-				defer rows.Close()
-				for rows.Next() {
-					var ingredientID int
-					var used float64
-					if err := rows.Scan(&ingredientID, &used); err == nil {
-						actualInventoryUsed[ingredientID] += used
-					}
-				}
+			if err := r.addOrderUsage(ctx, orderID, actualInventoryUsed); err != nil {
+				return models.BatchOrderResponse{}, err
 			}
 		}
 
@@ -858,39 +1689,348 @@ func (r *orderRepository) BatchProcessOrders(ctx context.Context, orders []model
 		rows, err := r.db.QueryContext(ctx, `
             SELECT i.id, i.name, i.quantity 
             FROM inventory i
-            WHERE i.id = ANY($1)`, pq.Array(ingredientIDs))
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var ingredient models.InventoryUsage
-				if err := rows.Scan(&ingredient.IngredientID, &ingredient.Name, &ingredient.RemainingStock); err == nil {
-					ingredient.QuantityUsed = actualInventoryUsed[ingredient.IngredientID]
-					response.Summary.InventoryUsed = append(response.Summary.InventoryUsed, ingredient)
+            WHERE i.id = ANY($1) AND i.location_id = $2`, pq.Array(ingredientIDs), models.LocationIDFromContext(ctx))
+		if err != nil {
+			return models.BatchOrderResponse{}, fmt.Errorf("failed to get used ingredients: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var ingredient models.InventoryUsage
+			if err := rows.Scan(&ingredient.IngredientID, &ingredient.Name, &ingredient.RemainingStock); err != nil {
+				return models.BatchOrderResponse{}, fmt.Errorf("failed to scan used ingredient: %w", err)
+			}
+			ingredient.QuantityUsed = actualInventoryUsed[ingredient.IngredientID]
+			response.Summary.InventoryUsed = append(response.Summary.InventoryUsed, ingredient)
+		}
+
+		if err := rows.Err(); err != nil {
+			return models.BatchOrderResponse{}, fmt.Errorf("error after scanning used ingredients: %w", err)
+		}
+	}
+
+	response.Summary.TotalOrders = len(orders)
+	return response, nil
+}
+
+// addOrderUsage adds the ingredient usage recorded for an order to used, ingredient ID to quantity
+func (r *orderRepository) addOrderUsage(ctx context.Context, orderID int, used map[int]float64) error {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT ingredient_id, ABS(delta) as used 
+        FROM inventory_transactions 
+        WHERE reference_id = $1 AND transaction_type = 'order_usage'`,
+		orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get inventory usage of order %d: %w", orderID, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ingredientID int
+		var quantity float64
+		if err := rows.Scan(&ingredientID, &quantity); err != nil {
+			return fmt.Errorf("failed to scan inventory usage: %w", err)
+		}
+		used[ingredientID] += quantity
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error after scanning inventory usage: %w", err)
+	}
+
+	return nil
+}
+
+func (r *orderRepository) CheckBatchFeasibility(ctx context.Context, orders []models.Order) (models.BatchFeasibilityResponse, error) {
+	response := models.BatchFeasibilityResponse{
+		Orders:     make([]models.OrderFeasibility, 0, len(orders)),
+		Shortfalls: make([]models.IngredientShortfall, 0),
+	}
+
+	// Collect every menu item referenced by the batch
+	menuItemSet := make(map[int]bool)
+	for _, order := range orders {
+		for _, item := range order.Items {
+			menuItemSet[item.MenuItemID] = true
+		}
+	}
+	menuItemIDs := make([]int, 0, len(menuItemSet))
+	for id := range menuItemSet {
+		menuItemIDs = append(menuItemIDs, id)
+	}
+
+	// Load recipes and current stock for those menu items in one query, leaving out unlimited
+	// ingredients since they never run short. Like CreateOrder, a stock tracked item draws on its
+	// own stock_quantity instead of its ingredients.
+	type recipeLine struct {
+		Key      stockKey
+		Quantity float64
+	}
+	recipes := make(map[int][]recipeLine) // menuItemID -> ingredients or its own stock
+	active := make(map[int]bool)          // menuItemID -> is_active
+	stock := make(map[stockKey]float64)   // available quantity
+	names := make(map[stockKey]string)
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT mi.id, mi.name, mi.is_active, mi.stock_tracked, mi.stock_quantity,
+            mii.ingredient_id, mii.quantity, i.name, i.quantity
+        FROM menu_items mi
+        LEFT JOIN (
+            menu_item_ingredients mii
+            JOIN inventory i ON i.id = mii.ingredient_id AND NOT i.unlimited
+        ) ON mii.menu_item_id = mi.id AND NOT mi.stock_tracked
+        WHERE mi.id = ANY($1) AND mi.location_id = $2`, pq.Array(menuItemIDs), models.LocationIDFromContext(ctx))
+	if err != nil {
+		return models.BatchFeasibilityResponse{}, fmt.Errorf("failed to load menu item ingredients: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var menuItemID, stockQuantity int
+		var menuItemName string
+		var isActive, stockTracked bool
+		var ingredientID sql.NullInt64
+		var perUnit, available sql.NullFloat64
+		var name sql.NullString
+		if err := rows.Scan(&menuItemID, &menuItemName, &isActive, &stockTracked, &stockQuantity,
+			&ingredientID, &perUnit, &name, &available); err != nil {
+			return models.BatchFeasibilityResponse{}, fmt.Errorf("failed to scan menu item ingredient: %w", err)
+		}
+		active[menuItemID] = isActive
+		if _, ok := recipes[menuItemID]; !ok {
+			recipes[menuItemID] = []recipeLine{}
+		}
+		if stockTracked {
+			key := stockKey{MenuItemID: menuItemID}
+			recipes[menuItemID] = []recipeLine{{Key: key, Quantity: 1}}
+			stock[key] = float64(stockQuantity)
+			names[key] = menuItemName
+			continue
+		}
+		if !ingredientID.Valid {
+			continue
+		}
+		key := stockKey{IngredientID: int(ingredientID.Int64)}
+		recipes[menuItemID] = append(recipes[menuItemID], recipeLine{Key: key, Quantity: perUnit.Float64})
+		stock[key] = available.Float64
+		names[key] = name.String
+	}
+	if err := rows.Err(); err != nil {
+		return models.BatchFeasibilityResponse{}, fmt.Errorf("error after scanning menu item ingredients: %w", err)
+	}
+
+	// Simulate the batch in order: feasible orders consume the simulated stock
+	remaining := make(map[stockKey]float64, len(stock))
+	for key, qty := range stock {
+		remaining[key] = qty
+	}
+	totalRequired := make(map[stockKey]float64)
+
+	for i, order := range orders {
+		result := models.OrderFeasibility{
+			Index:      i,
+			CustomerID: order.CustomerID,
+		}
+
+		required := make(map[stockKey]float64)
+		for _, item := range order.Items {
+			lines, ok := recipes[item.MenuItemID]
+			if !ok {
+				result.Reason = fmt.Sprintf("menu item %d not found", item.MenuItemID)
+				break
+			}
+			if !active[item.MenuItemID] {
+				result.Reason = fmt.Sprintf("menu item %d is not currently available", item.MenuItemID)
+				break
+			}
+			for _, line := range lines {
+				if line.Key.MenuItemID != 0 {
+					required[line.Key] += float64(item.Quantity)
+				} else {
+					required[line.Key] += r.rounding.Apply(line.Quantity, item.Quantity)
+				}
+			}
+		}
+
+		if result.Reason == "" {
+			for key, qty := range required {
+				totalRequired[key] += qty
+				if qty > remaining[key] {
+					result.Shortfalls = append(result.Shortfalls, key.shortfall(names[key], qty, remaining[key]))
 				}
 			}
+			if len(result.Shortfalls) > 0 {
+				sortShortfalls(result.Shortfalls)
+				result.Reason = "insufficient inventory"
+			}
+		}
+
+		if result.Reason == "" {
+			for key, qty := range required {
+				remaining[key] -= qty
+			}
+			result.Feasible = true
+			response.Summary.Feasible++
+		} else {
+			response.Summary.Infeasible++
+		}
+
+		response.Orders = append(response.Orders, result)
+	}
+
+	// Aggregate shortfall of the whole batch against current stock
+	for key, qty := range totalRequired {
+		if qty > stock[key] {
+			response.Shortfalls = append(response.Shortfalls, key.shortfall(names[key], qty, stock[key]))
 		}
 	}
+	sortShortfalls(response.Shortfalls)
 
 	response.Summary.TotalOrders = len(orders)
 	return response, nil
 }
 
-func (r *orderRepository) calculateOrderTotal(ctx context.Context, items []models.OrderItem) (float64, error) {
-	var total float64
+// stockKey identifies what a batch draws on: an ingredient, or the stock of a stock tracked menu item
+type stockKey struct {
+	IngredientID int
+	MenuItemID   int
+}
+
+func (k stockKey) shortfall(name string, required, available float64) models.IngredientShortfall {
+	return models.IngredientShortfall{
+		IngredientID: k.IngredientID,
+		MenuItemID:   k.MenuItemID,
+		Name:         name,
+		Required:     required,
+		Available:    available,
+		Shortfall:    required - available,
+	}
+}
+
+// sortShortfalls orders ingredient shortfalls by ingredient ID, followed by stock tracked menu items
+func sortShortfalls(shortfalls []models.IngredientShortfall) {
+	sort.Slice(shortfalls, func(a, b int) bool {
+		if shortfalls[a].MenuItemID != shortfalls[b].MenuItemID {
+			return shortfalls[a].MenuItemID < shortfalls[b].MenuItemID
+		}
+		return shortfalls[a].IngredientID < shortfalls[b].IngredientID
+	})
+}
 
+// calculateOrderTotal returns the total of the items at current menu prices and sets the PriceAtOrder of
+// each item to its unit price, the menu price plus the price deltas of its modifiers, kept in ModifierDelta
+func (r *orderRepository) calculateOrderTotal(ctx context.Context, items []models.OrderItem) (models.Money, error) {
+	// Get current prices of all the ordered menu items at once
+	ids := make([]int64, 0, len(items))
+	seen := make(map[int]bool, len(items))
 	for _, item := range items {
-		// Get current price of the menu item
-		var price float64
-		err := r.db.QueryRowContext(ctx, `
-            SELECT price FROM menu_items 
-            WHERE id = $1`, item.MenuItemID).Scan(&price)
+		if !seen[item.MenuItemID] {
+			seen[item.MenuItemID] = true
+			ids = append(ids, int64(item.MenuItemID))
+		}
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, price, is_active FROM menu_items 
+        WHERE id = ANY($1) AND location_id = $2`, pq.Array(ids), models.LocationIDFromContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get menu item prices: %w", err)
+	}
+	defer rows.Close()
+
+	type menuPrice struct {
+		price    models.Money
+		isActive bool
+	}
+	prices := make(map[int]menuPrice, len(ids))
+	for rows.Next() {
+		var id int
+		var p menuPrice
+		if err := rows.Scan(&id, &p.price, &p.isActive); err != nil {
+			return 0, fmt.Errorf("failed to scan menu item price: %w", err)
+		}
+		prices[id] = p
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error after scanning menu item prices: %w", err)
+	}
+
+	modifierGroups, err := loadModifierGroups(ctx, r.db, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	var total models.Money
+	for i, item := range items {
+		p, ok := prices[item.MenuItemID]
+		if !ok {
+			// Missing items include items of other locations
+			return 0, fmt.Errorf("%w: %d", models.ErrInvalidMenuItemID, item.MenuItemID)
+		}
+		// Inactive items, including seasonal items out of season, can not be ordered
+		if !p.isActive {
+			return 0, models.ErrMenuItemUnavailable
+		}
+
+		// Selected modifiers add their price deltas to the unit price
+		delta, err := modifierPriceDelta(item, modifierGroups[item.MenuItemID])
 		if err != nil {
-			return 0, fmt.Errorf("failed to get price for menu item %d: %w", item.MenuItemID, err)
+			return 0, err
 		}
 
-		// Add to total
-		total += price * float64(item.Quantity)
+		// The client's price_at_order is ignored like its total_price
+		items[i].PriceAtOrder = p.price + delta
+		items[i].ModifierDelta = delta
+		total += items[i].PriceAtOrder * models.Money(item.Quantity)
 	}
 
 	return total, nil
 }
+
+// modifierPriceDelta checks the modifiers an order item selects in its customizations against the
+// menu item's modifier groups and returns the sum of their price deltas. Customization keys that
+// aren't group names stay free-form.
+func modifierPriceDelta(item models.OrderItem, groups []models.ModifierGroup) (models.Money, error) {
+	if len(groups) == 0 {
+		return 0, nil
+	}
+
+	selections := make(map[string]json.RawMessage)
+	if len(item.Customizations) > 0 {
+		var customizations map[string]json.RawMessage
+		if err := json.Unmarshal(item.Customizations, &customizations); err == nil {
+			for key, value := range customizations {
+				selections[strings.ToLower(key)] = value
+			}
+		}
+	}
+
+	var delta models.Money
+	for _, group := range groups {
+		value, ok := selections[strings.ToLower(group.Name)]
+		if !ok {
+			if group.Required {
+				return 0, fmt.Errorf("%w: menu item %d requires a %s", models.ErrInvalidModifier, item.MenuItemID, group.Name)
+			}
+			continue
+		}
+
+		var selected string
+		if err := json.Unmarshal(value, &selected); err != nil {
+			return 0, fmt.Errorf("%w: %s of menu item %d must be the name of a modifier", models.ErrInvalidModifier, group.Name, item.MenuItemID)
+		}
+		found := false
+		for _, modifier := range group.Modifiers {
+			if strings.EqualFold(modifier.Name, selected) {
+				delta += modifier.PriceDelta
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("%w: %q is not a %s of menu item %d", models.ErrInvalidModifier, selected, group.Name, item.MenuItemID)
+		}
+	}
+
+	return delta, nil
+}
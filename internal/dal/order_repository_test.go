@@ -0,0 +1,1110 @@
+package dal
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"frappuccino/internal/models"
+
+	"github.com/lib/pq"
+)
+
+func TestCreateOrderConcurrentDeduction(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	ctx := context.Background()
+
+	// Enough milk for exactly one latte
+	milk := createTestIngredient(t, db, models.DefaultLocationID, "test scarce milk", 200, false)
+	latte := createTestMenuItem(t, db, models.DefaultLocationID, "test scarce latte", 3.50, map[int]float64{milk: 200})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = repo.CreateOrder(ctx, models.Order{
+				Items: []models.OrderItem{{MenuItemID: latte, Quantity: 1}},
+			}, "")
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, models.ErrInsufficientInventory):
+			t.Errorf("CreateOrder error = %v, want ErrInsufficientInventory", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d orders succeeded, want exactly 1", succeeded)
+	}
+	if quantity := ingredientQuantity(t, db, milk); quantity != 0 {
+		t.Errorf("milk left = %v, want 0", quantity)
+	}
+}
+
+func TestCreateOrderRollsBackWhenTransactionsFail(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	ctx := context.Background()
+
+	beans := createTestIngredient(t, db, models.DefaultLocationID, "test rollback beans", 100, false)
+	espresso := createTestMenuItem(t, db, models.DefaultLocationID, "test rollback espresso", 2.50, map[int]float64{beans: 18})
+
+	// Force recording the inventory transactions of the order (step 5) to fail after the deduction
+	if _, err := db.Exec(`
+        CREATE FUNCTION test_fail_inventory_transaction() RETURNS trigger AS $$
+        BEGIN
+            RAISE EXCEPTION 'forced inventory transaction failure';
+        END $$ LANGUAGE plpgsql`); err != nil {
+		t.Fatalf("failed to create trigger function: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DROP FUNCTION test_fail_inventory_transaction()`) })
+	if _, err := db.Exec(`
+        CREATE TRIGGER test_fail_inventory_transaction
+        BEFORE INSERT ON inventory_transactions
+        FOR EACH ROW WHEN (NEW.ingredient_id = ` + strconv.Itoa(beans) + `)
+        EXECUTE FUNCTION test_fail_inventory_transaction()`); err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DROP TRIGGER test_fail_inventory_transaction ON inventory_transactions`) })
+
+	_, _, err := repo.CreateOrder(ctx, models.Order{
+		Items: []models.OrderItem{{MenuItemID: espresso, Quantity: 2}},
+	}, "")
+	if !errors.Is(err, models.ErrInventoryTransaction) {
+		t.Fatalf("CreateOrder error = %v, want ErrInventoryTransaction", err)
+	}
+
+	if quantity := ingredientQuantity(t, db, beans); quantity != 100 {
+		t.Errorf("beans left = %v, want the untouched 100", quantity)
+	}
+	var orders int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM order_items WHERE menu_item_id = $1`, espresso).Scan(&orders); err != nil {
+		t.Fatalf("failed to count orders: %v", err)
+	}
+	if orders != 0 {
+		t.Errorf("%d order items written, want 0", orders)
+	}
+}
+
+func TestCreateOrderSkipsUnlimitedIngredients(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	ctx := context.Background()
+
+	// Tap water is out of stock on paper but never runs out
+	water := createTestIngredient(t, db, models.DefaultLocationID, "test tap water", 0, true)
+	tea := createTestIngredient(t, db, models.DefaultLocationID, "test tea leaves", 10, false)
+	cup := createTestMenuItem(t, db, models.DefaultLocationID, "test cup of tea", 2.00, map[int]float64{water: 250, tea: 2})
+
+	if _, _, err := repo.CreateOrder(ctx, models.Order{
+		Items: []models.OrderItem{{MenuItemID: cup, Quantity: 2}},
+	}, ""); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	if quantity := ingredientQuantity(t, db, water); quantity != 0 {
+		t.Errorf("water = %v, want the untouched 0", quantity)
+	}
+	if quantity := ingredientQuantity(t, db, tea); quantity != 6 {
+		t.Errorf("tea leaves left = %v, want 6", quantity)
+	}
+}
+
+func TestOrderCodesSequencedPerLocation(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+
+	createOrders := func(code string, count int) []string {
+		t.Helper()
+		location := createTestLocation(t, db, code)
+		ctx := models.WithLocationID(context.Background(), location)
+		cookie := createTestMenuItem(t, db, location, "test cookie "+code, 1.50, nil)
+
+		var codes []string
+		for i := 0; i < count; i++ {
+			id, _, err := repo.CreateOrder(ctx, models.Order{
+				Items: []models.OrderItem{{MenuItemID: cookie, Quantity: 1}},
+			}, "")
+			if err != nil {
+				t.Fatalf("CreateOrder at %s: %v", code, err)
+			}
+			order, err := repo.GetOrderByID(ctx, id)
+			if err != nil {
+				t.Fatalf("GetOrderByID at %s: %v", code, err)
+			}
+			codes = append(codes, order.Code)
+		}
+		return codes
+	}
+
+	north := createOrders("NORTH", 2)
+	south := createOrders("SOUTH", 1)
+
+	for i, code := range north {
+		if !strings.HasPrefix(code, "NORTH") || !strings.HasSuffix(code, fmt.Sprintf("-%04d", i+1)) {
+			t.Errorf("north order %d code = %q, want NORTH...-%04d", i+1, code, i+1)
+		}
+	}
+	if !strings.HasPrefix(south[0], "SOUTH") || !strings.HasSuffix(south[0], "-0001") {
+		t.Errorf("south order code = %q, want SOUTH...-0001 independent of north", south[0])
+	}
+}
+
+func TestCreateOrderRejectsUnknownCustomer(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	ctx := context.Background()
+
+	cookie := createTestMenuItem(t, db, models.DefaultLocationID, "test bogus customer cookie", 1.50, nil)
+	var bogusCustomer int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) + 1000 FROM customers`).Scan(&bogusCustomer); err != nil {
+		t.Fatalf("failed to pick a missing customer: %v", err)
+	}
+
+	_, _, err := repo.CreateOrder(ctx, models.Order{
+		CustomerID: bogusCustomer,
+		Items:      []models.OrderItem{{MenuItemID: cookie, Quantity: 1}},
+	}, "")
+	if !errors.Is(err, models.ErrCustomerNotFound) {
+		t.Fatalf("CreateOrder error = %v, want ErrCustomerNotFound", err)
+	}
+
+	var orders int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM order_items WHERE menu_item_id = $1`, cookie).Scan(&orders); err != nil {
+		t.Fatalf("failed to count orders: %v", err)
+	}
+	if orders != 0 {
+		t.Errorf("%d order items written, want 0", orders)
+	}
+}
+
+func TestModifierPriceDelta(t *testing.T) {
+	groups := []models.ModifierGroup{
+		{Name: "Size", Required: true, Modifiers: []models.Modifier{
+			{Name: "S", PriceDelta: 0},
+			{Name: "M", PriceDelta: 0.50},
+			{Name: "L", PriceDelta: 1.00},
+		}},
+		{Name: "Milk", Modifiers: []models.Modifier{
+			{Name: "Whole", PriceDelta: 0},
+			{Name: "Oat", PriceDelta: 0.75},
+		}},
+	}
+
+	tests := []struct {
+		name           string
+		customizations string
+		want           models.Money
+		wantErr        bool
+	}{
+		{"required group only", `{"size": "M"}`, 0.50, false},
+		{"both groups", `{"Size": "l", "milk": "Oat"}`, 1.75, false},
+		{"free-form keys stay free", `{"size": "S", "extra_hot": true}`, 0, false},
+		{"missing required group", `{"milk": "Oat"}`, 0, true},
+		{"no customizations", ``, 0, true},
+		{"unknown modifier", `{"size": "XL"}`, 0, true},
+		{"selection not a name", `{"size": 2}`, 0, true},
+	}
+	for _, tt := range tests {
+		item := models.OrderItem{MenuItemID: 1, Quantity: 1}
+		if tt.customizations != "" {
+			item.Customizations = []byte(tt.customizations)
+		}
+		got, err := modifierPriceDelta(item, groups)
+		if tt.wantErr {
+			if !errors.Is(err, models.ErrInvalidModifier) {
+				t.Errorf("%s: error = %v, want ErrInvalidModifier", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: delta = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCreateOrderWithModifiers(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	menu := NewMenuRepository(db)
+	ctx := context.Background()
+
+	latte := createTestMenuItem(t, db, models.DefaultLocationID, "test modifier latte", 3.50, nil)
+	if _, err := menu.CreateModifierGroup(ctx, models.ModifierGroup{
+		MenuItemID: latte,
+		Name:       "Size",
+		Required:   true,
+		Modifiers:  []models.Modifier{{Name: "S"}, {Name: "L", PriceDelta: 1.00}},
+	}); err != nil {
+		t.Fatalf("CreateModifierGroup: %v", err)
+	}
+
+	// A valid selection adds its price delta to the item
+	id, _, err := repo.CreateOrder(ctx, models.Order{
+		Items: []models.OrderItem{{MenuItemID: latte, Quantity: 2, Customizations: []byte(`{"size": "L"}`)}},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateOrder with size L: %v", err)
+	}
+	order, err := repo.GetOrderByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOrderByID: %v", err)
+	}
+	if order.TotalPrice != 9.00 {
+		t.Errorf("total = %v, want 9.00", order.TotalPrice)
+	}
+	if item := order.Items[0]; item.PriceAtOrder != 4.50 || item.ModifierDelta != 1.00 {
+		t.Errorf("price_at_order = %v, modifier_delta = %v, want 4.50 and 1.00", item.PriceAtOrder, item.ModifierDelta)
+	}
+
+	// An unknown selection is rejected
+	_, _, err = repo.CreateOrder(ctx, models.Order{
+		Items: []models.OrderItem{{MenuItemID: latte, Quantity: 1, Customizations: []byte(`{"size": "XL"}`)}},
+	}, "")
+	if !errors.Is(err, models.ErrInvalidModifier) {
+		t.Errorf("CreateOrder with size XL error = %v, want ErrInvalidModifier", err)
+	}
+}
+
+func TestCheckBatchFeasibilityCutOff(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	ctx := context.Background()
+
+	// Enough beans for five espressos
+	beans := createTestIngredient(t, db, models.DefaultLocationID, "test feasibility beans", 90, false)
+	espresso := createTestMenuItem(t, db, models.DefaultLocationID, "test feasibility espresso", 2.50, map[int]float64{beans: 18})
+
+	orders := []models.Order{
+		{Items: []models.OrderItem{{MenuItemID: espresso, Quantity: 2}}},
+		{Items: []models.OrderItem{{MenuItemID: espresso, Quantity: 2}}},
+		{Items: []models.OrderItem{{MenuItemID: espresso, Quantity: 2}}},
+		{Items: []models.OrderItem{{MenuItemID: espresso, Quantity: 1}}},
+	}
+	response, err := repo.CheckBatchFeasibility(ctx, orders)
+	if err != nil {
+		t.Fatalf("CheckBatchFeasibility: %v", err)
+	}
+
+	// The third order no longer fits; the fourth still fits in what the first two left
+	want := []bool{true, true, false, true}
+	for i, order := range response.Orders {
+		if order.Feasible != want[i] {
+			t.Errorf("order %d feasible = %v, want %v (reason %q)", i, order.Feasible, want[i], order.Reason)
+		}
+	}
+	if short := response.Orders[2].Shortfalls; len(short) != 1 || short[0].IngredientID != beans || short[0].Available != 18 || short[0].Shortfall != 18 {
+		t.Errorf("order 2 shortfalls = %+v, want 18 of 36 beans available", short)
+	}
+	if len(response.Shortfalls) != 1 || response.Shortfalls[0].Required != 126 || response.Shortfalls[0].Shortfall != 36 {
+		t.Errorf("batch shortfalls = %+v, want 126 beans required, 36 short", response.Shortfalls)
+	}
+	if response.Summary.Feasible != 3 || response.Summary.Infeasible != 1 {
+		t.Errorf("summary = %+v, want 3 feasible and 1 infeasible", response.Summary)
+	}
+	if quantity := ingredientQuantity(t, db, beans); quantity != 90 {
+		t.Errorf("beans = %v after a dry run, want the untouched 90", quantity)
+	}
+}
+
+func TestCheckBatchFeasibilityMatchesCreateOrder(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	ctx := context.Background()
+
+	// The muffin's ingredient is out of stock, but it is sold from its own stock of 3
+	flour := createTestIngredient(t, db, models.DefaultLocationID, "test feasibility flour", 0, false)
+	muffin := createTestMenuItem(t, db, models.DefaultLocationID, "test feasibility muffin", 2.00, map[int]float64{flour: 50})
+	if _, err := db.Exec(`UPDATE menu_items SET stock_tracked = TRUE, stock_quantity = 3 WHERE id = $1`, muffin); err != nil {
+		t.Fatalf("failed to track muffin stock: %v", err)
+	}
+	retired := createTestMenuItem(t, db, models.DefaultLocationID, "test feasibility retired", 2.00, nil)
+	if _, err := db.Exec(`UPDATE menu_items SET is_active = FALSE WHERE id = $1`, retired); err != nil {
+		t.Fatalf("failed to deactivate menu item: %v", err)
+	}
+
+	response, err := repo.CheckBatchFeasibility(ctx, []models.Order{
+		{Items: []models.OrderItem{{MenuItemID: muffin, Quantity: 2}}},
+		{Items: []models.OrderItem{{MenuItemID: muffin, Quantity: 2}}},
+		{Items: []models.OrderItem{{MenuItemID: retired, Quantity: 1}}},
+	})
+	if err != nil {
+		t.Fatalf("CheckBatchFeasibility: %v", err)
+	}
+
+	if !response.Orders[0].Feasible {
+		t.Errorf("first muffin order infeasible (%q), want it served from the muffin stock", response.Orders[0].Reason)
+	}
+	if short := response.Orders[1].Shortfalls; response.Orders[1].Feasible || len(short) != 1 || short[0].MenuItemID != muffin || short[0].Available != 1 {
+		t.Errorf("second muffin order = %+v, want short of the 1 muffin left", response.Orders[1])
+	}
+	if response.Orders[2].Feasible || !strings.Contains(response.Orders[2].Reason, "not currently available") {
+		t.Errorf("inactive item order = %+v, want it unavailable", response.Orders[2])
+	}
+}
+
+func TestRestoredInventoryNotes(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	ctx := context.Background()
+
+	milk := createTestIngredient(t, db, models.DefaultLocationID, "test restore milk", 1000, false)
+	latte := createTestMenuItem(t, db, models.DefaultLocationID, "test restore latte", 3.50, map[int]float64{milk: 200})
+
+	tests := []struct {
+		name            string
+		end             func(id int) error
+		transactionType string
+		note            string
+	}{
+		{"cancel", func(id int) error { return repo.CancelOrder(ctx, id) }, "order_cancellation", "from cancelled order #"},
+		{"delete", func(id int) error { return repo.DeleteOrder(ctx, id) }, "order_deletion", "from deleted order #"},
+	}
+	for _, tt := range tests {
+		id, _, err := repo.CreateOrder(ctx, models.Order{
+			Items: []models.OrderItem{{MenuItemID: latte, Quantity: 2}},
+		}, "")
+		if err != nil {
+			t.Fatalf("%s: CreateOrder: %v", tt.name, err)
+		}
+		if err := tt.end(id); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var delta float64
+		var note string
+		err = db.QueryRow(`
+            SELECT delta, notes FROM inventory_transactions
+            WHERE reference_id = $1 AND ingredient_id = $2 AND transaction_type = $3`,
+			id, milk, tt.transactionType).Scan(&delta, &note)
+		if err != nil {
+			t.Fatalf("%s: failed to get the restoring transaction: %v", tt.name, err)
+		}
+		want := fmt.Sprintf(" for 2 x menu item #%d %s%d", latte, tt.note, id)
+		if delta != 400 || !strings.HasPrefix(note, "Restored 400") || !strings.HasSuffix(note, want) {
+			t.Errorf("%s: delta = %v, note = %q, want 400 and a note restoring 400%s", tt.name, delta, note, want)
+		}
+		if quantity := ingredientQuantity(t, db, milk); quantity != 1000 {
+			t.Errorf("%s: milk = %v, want the restored 1000", tt.name, quantity)
+		}
+	}
+}
+
+func TestGetOrderInventoryTransactionsOfDeletedOrder(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	locationID := createTestLocation(t, db, "test-trace")
+	ctx := models.WithLocationID(context.Background(), locationID)
+
+	milk := createTestIngredient(t, db, locationID, "test trace milk", 1000, false)
+	latte := createTestMenuItem(t, db, locationID, "test trace latte", 3.50, map[int]float64{milk: 150})
+
+	id, _, err := repo.CreateOrder(ctx, models.Order{
+		Items: []models.OrderItem{{MenuItemID: latte, Quantity: 2}},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if err := repo.DeleteOrder(ctx, id); err != nil {
+		t.Fatalf("DeleteOrder: %v", err)
+	}
+
+	transactions, err := repo.GetOrderInventoryTransactions(ctx, id)
+	if err != nil {
+		t.Fatalf("GetOrderInventoryTransactions: %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("got %d transactions, want the usage and the restoration: %+v", len(transactions), transactions)
+	}
+	want := []struct {
+		transactionType string
+		delta           float64
+	}{
+		{"order_usage", -300},
+		{"order_deletion", 300},
+	}
+	for i, w := range want {
+		got := transactions[i]
+		if got.TransactionType != w.transactionType || got.Delta != w.delta || got.IngredientID != milk {
+			t.Errorf("transaction %d = %+v, want %s of %v milk", i, got, w.transactionType, w.delta)
+		}
+	}
+}
+
+func TestUpdateOrderDeductsFractionalDelta(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	ctx := context.Background()
+
+	syrup := createTestIngredient(t, db, models.DefaultLocationID, "test fractional syrup", 100, false)
+	foam := createTestIngredient(t, db, models.DefaultLocationID, "test fractional foam", 10, false)
+	latte := createTestMenuItem(t, db, models.DefaultLocationID, "test fractional latte", 3.50, map[int]float64{syrup: 12.345})
+	cortado := createTestMenuItem(t, db, models.DefaultLocationID, "test fractional cortado", 3.00, map[int]float64{foam: 0.1})
+
+	// 0.1 + 0.2 of foam in two lines
+	id, _, err := repo.CreateOrder(ctx, models.Order{
+		Items: []models.OrderItem{
+			{MenuItemID: latte, Quantity: 2},
+			{MenuItemID: cortado, Quantity: 1},
+			{MenuItemID: cortado, Quantity: 2},
+		},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if quantity := ingredientQuantity(t, db, syrup); quantity != 75.31 {
+		t.Errorf("syrup after CreateOrder = %v, want 100 - 2 x 12.345 = 75.31", quantity)
+	}
+
+	// Three lattes and the same 0.3 of foam in one line
+	if err := repo.UpdateOrder(ctx, id, models.Order{
+		Items: []models.OrderItem{
+			{MenuItemID: latte, Quantity: 3},
+			{MenuItemID: cortado, Quantity: 3},
+		},
+	}); err != nil {
+		t.Fatalf("UpdateOrder: %v", err)
+	}
+	if quantity := ingredientQuantity(t, db, syrup); quantity != 62.965 {
+		t.Errorf("syrup after UpdateOrder = %v, want 100 - 3 x 12.345 = 62.965", quantity)
+	}
+	if quantity := ingredientQuantity(t, db, foam); quantity != 9.7 {
+		t.Errorf("foam after UpdateOrder = %v, want the unchanged 9.7", quantity)
+	}
+
+	// Only the syrup changed, by one latte's worth
+	rows, err := db.Query(`
+        SELECT ingredient_id, delta FROM inventory_transactions
+        WHERE reference_id = $1 AND transaction_type = 'order_update'`, id)
+	if err != nil {
+		t.Fatalf("failed to get update transactions: %v", err)
+	}
+	defer rows.Close()
+	deltas := make(map[int]float64)
+	for rows.Next() {
+		var ingredientID int
+		var delta float64
+		if err := rows.Scan(&ingredientID, &delta); err != nil {
+			t.Fatalf("failed to scan update transaction: %v", err)
+		}
+		deltas[ingredientID] = delta
+	}
+	if len(deltas) != 1 || deltas[syrup] != -12.345 {
+		t.Errorf("order_update deltas = %v, want only -12.345 of syrup", deltas)
+	}
+}
+
+func TestGetStaleOrdersReturnsOldestFirst(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "STALE")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	oldest := createTestOrder(t, db, location, now.Add(-30*time.Minute), 5)
+	stale := createTestOrder(t, db, location, now.Add(-15*time.Minute), 5)
+	fresh := createTestOrder(t, db, location, now.Add(-2*time.Minute), 5)
+	// Only orders still in the status count
+	ready := createTestOrder(t, db, location, now.Add(-40*time.Minute), 5)
+	for _, id := range []int{oldest, stale, fresh} {
+		setTestOrderStatus(t, db, id, "preparing")
+	}
+	setTestOrderStatus(t, db, ready, "ready")
+
+	orders, err := repo.GetStaleOrders(ctx, "preparing", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("GetStaleOrders: %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != oldest || orders[1].ID != stale {
+		t.Errorf("GetStaleOrders = %+v, want orders %d then %d", orders, oldest, stale)
+	}
+}
+
+func TestBulkUpdateStatusAdvancesPreparingOrders(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "BULK")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	first := createTestOrder(t, db, location, now.Add(-time.Hour), 5)
+	second := createTestOrder(t, db, location, now.Add(-time.Minute), 5)
+	pending := createTestOrder(t, db, location, now.Add(-time.Minute), 5)
+	setTestOrderStatus(t, db, first, "preparing")
+	setTestOrderStatus(t, db, second, "preparing")
+	setTestOrderStatus(t, db, pending, "pending")
+
+	response, err := repo.BulkUpdateStatus(ctx, "ready", models.OrderFilters{Status: "preparing"})
+	if err != nil {
+		t.Fatalf("BulkUpdateStatus: %v", err)
+	}
+	if response.Matched != 2 || response.Succeeded != 2 || response.Skipped != 0 ||
+		len(response.UpdatedOrderIDs) != 2 || response.UpdatedOrderIDs[0] != first || response.UpdatedOrderIDs[1] != second {
+		t.Errorf("BulkUpdateStatus = %+v, want orders %d and %d advanced", response, first, second)
+	}
+	for _, id := range []int{first, second} {
+		var status string
+		var history int
+		if err := db.QueryRow(`
+            SELECT o.status, (SELECT COUNT(*) FROM order_status_history h WHERE h.order_id = o.id AND h.status = 'ready')
+            FROM orders o WHERE o.id = $1`, id).Scan(&status, &history); err != nil {
+			t.Fatalf("failed to get order %d: %v", id, err)
+		}
+		if status != "ready" || history != 1 {
+			t.Errorf("order %d: status %s with %d ready history rows, want ready with 1", id, status, history)
+		}
+	}
+
+	// Without a status filter every order matches, and those the state machine forbids are skipped
+	response, err = repo.BulkUpdateStatus(ctx, "ready", models.OrderFilters{})
+	if err != nil {
+		t.Fatalf("BulkUpdateStatus: %v", err)
+	}
+	if response.Matched != 3 || response.Succeeded != 0 || response.Skipped != 3 {
+		t.Errorf("BulkUpdateStatus = %+v, want all 3 orders skipped", response)
+	}
+	for _, skipped := range response.SkippedOrders {
+		if skipped.OrderID == pending && skipped.Reason != "cannot transition from pending to ready" {
+			t.Errorf("pending order skipped with %q", skipped.Reason)
+		}
+	}
+}
+
+func TestGetQueuePositionCountsOrdersAhead(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "QUEUE")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	latte := createTestMenuItem(t, db, location, "test queue latte", 4, nil)
+	if _, err := db.Exec(`UPDATE menu_items SET prep_time_minutes = 4 WHERE id = $1`, latte); err != nil {
+		t.Fatalf("failed to set prep time: %v", err)
+	}
+	// The cookie has no prep time and takes the default of 3 minutes
+	cookie := createTestMenuItem(t, db, location, "test queue cookie", 2, nil)
+
+	queue := []struct {
+		age    time.Duration
+		status string
+		items  map[int]int
+	}{
+		{30 * time.Minute, "preparing", map[int]int{latte: 2}}, // 8 minutes ahead
+		{25 * time.Minute, "ready", map[int]int{latte: 5}},     // out of the queue
+		{20 * time.Minute, "pending", map[int]int{cookie: 1}},  // 3 minutes ahead
+		{10 * time.Minute, "pending", map[int]int{latte: 1}},   // the order asked about
+		{5 * time.Minute, "pending", map[int]int{latte: 3}},    // behind it
+	}
+	ids := make([]int, len(queue))
+	for i, q := range queue {
+		ids[i] = createTestOrder(t, db, location, now.Add(-q.age), 0)
+		setTestOrderStatus(t, db, ids[i], q.status)
+		for menuItemID, quantity := range q.items {
+			createTestOrderItem(t, db, ids[i], menuItemID, quantity, 0)
+		}
+	}
+
+	eta, err := repo.GetQueuePosition(ctx, ids[3], 3)
+	if err != nil {
+		t.Fatalf("GetQueuePosition: %v", err)
+	}
+	if eta.Status != "pending" || eta.OwnPrepMinutes != 4 || eta.OrdersAhead != 2 || eta.MinutesAhead != 11 {
+		t.Errorf("GetQueuePosition = %+v, want 4 own minutes behind 2 orders of 11 minutes", eta)
+	}
+}
+
+func TestGetOrdersByIDsSkipsMissingOrders(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "BGET")
+	other := createTestLocation(t, db, "BGETO")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	latte := createTestMenuItem(t, db, location, "test batch get latte", 4, nil)
+	first := createTestOrder(t, db, location, time.Now(), 8)
+	createTestOrderItem(t, db, first, latte, 2, 4)
+	second := createTestOrder(t, db, location, time.Now(), 5)
+	// Orders of other locations are as missing as deleted ones
+	elsewhere := createTestOrder(t, db, other, time.Now(), 5)
+	deleted := createTestOrder(t, db, location, time.Now(), 5)
+	if _, err := db.Exec(`DELETE FROM orders WHERE id = $1`, deleted); err != nil {
+		t.Fatalf("failed to delete order: %v", err)
+	}
+
+	orders, err := repo.GetOrdersByIDs(ctx, []int{second, elsewhere, first, deleted})
+	if err != nil {
+		t.Fatalf("GetOrdersByIDs: %v", err)
+	}
+	if len(orders) != 2 || orders[0].ID != first || orders[1].ID != second {
+		t.Fatalf("GetOrdersByIDs = %+v, want orders %d and %d", orders, first, second)
+	}
+	if len(orders[0].Items) != 1 || orders[0].Items[0].MenuItemID != latte || orders[0].Items[0].Quantity != 2 {
+		t.Errorf("items of order %d = %+v, want 2 lattes", first, orders[0].Items)
+	}
+}
+
+func TestCreateOrderStoresServerTimestamps(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "STAMP")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	latte := createTestMenuItem(t, db, location, "test stamp latte", 4, nil)
+	backdated := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	id, _, err := repo.CreateOrder(ctx, models.Order{
+		Items:     []models.OrderItem{{MenuItemID: latte, Quantity: 1}},
+		CreatedAt: backdated,
+		UpdatedAt: backdated,
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	var createdAt, updatedAt time.Time
+	if err := db.QueryRow(`SELECT created_at, updated_at FROM orders WHERE id = $1`, id).Scan(&createdAt, &updatedAt); err != nil {
+		t.Fatalf("failed to get order timestamps: %v", err)
+	}
+	for _, stamp := range []time.Time{createdAt, updatedAt} {
+		if time.Since(stamp) > time.Minute {
+			t.Errorf("stored timestamp = %v, want the time of the insert", stamp)
+		}
+	}
+}
+
+func TestUpdateOrderStatusFollowsStateMachine(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "STATUS")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	id := createTestOrder(t, db, location, time.Now(), 5)
+	setTestOrderStatus(t, db, id, "pending")
+
+	for _, status := range []string{"preparing", "ready", "delivered"} {
+		if _, err := repo.UpdateOrderStatus(ctx, id, status); err != nil {
+			t.Fatalf("UpdateOrderStatus(%s): %v", status, err)
+		}
+	}
+	response, err := repo.UpdateOrderStatus(ctx, id, "preparing")
+	if !errors.Is(err, models.ErrInvalidTransition) {
+		t.Errorf("UpdateOrderStatus(delivered to preparing) = %+v, %v, want ErrInvalidTransition", response, err)
+	}
+
+	rows, err := db.Query(`SELECT status FROM order_status_history WHERE order_id = $1 ORDER BY id`, id)
+	if err != nil {
+		t.Fatalf("failed to get status history: %v", err)
+	}
+	defer rows.Close()
+	var history []string
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			t.Fatalf("failed to scan status history: %v", err)
+		}
+		history = append(history, status)
+	}
+	if strings.Join(history, ",") != "preparing,ready,delivered" {
+		t.Errorf("status history = %v, want preparing, ready, delivered", history)
+	}
+}
+
+func TestGetAllOrdersFiltersByCustomization(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "CUSTOM")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	latte := createTestMenuItem(t, db, location, "test custom latte", 4, nil)
+	customizations := []string{
+		`{"milk": "Oat"}`,
+		`{"extras": {"oat_topping": true}}`, // keys match at any depth
+		`{"milk": "whole", "shots": 2}`,
+		``,
+	}
+	ids := make([]int, len(customizations))
+	for i, c := range customizations {
+		ids[i] = createTestOrder(t, db, location, now.Add(time.Duration(i)*time.Second), 4)
+		createTestOrderItem(t, db, ids[i], latte, 1, 4)
+		if c != "" {
+			if _, err := db.Exec(`UPDATE order_items SET customizations = $2 WHERE order_id = $1`, ids[i], c); err != nil {
+				t.Fatalf("failed to customize order %d: %v", ids[i], err)
+			}
+		}
+	}
+
+	response, err := repo.GetAllOrders(ctx, models.OrderFilters{Customization: "oat", Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAllOrders: %v", err)
+	}
+	// Newest first
+	if response.TotalCount != 2 || len(response.Orders) != 2 || response.Orders[0].ID != ids[1] || response.Orders[1].ID != ids[0] {
+		t.Errorf("GetAllOrders = %d orders %+v, want orders %d and %d", response.TotalCount, response.Orders, ids[1], ids[0])
+	}
+}
+
+// countingConnector records the statements run on its connections. Its connections hide the driver's
+// direct query methods, so every statement is prepared through Prepare.
+type countingConnector struct {
+	driver.Connector
+	mu      sync.Mutex
+	queries []string
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, connector: c}, nil
+}
+
+// count returns how many recorded statements contain substr
+func (c *countingConnector) count(substr string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, query := range c.queries {
+		if strings.Contains(query, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+type countingConn struct {
+	driver.Conn
+	connector *countingConnector
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	c.connector.mu.Lock()
+	c.connector.queries = append(c.connector.queries, query)
+	c.connector.mu.Unlock()
+	return c.Conn.Prepare(query)
+}
+
+func TestCalculateOrderTotalFetchesPricesInOneQuery(t *testing.T) {
+	db := openTestDB(t)
+	location := createTestLocation(t, db, "PRICES")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	latte := createTestMenuItem(t, db, location, "test prices latte", 3.50, nil)
+	tea := createTestMenuItem(t, db, location, "test prices tea", 2, nil)
+	muffin := createTestMenuItem(t, db, location, "test prices muffin", 2.25, nil)
+
+	pqConnector, err := pq.NewConnector(os.Getenv("TEST_DATABASE_URL"))
+	if err != nil {
+		t.Fatalf("failed to create connector: %v", err)
+	}
+	connector := &countingConnector{Connector: pqConnector}
+	counted := sql.OpenDB(connector)
+	t.Cleanup(func() { counted.Close() })
+	repo := newTestOrderRepository(counted)
+
+	// 20 lines of three menu items
+	var items []models.OrderItem
+	for _, id := range []int{latte, tea, muffin, latte, tea} {
+		for i := 0; i < 4; i++ {
+			items = append(items, models.OrderItem{MenuItemID: id, Quantity: 1})
+		}
+	}
+	total, err := repo.calculateOrderTotal(ctx, items)
+	if err != nil {
+		t.Fatalf("calculateOrderTotal: %v", err)
+	}
+	if total != 53 {
+		t.Errorf("total = %v, want 53", total)
+	}
+	if n := connector.count("FROM menu_items"); n != 1 {
+		t.Errorf("ran %d menu item price queries, want 1", n)
+	}
+
+	// A missing menu item is still reported by its ID
+	items = append(items, models.OrderItem{MenuItemID: -1, Quantity: 1})
+	if _, err := repo.calculateOrderTotal(ctx, items); !errors.Is(err, models.ErrInvalidMenuItemID) || !strings.HasSuffix(err.Error(), ": -1") {
+		t.Errorf("error = %v, want ErrInvalidMenuItemID for -1", err)
+	}
+}
+
+func TestCreateOrderDecrementsStockTrackedItem(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "STOCK")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	// A leftover recipe of a stock tracked item is ignored
+	flour := createTestIngredient(t, db, location, "test stock flour", 1000, false)
+	cookie := createTestMenuItem(t, db, location, "test stock cookie", 2.50, map[int]float64{flour: 50})
+	if _, err := db.Exec(`UPDATE menu_items SET stock_tracked = TRUE, stock_quantity = 5 WHERE id = $1`, cookie); err != nil {
+		t.Fatalf("failed to track stock of menu item: %v", err)
+	}
+	stock := func() int {
+		t.Helper()
+		var quantity int
+		if err := db.QueryRow(`SELECT stock_quantity FROM menu_items WHERE id = $1`, cookie).Scan(&quantity); err != nil {
+			t.Fatalf("failed to get stock of menu item: %v", err)
+		}
+		return quantity
+	}
+	order := models.Order{Items: []models.OrderItem{{MenuItemID: cookie, Quantity: 3}}}
+
+	id, _, err := repo.CreateOrder(ctx, order, "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if got := stock(); got != 2 {
+		t.Errorf("cookie stock = %d, want 2", got)
+	}
+	if got := ingredientQuantity(t, db, flour); got != 1000 {
+		t.Errorf("flour = %v, want it untouched at 1000", got)
+	}
+	var transactions int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM inventory_transactions WHERE reference_id = $1`, id).Scan(&transactions); err != nil {
+		t.Fatalf("failed to count inventory transactions: %v", err)
+	}
+	if transactions != 0 {
+		t.Errorf("order recorded %d inventory transactions, want none", transactions)
+	}
+
+	if _, _, err := repo.CreateOrder(ctx, order, ""); !errors.Is(err, models.ErrInsufficientInventory) {
+		t.Errorf("CreateOrder beyond the stock error = %v, want ErrInsufficientInventory", err)
+	}
+	if got := stock(); got != 2 {
+		t.Errorf("cookie stock after a rejected order = %d, want 2", got)
+	}
+
+	if err := repo.CancelOrder(ctx, id); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if got := stock(); got != 5 {
+		t.Errorf("cookie stock after cancelling = %d, want the restored 5", got)
+	}
+}
+
+func TestOrderTotalsComputedWithoutClientPrices(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "NOPRICE")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	latte := createTestMenuItem(t, db, location, "test noprice latte", 3.50, nil)
+	stored := func(id int) (total, priceAtOrder models.Money) {
+		t.Helper()
+		err := db.QueryRow(`
+            SELECT o.total_price, oi.price_at_order
+            FROM orders o JOIN order_items oi ON oi.order_id = o.id
+            WHERE o.id = $1`, id).Scan(&total, &priceAtOrder)
+		if err != nil {
+			t.Fatalf("failed to get total of order %d: %v", id, err)
+		}
+		return total, priceAtOrder
+	}
+
+	// No total is sent, and a client's item price is ignored
+	id, _, err := repo.CreateOrder(ctx, models.Order{
+		Items: []models.OrderItem{{MenuItemID: latte, Quantity: 2, PriceAtOrder: 0.01}},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if total, price := stored(id); total != 7 || price != 3.50 {
+		t.Errorf("created order total = %v at %v each, want 7 at 3.50", total, price)
+	}
+
+	err = repo.UpdateOrder(ctx, id, models.Order{
+		Items:      []models.OrderItem{{MenuItemID: latte, Quantity: 3}},
+		TotalPrice: 999,
+	})
+	if err != nil {
+		t.Fatalf("UpdateOrder: %v", err)
+	}
+	if total, price := stored(id); total != 10.50 || price != 3.50 {
+		t.Errorf("updated order total = %v at %v each, want 10.50 at 3.50", total, price)
+	}
+
+	response, err := repo.BatchProcessOrders(ctx, []models.Order{
+		{Items: []models.OrderItem{{MenuItemID: latte, Quantity: 1}}},
+	})
+	if err != nil {
+		t.Fatalf("BatchProcessOrders: %v", err)
+	}
+	if len(response.ProcessedOrders) != 1 || response.ProcessedOrders[0].Status != "accepted" || response.ProcessedOrders[0].Total != 3.50 {
+		t.Fatalf("batch = %+v, want one accepted order of 3.50", response.ProcessedOrders)
+	}
+	if total, _ := stored(response.ProcessedOrders[0].OrderID); total != 3.50 {
+		t.Errorf("batch order total = %v, want 3.50", total)
+	}
+}
+
+func TestDeductionPointOfEachMode(t *testing.T) {
+	db := openTestDB(t)
+	location := createTestLocation(t, db, "DEDUCT")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	for _, mode := range []string{DeductOnCreate, DeductOnPrepare} {
+		repo := NewOrderRepository(db, DefaultUsageRounding, mode, false)
+		milk := createTestIngredient(t, db, location, "test deduct milk "+mode, 1000, false)
+		latte := createTestMenuItem(t, db, location, "test deduct latte "+mode, 3.50, map[int]float64{milk: 200})
+		order := models.Order{Items: []models.OrderItem{{MenuItemID: latte, Quantity: 1}}}
+
+		id, _, err := repo.CreateOrder(ctx, order, "")
+		if err != nil {
+			t.Fatalf("%s: CreateOrder: %v", mode, err)
+		}
+		want := 800.0
+		if mode == DeductOnPrepare {
+			want = 1000
+		}
+		if got := ingredientQuantity(t, db, milk); got != want {
+			t.Errorf("%s: milk after creating = %v, want %v", mode, got, want)
+		}
+
+		// Either way the stock is taken by the time the order is prepared, and only once
+		if _, err := repo.UpdateOrderStatus(ctx, id, "preparing"); err != nil {
+			t.Fatalf("%s: UpdateOrderStatus: %v", mode, err)
+		}
+		if got := ingredientQuantity(t, db, milk); got != 800 {
+			t.Errorf("%s: milk after preparing = %v, want 800", mode, got)
+		}
+		if err := repo.CancelOrder(ctx, id); err != nil {
+			t.Fatalf("%s: CancelOrder: %v", mode, err)
+		}
+		if got := ingredientQuantity(t, db, milk); got != 1000 {
+			t.Errorf("%s: milk after cancelling a prepared order = %v, want the restored 1000", mode, got)
+		}
+
+		// Cancelling before preparing restores only what was deducted
+		id, _, err = repo.CreateOrder(ctx, order, "")
+		if err != nil {
+			t.Fatalf("%s: CreateOrder: %v", mode, err)
+		}
+		if err := repo.CancelOrder(ctx, id); err != nil {
+			t.Fatalf("%s: CancelOrder: %v", mode, err)
+		}
+		if got := ingredientQuantity(t, db, milk); got != 1000 {
+			t.Errorf("%s: milk after cancelling a new order = %v, want 1000", mode, got)
+		}
+	}
+}
+
+func TestOrdersRejectInactiveCustomers(t *testing.T) {
+	db := openTestDB(t)
+	repo := newTestOrderRepository(db)
+	location := createTestLocation(t, db, "INACTIVE")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	cookie := createTestMenuItem(t, db, location, "test inactive cookie", 1.50, nil)
+	items := []models.OrderItem{{MenuItemID: cookie, Quantity: 1}}
+	active := createTestCustomer(t, db, "Active")
+	inactive := createTestCustomer(t, db, "Inactive")
+	if _, err := db.Exec(`UPDATE customers SET is_active = FALSE WHERE id = $1`, inactive); err != nil {
+		t.Fatalf("failed to deactivate customer: %v", err)
+	}
+
+	if _, _, err := repo.CreateOrder(ctx, models.Order{CustomerID: inactive, Items: items}, ""); err != models.ErrCustomerInactive {
+		t.Errorf("CreateOrder for an inactive customer error = %v, want ErrCustomerInactive", err)
+	}
+
+	// Guest orders stay allowed, and are stored without a customer when created or updated
+	guest, _, err := repo.CreateOrder(ctx, models.Order{Items: items}, "")
+	if err != nil {
+		t.Fatalf("CreateOrder for a guest: %v", err)
+	}
+	id, _, err := repo.CreateOrder(ctx, models.Order{CustomerID: active, Items: items}, "")
+	if err != nil {
+		t.Fatalf("CreateOrder for an active customer: %v", err)
+	}
+	if err := repo.UpdateOrder(ctx, id, models.Order{CustomerID: inactive, Items: items}); err != models.ErrCustomerInactive {
+		t.Errorf("UpdateOrder to an inactive customer error = %v, want ErrCustomerInactive", err)
+	}
+	if err := repo.UpdateOrder(ctx, id, models.Order{Items: items}); err != nil {
+		t.Fatalf("UpdateOrder to a guest: %v", err)
+	}
+	for _, orderID := range []int{guest, id} {
+		var customerID sql.NullInt64
+		if err := db.QueryRow(`SELECT customer_id FROM orders WHERE id = $1`, orderID).Scan(&customerID); err != nil {
+			t.Fatalf("failed to get customer of order %d: %v", orderID, err)
+		}
+		if customerID.Valid {
+			t.Errorf("order %d customer = %d, want a guest order without one", orderID, customerID.Int64)
+		}
+	}
+}
+
+func TestCreateOrderRequestsReorderBelowLevel(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewOrderRepository(db, DefaultUsageRounding, DeductOnCreate, true)
+	location := createTestLocation(t, db, "REORDER")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	milk := createTestIngredient(t, db, location, "test reorder milk", 500, false)
+	beans := createTestIngredient(t, db, location, "test reorder beans", 1000, false)
+	if _, err := db.Exec(`UPDATE inventory SET reorder_level = 300 WHERE id = $1`, milk); err != nil {
+		t.Fatalf("failed to set reorder level: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE inventory SET reorder_level = 100 WHERE id = $1`, beans); err != nil {
+		t.Fatalf("failed to set reorder level: %v", err)
+	}
+	latte := createTestMenuItem(t, db, location, "test reorder latte", 4, map[int]float64{milk: 150, beans: 20})
+	order := models.Order{Items: []models.OrderItem{{MenuItemID: latte, Quantity: 1}}}
+
+	// 350 ml of milk is left, still above its level; the second order takes it to 200 and the third to 50
+	var ids []int
+	for i := 0; i < 3; i++ {
+		id, _, err := repo.CreateOrder(ctx, order, "")
+		if err != nil {
+			t.Fatalf("CreateOrder %d: %v", i+1, err)
+		}
+		ids = append(ids, id)
+	}
+
+	rows, err := db.Query(`
+        SELECT ingredient_id, quantity, reorder_level, order_id FROM reorder_requests
+        WHERE ingredient_id IN ($1, $2) AND status = 'open'`, milk, beans)
+	if err != nil {
+		t.Fatalf("failed to get reorder requests: %v", err)
+	}
+	defer rows.Close()
+	var requests []struct {
+		ingredientID, orderID int
+		quantity, level       float64
+	}
+	for rows.Next() {
+		var r struct {
+			ingredientID, orderID int
+			quantity, level       float64
+		}
+		if err := rows.Scan(&r.ingredientID, &r.quantity, &r.level, &r.orderID); err != nil {
+			t.Fatalf("failed to scan reorder request: %v", err)
+		}
+		requests = append(requests, r)
+	}
+	// The open request isn't duplicated by the third order
+	if len(requests) != 1 {
+		t.Fatalf("reorder requests = %+v, want one for the milk", requests)
+	}
+	if r := requests[0]; r.ingredientID != milk || r.quantity != 200 || r.level != 300 || r.orderID != ids[1] {
+		t.Errorf("reorder request = %+v, want milk at 200 below 300 raised by order %d", r, ids[1])
+	}
+}
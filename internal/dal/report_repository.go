@@ -17,6 +17,24 @@ type ReportRepository interface {
 	GetPopularItems(ctx context.Context, limit int) ([]models.PopularItem, error)
 	GetOrderedItemsByPeriod(ctx context.Context, period string, month time.Month, year int) (models.PeriodReportResponse, error)
 	GetFullTextSearch(ctx context.Context, query string, filter string, minPrice, maxPrice float64) (models.SearchResult, error)
+	GetOrderCountInWindow(ctx context.Context, window time.Duration) (int, error)
+	GetCostVariance(ctx context.Context, startDate, endDate time.Time) ([]models.IngredientCostVariance, []models.MenuItemCostImpact, error)
+	GetRestockHistory(ctx context.Context, ingredientID int, startDate, endDate time.Time) ([]models.RestockTransaction, error)
+	GetDailySales(ctx context.Context, startDate, endDate time.Time) ([]models.SalesTrend, error)
+	GetSalesTrend(ctx context.Context, startDate, endDate time.Time, granularity string) ([]models.SalesTrend, error)
+	GetRefundTrend(ctx context.Context, granularity string, startDate, endDate time.Time) ([]models.RefundTrendBucket, error)
+	GetMenuItemMargins(ctx context.Context) ([]models.MenuItemMargin, error)
+	GetPriceMismatches(ctx context.Context, startDate, endDate time.Time) ([]models.PriceMismatch, error)
+	GetHourlyLoad(ctx context.Context, weekday time.Weekday, since, until time.Time) ([]models.HourlyStaffing, error)
+	GetHourlyProfit(ctx context.Context, startDate, endDate time.Time) ([]models.HourlyProfit, error)
+	GetSalesBaseline(ctx context.Context, date time.Time, baselineDays int) (models.SalesAnomalyMetric, models.SalesAnomalyMetric, error)
+	GetMenuItemContributions(ctx context.Context, startDate, endDate time.Time) ([]models.MenuItemContribution, error)
+	GetTotalMismatches(ctx context.Context) ([]models.TotalMismatch, error)
+	GetOrderSizeCounts(ctx context.Context, bounds []float64) (map[int]int, error)
+	GetSalesByPaymentMethod(ctx context.Context, startDate, endDate time.Time) ([]models.PaymentMethodSales, error)
+	GetRepeatOrderCounts(ctx context.Context, startDate, endDate time.Time) (models.RepeatRateResponse, error)
+	GetCustomerSpending(ctx context.Context, customerID int) (models.CustomerSpendingResponse, error)
+	GetDiscountTotals(ctx context.Context, startDate, endDate time.Time) (models.DiscountSummaryResponse, error)
 }
 
 type reportRepository struct {
@@ -33,12 +51,12 @@ func (r *reportRepository) GetTotalSales(ctx context.Context, startDate, endDate
         FROM orders
     `
 
-	var args []interface{}
-	var whereClauses []string
+	args := []interface{}{models.LocationIDFromContext(ctx)}
+	whereClauses := []string{"location_id = $1"}
 
 	// Handle start date if provided
 	if startDate != "" {
-		whereClauses = append(whereClauses, "created_at >= $1")
+		whereClauses = append(whereClauses, fmt.Sprintf("created_at >= $%d", len(args)+1))
 		args = append(args, startDate)
 	}
 
@@ -49,10 +67,7 @@ func (r *reportRepository) GetTotalSales(ctx context.Context, startDate, endDate
 		args = append(args, endDate)
 	}
 
-	// Add WHERE clause if we have any conditions
-	if len(whereClauses) > 0 {
-		query += " WHERE " + strings.Join(whereClauses, " AND ")
-	}
+	query += " WHERE " + strings.Join(whereClauses, " AND ")
 
 	var totalSales float64
 	err := r.db.QueryRowContext(ctx, query, args...).Scan(&totalSales)
@@ -63,6 +78,22 @@ func (r *reportRepository) GetTotalSales(ctx context.Context, startDate, endDate
 	return totalSales, nil
 }
 
+func (r *reportRepository) GetOrderCountInWindow(ctx context.Context, window time.Duration) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM orders
+        WHERE created_at >= NOW() - make_interval(secs => $1)
+        AND location_id = $2`,
+		window.Seconds(), models.LocationIDFromContext(ctx),
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count orders in window: %w", err)
+	}
+
+	return count, nil
+}
+
 func (r *reportRepository) GetPopularItems(ctx context.Context, limit int) ([]models.PopularItem, error) {
 	query := `
 		SELECT 
@@ -72,12 +103,13 @@ func (r *reportRepository) GetPopularItems(ctx context.Context, limit int) ([]mo
 			SUM(oi.quantity) as total_quantity
 		FROM order_items oi
 		JOIN menu_items mi ON oi.menu_item_id = mi.id
+		WHERE mi.location_id = $2
 		GROUP BY mi.id, mi.name
 		ORDER BY total_quantity DESC
 		LIMIT $1
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, limit)
+	rows, err := r.db.QueryContext(ctx, query, limit, models.LocationIDFromContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get popular items: %w", err)
 	}
@@ -118,10 +150,11 @@ func (r *reportRepository) GetOrderedItemsByPeriod(ctx context.Context, period s
             FROM orders
             WHERE EXTRACT(MONTH FROM created_at) = $1
             AND EXTRACT(YEAR FROM created_at) = $2
+            AND location_id = $3
             GROUP BY day
             ORDER BY day
         `
-		args = []interface{}{month, year}
+		args = []interface{}{month, year, models.LocationIDFromContext(ctx)}
 	case "month":
 		query = `
             SELECT 
@@ -130,12 +163,41 @@ func (r *reportRepository) GetOrderedItemsByPeriod(ctx context.Context, period s
                 COALESCE(SUM(total_price), 0) as total_sales
             FROM orders
             WHERE EXTRACT(YEAR FROM created_at) = $1
+            AND location_id = $2
             GROUP BY month_name, EXTRACT(MONTH FROM created_at)
             ORDER BY EXTRACT(MONTH FROM created_at)
         `
-		args = []interface{}{year}
+		args = []interface{}{year, models.LocationIDFromContext(ctx)}
+	case "week":
+		// ISO weeks belong to the ISO year, so early January can fall in week 52/53 of the previous
+		// year and late December in week 1 of the next
+		query = `
+            SELECT 
+                EXTRACT(WEEK FROM created_at)::int as week,
+                COUNT(*) as order_count,
+                COALESCE(SUM(total_price), 0) as total_sales
+            FROM orders
+            WHERE EXTRACT(ISOYEAR FROM created_at) = $1
+            AND location_id = $2
+            GROUP BY week
+            ORDER BY week
+        `
+		args = []interface{}{year, models.LocationIDFromContext(ctx)}
+	case "year":
+		response.Year = 0
+		query = `
+            SELECT 
+                EXTRACT(YEAR FROM created_at)::int as year,
+                COUNT(*) as order_count,
+                COALESCE(SUM(total_price), 0) as total_sales
+            FROM orders
+            WHERE location_id = $1
+            GROUP BY year
+            ORDER BY year
+        `
+		args = []interface{}{models.LocationIDFromContext(ctx)}
 	default:
-		return models.PeriodReportResponse{}, fmt.Errorf("invalid period: %s", period)
+		return models.PeriodReportResponse{}, models.ErrInvalidPeriod
 	}
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
@@ -147,12 +209,12 @@ func (r *reportRepository) GetOrderedItemsByPeriod(ctx context.Context, period s
 	var reports []models.PeriodReport
 	for rows.Next() {
 		var report models.PeriodReport
-		if period == "day" {
-			var day int
-			if err := rows.Scan(&day, &report.OrderCount, &report.TotalSales); err != nil {
-				return models.PeriodReportResponse{}, fmt.Errorf("failed to scan day report: %w", err)
+		if period != "month" {
+			var number int
+			if err := rows.Scan(&number, &report.OrderCount, &report.TotalSales); err != nil {
+				return models.PeriodReportResponse{}, fmt.Errorf("failed to scan %s report: %w", period, err)
 			}
-			report.Period = day
+			report.Period = number
 		} else {
 			var monthName string
 			if err := rows.Scan(&monthName, &report.OrderCount, &report.TotalSales); err != nil {
@@ -186,9 +248,10 @@ func (r *reportRepository) GetFullTextSearch(ctx context.Context, query string,
 
 	// Validate filter
 	validFilters := map[string]bool{
-		"all":    true,
-		"menu":   true,
-		"orders": true,
+		"all":       true,
+		"menu":      true,
+		"orders":    true,
+		"customers": true,
 	}
 	if !validFilters[filter] {
 		return models.SearchResult{}, fmt.Errorf("invalid filter value: %s", filter)
@@ -203,11 +266,12 @@ func (r *reportRepository) GetFullTextSearch(ctx context.Context, query string,
             WHERE search_vector @@ plainto_tsquery('english', $1)
             AND ($2 = 0 OR price >= $2)
             AND ($3 = 0 OR price <= $3)
+            AND location_id = $4
             ORDER BY relevance DESC
             LIMIT 10
         `
 
-		rows, err := r.db.QueryContext(ctx, menuQuery, query, minPrice, maxPrice)
+		rows, err := r.db.QueryContext(ctx, menuQuery, query, minPrice, maxPrice, models.LocationIDFromContext(ctx))
 		if err != nil {
 			return models.SearchResult{}, fmt.Errorf("failed to search menu items: %w", err)
 		}
@@ -249,12 +313,13 @@ func (r *reportRepository) GetFullTextSearch(ctx context.Context, query string,
             )
             AND ($2 = 0 OR o.total_price >= $2)
             AND ($3 = 0 OR o.total_price <= $3)
+            AND o.location_id = $4
             GROUP BY o.id, c.first_name, c.last_name, o.total_price, o.status, o.special_instructions
             ORDER BY relevance DESC
             LIMIT 10
         `
 
-		rows, err := r.db.QueryContext(ctx, orderQuery, query, minPrice, maxPrice)
+		rows, err := r.db.QueryContext(ctx, orderQuery, query, minPrice, maxPrice, models.LocationIDFromContext(ctx))
 		if err != nil {
 			return models.SearchResult{}, fmt.Errorf("failed to search orders: %w", err)
 		}
@@ -274,6 +339,844 @@ func (r *reportRepository) GetFullTextSearch(ctx context.Context, query string,
 		}
 	}
 
+	// Search customers if filter includes "customers" or "all"; price bounds don't apply to them
+	if filter == "all" || filter == "customers" {
+		customerQuery := `
+            SELECT 
+                id,
+                first_name || ' ' || last_name as name,
+                COALESCE(email, '') as email,
+                ts_rank(
+                    setweight(to_tsvector('english', first_name || ' ' || last_name), 'A') ||
+                    setweight(to_tsvector('english', COALESCE(email, '')), 'B'),
+                    plainto_tsquery('english', $1)
+                ) as relevance
+            FROM customers
+            WHERE (
+                to_tsvector('english', first_name || ' ' || last_name) @@ plainto_tsquery('english', $1) OR
+                to_tsvector('english', COALESCE(email, '')) @@ plainto_tsquery('english', $1)
+            )
+            ORDER BY relevance DESC
+            LIMIT 10
+        `
+
+		rows, err := r.db.QueryContext(ctx, customerQuery, query)
+		if err != nil {
+			return models.SearchResult{}, fmt.Errorf("failed to search customers: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var customer models.SearchCustomer
+			if err := rows.Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Relevance); err != nil {
+				return models.SearchResult{}, fmt.Errorf("failed to scan customer: %w", err)
+			}
+			result.Customers = append(result.Customers, customer)
+		}
+		if err = rows.Err(); err != nil {
+			return models.SearchResult{}, fmt.Errorf("error after scanning customers: %w", err)
+		}
+	}
+
 	result.Total = len(result.MenuItems) + len(result.Orders) + len(result.Customers)
 	return result, nil
 }
+
+func (r *reportRepository) GetCostVariance(ctx context.Context, startDate, endDate time.Time) ([]models.IngredientCostVariance, []models.MenuItemCostImpact, error) {
+	// First and last cost change of each ingredient within the period
+	rows, err := r.db.QueryContext(ctx, `
+        WITH changes AS (
+            SELECT 
+                ingredient_id,
+                COALESCE(old_cost, 0) AS old_cost,
+                COALESCE(new_cost, 0) AS new_cost,
+                ROW_NUMBER() OVER (PARTITION BY ingredient_id ORDER BY changed_at ASC, id ASC) AS first_rn,
+                ROW_NUMBER() OVER (PARTITION BY ingredient_id ORDER BY changed_at DESC, id DESC) AS last_rn,
+                COUNT(*) OVER (PARTITION BY ingredient_id) AS change_count
+            FROM ingredient_cost_history
+            WHERE changed_at BETWEEN $1 AND $2
+        )
+        SELECT i.id, i.name, i.unit, f.old_cost, l.new_cost, f.change_count
+        FROM inventory i
+        JOIN changes f ON f.ingredient_id = i.id AND f.first_rn = 1
+        JOIN changes l ON l.ingredient_id = i.id AND l.last_rn = 1
+        WHERE i.location_id = $3
+        ORDER BY i.id`, startDate, endDate, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query cost history: %w", err)
+	}
+	defer rows.Close()
+
+	variances := []models.IngredientCostVariance{}
+	varianceByIngredient := make(map[int]float64)
+	for rows.Next() {
+		var v models.IngredientCostVariance
+		if err := rows.Scan(&v.IngredientID, &v.Name, &v.Unit, &v.StartCost, &v.EndCost, &v.Changes); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan cost variance: %w", err)
+		}
+		v.Variance = v.EndCost - v.StartCost
+		if v.StartCost != 0 {
+			v.VariancePercent = v.Variance / v.StartCost * 100
+		}
+		variances = append(variances, v)
+		varianceByIngredient[v.IngredientID] = v.Variance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	impacts := []models.MenuItemCostImpact{}
+	if len(variances) == 0 {
+		return variances, impacts, nil
+	}
+
+	ingredientIDs := make([]int, 0, len(varianceByIngredient))
+	for id := range varianceByIngredient {
+		ingredientIDs = append(ingredientIDs, id)
+	}
+
+	// Menu items using any of the changed ingredients
+	itemRows, err := r.db.QueryContext(ctx, `
+        SELECT mi.id, mi.name, mi.price, mii.ingredient_id, mii.quantity
+        FROM menu_item_ingredients mii
+        JOIN menu_items mi ON mi.id = mii.menu_item_id
+        WHERE mii.ingredient_id = ANY($1)
+        AND mi.location_id = $2
+        ORDER BY mi.id`, pq.Array(ingredientIDs), models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query affected menu items: %w", err)
+	}
+	defer itemRows.Close()
+
+	impactIndex := make(map[int]int)
+	for itemRows.Next() {
+		var menuItemID, ingredientID int
+		var name string
+		var price models.Money
+		var quantity float64
+		if err := itemRows.Scan(&menuItemID, &name, &price, &ingredientID, &quantity); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan affected menu item: %w", err)
+		}
+
+		idx, ok := impactIndex[menuItemID]
+		if !ok {
+			idx = len(impacts)
+			impactIndex[menuItemID] = idx
+			impacts = append(impacts, models.MenuItemCostImpact{MenuItemID: menuItemID, Name: name, Price: price})
+		}
+		impacts[idx].CostChange += quantity * varianceByIngredient[ingredientID]
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return variances, impacts, nil
+}
+
+func (r *reportRepository) GetRestockHistory(ctx context.Context, ingredientID int, startDate, endDate time.Time) ([]models.RestockTransaction, error) {
+	query := `
+        SELECT 
+            t.id,
+            t.ingredient_id,
+            i.name,
+            COALESCE(NULLIF(i.supplier_info->>'supplier', ''), 'Unknown Supplier'),
+            t.delta,
+            COALESCE(t.notes, ''),
+            t.created_at
+        FROM inventory_transactions t
+        JOIN inventory i ON i.id = t.ingredient_id
+        WHERE t.transaction_type = 'restock'
+        AND i.location_id = $1
+    `
+
+	args := []interface{}{models.LocationIDFromContext(ctx)}
+	if ingredientID != 0 {
+		args = append(args, ingredientID)
+		query += fmt.Sprintf(" AND t.ingredient_id = $%d", len(args))
+	}
+	if !startDate.IsZero() {
+		args = append(args, startDate)
+		query += fmt.Sprintf(" AND t.created_at >= $%d", len(args))
+	}
+	if !endDate.IsZero() {
+		args = append(args, endDate)
+		query += fmt.Sprintf(" AND t.created_at <= $%d", len(args))
+	}
+	query += " ORDER BY t.created_at, t.id"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query restock history: %w", err)
+	}
+	defer rows.Close()
+
+	restocks := []models.RestockTransaction{}
+	for rows.Next() {
+		var restock models.RestockTransaction
+		if err := rows.Scan(
+			&restock.ID,
+			&restock.IngredientID,
+			&restock.IngredientName,
+			&restock.Supplier,
+			&restock.Quantity,
+			&restock.Notes,
+			&restock.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan restock: %w", err)
+		}
+		restocks = append(restocks, restock)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return restocks, nil
+}
+
+// GetDailySales returns sales per day of non-cancelled orders between the dates (inclusive)
+func (r *reportRepository) GetDailySales(ctx context.Context, startDate, endDate time.Time) ([]models.SalesTrend, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            date_trunc('day', created_at) AS day,
+            COALESCE(SUM(total_price), 0) AS total_sales,
+            COUNT(*) AS order_count
+        FROM orders
+        WHERE status <> 'cancelled'
+        AND created_at >= $1
+        AND created_at < $2::timestamptz + INTERVAL '1 day'
+        AND location_id = $3
+        GROUP BY day
+        ORDER BY day`, startDate, endDate, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily sales: %w", err)
+	}
+	defer rows.Close()
+
+	var trends []models.SalesTrend
+	for rows.Next() {
+		var trend models.SalesTrend
+		if err := rows.Scan(&trend.Date, &trend.TotalSales, &trend.OrderCount); err != nil {
+			return nil, fmt.Errorf("failed to scan daily sales: %w", err)
+		}
+		if trend.OrderCount > 0 {
+			trend.AvgOrder = trend.TotalSales / models.Money(trend.OrderCount)
+		}
+		trends = append(trends, trend)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return trends, nil
+}
+
+// GetSalesTrend returns sales of non-cancelled orders per bucket between the dates, where granularity is a
+// date_trunc field (day, week or month). Every bucket of the range is returned, with zeros when it has no orders.
+func (r *reportRepository) GetSalesTrend(ctx context.Context, startDate, endDate time.Time, granularity string) ([]models.SalesTrend, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH buckets AS (
+            SELECT generate_series(
+                date_trunc($1, $2::timestamptz),
+                date_trunc($1, $3::timestamptz),
+                ('1 ' || $1)::interval
+            ) AS bucket
+        ),
+        sales AS (
+            SELECT 
+                date_trunc($1, created_at) AS bucket,
+                SUM(total_price) AS total_sales,
+                COUNT(*) AS order_count
+            FROM orders
+            WHERE status <> 'cancelled'
+            AND created_at BETWEEN $2 AND $3
+            AND location_id = $4
+            GROUP BY 1
+        )
+        SELECT 
+            b.bucket,
+            COALESCE(s.total_sales, 0),
+            COALESCE(s.order_count, 0)
+        FROM buckets b
+        LEFT JOIN sales s ON s.bucket = b.bucket
+        ORDER BY b.bucket`, granularity, startDate, endDate, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sales trend: %w", err)
+	}
+	defer rows.Close()
+
+	var trends []models.SalesTrend
+	for rows.Next() {
+		var trend models.SalesTrend
+		if err := rows.Scan(&trend.Date, &trend.TotalSales, &trend.OrderCount); err != nil {
+			return nil, fmt.Errorf("failed to scan sales trend: %w", err)
+		}
+		if trend.OrderCount > 0 {
+			trend.AvgOrder = trend.TotalSales / models.Money(trend.OrderCount)
+		}
+		trends = append(trends, trend)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning sales trend: %w", err)
+	}
+
+	return trends, nil
+}
+
+// GetRefundTrend returns gross sales of non-cancelled orders and refunds issued per bucket,
+// where granularity is a date_trunc field (day, week or month). Buckets with neither are omitted.
+func (r *reportRepository) GetRefundTrend(ctx context.Context, granularity string, startDate, endDate time.Time) ([]models.RefundTrendBucket, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH sales AS (
+            SELECT date_trunc($1, created_at) AS bucket, SUM(total_price) AS gross_sales
+            FROM orders
+            WHERE status <> 'cancelled'
+            AND created_at BETWEEN $2 AND $3
+            AND location_id = $4
+            GROUP BY bucket
+        ),
+        refunded AS (
+            SELECT date_trunc($1, rf.created_at) AS bucket, SUM(rf.amount) AS refunds
+            FROM refunds rf
+            JOIN orders o ON o.id = rf.order_id
+            WHERE rf.created_at BETWEEN $2 AND $3
+            AND o.location_id = $4
+            GROUP BY bucket
+        )
+        SELECT 
+            COALESCE(s.bucket, rf.bucket) AS bucket,
+            COALESCE(s.gross_sales, 0),
+            COALESCE(rf.refunds, 0)
+        FROM sales s
+        FULL OUTER JOIN refunded rf ON rf.bucket = s.bucket
+        ORDER BY bucket`, granularity, startDate, endDate, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refund trend: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []models.RefundTrendBucket
+	for rows.Next() {
+		var bucket models.RefundTrendBucket
+		var period time.Time
+		if err := rows.Scan(&period, &bucket.GrossSales, &bucket.Refunds); err != nil {
+			return nil, fmt.Errorf("failed to scan refund trend: %w", err)
+		}
+		bucket.Period = period.Format("2006-01-02")
+		buckets = append(buckets, bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning refund trend: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// GetMenuItemMargins returns the production cost of every active menu item at current ingredient costs.
+// CostKnown is false for items without ingredients or using an ingredient without a cost.
+func (r *reportRepository) GetMenuItemMargins(ctx context.Context) ([]models.MenuItemMargin, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            mi.id,
+            mi.name,
+            mi.price,
+            COALESCE(SUM(mii.quantity * i.cost_per_unit), 0) AS production_cost,
+            COUNT(mii.ingredient_id) > 0 AND bool_and(i.cost_per_unit IS NOT NULL) AS cost_known
+        FROM menu_items mi
+        LEFT JOIN menu_item_ingredients mii ON mii.menu_item_id = mi.id
+        LEFT JOIN inventory i ON i.id = mii.ingredient_id
+        WHERE mi.is_active
+        AND mi.location_id = $1
+        GROUP BY mi.id
+        ORDER BY mi.id`, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get menu item margins: %w", err)
+	}
+	defer rows.Close()
+
+	var margins []models.MenuItemMargin
+	for rows.Next() {
+		var margin models.MenuItemMargin
+		var costKnown sql.NullBool
+		if err := rows.Scan(
+			&margin.MenuItemID,
+			&margin.Name,
+			&margin.Price,
+			&margin.ProductionCost,
+			&costKnown,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan menu item margin: %w", err)
+		}
+		margin.CostKnown = costKnown.Bool
+		margins = append(margins, margin)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning menu item margins: %w", err)
+	}
+
+	return margins, nil
+}
+
+// GetHourlyLoad returns, per hour of the day, the total and peak number of non-cancelled orders
+// placed on the given weekday in [since, until). AvgOrders holds the total; callers divide it.
+func (r *reportRepository) GetHourlyLoad(ctx context.Context, weekday time.Weekday, since, until time.Time) ([]models.HourlyStaffing, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH per_day AS (
+            SELECT 
+                date_trunc('day', created_at) AS day,
+                EXTRACT(HOUR FROM created_at)::int AS hour,
+                COUNT(*) AS order_count
+            FROM orders
+            WHERE status <> 'cancelled'
+            AND EXTRACT(DOW FROM created_at) = $1
+            AND created_at >= $2
+            AND created_at < $3
+            AND location_id = $4
+            GROUP BY day, hour
+        )
+        SELECT hour, SUM(order_count), MAX(order_count)
+        FROM per_day
+        GROUP BY hour
+        ORDER BY hour`, int(weekday), since, until, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hourly load: %w", err)
+	}
+	defer rows.Close()
+
+	var hours []models.HourlyStaffing
+	for rows.Next() {
+		var hour models.HourlyStaffing
+		if err := rows.Scan(&hour.Hour, &hour.AvgOrders, &hour.PeakOrders); err != nil {
+			return nil, fmt.Errorf("failed to scan hourly load: %w", err)
+		}
+		hours = append(hours, hour)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning hourly load: %w", err)
+	}
+
+	return hours, nil
+}
+
+// GetHourlyProfit returns, per hour of the day, the revenue of non-cancelled orders placed between
+// the dates and the cost of the ingredients of the items sold at current ingredient costs
+func (r *reportRepository) GetHourlyProfit(ctx context.Context, startDate, endDate time.Time) ([]models.HourlyProfit, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH sold AS (
+            SELECT 
+                EXTRACT(HOUR FROM o.created_at)::int AS hour,
+                o.id AS order_id,
+                oi.quantity * oi.price_at_order AS revenue,
+                oi.quantity * COALESCE((
+                    SELECT SUM(mii.quantity * i.cost_per_unit)
+                    FROM menu_item_ingredients mii
+                    JOIN inventory i ON i.id = mii.ingredient_id
+                    WHERE mii.menu_item_id = oi.menu_item_id
+                ), 0) AS ingredient_cost
+            FROM orders o
+            JOIN order_items oi ON oi.order_id = o.id
+            WHERE o.status <> 'cancelled'
+            AND o.created_at BETWEEN $1 AND $2
+            AND o.location_id = $3
+        )
+        SELECT 
+            hour,
+            COUNT(DISTINCT order_id),
+            SUM(revenue),
+            SUM(ingredient_cost)
+        FROM sold
+        GROUP BY hour
+        ORDER BY hour`, startDate, endDate, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hourly profit: %w", err)
+	}
+	defer rows.Close()
+
+	var hours []models.HourlyProfit
+	for rows.Next() {
+		var hour models.HourlyProfit
+		if err := rows.Scan(&hour.Hour, &hour.OrderCount, &hour.Revenue, &hour.IngredientCost); err != nil {
+			return nil, fmt.Errorf("failed to scan hourly profit: %w", err)
+		}
+		hours = append(hours, hour)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning hourly profit: %w", err)
+	}
+
+	return hours, nil
+}
+
+// GetSalesBaseline returns the sales and order count of non-cancelled orders on the date, with the mean
+// and sample standard deviation of the baselineDays days before it. Days without orders count as zero.
+func (r *reportRepository) GetSalesBaseline(ctx context.Context, date time.Time, baselineDays int) (models.SalesAnomalyMetric, models.SalesAnomalyMetric, error) {
+	var sales, orders models.SalesAnomalyMetric
+	var salesMean, salesStdDev, ordersMean, ordersStdDev sql.NullFloat64
+	err := r.db.QueryRowContext(ctx, `
+        WITH days AS (
+            SELECT day::date AS day
+            FROM generate_series($1::date - $2::int, $1::date, INTERVAL '1 day') AS day
+        ),
+        daily AS (
+            SELECT 
+                d.day,
+                COALESCE(SUM(o.total_price), 0) AS sales,
+                COUNT(o.id) AS order_count
+            FROM days d
+            LEFT JOIN orders o ON o.created_at >= d.day
+                AND o.created_at < d.day + 1
+                AND o.status <> 'cancelled'
+                AND o.location_id = $3
+            GROUP BY d.day
+        ),
+        stats AS (
+            SELECT 
+                day,
+                sales,
+                order_count,
+                AVG(sales) OVER baseline AS sales_mean,
+                STDDEV_SAMP(sales) OVER baseline AS sales_stddev,
+                AVG(order_count) OVER baseline AS orders_mean,
+                STDDEV_SAMP(order_count) OVER baseline AS orders_stddev
+            FROM daily
+            WINDOW baseline AS (ORDER BY day ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING)
+        )
+        SELECT sales, order_count, sales_mean, sales_stddev, orders_mean, orders_stddev
+        FROM stats
+        WHERE day = $1::date`, date, baselineDays, models.LocationIDFromContext(ctx)).Scan(
+		&sales.Value,
+		&orders.Value,
+		&salesMean,
+		&salesStdDev,
+		&ordersMean,
+		&ordersStdDev,
+	)
+	if err != nil {
+		return models.SalesAnomalyMetric{}, models.SalesAnomalyMetric{}, fmt.Errorf("failed to get sales baseline: %w", err)
+	}
+
+	sales.Mean, sales.StdDev = salesMean.Float64, salesStdDev.Float64
+	orders.Mean, orders.StdDev = ordersMean.Float64, ordersStdDev.Float64
+	return sales, orders, nil
+}
+
+// GetMenuItemContributions returns, per menu item sold between the dates in non-cancelled orders, the
+// units sold, the revenue and the cost of their ingredients at current ingredient costs
+func (r *reportRepository) GetMenuItemContributions(ctx context.Context, startDate, endDate time.Time) ([]models.MenuItemContribution, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH costs AS (
+            SELECT mii.menu_item_id, SUM(mii.quantity * i.cost_per_unit) AS unit_cost
+            FROM menu_item_ingredients mii
+            JOIN inventory i ON i.id = mii.ingredient_id
+            GROUP BY mii.menu_item_id
+        )
+        SELECT 
+            mi.id,
+            mi.name,
+            SUM(oi.quantity),
+            SUM(oi.quantity * oi.price_at_order),
+            SUM(oi.quantity) * COALESCE(MAX(c.unit_cost), 0)
+        FROM orders o
+        JOIN order_items oi ON oi.order_id = o.id
+        JOIN menu_items mi ON mi.id = oi.menu_item_id
+        LEFT JOIN costs c ON c.menu_item_id = mi.id
+        WHERE o.status <> 'cancelled'
+        AND o.created_at BETWEEN $1 AND $2
+        AND o.location_id = $3
+        GROUP BY mi.id, mi.name
+        ORDER BY mi.id`, startDate, endDate, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get menu item contributions: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.MenuItemContribution
+	for rows.Next() {
+		var item models.MenuItemContribution
+		if err := rows.Scan(&item.MenuItemID, &item.Name, &item.UnitsSold, &item.Revenue, &item.IngredientCost); err != nil {
+			return nil, fmt.Errorf("failed to scan menu item contribution: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning menu item contributions: %w", err)
+	}
+
+	return items, nil
+}
+
+// GetOrderSizeCounts counts non-cancelled orders per total price bucket. bounds are the increasing lower
+// bounds of the buckets; the result is keyed by the 1-based bucket number, with totals below the first
+// bound in bucket 0
+func (r *reportRepository) GetOrderSizeCounts(ctx context.Context, bounds []float64) (map[int]int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            width_bucket(total_price, $1::numeric[]) AS bucket,
+            COUNT(*)
+        FROM orders
+        WHERE status <> 'cancelled'
+        AND location_id = $2
+        GROUP BY bucket`, pq.Array(bounds), models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order size distribution: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan order size bucket: %w", err)
+		}
+		counts[bucket] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning order size buckets: %w", err)
+	}
+
+	return counts, nil
+}
+
+// GetSalesByPaymentMethod returns the sales of non-cancelled orders placed between the dates per
+// payment method, largest first
+func (r *reportRepository) GetSalesByPaymentMethod(ctx context.Context, startDate, endDate time.Time) ([]models.PaymentMethodSales, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            COALESCE(payment_method::text, 'unspecified') AS method,
+            COALESCE(SUM(total_price), 0),
+            COUNT(*)
+        FROM orders
+        WHERE status <> 'cancelled'
+        AND created_at BETWEEN $1 AND $2
+        AND location_id = $3
+        GROUP BY method
+        ORDER BY SUM(total_price) DESC, method`, startDate, endDate, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sales by payment method: %w", err)
+	}
+	defer rows.Close()
+
+	var sales []models.PaymentMethodSales
+	for rows.Next() {
+		var method models.PaymentMethodSales
+		if err := rows.Scan(&method.PaymentMethod, &method.TotalSales, &method.OrderCount); err != nil {
+			return nil, fmt.Errorf("failed to scan payment method sales: %w", err)
+		}
+		sales = append(sales, method)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning payment method sales: %w", err)
+	}
+
+	return sales, nil
+}
+
+// GetRepeatOrderCounts counts the non-cancelled orders placed between the dates, how many of them follow
+// an earlier order of the same customer, and the customers whose first order falls inside or before the dates
+func (r *reportRepository) GetRepeatOrderCounts(ctx context.Context, startDate, endDate time.Time) (models.RepeatRateResponse, error) {
+	var counts models.RepeatRateResponse
+	err := r.db.QueryRowContext(ctx, `
+        WITH ranked AS (
+            SELECT 
+                customer_id,
+                created_at,
+                ROW_NUMBER() OVER (PARTITION BY customer_id ORDER BY created_at, id) AS nth
+            FROM orders
+            WHERE status <> 'cancelled'
+            AND customer_id IS NOT NULL
+            AND location_id = $3
+        )
+        SELECT 
+            COUNT(*),
+            COUNT(*) FILTER (WHERE nth > 1),
+            COUNT(DISTINCT customer_id) FILTER (WHERE nth = 1),
+            COUNT(DISTINCT customer_id) - COUNT(DISTINCT customer_id) FILTER (WHERE nth = 1)
+        FROM ranked
+        WHERE created_at BETWEEN $1 AND $2`, startDate, endDate, models.LocationIDFromContext(ctx)).Scan(
+		&counts.TotalOrders,
+		&counts.RepeatOrders,
+		&counts.NewCustomers,
+		&counts.ReturningCustomers,
+	)
+	if err != nil {
+		return models.RepeatRateResponse{}, fmt.Errorf("failed to get repeat order counts: %w", err)
+	}
+	return counts, nil
+}
+
+// GetDiscountTotals counts the non-cancelled orders placed between the dates, how many of them carry
+// a discount, and the sum of their discounts
+func (r *reportRepository) GetDiscountTotals(ctx context.Context, startDate, endDate time.Time) (models.DiscountSummaryResponse, error) {
+	var totals models.DiscountSummaryResponse
+	err := r.db.QueryRowContext(ctx, `
+        SELECT 
+            COUNT(*),
+            COUNT(*) FILTER (WHERE discount_amount > 0),
+            COALESCE(SUM(discount_amount), 0)
+        FROM orders
+        WHERE status <> 'cancelled'
+        AND created_at BETWEEN $1 AND $2
+        AND location_id = $3`, startDate, endDate, models.LocationIDFromContext(ctx)).Scan(
+		&totals.TotalOrders,
+		&totals.DiscountedOrders,
+		&totals.TotalDiscounts,
+	)
+	if err != nil {
+		return models.DiscountSummaryResponse{}, fmt.Errorf("failed to get discount totals: %w", err)
+	}
+	return totals, nil
+}
+
+// GetCustomerSpending sums the non-cancelled orders of a customer; a customer without orders gets zeroes
+func (r *reportRepository) GetCustomerSpending(ctx context.Context, customerID int) (models.CustomerSpendingResponse, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM customers WHERE id = $1)`, customerID).Scan(&exists)
+	if err != nil {
+		return models.CustomerSpendingResponse{}, fmt.Errorf("failed to check customer: %w", err)
+	}
+	if !exists {
+		return models.CustomerSpendingResponse{}, models.ErrCustomerNotFound
+	}
+
+	spending := models.CustomerSpendingResponse{CustomerID: customerID}
+	var firstOrder, lastOrder sql.NullTime
+	err = r.db.QueryRowContext(ctx, `
+        SELECT 
+            COUNT(*),
+            COALESCE(SUM(total_price), 0),
+            COALESCE(AVG(total_price), 0),
+            MIN(created_at),
+            MAX(created_at)
+        FROM orders
+        WHERE customer_id = $1
+        AND status <> 'cancelled'
+        AND location_id = $2`, customerID, models.LocationIDFromContext(ctx),
+	).Scan(&spending.TotalOrders, &spending.TotalSpent, &spending.AverageOrderValue, &firstOrder, &lastOrder)
+	if err != nil {
+		return models.CustomerSpendingResponse{}, fmt.Errorf("failed to get customer spending: %w", err)
+	}
+
+	if firstOrder.Valid {
+		spending.FirstOrderAt = &firstOrder.Time
+	}
+	if lastOrder.Valid {
+		spending.LastOrderAt = &lastOrder.Time
+	}
+
+	return spending, nil
+}
+
+// GetTotalMismatches returns orders whose stored total_price isn't the sum of quantity * price_at_order
+// of their items less their discount_amount, oldest first
+func (r *reportRepository) GetTotalMismatches(ctx context.Context) ([]models.TotalMismatch, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            o.id,
+            o.total_price,
+            COALESCE(SUM(oi.quantity * oi.price_at_order), 0) - o.discount_amount AS recomputed,
+            o.created_at
+        FROM orders o
+        LEFT JOIN order_items oi ON oi.order_id = o.id
+        WHERE o.location_id = $1
+        GROUP BY o.id
+        HAVING o.total_price <> COALESCE(SUM(oi.quantity * oi.price_at_order), 0) - o.discount_amount
+        ORDER BY o.created_at, o.id`, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order total mismatches: %w", err)
+	}
+	defer rows.Close()
+
+	var mismatches []models.TotalMismatch
+	for rows.Next() {
+		var mismatch models.TotalMismatch
+		if err := rows.Scan(
+			&mismatch.OrderID,
+			&mismatch.StoredTotal,
+			&mismatch.RecomputedTotal,
+			&mismatch.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan order total mismatch: %w", err)
+		}
+		mismatch.Difference = mismatch.StoredTotal - mismatch.RecomputedTotal
+		mismatches = append(mismatches, mismatch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning order total mismatches: %w", err)
+	}
+
+	return mismatches, nil
+}
+
+// GetPriceMismatches returns order items of orders placed between the dates whose price_at_order, less
+// the price deltas of its modifiers, differs from the menu item's price at the time: the latest price_history change before the order,
+// else the old price of the first change after it, else the current price if it never changed
+func (r *reportRepository) GetPriceMismatches(ctx context.Context, startDate, endDate time.Time) ([]models.PriceMismatch, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT 
+            oi.order_id,
+            oi.id,
+            oi.menu_item_id,
+            mi.name,
+            oi.price_at_order,
+            oi.modifier_delta,
+            p.expected_price,
+            o.created_at
+        FROM order_items oi
+        JOIN orders o ON o.id = oi.order_id
+        JOIN menu_items mi ON mi.id = oi.menu_item_id
+        CROSS JOIN LATERAL (
+            SELECT COALESCE(
+                (SELECT ph.new_price FROM price_history ph
+                 WHERE ph.menu_item_id = oi.menu_item_id AND ph.changed_at <= o.created_at
+                 ORDER BY ph.changed_at DESC LIMIT 1),
+                (SELECT ph.old_price FROM price_history ph
+                 WHERE ph.menu_item_id = oi.menu_item_id AND ph.changed_at > o.created_at
+                 ORDER BY ph.changed_at ASC LIMIT 1),
+                mi.price
+            ) AS expected_price
+        ) p
+        WHERE o.created_at BETWEEN $1 AND $2
+        AND o.location_id = $3
+        AND oi.price_at_order - oi.modifier_delta <> p.expected_price
+        ORDER BY o.created_at, oi.id`, startDate, endDate, models.LocationIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to audit order prices: %w", err)
+	}
+	defer rows.Close()
+
+	var mismatches []models.PriceMismatch
+	for rows.Next() {
+		var mismatch models.PriceMismatch
+		if err := rows.Scan(
+			&mismatch.OrderID,
+			&mismatch.OrderItemID,
+			&mismatch.MenuItemID,
+			&mismatch.Name,
+			&mismatch.PriceAtOrder,
+			&mismatch.ModifierDelta,
+			&mismatch.ExpectedPrice,
+			&mismatch.OrderedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan price mismatch: %w", err)
+		}
+		mismatch.Difference = mismatch.PriceAtOrder - mismatch.ModifierDelta - mismatch.ExpectedPrice
+		mismatches = append(mismatches, mismatch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning price mismatches: %w", err)
+	}
+
+	return mismatches, nil
+}
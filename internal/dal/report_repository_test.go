@@ -0,0 +1,552 @@
+package dal
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"frappuccino/internal/models"
+)
+
+func TestGetOrderedItemsByPeriodGroupsISOWeek53(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "WK")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	noon := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	}
+	// ISO week 53 of 2020 runs from Monday 2020-12-28 to Sunday 2021-01-03, and week 1 of 2020
+	// starts on 2019-12-30
+	createTestOrder(t, db, location, noon(2019, time.December, 30), 1)
+	createTestOrder(t, db, location, noon(2020, time.December, 31), 2)
+	createTestOrder(t, db, location, noon(2021, time.January, 2), 3)
+	createTestOrder(t, db, location, noon(2021, time.January, 4), 4)
+
+	tests := []struct {
+		year  int
+		weeks map[int]int // week -> orders
+	}{
+		{2020, map[int]int{1: 1, 53: 2}},
+		{2021, map[int]int{1: 1}},
+	}
+	for _, tt := range tests {
+		response, err := repo.GetOrderedItemsByPeriod(ctx, "week", 0, tt.year)
+		if err != nil {
+			t.Fatalf("GetOrderedItemsByPeriod(week, %d): %v", tt.year, err)
+		}
+		got := make(map[int]int)
+		for _, report := range response.Reports {
+			week, ok := report.Period.(int)
+			if !ok {
+				t.Fatalf("week period = %#v, want an int", report.Period)
+			}
+			got[week] = report.OrderCount
+		}
+		if len(got) != len(tt.weeks) {
+			t.Errorf("%d: weeks = %v, want %v", tt.year, got, tt.weeks)
+			continue
+		}
+		for week, orders := range tt.weeks {
+			if got[week] != orders {
+				t.Errorf("%d: week %d has %d orders, want %d", tt.year, week, got[week], orders)
+			}
+		}
+	}
+}
+
+func TestGetOrderCountInWindow(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "RATE")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	now := time.Now()
+	for _, age := range []time.Duration{time.Minute, 5 * time.Minute, 14 * time.Minute, 16 * time.Minute, time.Hour} {
+		createTestOrder(t, db, location, now.Add(-age), 5)
+	}
+
+	count, err := repo.GetOrderCountInWindow(ctx, 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GetOrderCountInWindow: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("orders in the last 15 minutes = %d, want 3", count)
+	}
+}
+
+func TestGetCostVarianceOverPeriod(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "VAR")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	syrup := createTestIngredient(t, db, location, "test variance syrup", 100, false)
+	// Ingredients without cost changes in the period are left out
+	createTestIngredient(t, db, location, "test variance water", 100, false)
+	latte := createTestMenuItem(t, db, location, "test variance latte", 5, map[int]float64{syrup: 2})
+
+	changes := []struct {
+		oldCost, newCost float64
+		changedAt        time.Time
+	}{
+		{0.25, 0.50, now.AddDate(0, 0, -60)}, // before the period
+		{0.50, 0.75, now.AddDate(0, 0, -20)},
+		{0.75, 1.00, now.AddDate(0, 0, -5)},
+	}
+	for _, c := range changes {
+		if _, err := db.Exec(`
+            INSERT INTO ingredient_cost_history (ingredient_id, old_cost, new_cost, changed_at)
+            VALUES ($1, $2, $3, $4)`, syrup, c.oldCost, c.newCost, c.changedAt); err != nil {
+			t.Fatalf("failed to record cost change: %v", err)
+		}
+	}
+
+	ingredients, menuItems, err := repo.GetCostVariance(ctx, now.AddDate(0, 0, -30), now)
+	if err != nil {
+		t.Fatalf("GetCostVariance: %v", err)
+	}
+	if len(ingredients) != 1 {
+		t.Fatalf("ingredients = %+v, want the syrup", ingredients)
+	}
+	v := ingredients[0]
+	if v.IngredientID != syrup || v.StartCost != 0.50 || v.EndCost != 1.00 || v.Variance != 0.50 || v.VariancePercent != 100 || v.Changes != 2 {
+		t.Errorf("variance = %+v, want 0.50 to 1.00 over 2 changes, +0.50 or 100%%", v)
+	}
+	// Two units of syrup per latte
+	if len(menuItems) != 1 || menuItems[0].MenuItemID != latte || menuItems[0].CostChange != 1.00 {
+		t.Errorf("menu items = %+v, want the latte costing 1.00 more", menuItems)
+	}
+}
+
+func TestGetRestockHistoryListsRestocks(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "RESTOCK")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	milk := createTestIngredient(t, db, location, "test restock milk", 0, false)
+	setTestSupplier(t, db, milk, "Dairy Co")
+	sugar := createTestIngredient(t, db, location, "test restock sugar", 0, false)
+	createTestTransaction(t, db, milk, 500, "restock", now.AddDate(0, 0, -10))
+	createTestTransaction(t, db, sugar, 200, "restock", now.AddDate(0, 0, -8))
+	createTestTransaction(t, db, milk, 300, "restock", now.AddDate(0, 0, -4))
+	// Usage and restocks outside the period are left out
+	createTestTransaction(t, db, milk, -100, "order_usage", now.AddDate(0, 0, -3))
+	createTestTransaction(t, db, milk, 900, "restock", now.AddDate(0, 0, -40))
+
+	restocks, err := repo.GetRestockHistory(ctx, 0, now.AddDate(0, 0, -30), now)
+	if err != nil {
+		t.Fatalf("GetRestockHistory: %v", err)
+	}
+	want := []models.RestockTransaction{
+		{IngredientID: milk, Supplier: "Dairy Co", Quantity: 500},
+		{IngredientID: sugar, Supplier: "Unknown Supplier", Quantity: 200},
+		{IngredientID: milk, Supplier: "Dairy Co", Quantity: 300},
+	}
+	if len(restocks) != len(want) {
+		t.Fatalf("GetRestockHistory = %+v, want 3 restocks", restocks)
+	}
+	for i, restock := range restocks {
+		if restock.IngredientID != want[i].IngredientID || restock.Supplier != want[i].Supplier || restock.Quantity != want[i].Quantity {
+			t.Errorf("restock %d = %+v, want %+v", i, restock, want[i])
+		}
+	}
+
+	restocks, err = repo.GetRestockHistory(ctx, sugar, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("GetRestockHistory: %v", err)
+	}
+	if len(restocks) != 1 || restocks[0].IngredientID != sugar {
+		t.Errorf("GetRestockHistory of the sugar = %+v, want its one restock", restocks)
+	}
+}
+
+func TestGetRefundTrendPerBucket(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "REFUND")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	noon := func(month time.Month, day int) time.Time {
+		return time.Date(2021, month, day, 12, 0, 0, 0, time.UTC)
+	}
+	january := createTestOrder(t, db, location, noon(time.January, 10), 100)
+	createTestOrder(t, db, location, noon(time.January, 11), 50)
+	february := createTestOrder(t, db, location, noon(time.February, 12), 200)
+	createTestRefund(t, db, january, 15, noon(time.January, 20))
+	createTestRefund(t, db, february, 20, noon(time.February, 15))
+	// Refunds count in the bucket they were made in, even without sales in it
+	createTestRefund(t, db, january, 5, noon(time.March, 2))
+
+	buckets, err := repo.GetRefundTrend(ctx, "month", noon(time.January, 1), noon(time.March, 31))
+	if err != nil {
+		t.Fatalf("GetRefundTrend: %v", err)
+	}
+	want := []models.RefundTrendBucket{
+		{Period: "2021-01-01", GrossSales: 150, Refunds: 15},
+		{Period: "2021-02-01", GrossSales: 200, Refunds: 20},
+		{Period: "2021-03-01", GrossSales: 0, Refunds: 5},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("GetRefundTrend = %+v, want 3 months", buckets)
+	}
+	for i, bucket := range buckets {
+		if bucket.Period != want[i].Period || bucket.GrossSales != want[i].GrossSales || bucket.Refunds != want[i].Refunds {
+			t.Errorf("bucket %d = %+v, want %+v", i, bucket, want[i])
+		}
+	}
+}
+
+func TestGetMenuItemMarginsAtCurrentCosts(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "MARGIN")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	milk := createTestIngredient(t, db, location, "test margin milk", 1000, false)
+	syrup := createTestIngredient(t, db, location, "test margin syrup", 1000, false)
+	if _, err := db.Exec(`UPDATE inventory SET cost_per_unit = NULL WHERE id = $1`, syrup); err != nil {
+		t.Fatalf("failed to clear cost: %v", err)
+	}
+	// 200 ml of milk at 0.01 costs 2
+	latte := createTestMenuItem(t, db, location, "test margin latte", 4, map[int]float64{milk: 200})
+	mocha := createTestMenuItem(t, db, location, "test margin mocha", 5, map[int]float64{milk: 200, syrup: 10})
+	tea := createTestMenuItem(t, db, location, "test margin tea", 2, nil)
+
+	margins, err := repo.GetMenuItemMargins(ctx)
+	if err != nil {
+		t.Fatalf("GetMenuItemMargins: %v", err)
+	}
+	want := []models.MenuItemMargin{
+		{MenuItemID: latte, Price: 4, ProductionCost: 2, CostKnown: true},
+		{MenuItemID: mocha, Price: 5, ProductionCost: 2, CostKnown: false},
+		{MenuItemID: tea, Price: 2, ProductionCost: 0, CostKnown: false},
+	}
+	if len(margins) != len(want) {
+		t.Fatalf("GetMenuItemMargins = %+v, want the latte, mocha and tea", margins)
+	}
+	for i, margin := range margins {
+		w := want[i]
+		if margin.MenuItemID != w.MenuItemID || margin.Price != w.Price || margin.ProductionCost != w.ProductionCost || margin.CostKnown != w.CostKnown {
+			t.Errorf("margin %d = %+v, want %+v", i, margin, w)
+		}
+	}
+}
+
+func TestGetPriceMismatchesFlagsWrongPrices(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "AUDIT")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	// The latte went from 4.00 to 5.00 ten days ago
+	latte := createTestMenuItem(t, db, location, "test audit latte", 5, nil)
+	if _, err := db.Exec(`
+        INSERT INTO price_history (menu_item_id, old_price, new_price, changed_at)
+        VALUES ($1, 4, 5, $2)`, latte, now.AddDate(0, 0, -10)); err != nil {
+		t.Fatalf("failed to record price change: %v", err)
+	}
+
+	sales := []struct {
+		age   int // days
+		price models.Money
+	}{
+		{15, 4},   // the old price
+		{12, 5},   // the new price before it applied
+		{5, 5},    // the new price
+		{3, 4.50}, // undercharged
+		{2, 5.50}, // with a 0.50 modifier
+	}
+	orders := make([]int, len(sales))
+	for i, sale := range sales {
+		orders[i] = createTestOrder(t, db, location, now.AddDate(0, 0, -sale.age), sale.price)
+		createTestOrderItem(t, db, orders[i], latte, 1, sale.price)
+	}
+	if _, err := db.Exec(`UPDATE order_items SET modifier_delta = 0.50 WHERE order_id = $1`, orders[4]); err != nil {
+		t.Fatalf("failed to set modifier delta: %v", err)
+	}
+
+	mismatches, err := repo.GetPriceMismatches(ctx, now.AddDate(0, 0, -30), now)
+	if err != nil {
+		t.Fatalf("GetPriceMismatches: %v", err)
+	}
+	if len(mismatches) != 2 {
+		t.Fatalf("GetPriceMismatches = %+v, want the orders of 12 and 3 days ago", mismatches)
+	}
+	if m := mismatches[0]; m.OrderID != orders[1] || m.ExpectedPrice != 4 || m.Difference != 1 {
+		t.Errorf("mismatch = %+v, want order %d charged 1.00 over 4.00", m, orders[1])
+	}
+	if m := mismatches[1]; m.OrderID != orders[3] || m.ExpectedPrice != 5 || m.Difference != -0.50 {
+		t.Errorf("mismatch = %+v, want order %d charged 0.50 under 5.00", m, orders[3])
+	}
+}
+
+func TestGetHourlyProfitPerHour(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "PROFIT")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	// Hours are taken in the time zone of the database session
+	var timeZone string
+	if err := db.QueryRow(`SELECT current_setting('TimeZone')`).Scan(&timeZone); err != nil {
+		t.Fatalf("failed to get the session time zone: %v", err)
+	}
+	zone, err := time.LoadLocation(timeZone)
+	if err != nil {
+		t.Skipf("session time zone %q is unknown to Go: %v", timeZone, err)
+	}
+	yesterday := time.Now().In(zone).AddDate(0, 0, -1)
+	at := func(hour int) time.Time {
+		return time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), hour, 15, 0, 0, zone)
+	}
+
+	// 200 ml of milk at 0.01 makes a latte cost 2.00; the cake has no recipe
+	milk := createTestIngredient(t, db, location, "test profit milk", 10000, false)
+	latte := createTestMenuItem(t, db, location, "test profit latte", 4, map[int]float64{milk: 200})
+	cake := createTestMenuItem(t, db, location, "test profit cake", 3, nil)
+
+	morning := createTestOrder(t, db, location, at(8), 8)
+	createTestOrderItem(t, db, morning, latte, 2, 4)
+	createTestOrderItem(t, db, createTestOrder(t, db, location, at(8).Add(30*time.Minute), 4), latte, 1, 4)
+	afternoon := createTestOrder(t, db, location, at(14), 10)
+	createTestOrderItem(t, db, afternoon, latte, 1, 4)
+	createTestOrderItem(t, db, afternoon, cake, 2, 3)
+
+	hours, err := repo.GetHourlyProfit(ctx, at(0), at(23))
+	if err != nil {
+		t.Fatalf("GetHourlyProfit: %v", err)
+	}
+	want := []models.HourlyProfit{
+		{Hour: 8, OrderCount: 2, Revenue: 12, IngredientCost: 6},
+		{Hour: 14, OrderCount: 1, Revenue: 10, IngredientCost: 2},
+	}
+	if len(hours) != len(want) {
+		t.Fatalf("GetHourlyProfit = %+v, want hours 8 and 14", hours)
+	}
+	for i, hour := range hours {
+		if hour != want[i] {
+			t.Errorf("hour %d = %+v, want %+v", i, hour, want[i])
+		}
+	}
+}
+
+func TestGetFullTextSearchWithinPriceBand(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "SEARCH")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	createTestMenuItem(t, db, location, "test zebracino small", 3, nil)
+	medium := createTestMenuItem(t, db, location, "test zebracino medium", 5, nil)
+	large := createTestMenuItem(t, db, location, "test zebracino large", 6, nil)
+	createTestMenuItem(t, db, location, "test zebracino giant", 8, nil)
+	// Items are indexed once they have a description, as the API always gives them
+	if _, err := db.Exec(`UPDATE menu_items SET description = 'Iced' WHERE location_id = $1`, location); err != nil {
+		t.Fatalf("failed to set descriptions: %v", err)
+	}
+
+	result, err := repo.GetFullTextSearch(ctx, "zebracino", "menu", 4, 6)
+	if err != nil {
+		t.Fatalf("GetFullTextSearch: %v", err)
+	}
+	found := make(map[int]bool)
+	for _, item := range result.MenuItems {
+		found[item.ID] = true
+	}
+	// The band includes its bounds
+	if len(result.MenuItems) != 2 || !found[medium] || !found[large] {
+		t.Errorf("menu items = %+v, want the medium and large at 5.00 and 6.00", result.MenuItems)
+	}
+
+	// A zero bound is open
+	result, err = repo.GetFullTextSearch(ctx, "zebracino", "menu", 5.5, 0)
+	if err != nil {
+		t.Fatalf("GetFullTextSearch: %v", err)
+	}
+	if len(result.MenuItems) != 2 {
+		t.Errorf("menu items from 5.50 = %+v, want the large and giant", result.MenuItems)
+	}
+}
+
+func TestGetOrderSizeCountsPerBucket(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "SIZES")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	// Each bucket includes its lower bound
+	for _, total := range []models.Money{3, 4.99, 5, 9.50, 15, 20, 42} {
+		createTestOrder(t, db, location, now, total)
+	}
+	cancelled := createTestOrder(t, db, location, now, 7)
+	setTestOrderStatus(t, db, cancelled, "cancelled")
+
+	counts, err := repo.GetOrderSizeCounts(ctx, []float64{0, 5, 10, 20})
+	if err != nil {
+		t.Fatalf("GetOrderSizeCounts: %v", err)
+	}
+	want := map[int]int{1: 2, 2: 2, 3: 1, 4: 2}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+}
+
+func TestGetTotalMismatchesListsStoredAndRecomputedTotals(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "TOTALS")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	latte := createTestMenuItem(t, db, location, "test totals latte", 4, nil)
+	matching := createTestOrder(t, db, location, now.Add(-3*time.Hour), 7)
+	createTestOrderItem(t, db, matching, latte, 2, 3.50)
+	// The discount is taken off the recomputed total
+	discounted := createTestOrder(t, db, location, now.Add(-2*time.Hour), 6.50)
+	createTestOrderItem(t, db, discounted, latte, 1, 7)
+	if _, err := db.Exec(`UPDATE orders SET discount_amount = 0.50 WHERE id = $1`, discounted); err != nil {
+		t.Fatalf("failed to set discount: %v", err)
+	}
+	legacy := createTestOrder(t, db, location, now.Add(-time.Hour), 10)
+	createTestOrderItem(t, db, legacy, latte, 2, 4)
+
+	mismatches, err := repo.GetTotalMismatches(ctx)
+	if err != nil {
+		t.Fatalf("GetTotalMismatches: %v", err)
+	}
+	if len(mismatches) != 1 {
+		t.Fatalf("mismatches = %+v, want only the legacy order", mismatches)
+	}
+	got := mismatches[0]
+	if got.OrderID != legacy || got.StoredTotal != 10 || got.RecomputedTotal != 8 || got.Difference != 2 {
+		t.Errorf("mismatch = %+v, want order %d stored at 10 and recomputed at 8", got, legacy)
+	}
+}
+
+func TestGetSalesBaselineOfOutlierDay(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "ANOMALY")
+	ctx := models.WithLocationID(context.Background(), location)
+
+	// Days are taken in the time zone of the database session
+	var timeZone string
+	if err := db.QueryRow(`SELECT current_setting('TimeZone')`).Scan(&timeZone); err != nil {
+		t.Fatalf("failed to get the session time zone: %v", err)
+	}
+	zone, err := time.LoadLocation(timeZone)
+	if err != nil {
+		t.Skipf("session time zone %q is unknown to Go: %v", timeZone, err)
+	}
+	now := time.Now().In(zone)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, zone).AddDate(0, 0, -1)
+
+	// The four baseline days sell 20, 22, 18 and 20 in 2, 3, 2 and 3 orders
+	for daysBefore, totals := range map[int][]models.Money{
+		4: {10, 10},
+		3: {8, 8, 6},
+		2: {9, 9},
+		1: {7, 7, 6},
+		0: {50, 50},
+	} {
+		for _, total := range totals {
+			createTestOrder(t, db, location, day.AddDate(0, 0, -daysBefore), total)
+		}
+	}
+	cancelled := createTestOrder(t, db, location, day, 500)
+	setTestOrderStatus(t, db, cancelled, "cancelled")
+
+	sales, orders, err := repo.GetSalesBaseline(ctx, day, 4)
+	if err != nil {
+		t.Fatalf("GetSalesBaseline: %v", err)
+	}
+	// Sample deviations: sqrt(8/3) of the sales and sqrt(1/3) of the order counts
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if sales.Value != 100 || !near(sales.Mean, 20) || !near(sales.StdDev, math.Sqrt(8.0/3)) {
+		t.Errorf("sales = %+v, want 100 against a mean of 20 and deviation of %v", sales, math.Sqrt(8.0/3))
+	}
+	if orders.Value != 2 || !near(orders.Mean, 2.5) || !near(orders.StdDev, math.Sqrt(1.0/3)) {
+		t.Errorf("orders = %+v, want 2 against a mean of 2.5 and deviation of %v", orders, math.Sqrt(1.0/3))
+	}
+}
+
+func TestGetRepeatOrderCountsOfNewAndReturningCustomers(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "REPEAT")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	order := func(customerID int, createdAt time.Time) int {
+		t.Helper()
+		id := createTestOrder(t, db, location, createdAt, 5)
+		if _, err := db.Exec(`UPDATE orders SET customer_id = $2 WHERE id = $1`, id, customerID); err != nil {
+			t.Fatalf("failed to set customer of order %d: %v", id, err)
+		}
+		return id
+	}
+	// Ana ordered before the period, Ben orders twice in it and Cal once
+	ana := createTestCustomer(t, db, "Ana")
+	order(ana, now.AddDate(0, 0, -30))
+	order(ana, now.AddDate(0, 0, -3))
+	ben := createTestCustomer(t, db, "Ben")
+	order(ben, now.AddDate(0, 0, -5))
+	order(ben, now.AddDate(0, 0, -1))
+	cal := createTestCustomer(t, db, "Cal")
+	order(cal, now.AddDate(0, 0, -2))
+	// Dee's earlier order was cancelled, so she is new; orders without a customer don't count
+	dee := createTestCustomer(t, db, "Dee")
+	setTestOrderStatus(t, db, order(dee, now.AddDate(0, 0, -30)), "cancelled")
+	order(dee, now.AddDate(0, 0, -4))
+	createTestOrder(t, db, location, now.AddDate(0, 0, -1), 5)
+
+	counts, err := repo.GetRepeatOrderCounts(ctx, now.AddDate(0, 0, -7), now)
+	if err != nil {
+		t.Fatalf("GetRepeatOrderCounts: %v", err)
+	}
+	want := models.RepeatRateResponse{TotalOrders: 5, RepeatOrders: 2, NewCustomers: 3, ReturningCustomers: 1}
+	if counts != want {
+		t.Errorf("counts = %+v, want %+v", counts, want)
+	}
+}
+
+func TestGetDiscountTotalsSkipsCancelledOrders(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReportRepository(db)
+	location := createTestLocation(t, db, "DISCOUNT")
+	ctx := models.WithLocationID(context.Background(), location)
+	now := time.Now()
+
+	order := func(createdAt time.Time, discount models.Money) int {
+		t.Helper()
+		id := createTestOrder(t, db, location, createdAt, 10)
+		if _, err := db.Exec(`UPDATE orders SET discount_amount = $2 WHERE id = $1`, id, discount); err != nil {
+			t.Fatalf("failed to set discount of order %d: %v", id, err)
+		}
+		return id
+	}
+	order(now.AddDate(0, 0, -1), 2)
+	order(now.AddDate(0, 0, -2), 1.5)
+	order(now.AddDate(0, 0, -3), 0)
+	// A cancelled order and one before the period don't count
+	setTestOrderStatus(t, db, order(now.AddDate(0, 0, -2), 5), "cancelled")
+	order(now.AddDate(0, 0, -30), 4)
+
+	totals, err := repo.GetDiscountTotals(ctx, now.AddDate(0, 0, -7), now)
+	if err != nil {
+		t.Fatalf("GetDiscountTotals: %v", err)
+	}
+	want := models.DiscountSummaryResponse{TotalOrders: 3, DiscountedOrders: 2, TotalDiscounts: 3.5}
+	if totals != want {
+		t.Errorf("totals = %+v, want %+v", totals, want)
+	}
+}
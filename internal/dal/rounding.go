@@ -0,0 +1,79 @@
+package dal
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Rounding modes of ingredient usage
+const (
+	RoundingTruncate = "truncate"
+	RoundingRound    = "round"
+	RoundingCeil     = "ceil"
+)
+
+// maxUsagePrecision is the scale of inventory quantities in the database
+const maxUsagePrecision = 3
+
+// UsageRounding rounds the ingredient usage of an order line (recipe quantity times item
+// quantity) before it is deducted from or restored to inventory
+type UsageRounding struct {
+	Mode      string // truncate, round or ceil
+	Precision int    // decimal places kept, 0 to 3
+}
+
+// DefaultUsageRounding keeps usage at the full precision inventory is stored with
+var DefaultUsageRounding = UsageRounding{Mode: RoundingRound, Precision: maxUsagePrecision}
+
+// NewUsageRounding validates a rounding mode and precision; an empty mode means round
+func NewUsageRounding(mode string, precision int) (UsageRounding, error) {
+	if mode == "" {
+		mode = RoundingRound
+	}
+	switch mode {
+	case RoundingTruncate, RoundingRound, RoundingCeil:
+	default:
+		return UsageRounding{}, fmt.Errorf("invalid usage rounding mode %q, must be truncate, round or ceil", mode)
+	}
+	if precision < 0 || precision > maxUsagePrecision {
+		return UsageRounding{}, fmt.Errorf("usage rounding precision must be between 0 and %d", maxUsagePrecision)
+	}
+	return UsageRounding{Mode: mode, Precision: precision}, nil
+}
+
+// Apply rounds the usage of quantity units of a recipe needing perUnit of an ingredient
+func (u UsageRounding) Apply(perUnit float64, quantity int) float64 {
+	scale := math.Pow10(u.Precision)
+	// Drop float noise first so e.g. 0.1*3 isn't ceiled up to 0.301
+	scaled := math.Round(perUnit*float64(quantity)*scale*1e6) / 1e6
+	switch u.Mode {
+	case RoundingTruncate:
+		scaled = math.Trunc(scaled)
+	case RoundingCeil:
+		scaled = math.Ceil(scaled)
+	default:
+		scaled = math.Round(scaled)
+	}
+	return scaled / scale
+}
+
+// inventoryScale snaps a sum of usages to the precision inventory is stored with, dropping
+// float noise such as 0.1+0.2-0.3 != 0
+func inventoryScale(quantity float64) float64 {
+	scale := math.Pow10(maxUsagePrecision)
+	return math.Round(quantity*scale) / scale
+}
+
+// sql wraps a SQL expression computing ingredient usage in the same rounding as Apply
+func (u UsageRounding) sql(expr string) string {
+	switch u.Mode {
+	case RoundingTruncate:
+		return fmt.Sprintf("trunc((%s)::numeric, %d)", expr, u.Precision)
+	case RoundingCeil:
+		scale := "1" + strings.Repeat("0", u.Precision)
+		return fmt.Sprintf("(ceil((%s)::numeric * %s) / %s)", expr, scale, scale)
+	default:
+		return fmt.Sprintf("round((%s)::numeric, %d)", expr, u.Precision)
+	}
+}
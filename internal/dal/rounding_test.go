@@ -0,0 +1,102 @@
+package dal
+
+import (
+	"context"
+	"testing"
+
+	"frappuccino/internal/models"
+)
+
+func TestNewUsageRounding(t *testing.T) {
+	tests := []struct {
+		mode      string
+		precision int
+		want      UsageRounding
+		wantErr   bool
+	}{
+		{"", 3, UsageRounding{Mode: RoundingRound, Precision: 3}, false},
+		{"truncate", 0, UsageRounding{Mode: RoundingTruncate, Precision: 0}, false},
+		{"ceil", 2, UsageRounding{Mode: RoundingCeil, Precision: 2}, false},
+		{"floor", 2, UsageRounding{}, true},
+		{"round", -1, UsageRounding{}, true},
+		{"round", 4, UsageRounding{}, true},
+	}
+	for _, tt := range tests {
+		got, err := NewUsageRounding(tt.mode, tt.precision)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewUsageRounding(%q, %d) error = %v, want error %v", tt.mode, tt.precision, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NewUsageRounding(%q, %d) = %+v, want %+v", tt.mode, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestUsageRoundingApply(t *testing.T) {
+	tests := []struct {
+		rounding UsageRounding
+		perUnit  float64
+		quantity int
+		want     float64
+	}{
+		{UsageRounding{RoundingRound, 3}, 0.1, 3, 0.3},
+		{UsageRounding{RoundingCeil, 3}, 0.1, 3, 0.3}, // float noise must not ceil up to 0.301
+		{UsageRounding{RoundingCeil, 1}, 0.33, 2, 0.7},
+		{UsageRounding{RoundingTruncate, 1}, 0.33, 2, 0.6},
+		{UsageRounding{RoundingRound, 1}, 0.33, 2, 0.7},
+		{UsageRounding{RoundingRound, 0}, 2.5, 1, 3},
+		{UsageRounding{RoundingTruncate, 0}, 18, 2, 36},
+	}
+	for _, tt := range tests {
+		if got := tt.rounding.Apply(tt.perUnit, tt.quantity); got != tt.want {
+			t.Errorf("%+v.Apply(%v, %d) = %v, want %v", tt.rounding, tt.perUnit, tt.quantity, got, tt.want)
+		}
+	}
+}
+
+func TestOrderDeductionRounding(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		mode string
+		// stock left of the 100 of each ingredient after ordering 3 and after updating to 4
+		afterCreate, afterUpdate [2]float64
+	}{
+		// 3 x 2.4 = 7.2 and 3 x 2.6 = 7.8; 4 x 2.4 = 9.6 and 4 x 2.6 = 10.4
+		{RoundingTruncate, [2]float64{93, 93}, [2]float64{91, 90}},
+		{RoundingRound, [2]float64{93, 92}, [2]float64{90, 90}},
+		{RoundingCeil, [2]float64{92, 92}, [2]float64{90, 89}},
+	}
+	for _, tt := range tests {
+		repo := NewOrderRepository(db, UsageRounding{Mode: tt.mode, Precision: 0}, DeductOnCreate, false)
+		sugar := createTestIngredient(t, db, models.DefaultLocationID, "test rounding sugar "+tt.mode, 100, false)
+		cocoa := createTestIngredient(t, db, models.DefaultLocationID, "test rounding cocoa "+tt.mode, 100, false)
+		mocha := createTestMenuItem(t, db, models.DefaultLocationID, "test rounding mocha "+tt.mode, 4.00,
+			map[int]float64{sugar: 2.4, cocoa: 2.6})
+
+		stock := func() [2]float64 {
+			return [2]float64{ingredientQuantity(t, db, sugar), ingredientQuantity(t, db, cocoa)}
+		}
+
+		id, _, err := repo.CreateOrder(ctx, models.Order{
+			Items: []models.OrderItem{{MenuItemID: mocha, Quantity: 3}},
+		}, "")
+		if err != nil {
+			t.Fatalf("%s: CreateOrder: %v", tt.mode, err)
+		}
+		if got := stock(); got != tt.afterCreate {
+			t.Errorf("%s: sugar and cocoa after CreateOrder = %v, want %v", tt.mode, got, tt.afterCreate)
+		}
+
+		if err := repo.UpdateOrder(ctx, id, models.Order{
+			Items: []models.OrderItem{{MenuItemID: mocha, Quantity: 4}},
+		}); err != nil {
+			t.Fatalf("%s: UpdateOrder: %v", tt.mode, err)
+		}
+		if got := stock(); got != tt.afterUpdate {
+			t.Errorf("%s: sugar and cocoa after UpdateOrder = %v, want %v", tt.mode, got, tt.afterUpdate)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"frappuccino/internal/models"
+)
+
+type APIHandler struct {
+	versions models.APIVersionsResponse
+}
+
+func NewAPIHandler(versions models.APIVersionsResponse) *APIHandler {
+	return &APIHandler{versions: versions}
+}
+
+func (h *APIHandler) GetVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.versions)
+}
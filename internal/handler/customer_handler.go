@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"frappuccino/internal/models"
+	"frappuccino/internal/service"
+)
+
+type CustomerHandler struct {
+	customerService service.CustomerService
+}
+
+func NewCustomerHandler(service service.CustomerService) *CustomerHandler {
+	return &CustomerHandler{customerService: service}
+}
+
+func (h *CustomerHandler) GetVisitFrequency(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidCustomerID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.customerService.GetVisitFrequency(r.Context(), id)
+	if err != nil {
+		if err == models.ErrCustomerNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get visit frequency: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *CustomerHandler) GetRecommendations(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidCustomerID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := 5
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			http.Error(w, models.ErrInvalidLimit.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := h.customerService.GetRecommendations(r.Context(), id, limit)
+	if err != nil {
+		switch err {
+		case models.ErrCustomerNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case models.ErrInvalidLimit:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get recommendations: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// healthPingTimeout bounds the database ping of a readiness check
+const healthPingTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	db *sql.DB
+}
+
+func NewHealthHandler(db *sql.DB) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+// Health is the readiness check: it reports 503 while the database can't be reached
+func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.db.PingContext(ctx); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "degraded",
+			"db":     "unreachable",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+	})
+}
+
+// Livez is the liveness check; it never touches the database so a database outage doesn't restart the server
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
@@ -1,15 +1,26 @@
 package handler
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"frappuccino/internal/models"
 	"frappuccino/internal/service"
 )
 
+// csvFlushRows is how many CSV rows are buffered before flushing to the client
+const csvFlushRows = 100
+
 type InventoryHandler struct {
 	inventoryService service.InventoryService
 }
@@ -49,7 +60,11 @@ func (h *InventoryHandler) GetIngredient(w http.ResponseWriter, r *http.Request)
 
 	ingredient, err := h.inventoryService.GetIngredient(r.Context(), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get ingredient: %v", err), http.StatusInternalServerError)
+		if err == models.ErrIngredientNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get ingredient: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -94,6 +109,40 @@ func (h *InventoryHandler) UpdateIngredient(w http.ResponseWriter, r *http.Reque
 	})
 }
 
+// PatchIngredient updates only the fields present in the request body
+func (h *InventoryHandler) PatchIngredient(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+		return
+	}
+
+	var update models.InventoryUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	err = h.inventoryService.PatchIngredient(r.Context(), id, update)
+	if err != nil {
+		switch err {
+		case models.ErrIngredientNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case models.ErrEmptyUpdate, models.ErrInvalidQuantity, models.ErrInvalidCostPerUnit, models.ErrInvalidReOrderLevel:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to update ingredient: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Ingredient updated successfully",
+	})
+}
+
 func (h *InventoryHandler) DeleteIngredient(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
@@ -143,10 +192,352 @@ func (h *InventoryHandler) GetLeftOversWithPagination(w http.ResponseWriter, r *
 
 	leftovers, err := h.inventoryService.GetLeftOversWithPagination(r.Context(), sortBy, page, pageSize)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get leftovers: %v", err), http.StatusInternalServerError)
+		switch err {
+		case models.ErrInvalidSortByValue, models.ErrInvalidPage, models.ErrInvalidPageSize:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get leftovers: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(leftovers)
 }
+
+func (h *InventoryHandler) GetShoppingList(w http.ResponseWriter, r *http.Request) {
+	forecastDaysStr := r.URL.Query().Get("forecast_days")
+	if forecastDaysStr == "" {
+		forecastDaysStr = "7"
+	}
+
+	forecastDays, err := strconv.Atoi(forecastDaysStr)
+	if err != nil || forecastDays <= 0 {
+		http.Error(w, models.ErrInvalidForecastDays.Error(), http.StatusBadRequest)
+		return
+	}
+
+	shoppingList, err := h.inventoryService.GetShoppingList(r.Context(), forecastDays)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidForecastDays:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get shopping list: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shoppingList)
+}
+
+func (h *InventoryHandler) GetRevenueAtRisk(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+		return
+	}
+
+	daysStr := r.URL.Query().Get("days")
+	if daysStr == "" {
+		daysStr = "30"
+	}
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days <= 0 {
+		http.Error(w, models.ErrInvalidDays.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.inventoryService.GetRevenueAtRisk(r.Context(), id, days)
+	if err != nil {
+		switch err {
+		case models.ErrIngredientNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case models.ErrInvalidDays:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get revenue at risk: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *InventoryHandler) RestockIngredient(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+		return
+	}
+
+	var request models.RestockRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.inventoryService.RestockIngredient(r.Context(), id, request)
+	if err != nil {
+		switch err {
+		case models.ErrIngredientNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case models.ErrInvalidRestockQty, models.ErrInvalidExpiryDate:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to restock ingredient: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *InventoryHandler) GetUnusedIngredients(w http.ResponseWriter, r *http.Request) {
+	ingredients, err := h.inventoryService.GetUnusedIngredients(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get unused ingredients: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ingredients)
+}
+
+func (h *InventoryHandler) GetLowStockAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts, err := h.inventoryService.GetLowStockItems(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get low stock alerts: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+func (h *InventoryHandler) GetReorderRequests(w http.ResponseWriter, r *http.Request) {
+	requests, err := h.inventoryService.GetReorderRequests(r.Context(), strings.ToLower(r.URL.Query().Get("status")))
+	if err != nil {
+		if err == models.ErrInvalidReorderStatus {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get reorder requests: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+func (h *InventoryHandler) GetReorderPriority(w http.ResponseWriter, r *http.Request) {
+	priorities, err := h.inventoryService.GetReorderPriority(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get reorder priority: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(priorities)
+}
+
+// GetStockCoverage lists ingredients by days of stock left, lowest first
+func (h *InventoryHandler) GetStockCoverage(w http.ResponseWriter, r *http.Request) {
+	coverage, err := h.inventoryService.GetStockCoverage(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get stock coverage: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coverage)
+}
+
+// GetExpiryRisk lists stock lots projected to expire before they are used up, with the waste they cause
+func (h *InventoryHandler) GetExpiryRisk(w http.ResponseWriter, r *http.Request) {
+	response, err := h.inventoryService.GetExpiryRisk(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get expiry risk: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExportTransactions streams the inventory ledger as CSV, flushing as rows are read
+func (h *InventoryHandler) ExportTransactions(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" {
+		http.Error(w, models.ErrInvalidExportFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	startDate, err := parseOptionalDate(r, "start_date", false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endDate, err := parseOptionalDate(r, "end_date", true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writer := csv.NewWriter(w)
+	started := false
+	writeHeader := func() {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="inventory_transactions.csv"`)
+		writer.Write([]string{"ingredient", "type", "delta", "reference_id", "notes", "timestamp"})
+		started = true
+	}
+
+	rowsWritten := 0
+	err = h.inventoryService.StreamTransactions(r.Context(), startDate, endDate, func(t models.InventoryTransaction) error {
+		if !started {
+			writeHeader()
+		}
+
+		referenceID := ""
+		if t.ReferenceID != 0 {
+			referenceID = strconv.Itoa(t.ReferenceID)
+		}
+		if err := writer.Write([]string{
+			t.IngredientName,
+			t.TransactionType,
+			strconv.FormatFloat(t.Delta, 'f', -1, 64),
+			referenceID,
+			t.Notes,
+			t.CreatedAt.Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+
+		rowsWritten++
+		if rowsWritten%csvFlushRows == 0 {
+			writer.Flush()
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+		return writer.Error()
+	})
+	if err != nil {
+		// Once streaming has started the status is already sent, so the export is cut short
+		if started {
+			log.Printf("inventory transaction export aborted after %d rows: %v request_id=%s", rowsWritten, err, models.RequestIDFromContext(r.Context()))
+			writer.Flush()
+			return
+		}
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to export inventory transactions: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if !started {
+		writeHeader()
+	}
+	writer.Flush()
+}
+
+// maxInventoryImportBytes caps the size of a POST /inventory/import CSV
+const maxInventoryImportBytes = 5 << 20
+
+// inventoryImportColumns are the columns a POST /inventory/import CSV header must contain, in any order
+var inventoryImportColumns = []string{"name", "quantity", "unit", "cost_per_unit", "reorder_level"}
+
+// ImportIngredients upserts ingredients from a stocktake CSV. A malformed header or CSV imports
+// nothing; rows that fail to parse or validate are skipped and reported by line.
+func (h *InventoryHandler) ImportIngredients(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "text/csv" {
+		http.Error(w, "Content-Type must be text/csv", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	reader := csv.NewReader(http.MaxBytesReader(w, r.Body, maxInventoryImportBytes))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		http.Error(w, models.ErrInvalidImportHeader.Error(), http.StatusBadRequest)
+		return
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))] = i
+	}
+	for _, column := range inventoryImportColumns {
+		if _, ok := columns[column]; !ok {
+			http.Error(w, models.ErrInvalidImportHeader.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var rows []models.InventoryImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			http.Error(w, fmt.Sprintf("Invalid CSV: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := models.InventoryImportRow{Line: line}
+		if err != nil {
+			row.ParseError = fmt.Sprintf("expected %d fields, got %d", len(header), len(record))
+			rows = append(rows, row)
+			continue
+		}
+		row.Name = record[columns["name"]]
+		row.Unit = record[columns["unit"]]
+		if row.Quantity, err = parseCSVNumber(record[columns["quantity"]]); err != nil {
+			row.ParseError = "quantity must be a number"
+		}
+		// Cost and reorder level may be left blank
+		if cost := strings.TrimSpace(record[columns["cost_per_unit"]]); cost != "" && row.ParseError == "" {
+			if row.CostPerUnit, err = parseCSVNumber(cost); err != nil {
+				row.ParseError = "cost_per_unit must be a number"
+			}
+		}
+		if level := strings.TrimSpace(record[columns["reorder_level"]]); level != "" && row.ParseError == "" {
+			if row.ReOrderLevel, err = parseCSVNumber(level); err != nil {
+				row.ParseError = "reorder_level must be a number"
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	response, err := h.inventoryService.ImportIngredients(r.Context(), rows)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import inventory: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseCSVNumber parses a finite number from a CSV cell
+func parseCSVNumber(value string) (float64, error) {
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", value)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"frappuccino/internal/models"
+	"frappuccino/internal/service"
+)
+
+// fakeInventoryService knows only ingredient 1 and keeps the rows it is asked to import
+type fakeInventoryService struct {
+	service.InventoryService
+	imported []models.InventoryImportRow
+	ledger   []models.InventoryTransaction
+}
+
+func (s *fakeInventoryService) GetIngredient(ctx context.Context, id int) (models.Inventory, error) {
+	if id != 1 {
+		return models.Inventory{}, models.ErrIngredientNotFound
+	}
+	return models.Inventory{ID: 1, Name: "Milk"}, nil
+}
+
+func TestGetIngredientStatusCodes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /inventory/{id}", NewInventoryHandler(&fakeInventoryService{}).GetIngredient)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/inventory/1", http.StatusOK},
+		{"/inventory/42", http.StatusNotFound},
+		{"/inventory/milk", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func (s *fakeInventoryService) ImportIngredients(ctx context.Context, rows []models.InventoryImportRow) (*models.InventoryImportResponse, error) {
+	s.imported = rows
+	return &models.InventoryImportResponse{Failures: []models.InventoryImportFailure{}}, nil
+}
+
+func importCSV(inventory *fakeInventoryService, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/inventory/import", strings.NewReader(body))
+	r.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	w := httptest.NewRecorder()
+	NewInventoryHandler(inventory).ImportIngredients(w, r)
+	return w
+}
+
+func TestImportIngredientsParsesRows(t *testing.T) {
+	inventory := &fakeInventoryService{}
+	body := "\ufeffUnit, Name ,quantity,cost_per_unit,reorder_level\n" +
+		"ml,Milk,5000,0.01,1000\n" +
+		"g,Sugar, 2500 ,,\n" +
+		"g,Cocoa,lots,0.05,100\n" +
+		"g,Cinnamon,100,NaN,10\n" +
+		"items,Cups,300\n"
+
+	w := importCSV(inventory, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+
+	want := []models.InventoryImportRow{
+		{Line: 2, Name: "Milk", Quantity: 5000, Unit: "ml", CostPerUnit: 0.01, ReOrderLevel: 1000},
+		{Line: 3, Name: "Sugar", Quantity: 2500, Unit: "g"},
+		{Line: 4, Name: "Cocoa", Unit: "g", ParseError: "quantity must be a number"},
+		{Line: 5, Name: "Cinnamon", Quantity: 100, Unit: "g", ParseError: "cost_per_unit must be a number"},
+		{Line: 6, ParseError: "expected 5 fields, got 3"},
+	}
+	if !reflect.DeepEqual(inventory.imported, want) {
+		t.Errorf("imported rows =\n%+v\nwant\n%+v", inventory.imported, want)
+	}
+}
+
+func TestImportIngredientsRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"not CSV", "application/json", `[]`, http.StatusUnsupportedMediaType},
+		{"missing column", "text/csv", "name,quantity,unit,cost_per_unit\nMilk,1,ml,0.01\n", http.StatusBadRequest},
+		{"empty body", "text/csv", "", http.StatusBadRequest},
+		{"broken quoting", "text/csv", "name,quantity,unit,cost_per_unit,reorder_level\n\"Milk,1,ml,0.01,1\n", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		inventory := &fakeInventoryService{}
+		r := httptest.NewRequest(http.MethodPost, "/inventory/import", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		NewInventoryHandler(inventory).ImportIngredients(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if inventory.imported != nil {
+			t.Errorf("%s: imported %d rows, want none", tt.name, len(inventory.imported))
+		}
+	}
+}
+
+func (s *fakeInventoryService) StreamTransactions(ctx context.Context, startDate, endDate time.Time, fn func(models.InventoryTransaction) error) error {
+	for _, transaction := range s.ledger {
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportTransactionsWritesCSV(t *testing.T) {
+	inventory := &fakeInventoryService{ledger: []models.InventoryTransaction{
+		{IngredientName: "Milk", TransactionType: "order_usage", Delta: -200.5, ReferenceID: 42, Notes: "Used for order #42, latte",
+			CreatedAt: time.Date(2031, time.March, 3, 9, 30, 0, 0, time.UTC)},
+		{IngredientName: "Sugar", TransactionType: "restock", Delta: 1000,
+			CreatedAt: time.Date(2031, time.March, 4, 8, 0, 0, 0, time.UTC)},
+	}}
+	w := httptest.NewRecorder()
+	NewInventoryHandler(inventory).ExportTransactions(w, httptest.NewRequest(http.MethodGet, "/inventory/transactions/export?format=csv", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("status = %d with %q, want 200 with text/csv", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := "ingredient,type,delta,reference_id,notes,timestamp\n" +
+		"Milk,order_usage,-200.5,42,\"Used for order #42, latte\",2031-03-03T09:30:00Z\n" +
+		"Sugar,restock,1000,,,2031-03-04T08:00:00Z\n"
+	if w.Body.String() != want {
+		t.Errorf("body =\n%s\nwant\n%s", w.Body.String(), want)
+	}
+
+	w = httptest.NewRecorder()
+	NewInventoryHandler(inventory).ExportTransactions(w, httptest.NewRequest(http.MethodGet, "/inventory/transactions/export?format=xlsx", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("xlsx export status = %d, want 400", w.Code)
+	}
+}
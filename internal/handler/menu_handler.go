@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"frappuccino/internal/models"
 	"frappuccino/internal/service"
@@ -19,11 +23,62 @@ func NewMenuHandler(menuService service.MenuService) *MenuHandler {
 }
 
 func (h *MenuHandler) ListMenuItems(w http.ResponseWriter, r *http.Request) {
-	items, err := h.menuService.GetAllMenu(r.Context())
+	filters := models.MenuFilters{
+		Category: r.URL.Query().Get("category"),
+		Query:    r.URL.Query().Get("q"),
+	}
+	if active := r.URL.Query().Get("active"); active != "" {
+		parsed, err := strconv.ParseBool(active)
+		if err != nil {
+			http.Error(w, models.ErrInvalidActiveFilter.Error(), http.StatusBadRequest)
+			return
+		}
+		filters.Active = &parsed
+	}
+	if minPrice := r.URL.Query().Get("minPrice"); minPrice != "" {
+		parsed, err := strconv.ParseFloat(minPrice, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v: minPrice must be a number", models.ErrInvalidPriceRange), http.StatusBadRequest)
+			return
+		}
+		filters.MinPrice = &parsed
+	}
+	if maxPrice := r.URL.Query().Get("maxPrice"); maxPrice != "" {
+		parsed, err := strconv.ParseFloat(maxPrice, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v: maxPrice must be a number", models.ErrInvalidPriceRange), http.StatusBadRequest)
+			return
+		}
+		filters.MaxPrice = &parsed
+	}
+
+	getMenu := h.menuService.GetAllMenu
+	// Cache-Control: no-cache (or the older Pragma: no-cache) reads through to the database
+	if strings.Contains(r.Header.Get("Cache-Control"), "no-cache") || r.Header.Get("Pragma") == "no-cache" {
+		getMenu = h.menuService.RefreshMenu
+	}
+	if !filters.IsEmpty() {
+		getMenu = func(ctx context.Context) ([]models.MenuItems, []string, error) {
+			return h.menuService.GetMenuFiltered(ctx, filters)
+		}
+	}
+
+	items, warnings, err := getMenu(r.Context())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get menu items: %v", err), http.StatusInternalServerError)
+		if errors.Is(err, models.ErrInvalidPriceRange) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get menu items: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
+
+	// Partial failures still return the menu, flagged with a Warning header
+	for _, warning := range warnings {
+		log.Printf("menu listing warning: %s request_id=%s", warning, models.RequestIDFromContext(r.Context()))
+		w.Header().Add("Warning", fmt.Sprintf("199 - %q", warning))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(items)
 }
@@ -38,7 +93,7 @@ func (h *MenuHandler) GetMenuItem(w http.ResponseWriter, r *http.Request) {
 
 	item, err := h.menuService.GetMenuItemByID(r.Context(), id)
 	if err != nil {
-		if err == models.ErrInvalidMenuItemID {
+		if err == models.ErrInvalidMenuItemID || err == models.ErrMenuItemNotFound {
 			http.Error(w, "Menu item not found", http.StatusNotFound)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to get menu item: %v", err), http.StatusInternalServerError)
@@ -59,6 +114,11 @@ func (h *MenuHandler) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
 
 	id, err := h.menuService.CreateMenuItem(r.Context(), item)
 	if err != nil {
+		// Unknown ingredients are reported by id so the recipe can be fixed
+		if errors.Is(err, models.ErrIngredientNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to add menu item: %v", err), http.StatusBadRequest)
 		return
 	}
@@ -86,6 +146,10 @@ func (h *MenuHandler) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.menuService.UpdateMenuItem(r.Context(), id, item); err != nil {
+		if errors.Is(err, models.ErrIngredientNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to update menu item: %v", err), http.StatusBadRequest)
 		return
 	}
@@ -116,3 +180,356 @@ func (h *MenuHandler) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
 		"message": "Menu item deleted successfully",
 	})
 }
+
+func (h *MenuHandler) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history, err := h.menuService.GetPriceHistory(r.Context(), id)
+	if err != nil {
+		if err == models.ErrInvalidMenuItemID || err == models.ErrMenuItemNotFound {
+			http.Error(w, "Menu item not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get price history: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+func (h *MenuHandler) GetModifierGroups(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groups, err := h.menuService.GetModifierGroups(r.Context(), id)
+	if err != nil {
+		if err == models.ErrInvalidMenuItemID {
+			http.Error(w, "Menu item not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get modifier groups: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+func (h *MenuHandler) CreateModifierGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var group models.ModifierGroup
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	groupID, err := h.menuService.CreateModifierGroup(r.Context(), id, group)
+	if err != nil {
+		switch {
+		case err == models.ErrInvalidMenuItemID:
+			http.Error(w, "Menu item not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrInvalidModifierGroup):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to add modifier group: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      groupID,
+		"message": "Modifier group added successfully",
+	})
+}
+
+func (h *MenuHandler) UpdateModifierGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+	groupID, err := strconv.Atoi(r.PathValue("groupID"))
+	if err != nil || groupID <= 0 {
+		http.Error(w, models.ErrModifierGroupNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	var group models.ModifierGroup
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.menuService.UpdateModifierGroup(r.Context(), id, groupID, group); err != nil {
+		switch {
+		case err == models.ErrModifierGroupNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, models.ErrInvalidModifierGroup):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to update modifier group: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Modifier group updated successfully",
+	})
+}
+
+func (h *MenuHandler) DeleteModifierGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+	groupID, err := strconv.Atoi(r.PathValue("groupID"))
+	if err != nil || groupID <= 0 {
+		http.Error(w, models.ErrModifierGroupNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := h.menuService.DeleteModifierGroup(r.Context(), id, groupID); err != nil {
+		if err == models.ErrModifierGroupNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to delete modifier group: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Modifier group deleted successfully",
+	})
+}
+
+func (h *MenuHandler) GetMenuTree(w http.ResponseWriter, r *http.Request) {
+	tree, warnings, err := h.menuService.GetMenuTree(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get menu tree: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	for _, warning := range warnings {
+		log.Printf("menu tree warning: %s request_id=%s", warning, models.RequestIDFromContext(r.Context()))
+		w.Header().Add("Warning", fmt.Sprintf("199 - %q", warning))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
+func (h *MenuHandler) GetUnavailableMenuItems(w http.ResponseWriter, r *http.Request) {
+	items, err := h.menuService.GetUnavailableMenuItems(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get unavailable menu items: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func (h *MenuHandler) GetIngredientTree(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tree, err := h.menuService.GetIngredientTree(r.Context(), id)
+	if err != nil {
+		if err == models.ErrInvalidMenuItemID {
+			http.Error(w, "Menu item not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get ingredient tree: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
+func (h *MenuHandler) PreviewPriceChange(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request models.PriceWhatIfRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.menuService.PreviewPriceChange(r.Context(), id, request)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidMenuItemID:
+			http.Error(w, "Menu item not found", http.StatusNotFound)
+		case models.ErrInvalidMenuItemPrice, models.ErrInvalidDays:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to preview price change: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *MenuHandler) GetRemovalImpact(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	days := 0
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days <= 0 {
+			http.Error(w, models.ErrInvalidDays.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := h.menuService.GetRemovalImpact(r.Context(), id, days)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidMenuItemID:
+			http.Error(w, "Menu item not found", http.StatusNotFound)
+		case models.ErrInvalidDays:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get removal impact: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *MenuHandler) GetBreakEven(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidMenuItemID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fixedCost, err := strconv.ParseFloat(r.URL.Query().Get("fixed_cost"), 64)
+	if err != nil {
+		http.Error(w, models.ErrInvalidFixedCost.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.menuService.GetBreakEven(r.Context(), id, fixedCost)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidMenuItemID:
+			http.Error(w, "Menu item not found", http.StatusNotFound)
+		case models.ErrInvalidFixedCost:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case models.ErrUnknownUnitCost, models.ErrNoContribution:
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get break-even: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// WarmMenuCache reloads the menu from the database into the cache
+func (h *MenuHandler) WarmMenuCache(w http.ResponseWriter, r *http.Request) {
+	items, warnings, err := h.menuService.RefreshMenu(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to warm menu cache: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Menu cache warmed",
+		"items":   len(items),
+	}
+	if len(warnings) > 0 {
+		response["message"] = "Menu loaded with warnings and was not cached"
+		response["warnings"] = warnings
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *MenuHandler) NormalizeCategories(w http.ResponseWriter, r *http.Request) {
+	response, err := h.menuService.NormalizeCategories(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to normalize menu categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *MenuHandler) GetMenuItemsWithoutRecipe(w http.ResponseWriter, r *http.Request) {
+	items, err := h.menuService.GetMenuItemsWithoutRecipe(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get menu items without recipe: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// BulkAssignIngredient adds an ingredient to the recipes of several menu items in one transaction
+func (h *MenuHandler) BulkAssignIngredient(w http.ResponseWriter, r *http.Request) {
+	var request models.BulkAssignIngredientRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.menuService.BulkAssignIngredient(r.Context(), request)
+	if err != nil {
+		switch {
+		case err == models.ErrInvalidBulkAssign, errors.Is(err, models.ErrIngredientNotFound):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, models.ErrMenuItemNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to assign ingredient: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
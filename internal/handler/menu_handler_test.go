@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"frappuccino/internal/models"
+	"frappuccino/internal/service"
+)
+
+// fakeMenuService knows only menu item 1
+type fakeMenuService struct {
+	service.MenuService
+}
+
+func (s *fakeMenuService) GetMenuItemByID(ctx context.Context, id int) (models.MenuItems, error) {
+	if id != 1 {
+		return models.MenuItems{}, models.ErrMenuItemNotFound
+	}
+	return models.MenuItems{ID: 1, Name: "Latte", Price: 3.50}, nil
+}
+
+func (s *fakeMenuService) GetAllMenu(ctx context.Context) ([]models.MenuItems, []string, error) {
+	// The ingredients of the latte failed to load
+	items := []models.MenuItems{{ID: 1, Name: "Latte", Price: 3.50, Ingredients: []models.MenuItemIngredients{}}}
+	return items, []string{"ingredients for menu item 1 could not be loaded: connection reset"}, nil
+}
+
+func TestGetMenuItemStatusCodes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /menu/{id}", NewMenuHandler(&fakeMenuService{}).GetMenuItem)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/menu/1", http.StatusOK},
+		{"/menu/42", http.StatusNotFound},
+		{"/menu/latte", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func TestGetAllMenuWarnsOfPartialListing(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /menu", NewMenuHandler(&fakeMenuService{}).ListMenuItems)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/menu", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /menu = %d, want 200", w.Code)
+	}
+	var items []models.MenuItems
+	if err := json.NewDecoder(w.Body).Decode(&items); err != nil || len(items) != 1 {
+		t.Fatalf("body = %+v, %v, want the latte", items, err)
+	}
+	if got := w.Header().Get("Warning"); !strings.Contains(got, "menu item 1 could not be loaded") {
+		t.Errorf("Warning = %q, want the ingredient failure", got)
+	}
+}
@@ -2,9 +2,11 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"frappuccino/internal/models"
@@ -26,17 +28,33 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orderID, err := h.orderService.CreateOrder(r.Context(), order)
+	orderID, replayed, err := h.orderService.CreateOrder(r.Context(), order, r.Header.Get("Idempotency-Key"))
 	if err != nil {
 		switch err {
-		case models.ErrEmptyOrder, models.ErrInvalidTotalPrice:
+		case models.ErrInvalidIdempotencyKey, models.ErrEmptyOrder, models.ErrInvalidOrderItem, models.ErrInvalidTotalPrice, models.ErrJSONTooLarge, models.ErrJSONTooDeep, models.ErrInvalidJSON, models.ErrMenuItemUnavailable, models.ErrClientTimestamps, models.ErrCustomerNotFound, models.ErrCustomerInactive, models.ErrInvalidDiscount:
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		default:
-			http.Error(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusInternalServerError)
+			if errors.Is(err, models.ErrInsufficientInventory) {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else if errors.Is(err, models.ErrInvalidModifier) || errors.Is(err, models.ErrInvalidMenuItemID) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusInternalServerError)
+			}
 		}
 		return
 	}
 
+	// A retry with the same Idempotency-Key gets the original order back
+	if replayed {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      orderID,
+			"message": "Order already created",
+		})
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -55,7 +73,7 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 
 	order, err := h.orderService.GetOrder(r.Context(), id)
 	if err != nil {
-		if err == models.ErrInvalidOrderID {
+		if err == models.ErrOrderNotFound {
 			http.Error(w, "Order not found", http.StatusNotFound)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to get order: %v", err), http.StatusInternalServerError)
@@ -89,11 +107,21 @@ func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 			filters.CustomerID = id
 		}
 	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 {
+			http.Error(w, models.ErrInvalidLimit.Error(), http.StatusBadRequest)
+			return
+		}
+		filters.Limit = parsed
+	}
+	filters.Cursor = r.URL.Query().Get("cursor")
+	filters.Customization = strings.TrimSpace(r.URL.Query().Get("customization"))
 
 	orders, err := h.orderService.ListOrders(r.Context(), filters)
 	if err != nil {
 		switch err {
-		case models.ErrInvalidDateRange:
+		case models.ErrInvalidDateRange, models.ErrInvalidLimit, models.ErrInvalidCursor:
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		default:
 			http.Error(w, fmt.Sprintf("Failed to list orders: %v", err), http.StatusInternalServerError)
@@ -122,12 +150,18 @@ func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 	err = h.orderService.UpdateOrder(r.Context(), id, order)
 	if err != nil {
 		switch err {
-		case models.ErrInvalidOrderID:
+		case models.ErrOrderNotFound:
 			http.Error(w, "Order not found", http.StatusNotFound)
-		case models.ErrEmptyOrder, models.ErrInvalidTotalPrice:
+		case models.ErrEmptyOrder, models.ErrInvalidOrderItem, models.ErrInvalidTotalPrice, models.ErrJSONTooLarge, models.ErrJSONTooDeep, models.ErrInvalidJSON, models.ErrMenuItemUnavailable, models.ErrClientTimestamps, models.ErrInvalidOrderStatus, models.ErrInvalidDiscount, models.ErrCustomerNotFound, models.ErrCustomerInactive:
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		default:
-			http.Error(w, fmt.Sprintf("Failed to update order: %v", err), http.StatusInternalServerError)
+			if errors.Is(err, models.ErrInsufficientInventory) || errors.Is(err, models.ErrInvalidTransition) {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else if errors.Is(err, models.ErrInvalidModifier) || errors.Is(err, models.ErrInvalidMenuItemID) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to update order: %v", err), http.StatusInternalServerError)
+			}
 		}
 		return
 	}
@@ -149,7 +183,7 @@ func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 
 	err = h.orderService.DeleteOrder(r.Context(), id)
 	if err != nil {
-		if err == models.ErrInvalidOrderID {
+		if err == models.ErrOrderNotFound {
 			http.Error(w, "Order not found", http.StatusNotFound)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to delete order: %v", err), http.StatusInternalServerError)
@@ -175,10 +209,14 @@ func (h *OrderHandler) CloseOrder(w http.ResponseWriter, r *http.Request) {
 	err = h.orderService.CloseOrder(r.Context(), id)
 	if err != nil {
 		switch err {
-		case models.ErrInvalidOrderID:
+		case models.ErrOrderNotFound:
 			http.Error(w, "Order not found", http.StatusNotFound)
 		default:
-			http.Error(w, fmt.Sprintf("Failed to close order: %v", err), http.StatusInternalServerError)
+			if errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrInsufficientInventory) {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to close order: %v", err), http.StatusInternalServerError)
+			}
 		}
 		return
 	}
@@ -220,7 +258,7 @@ func (h *OrderHandler) ProcessBatchOrders(w http.ResponseWriter, r *http.Request
 	response, err := h.orderService.ProcessBatchOrders(r.Context(), batchRequest.Orders)
 	if err != nil {
 		switch err {
-		case models.ErrEmptyBatch, models.ErrEmptyOrder, models.ErrInvalidTotalPrice:
+		case models.ErrEmptyBatch, models.ErrEmptyOrder, models.ErrInvalidOrderItem, models.ErrInvalidTotalPrice, models.ErrJSONTooLarge, models.ErrJSONTooDeep, models.ErrInvalidJSON, models.ErrMenuItemUnavailable, models.ErrClientTimestamps:
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		default:
 			http.Error(w, fmt.Sprintf("Failed to process batch orders: %v", err), http.StatusInternalServerError)
@@ -232,3 +270,236 @@ func (h *OrderHandler) ProcessBatchOrders(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+func (h *OrderHandler) CheckBatchFeasibility(w http.ResponseWriter, r *http.Request) {
+	var batchRequest models.BatchOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&batchRequest); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.orderService.CheckBatchFeasibility(r.Context(), batchRequest.Orders)
+	if err != nil {
+		switch err {
+		case models.ErrEmptyBatch, models.ErrEmptyOrder, models.ErrInvalidOrderItem:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to check batch feasibility: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OrderHandler) GetStaleOrders(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "preparing"
+	}
+
+	olderThanStr := r.URL.Query().Get("older_than")
+	if olderThanStr == "" {
+		olderThanStr = "10m"
+	}
+	olderThan, err := time.ParseDuration(olderThanStr)
+	if err != nil {
+		http.Error(w, models.ErrInvalidOlderThan.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orders, err := h.orderService.GetStaleOrders(r.Context(), status, olderThan)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidOrderStatus, models.ErrInvalidOlderThan:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get stale orders: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+func (h *OrderHandler) BulkUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	var request models.BulkStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.orderService.BulkUpdateStatus(r.Context(), request.Status, request.Filters)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidOrderStatus, models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			if errors.Is(err, models.ErrInsufficientInventory) {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to update order statuses: %v", err), http.StatusInternalServerError)
+			}
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidOrderID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request models.OrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.orderService.UpdateOrderStatus(r.Context(), id, request.Status)
+	if err != nil {
+		switch err {
+		case models.ErrOrderNotFound:
+			http.Error(w, "Order not found", http.StatusNotFound)
+		case models.ErrInvalidOrderStatus:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			if errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrInsufficientInventory) {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to update order status: %v", err), http.StatusInternalServerError)
+			}
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidOrderID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.orderService.CancelOrder(r.Context(), id)
+	if err != nil {
+		switch err {
+		case models.ErrOrderNotFound:
+			http.Error(w, "Order not found", http.StatusNotFound)
+		default:
+			if errors.Is(err, models.ErrInvalidTransition) {
+				http.Error(w, err.Error(), http.StatusConflict)
+			} else {
+				http.Error(w, fmt.Sprintf("Failed to cancel order: %v", err), http.StatusInternalServerError)
+			}
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Order cancelled successfully",
+	})
+}
+
+func (h *OrderHandler) GetOrderStatusHistory(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidOrderID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history, err := h.orderService.GetOrderStatusHistory(r.Context(), id)
+	if err != nil {
+		if err == models.ErrOrderNotFound {
+			http.Error(w, "Order not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get order status history: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+func (h *OrderHandler) GetOrderInventoryTransactions(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidOrderID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.orderService.GetOrderInventoryTransactions(r.Context(), id)
+	if err != nil {
+		if err == models.ErrOrderNotFound {
+			http.Error(w, "Order not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get order inventory transactions: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OrderHandler) BatchGetOrders(w http.ResponseWriter, r *http.Request) {
+	var request models.BatchGetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.orderService.GetOrdersByIDs(r.Context(), request.OrderIDs)
+	if err != nil {
+		if err == models.ErrInvalidOrderIDs {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get orders: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *OrderHandler) GetQueueETA(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidOrderID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	eta, err := h.orderService.GetQueueETA(r.Context(), id)
+	if err != nil {
+		if err == models.ErrOrderNotFound {
+			http.Error(w, "Order not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get queue ETA: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(eta)
+}
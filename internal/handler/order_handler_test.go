@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"frappuccino/internal/models"
+	"frappuccino/internal/service"
+)
+
+// fakeOrderService keeps created orders in memory and knows the customers in customers. Methods the
+// tests don't use are left to the embedded nil interface.
+type fakeOrderService struct {
+	service.OrderService
+	customers map[int]bool
+	orders    []models.Order
+}
+
+func (s *fakeOrderService) CreateOrder(ctx context.Context, order models.Order, idempotencyKey string) (int, bool, error) {
+	if order.CustomerID != 0 && !s.customers[order.CustomerID] {
+		return 0, false, models.ErrCustomerNotFound
+	}
+	s.orders = append(s.orders, order)
+	return len(s.orders), false, nil
+}
+
+func TestCreateOrderRejectsUnknownCustomer(t *testing.T) {
+	orders := &fakeOrderService{customers: map[int]bool{1: true}}
+	h := NewOrderHandler(orders)
+
+	body := `{"customer_id": 9999, "items": [{"menu_item_id": 1, "quantity": 1}]}`
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), models.ErrCustomerNotFound.Error()) {
+		t.Errorf("body = %q, want it to name the missing customer", w.Body.String())
+	}
+	if len(orders.orders) != 0 {
+		t.Errorf("%d orders created, want 0", len(orders.orders))
+	}
+}
+
+func TestCreateOrderAcceptsKnownCustomer(t *testing.T) {
+	orders := &fakeOrderService{customers: map[int]bool{1: true}}
+	h := NewOrderHandler(orders)
+
+	body := `{"customer_id": 1, "items": [{"menu_item_id": 1, "quantity": 1}]}`
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want 201", w.Code)
+	}
+}
+
+// missingOrderService has no orders but order 7, which is delivered
+type missingOrderService struct {
+	service.OrderService
+}
+
+const deliveredOrderID = 7
+
+func (s *missingOrderService) find(id int) error {
+	if id == deliveredOrderID {
+		return fmt.Errorf("%w: order %d can not move from delivered", models.ErrInvalidTransition, id)
+	}
+	return models.ErrOrderNotFound
+}
+
+func (s *missingOrderService) GetOrder(ctx context.Context, id int) (models.Order, error) {
+	if id == deliveredOrderID {
+		return models.Order{ID: id, Status: "delivered"}, nil
+	}
+	return models.Order{}, models.ErrOrderNotFound
+}
+
+func (s *missingOrderService) UpdateOrder(ctx context.Context, id int, order models.Order) error {
+	return s.find(id)
+}
+
+func (s *missingOrderService) DeleteOrder(ctx context.Context, id int) error {
+	if id == deliveredOrderID {
+		return nil
+	}
+	return models.ErrOrderNotFound
+}
+
+func (s *missingOrderService) CloseOrder(ctx context.Context, id int) error {
+	return s.find(id)
+}
+
+func (s *missingOrderService) CancelOrder(ctx context.Context, id int) error {
+	return s.find(id)
+}
+
+func (s *missingOrderService) UpdateOrderStatus(ctx context.Context, id int, status string) (models.OrderStatusResponse, error) {
+	return models.OrderStatusResponse{}, s.find(id)
+}
+
+func (s *missingOrderService) GetOrderStatusHistory(ctx context.Context, id int) ([]models.OrderStatusHistory, error) {
+	return nil, models.ErrOrderNotFound
+}
+
+func (s *missingOrderService) GetOrderInventoryTransactions(ctx context.Context, id int) (*models.OrderInventoryTransactionsResponse, error) {
+	return nil, models.ErrOrderNotFound
+}
+
+func (s *missingOrderService) GetQueueETA(ctx context.Context, id int) (models.QueueETAResponse, error) {
+	return models.QueueETAResponse{}, models.ErrOrderNotFound
+}
+
+func newOrderMux() *http.ServeMux {
+	h := NewOrderHandler(&missingOrderService{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orders/{id}", h.GetOrder)
+	mux.HandleFunc("GET /orders/{id}/queue-eta", h.GetQueueETA)
+	mux.HandleFunc("PUT /orders/{id}", h.UpdateOrder)
+	mux.HandleFunc("DELETE /orders/{id}", h.DeleteOrder)
+	mux.HandleFunc("POST /orders/{id}/close", h.CloseOrder)
+	mux.HandleFunc("POST /orders/{id}/cancel", h.CancelOrder)
+	mux.HandleFunc("PATCH /orders/{id}/status", h.UpdateOrderStatus)
+	mux.HandleFunc("GET /orders/{id}/status-history", h.GetOrderStatusHistory)
+	mux.HandleFunc("GET /orders/{id}/inventory-transactions", h.GetOrderInventoryTransactions)
+	return mux
+}
+
+func TestOrderRoutesStatusCodes(t *testing.T) {
+	mux := newOrderMux()
+	update := `{"items": [{"menu_item_id": 1, "quantity": 1}]}`
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/orders/42", "", http.StatusNotFound},
+		{http.MethodGet, "/orders/42/queue-eta", "", http.StatusNotFound},
+		{http.MethodPut, "/orders/42", update, http.StatusNotFound},
+		{http.MethodDelete, "/orders/42", "", http.StatusNotFound},
+		{http.MethodPost, "/orders/42/close", "", http.StatusNotFound},
+		{http.MethodPost, "/orders/42/cancel", "", http.StatusNotFound},
+		{http.MethodPatch, "/orders/42/status", `{"status": "ready"}`, http.StatusNotFound},
+		{http.MethodGet, "/orders/42/status-history", "", http.StatusNotFound},
+		{http.MethodGet, "/orders/42/inventory-transactions", "", http.StatusNotFound},
+
+		{http.MethodGet, "/orders/abc", "", http.StatusBadRequest},
+		{http.MethodPost, "/orders/0/close", "", http.StatusBadRequest},
+
+		{http.MethodGet, "/orders/7", "", http.StatusOK},
+		{http.MethodDelete, "/orders/7", "", http.StatusOK},
+		{http.MethodPost, "/orders/7/close", "", http.StatusConflict},
+		{http.MethodPost, "/orders/7/cancel", "", http.StatusConflict},
+		{http.MethodPut, "/orders/7", update, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d (%s)", tt.method, tt.path, w.Code, tt.want, strings.TrimSpace(w.Body.String()))
+		}
+	}
+}
+
+// unknownMenuItemService fails every order on a menu item missing at the request's location
+type unknownMenuItemService struct {
+	service.OrderService
+}
+
+func (s *unknownMenuItemService) CreateOrder(ctx context.Context, order models.Order, idempotencyKey string) (int, bool, error) {
+	return 0, false, fmt.Errorf("%w: %d", models.ErrInvalidMenuItemID, order.Items[0].MenuItemID)
+}
+
+func (s *unknownMenuItemService) UpdateOrder(ctx context.Context, id int, order models.Order) error {
+	return fmt.Errorf("failed to calculate order total: %w", fmt.Errorf("%w: %d", models.ErrInvalidMenuItemID, order.Items[0].MenuItemID))
+}
+
+func TestOrderWithUnknownMenuItemIsBadRequest(t *testing.T) {
+	h := NewOrderHandler(&unknownMenuItemService{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /orders", h.CreateOrder)
+	mux.HandleFunc("PUT /orders/{id}", h.UpdateOrder)
+
+	body := `{"items": [{"menu_item_id": 99, "quantity": 1}]}`
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		path := "/orders"
+		if method == http.MethodPut {
+			path = "/orders/1"
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid menu item id: 99") {
+			t.Errorf("%s %s = %d %q, want 400 naming menu item 99", method, path, w.Code, strings.TrimSpace(w.Body.String()))
+		}
+	}
+}
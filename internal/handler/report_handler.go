@@ -2,12 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"frappuccino/internal/models"
 	"frappuccino/internal/service"
 )
 
@@ -34,11 +37,43 @@ func (h *ReportHandler) GetTotalSales(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+func (h *ReportHandler) GetOrderRate(w http.ResponseWriter, r *http.Request) {
+	windowStr := r.URL.Query().Get("window")
+	if windowStr == "" {
+		windowStr = "15m"
+	}
+
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window <= 0 {
+		http.Error(w, models.ErrInvalidWindow.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetOrderRate(r.Context(), window)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidWindow:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get order rate: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 func (h *ReportHandler) GetPopularItems(w http.ResponseWriter, r *http.Request) {
+	format, err := negotiateFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	limitStr := r.URL.Query().Get("limit")
 	limit := 10 // default value
 	if limitStr != "" {
-		var err error
 		limit, err = strconv.Atoi(limitStr)
 		if err != nil || limit <= 0 {
 			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
@@ -46,12 +81,36 @@ func (h *ReportHandler) GetPopularItems(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	items, err := h.reportService.GetPopularItems(r.Context(), limit)
+	getPopularItems := h.reportService.GetPopularItems
+	if r.URL.Query().Get("refresh") == "true" {
+		getPopularItems = h.reportService.RefreshPopularItems
+	}
+
+	items, err := getPopularItems(r.Context(), limit)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get popular items: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	if format == formatCSV {
+		rows := make([][]string, 0, len(items))
+		for _, item := range items {
+			rows = append(rows, []string{
+				strconv.Itoa(item.MenuItemID),
+				item.Name,
+				strconv.Itoa(item.OrderCount),
+				strconv.Itoa(item.TotalQuantity),
+				strconv.FormatFloat(item.Percentage, 'f', 2, 64),
+			})
+		}
+		filename := fmt.Sprintf("popular_items_%s.csv", time.Now().Format("2006-01-02"))
+		header := []string{"menu_item_id", "name", "order_count", "total_quantity", "percentage"}
+		if err := writeCSV(w, filename, header, rows); err != nil {
+			log.Printf("popular items export failed: %v request_id=%s", err, models.RequestIDFromContext(r.Context()))
+		}
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(items)
 }
@@ -63,9 +122,15 @@ func (h *ReportHandler) GetOrderedItemsByPeriod(w http.ResponseWriter, r *http.R
 	yearStr := r.URL.Query().Get("year")
 
 	// Validate period
-	validPeriods := map[string]bool{"day": true, "month": true}
+	validPeriods := map[string]bool{"day": true, "week": true, "month": true, "year": true}
 	if !validPeriods[period] {
-		http.Error(w, "period must be one of: day, month", http.StatusBadRequest)
+		http.Error(w, models.ErrInvalidPeriod.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only daily reports are scoped to a month
+	if period != "day" && monthStr != "" {
+		http.Error(w, fmt.Sprintf("month parameter should not be provided for %s period reports", period), http.StatusBadRequest)
 		return
 	}
 
@@ -88,10 +153,8 @@ func (h *ReportHandler) GetOrderedItemsByPeriod(w http.ResponseWriter, r *http.R
 			}
 			month = parsedMonth
 		}
-	} else {
-		if period == "daily" || period == "weekly" {
-			month = time.Now().Month()
-		}
+	} else if period == "day" {
+		month = time.Now().Month()
 	}
 
 	// Parse year
@@ -107,15 +170,14 @@ func (h *ReportHandler) GetOrderedItemsByPeriod(w http.ResponseWriter, r *http.R
 		year = time.Now().Year()
 	}
 
-	// Additional validation for monthly reports
-	if period == "monthly" && monthStr != "" {
-		http.Error(w, "month parameter should not be provided for monthly period reports", http.StatusBadRequest)
-		return
-	}
-
 	response, err := h.reportService.GetOrderedItemsByPeriod(r.Context(), period, month, year)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get period report: %v", err), http.StatusInternalServerError)
+		switch err {
+		case models.ErrInvalidPeriod:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get period report: %v", err), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -192,6 +254,10 @@ func (h *ReportHandler) Search(w http.ResponseWriter, r *http.Request) {
 	// Call service with all parameters
 	result, err := h.reportService.Search(r.Context(), query, filter, minPrice, maxPrice)
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidPriceRange) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
 		return
 	}
@@ -202,3 +268,471 @@ func (h *ReportHandler) Search(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
+
+func (h *ReportHandler) GetCostVariance(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetCostVariance(r.Context(), startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get cost variance: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetRestockHistory(w http.ResponseWriter, r *http.Request) {
+	var ingredientID int
+	if ingredientIDStr := r.URL.Query().Get("ingredient_id"); ingredientIDStr != "" {
+		id, err := strconv.Atoi(ingredientIDStr)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+			return
+		}
+		ingredientID = id
+	}
+
+	startDate, err := parseOptionalDate(r, "start_date", false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endDate, err := parseOptionalDate(r, "end_date", true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetRestockHistory(r.Context(), ingredientID, startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get restock history: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetSalesPerLaborHour(w http.ResponseWriter, r *http.Request) {
+	var request models.SalesPerLaborHourRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetSalesPerLaborHour(r.Context(), request.Days)
+	if err != nil {
+		switch err {
+		case models.ErrEmptyStaffing, models.ErrInvalidDate, models.ErrInvalidLaborHours:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get sales per labor hour: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetTargetAttainment(w http.ResponseWriter, r *http.Request) {
+	var request models.TargetAttainmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetTargetAttainment(r.Context(), request)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDate, models.ErrInvalidDateRange, models.ErrInvalidSalesTarget:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get target attainment: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetSalesTrend(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	granularity := strings.ToLower(r.URL.Query().Get("granularity"))
+	if granularity == "" {
+		granularity = "day"
+	}
+
+	response, err := h.reportService.GetSalesTrend(r.Context(), granularity, startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidGranularity, models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get sales trend: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetRefundTrend(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	granularity := strings.ToLower(r.URL.Query().Get("granularity"))
+	if granularity == "" {
+		granularity = "day"
+	}
+
+	response, err := h.reportService.GetRefundTrend(r.Context(), granularity, startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidGranularity, models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get refund trend: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetLowMarginItems(w http.ResponseWriter, r *http.Request) {
+	threshold := 20.0 // default value
+	if thresholdStr := r.URL.Query().Get("threshold"); thresholdStr != "" {
+		var err error
+		threshold, err = strconv.ParseFloat(thresholdStr, 64)
+		if err != nil {
+			http.Error(w, models.ErrInvalidThreshold.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := h.reportService.GetLowMarginItems(r.Context(), threshold)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidThreshold:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get low margin items: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetStaffingRecommendation(w http.ResponseWriter, r *http.Request) {
+	date := time.Now()
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		var err error
+		date, err = time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			http.Error(w, models.ErrInvalidDate.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ordersPerStaff := 10 // default value
+	if ordersPerStaffStr := r.URL.Query().Get("orders_per_staff"); ordersPerStaffStr != "" {
+		var err error
+		ordersPerStaff, err = strconv.Atoi(ordersPerStaffStr)
+		if err != nil || ordersPerStaff <= 0 {
+			http.Error(w, models.ErrInvalidOrdersPerStaff.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := h.reportService.GetStaffingRecommendation(r.Context(), date, ordersPerStaff)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidOrdersPerStaff:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get staffing recommendation: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSalesAnomalies compares a day's sales with the trailing baseline; date defaults to today,
+// std_devs to 2 and baseline_days to 28
+func (h *ReportHandler) GetSalesAnomalies(w http.ResponseWriter, r *http.Request) {
+	date := time.Now()
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		var err error
+		date, err = time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			http.Error(w, models.ErrInvalidDate.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	stdDevs := 2.0
+	if stdDevsStr := r.URL.Query().Get("std_devs"); stdDevsStr != "" {
+		var err error
+		stdDevs, err = strconv.ParseFloat(stdDevsStr, 64)
+		if err != nil {
+			http.Error(w, models.ErrInvalidStdDevs.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	baselineDays := 28
+	if baselineDaysStr := r.URL.Query().Get("baseline_days"); baselineDaysStr != "" {
+		var err error
+		baselineDays, err = strconv.Atoi(baselineDaysStr)
+		if err != nil {
+			http.Error(w, models.ErrInvalidBaselineDays.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := h.reportService.GetSalesAnomalies(r.Context(), date, stdDevs, baselineDays)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidStdDevs, models.ErrInvalidBaselineDays:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get sales anomalies: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetPriceAudit(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetPriceAudit(r.Context(), startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to audit order prices: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetTotalMismatches lists orders whose stored total doesn't match their items
+func (h *ReportHandler) GetTotalMismatches(w http.ResponseWriter, r *http.Request) {
+	mismatches, err := h.reportService.GetTotalMismatches(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get order total mismatches: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mismatches)
+}
+
+func (h *ReportHandler) GetProfitableHours(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetProfitableHours(r.Context(), startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get profitable hours: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetMenuContribution ranks menu items by per-unit margin times units sold over a date range
+func (h *ReportHandler) GetMenuContribution(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetMenuContribution(r.Context(), startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get menu contribution: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetOrderSizeDistribution counts orders per total price bucket; buckets defaults to 5,10,20
+func (h *ReportHandler) GetOrderSizeDistribution(w http.ResponseWriter, r *http.Request) {
+	bounds := []float64{5, 10, 20}
+	if value := r.URL.Query().Get("buckets"); value != "" {
+		bounds = nil
+		for _, part := range strings.Split(value, ",") {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				http.Error(w, models.ErrInvalidBuckets.Error(), http.StatusBadRequest)
+				return
+			}
+			bounds = append(bounds, bound)
+		}
+	}
+
+	response, err := h.reportService.GetOrderSizeDistribution(r.Context(), bounds)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidBuckets:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get order size distribution: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetSalesByPaymentMethod(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetSalesByPaymentMethod(r.Context(), startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get sales by payment method: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetRepeatRate reports how many of the period's orders came from returning customers
+func (h *ReportHandler) GetRepeatRate(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetRepeatRate(r.Context(), startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get repeat rate: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetDiscountSummary(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, err := parseDateRangeParams(r, "start_date", "end_date")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetDiscountSummary(r.Context(), startDate, endDate)
+	if err != nil {
+		switch err {
+		case models.ErrInvalidDateRange:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get discount summary: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *ReportHandler) GetCustomerSpending(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, models.ErrInvalidCustomerID.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reportService.GetCustomerSpending(r.Context(), id)
+	if err != nil {
+		switch err {
+		case models.ErrCustomerNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case models.ErrInvalidCustomerID:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to get customer spending: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
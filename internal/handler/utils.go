@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"frappuccino/internal/models"
@@ -19,8 +24,13 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 }
 
 func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
-	startDateStr := r.URL.Query().Get("startDate")
-	endDateStr := r.URL.Query().Get("endDate")
+	return parseDateRangeParams(r, "startDate", "endDate")
+}
+
+// parseDateRangeParams parses a required YYYY-MM-DD date range from the given query parameters
+func parseDateRangeParams(r *http.Request, startKey, endKey string) (time.Time, time.Time, error) {
+	startDateStr := r.URL.Query().Get(startKey)
+	endDateStr := r.URL.Query().Get(endKey)
 
 	if startDateStr == "" || endDateStr == "" {
 		return time.Time{}, time.Time{}, models.ErrInvalidDateRange
@@ -44,3 +54,72 @@ func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
 	endDate = endDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
 	return startDate, endDate, nil
 }
+
+// parseOptionalDate parses an optional YYYY-MM-DD query parameter; endOfDay moves it to the last second of that day
+func parseOptionalDate(r *http.Request, key string, endOfDay bool) (time.Time, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, models.ErrInvalidDateRange
+	}
+
+	if endOfDay {
+		date = date.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+	}
+	return date, nil
+}
+
+// Response formats of reports supporting content negotiation
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// negotiateFormat picks the response format of a report: the format query parameter when set,
+// otherwise text/csv when the Accept header prefers it over JSON. JSON is the default.
+func negotiateFormat(r *http.Request) (string, error) {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case formatJSON, formatCSV:
+		return format, nil
+	case "":
+	default:
+		return "", models.ErrInvalidReportFormat
+	}
+
+	csvQuality, jsonQuality := -1.0, -1.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		switch mediaType {
+		case "text/csv":
+			csvQuality = max(csvQuality, quality)
+		case "application/json", "*/*":
+			jsonQuality = max(jsonQuality, quality)
+		}
+	}
+	if csvQuality > 0 && csvQuality > jsonQuality {
+		return formatCSV, nil
+	}
+	return formatJSON, nil
+}
+
+// writeCSV writes a report as a CSV attachment named filename
+func writeCSV(w http.ResponseWriter, filename string, header []string, rows [][]string) error {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	writer.WriteAll(rows)
+	return writer.Error()
+}
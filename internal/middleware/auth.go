@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"frappuccino/internal/models"
+)
+
+// publicPaths are reachable without an API key so probes don't need one
+var publicPaths = map[string]bool{
+	"/health": true,
+	"/livez":  true,
+}
+
+// APIKeyAuth rejects requests without one of the valid keys in an Authorization: Bearer or X-API-Key
+// header with a 401. With no valid keys every request outside publicPaths is rejected.
+func APIKeyAuth(validKeys []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if publicPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !validAPIKey(requestAPIKey(r), validKeys) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": models.ErrInvalidAPIKey.Error()})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// validAPIKey compares against every key in constant time so timing doesn't reveal a key
+func validAPIKey(key string, validKeys []string) bool {
+	if key == "" {
+		return false
+	}
+	valid := false
+	for _, validKey := range validKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(validKey)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	handler := APIKeyAuth([]string{"dev-key", "ops-key"})(okHandler())
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"bearer key", "/orders", map[string]string{"Authorization": "Bearer dev-key"}, http.StatusOK},
+		{"X-API-Key header", "/orders", map[string]string{"X-API-Key": "ops-key"}, http.StatusOK},
+		{"no key", "/orders", nil, http.StatusUnauthorized},
+		{"unknown key", "/orders", map[string]string{"X-API-Key": "guess"}, http.StatusUnauthorized},
+		{"key prefix", "/orders", map[string]string{"X-API-Key": "dev"}, http.StatusUnauthorized},
+		{"not a bearer token", "/orders", map[string]string{"Authorization": "Basic dev-key"}, http.StatusUnauthorized},
+		{"health probe", "/health", nil, http.StatusOK},
+		{"liveness probe", "/livez", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		for key, value := range tt.headers {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: WWW-Authenticate = %q, want Bearer", tt.name, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAPIKeyAuthWithoutKeysRejectsEverything(t *testing.T) {
+	handler := APIKeyAuth(nil)(okHandler())
+
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("X-API-Key", "")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}
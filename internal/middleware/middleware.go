@@ -1,28 +1,107 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
-)
 
-func Logging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
-	})
-}
+	"frappuccino/internal/models"
+)
 
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("panic: %v", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte("Internal Server Error"))
+				log.Printf("panic: %v trace_id=%s request_id=%s", err, TraceIDFromContext(r.Context()), models.RequestIDFromContext(r.Context()))
+				traceError(w, r, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}()
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Deprecation marks responses of deprecated routes with Deprecation and Sunset headers
+func Deprecation(routes []models.DeprecatedRoute) func(http.Handler) http.Handler {
+	deprecated := make(map[string]models.DeprecatedRoute, len(routes))
+	for _, route := range routes {
+		deprecated[route.Method+" "+route.Path] = route
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route, ok := deprecated[r.Method+" "+r.URL.Path]; ok {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Sunset", route.Sunset.UTC().Format(http.TimeFormat))
+				if route.Replacement != "" {
+					w.Header().Set("Link", "<"+route.Replacement+">; rel=\"successor-version\"")
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConcurrencyLimit allows at most limit requests through next at once. A request beyond the
+// limit waits up to wait for a slot to free up; if none does, it is rejected with 503 and told to
+// retry after the same wait, rounded up to whole seconds.
+func ConcurrencyLimit(limit int, wait time.Duration) func(http.Handler) http.Handler {
+	if limit < 1 {
+		limit = 1
+	}
+	slots := make(chan struct{}, limit)
+	retryAfter := max(1, int(math.Ceil(wait.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				next.ServeHTTP(w, r)
+			case <-timer.C:
+				log.Printf("%s %s rejected: %d requests in flight for %s trace_id=%s", r.Method, r.URL.Path, limit, wait, TraceIDFromContext(r.Context()))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				traceError(w, r, "Too many concurrent requests, retry later", http.StatusServiceUnavailable)
+			case <-r.Context().Done():
+				// The client gave up while waiting
+			}
+		})
+	}
+}
+
+// Location scopes the request to the location in the X-Location-ID header, rejecting IDs that
+// aren't positive integers or unknown to exists with 400. Without the header the default location is used.
+func Location(exists func(ctx context.Context, id int) (bool, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("X-Location-ID")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			locationID, err := strconv.Atoi(header)
+			if err != nil || locationID <= 0 {
+				http.Error(w, models.ErrInvalidLocationID.Error(), http.StatusBadRequest)
+				return
+			}
+			ok, err := exists(r.Context(), locationID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to resolve location: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, models.ErrInvalidLocationID.Error(), http.StatusBadRequest)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(models.WithLocationID(r.Context(), locationID)))
+		})
+	}
+}
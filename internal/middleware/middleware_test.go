@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"frappuccino/internal/models"
+)
+
+func TestDeprecationMarksDeprecatedRoute(t *testing.T) {
+	sunset := time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+	handler := Deprecation([]models.DeprecatedRoute{
+		{Method: http.MethodGet, Path: "/orders/numberOfOrderedItems", Sunset: sunset, Replacement: "/reports/popular-items"},
+	})(okHandler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/numberOfOrderedItems", nil))
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation = %q, want true", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Wed, 30 Jun 2027 00:00:00 GMT" {
+		t.Errorf("Sunset = %q, want the sunset date", got)
+	}
+	if got := w.Header().Get("Link"); got != `</reports/popular-items>; rel="successor-version"` {
+		t.Errorf("Link = %q, want the replacement", got)
+	}
+
+	// Other routes and other methods of the deprecated path are left alone
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/orders", nil),
+		httptest.NewRequest(http.MethodPost, "/orders/numberOfOrderedItems", nil),
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if got := w.Header().Get("Deprecation"); got != "" {
+			t.Errorf("%s %s: Deprecation = %q, want none", r.Method, r.URL.Path, got)
+		}
+	}
+}
+
+func TestConcurrencyLimitRejectsExcessBatches(t *testing.T) {
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(2)
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started.Done()
+		<-release
+	})
+	handler := ConcurrencyLimit(2, 1500*time.Millisecond)(blocking)
+
+	codes := make(chan *httptest.ResponseRecorder, 5)
+	serve := func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders/batch-process", nil))
+		codes <- w
+	}
+
+	// Two batches fill the limit and hold it past the wait of the three more fired after them
+	for i := 0; i < 2; i++ {
+		go serve()
+	}
+	started.Wait()
+	for i := 0; i < 3; i++ {
+		go serve()
+	}
+
+	for i := 0; i < 3; i++ {
+		w := <-codes
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("excess batch = %d, want 503", w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != "2" {
+			t.Errorf("Retry-After = %q, want the 1.5s wait rounded up to 2", got)
+		}
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if w := <-codes; w.Code != http.StatusOK {
+			t.Errorf("batch within the limit = %d, want 200", w.Code)
+		}
+	}
+}
+
+func TestConcurrencyLimitWaitsForFreedSlot(t *testing.T) {
+	release := make(chan struct{})
+	first := true
+	var mu sync.Mutex
+	handler := ConcurrencyLimit(1, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		wasFirst := first
+		first = false
+		mu.Unlock()
+		if wasFirst {
+			<-release
+		}
+	}))
+
+	done := make(chan int, 2)
+	serve := func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders/batch-process", nil))
+		done <- w.Code
+	}
+	go serve()
+	for {
+		mu.Lock()
+		running := !first
+		mu.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	go serve()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("batch = %d, want 200 once the slot is freed", code)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"container/list"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitStore decides whether a client identified by key may make another request now. When it
+// may not, it returns how long the client should wait.
+type RateLimitStore interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+// RateLimit rejects clients exceeding their rate with 429 and a Retry-After header. Clients are keyed
+// by their API key, or by remote IP without one. publicPaths are not limited.
+func RateLimit(store RateLimitStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if publicPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, retryAfter := store.Allow(rateLimitKey(r))
+			if !allowed {
+				log.Printf("%s %s rate limited trace_id=%s", r.Method, r.URL.Path, TraceIDFromContext(r.Context()))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				traceError(w, r, "Too many requests, retry later", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitKey(r *http.Request) string {
+	if key := requestAPIKey(r); key != "" {
+		return "key:" + key
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// MemoryRateLimitStore keeps a token bucket per client in memory. It tracks at most maxClients
+// clients; the least recently seen one is forgotten to make room for a new one.
+type MemoryRateLimitStore struct {
+	mu         sync.Mutex
+	rate       float64 // tokens added per second
+	burst      float64
+	maxClients int
+	buckets    map[string]*list.Element
+	recent     *list.List // most recently seen client first
+}
+
+type tokenBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+// NewMemoryRateLimitStore allows each client rps requests per second on average and bursts of up to burst requests
+func NewMemoryRateLimitStore(rps float64, burst int, maxClients int) *MemoryRateLimitStore {
+	if burst < 1 {
+		burst = 1
+	}
+	if maxClients < 1 {
+		maxClients = 1
+	}
+	return &MemoryRateLimitStore{
+		rate:       rps,
+		burst:      float64(burst),
+		maxClients: maxClients,
+		buckets:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+func (s *MemoryRateLimitStore) Allow(key string) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	bucket := s.bucket(key, now)
+
+	bucket.tokens = math.Min(s.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*s.rate)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / s.rate * float64(time.Second))
+	return false, wait
+}
+
+// bucket returns the bucket of key, starting a full one for a new client
+func (s *MemoryRateLimitStore) bucket(key string, now time.Time) *tokenBucket {
+	if element, ok := s.buckets[key]; ok {
+		s.recent.MoveToFront(element)
+		return element.Value.(*tokenBucket)
+	}
+
+	if s.recent.Len() >= s.maxClients {
+		oldest := s.recent.Back()
+		s.recent.Remove(oldest)
+		delete(s.buckets, oldest.Value.(*tokenBucket).key)
+	}
+
+	bucket := &tokenBucket{key: key, tokens: s.burst, updated: now}
+	s.buckets[key] = s.recent.PushFront(bucket)
+	return bucket
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestRateLimitRejectsClientOverLimit(t *testing.T) {
+	// One request every 10 seconds with bursts of 3, so no token comes back during the test
+	handler := RateLimit(NewMemoryRateLimitStore(0.1, 3, 100))(okHandler())
+
+	request := func(apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/orders/batch-process", nil)
+		r.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 1; i <= 3; i++ {
+		if w := request("busy"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst = %d, want 200", i, w.Code)
+		}
+	}
+
+	w := request("busy")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit = %d, want 429", w.Code)
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 10 {
+		t.Errorf("Retry-After = %q, want 1 to 10 seconds", w.Header().Get("Retry-After"))
+	}
+
+	// Other clients have their own bucket
+	if w := request("quiet"); w.Code != http.StatusOK {
+		t.Errorf("other client = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitKeysByRemoteIPWithoutAPIKey(t *testing.T) {
+	handler := RateLimit(NewMemoryRateLimitStore(0.1, 1, 100))(okHandler())
+
+	request := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := request("10.0.0.1:5000"); code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", code)
+	}
+	// Another connection from the same IP shares its bucket
+	if code := request("10.0.0.1:5001"); code != http.StatusTooManyRequests {
+		t.Errorf("second request from the same IP = %d, want 429", code)
+	}
+	if code := request("10.0.0.2:5000"); code != http.StatusOK {
+		t.Errorf("request from another IP = %d, want 200", code)
+	}
+}
+
+func TestRateLimitSkipsPublicPaths(t *testing.T) {
+	handler := RateLimit(NewMemoryRateLimitStore(0.1, 1, 100))(okHandler())
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("health check %d = %d, want 200", i+1, w.Code)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreForgetsLeastRecentClient(t *testing.T) {
+	store := NewMemoryRateLimitStore(0.1, 1, 2)
+
+	store.Allow("a")
+	store.Allow("b")
+	store.Allow("a") // b is now the least recently seen
+	store.Allow("c") // makes room by forgetting b
+
+	if len(store.buckets) != 2 {
+		t.Fatalf("store tracks %d clients, want 2", len(store.buckets))
+	}
+	if _, ok := store.buckets["b"]; ok {
+		t.Error("least recently seen client b is still tracked")
+	}
+	// A forgotten client starts again with a full bucket
+	if allowed, _ := store.Allow("b"); !allowed {
+		t.Error("forgotten client b was limited")
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"frappuccino/internal/models"
+)
+
+// Incoming IDs end up in log lines, so only short IDs of safe characters are kept
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID reads the incoming X-Request-ID header (or generates a UUID), stores it in the
+// request context and echoes it on the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newUUID()
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(models.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// TraceContext is the W3C trace context of a request
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+	Flags   string
+}
+
+// String formats the trace context as a traceparent header value
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("00-%s-%s-%s", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+type traceContextKey struct{}
+
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// Tracing reads the incoming traceparent header (or starts a new trace), stores
+// the trace context in the request context and echoes it on the response
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, ok := parseTraceparent(r.Header.Get("traceparent"))
+		if !ok {
+			tc = TraceContext{TraceID: randomHex(16), Flags: "01"}
+		}
+		// This server handles the request in its own span
+		tc.SpanID = randomHex(8)
+
+		w.Header().Set("traceparent", tc.String())
+		w.Header().Set("X-Trace-Id", tc.TraceID)
+
+		ctx := context.WithValue(r.Context(), traceContextKey{}, tc)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// TraceIDFromContext returns the trace ID of the request, or an empty string
+func TraceIDFromContext(ctx context.Context) string {
+	tc, _ := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc.TraceID
+}
+
+// traceError replies like http.Error, appending the trace ID of the request to msg so a client
+// can quote it when reporting the error
+func traceError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if traceID := TraceIDFromContext(r.Context()); traceID != "" {
+		msg += " (trace_id=" + traceID + ")"
+	}
+	http.Error(w, msg, code)
+}
+
+func parseTraceparent(header string) (TraceContext, bool) {
+	matches := traceparentPattern.FindStringSubmatch(header)
+	if matches == nil {
+		return TraceContext{}, false
+	}
+	// All-zero IDs are invalid per the W3C spec
+	if matches[1] == "00000000000000000000000000000000" || matches[2] == "0000000000000000" {
+		return TraceContext{}, false
+	}
+	return TraceContext{TraceID: matches[1], SpanID: matches[2], Flags: matches[3]}, true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
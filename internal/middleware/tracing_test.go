@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func TestTracingPreservesTraceIDToLogs(t *testing.T) {
+	var accessLog, panicLog bytes.Buffer
+	log.SetOutput(&panicLog)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	panics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	logger := slog.New(slog.NewJSONHandler(&accessLog, nil))
+	handler := Tracing(AccessLog(logger)(Recovery(panics)))
+
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("traceparent", testTraceparent)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "trace_id="+testTraceID) {
+		t.Errorf("error body = %q, want the trace ID", w.Body.String())
+	}
+	if got := w.Header().Get("X-Trace-Id"); got != testTraceID {
+		t.Errorf("X-Trace-Id = %q, want %q", got, testTraceID)
+	}
+	// The server answers in its own span of the same trace
+	if got := w.Header().Get("traceparent"); !strings.HasPrefix(got, "00-"+testTraceID+"-") || got == testTraceparent {
+		t.Errorf("traceparent = %q, want a new span of trace %s", got, testTraceID)
+	}
+
+	if !strings.Contains(panicLog.String(), "panic: boom trace_id="+testTraceID) {
+		t.Errorf("panic log = %q, want the trace ID", panicLog.String())
+	}
+	if !strings.Contains(accessLog.String(), `"trace_id":"`+testTraceID+`"`) {
+		t.Errorf("access log = %q, want the trace ID", accessLog.String())
+	}
+}
+
+func TestTracingStartsTraceWithoutValidHeader(t *testing.T) {
+	for _, header := range []string{"", "garbage", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+		var traceID string
+		handler := Tracing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceID = TraceIDFromContext(r.Context())
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if header != "" {
+			r.Header.Set("traceparent", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if len(traceID) != 32 || strings.Contains(header, traceID) {
+			t.Errorf("traceparent %q: trace ID = %q, want a new 32 digit ID", header, traceID)
+		}
+		if got := w.Header().Get("X-Trace-Id"); got != traceID {
+			t.Errorf("traceparent %q: X-Trace-Id = %q, want %q", header, got, traceID)
+		}
+	}
+}
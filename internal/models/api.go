@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// APIVersion describes a version of the API that clients can target
+type APIVersion struct {
+	Version  string `json:"version"`
+	Status   string `json:"status"` // "current", "deprecated"
+	BasePath string `json:"base_path"`
+}
+
+// DeprecatedRoute is a route scheduled for removal
+type DeprecatedRoute struct {
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Sunset      time.Time `json:"sunset"`
+	Replacement string    `json:"replacement,omitempty"`
+}
+
+// APIVersionsResponse - For GET /api/versions
+type APIVersionsResponse struct {
+	CurrentVersion    string            `json:"current_version"`
+	SupportedVersions []APIVersion      `json:"supported_versions"`
+	DeprecatedRoutes  []DeprecatedRoute `json:"deprecated_routes"`
+}
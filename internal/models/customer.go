@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// CustomerFrequencyResponse - For GET /customers/{id}/frequency
+type CustomerFrequencyResponse struct {
+	CustomerID          int        `json:"customer_id"`
+	OrderCount          int        `json:"order_count"`
+	FirstOrderAt        *time.Time `json:"first_order_at,omitempty"`
+	LastOrderAt         *time.Time `json:"last_order_at,omitempty"`
+	AvgDaysBetween      float64    `json:"avg_days_between_orders"` // 0 with fewer than two orders
+	DaysSinceLastOrder  float64    `json:"days_since_last_order"`
+	AtRiskThresholdDays int        `json:"at_risk_threshold_days"`
+	AtRisk              bool       `json:"at_risk"`
+}
+
+// CustomerRecommendationsResponse - For GET /customers/{id}/recommendations
+type CustomerRecommendationsResponse struct {
+	CustomerID int               `json:"customer_id"`
+	Source     string            `json:"source"` // "similar_customers", or "popular" when there is no usable history
+	Items      []RecommendedItem `json:"items"`
+}
+
+// RecommendedItem is an active menu item the customer hasn't ordered yet
+type RecommendedItem struct {
+	MenuItemID int     `json:"menu_item_id"`
+	Name       string  `json:"name"`
+	Price      Money   `json:"price"`
+	Score      float64 `json:"score"` // Weighted count of similar customers, or of all customers, who ordered it
+}
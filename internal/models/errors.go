@@ -3,24 +3,78 @@ package models
 import "errors"
 
 var (
-	ErrInvalidOrderID       = errors.New("invalid order ID")
-	ErrEmptyOrder           = errors.New("order must contain at least one item")
-	ErrInvalidTotalPrice    = errors.New("total price must be positive")
-	ErrInvalidDateRange     = errors.New("invalid date range")
-	ErrEmptyBatch           = errors.New("batch must contain at least one order")
-	ErrInvalidMonth         = errors.New("invalid month")
-	ErrInvalidYear          = errors.New("invalid year")
-	ErrEmptySearchQuery     = errors.New("search query cannot be empty")
-	ErrInvalidPriceRange    = errors.New("invalid price range")
-	ErrInvalidNumberRange   = errors.New("invalid number range")
-	ErrInvalidPeriod        = errors.New("invalid period, must be 'day' or 'month'")
-	ErrInvalidPage          = errors.New("invalid page")
-	ErrInvalidPageSize      = errors.New("invalid page size")
-	ErrInvalidSortByValue   = errors.New("sort by can be either price or quantity")
-	ErrInvalidMenuItemID    = errors.New("invalid menu item id")
-	ErrInvalidMenuItemName  = errors.New("invalid menu item name")
-	ErrInvalidMenuItemPrice = errors.New("invalid menu item price")
-	ErrInvalidQuantity      = errors.New("quantity can not be assigned to negative value")
-	ErrInvalidCostPerUnit   = errors.New("cost per unit can not be assigned to negative value")
-	ErrInvalidReOrderLevel  = errors.New("reorder level can not be assigned to negative value")
+	ErrInvalidOrderID        = errors.New("invalid order ID")
+	ErrEmptyOrder            = errors.New("order must contain at least one item")
+	ErrInvalidTotalPrice     = errors.New("order total must be positive")
+	ErrInvalidDateRange      = errors.New("invalid date range")
+	ErrEmptyBatch            = errors.New("batch must contain at least one order")
+	ErrInvalidOrderIDs       = errors.New("order_ids must contain between 1 and 100 positive order IDs")
+	ErrInvalidMonth          = errors.New("invalid month")
+	ErrInvalidYear           = errors.New("invalid year")
+	ErrEmptySearchQuery      = errors.New("search query cannot be empty")
+	ErrInvalidPriceRange     = errors.New("invalid price range")
+	ErrInvalidNumberRange    = errors.New("invalid number range")
+	ErrInvalidPeriod         = errors.New("invalid period, must be 'day', 'week', 'month' or 'year'")
+	ErrInvalidGranularity    = errors.New("invalid granularity, must be 'day', 'week' or 'month'")
+	ErrInvalidPage           = errors.New("invalid page")
+	ErrInvalidPageSize       = errors.New("invalid page size")
+	ErrInvalidLimit          = errors.New("limit must be between 1 and 100")
+	ErrInvalidCursor         = errors.New("invalid cursor")
+	ErrInvalidSortByValue    = errors.New("sort by can be either price, quantity or value")
+	ErrInvalidMenuItemID     = errors.New("invalid menu item id")
+	ErrInvalidMenuItemName   = errors.New("invalid menu item name")
+	ErrInvalidMenuItemPrice  = errors.New("invalid menu item price")
+	ErrInvalidPrepTime       = errors.New("prep time can not be assigned to negative value")
+	ErrInsufficientInventory = errors.New("insufficient inventory")
+	ErrMenuItemUnavailable   = errors.New("menu item is not currently available")
+	ErrInvalidSeason         = errors.New("season dates must be YYYY-MM-DD and season_start must not be after season_end")
+	ErrInvalidQuantity       = errors.New("quantity can not be assigned to negative value")
+	ErrInvalidRestockQty     = errors.New("restock quantity must be positive")
+	ErrInvalidCostPerUnit    = errors.New("cost per unit can not be assigned to negative value")
+	ErrInvalidReOrderLevel   = errors.New("reorder level can not be assigned to negative value")
+	ErrInvalidForecastDays   = errors.New("forecast days must be a positive integer")
+	ErrInvalidWindow         = errors.New("window must be a positive duration, e.g. 15m")
+	ErrInvalidTransition     = errors.New("invalid status transition")
+	ErrInvalidOrderStatus    = errors.New("invalid order status")
+	ErrInvalidOlderThan      = errors.New("older_than must be a positive duration, e.g. 10m")
+	ErrInvalidDate           = errors.New("invalid date, expected YYYY-MM-DD")
+	ErrInvalidExportFormat   = errors.New("format must be csv")
+	ErrEmptyStaffing         = errors.New("staffing must contain at least one day")
+	ErrInvalidOrdersPerStaff = errors.New("orders_per_staff must be a positive integer")
+	ErrInvalidLaborHours     = errors.New("labor hours must be positive")
+	ErrIngredientNotFound    = errors.New("ingredient not found")
+	ErrInvalidCustomerID     = errors.New("invalid customer ID")
+	ErrCustomerNotFound      = errors.New("customer not found")
+	ErrInvalidDays           = errors.New("days must be a positive integer")
+	ErrInvalidFixedCost      = errors.New("fixed cost must be a non-negative number")
+	ErrUnknownUnitCost       = errors.New("production cost is unknown: menu item has no ingredients or an ingredient has no cost")
+	ErrNoContribution        = errors.New("price does not exceed production cost, the item can never break even")
+	ErrInvalidThreshold      = errors.New("threshold must be a percentage between 0 and 100")
+	ErrJSONTooLarge          = errors.New("special instructions or customizations exceed the maximum size")
+	ErrJSONTooDeep           = errors.New("special instructions or customizations exceed the maximum nesting depth")
+	ErrClientTimestamps      = errors.New("created_at and updated_at are set by the server and must not be provided")
+	ErrInvalidIdempotencyKey = errors.New("Idempotency-Key must be at most 255 characters")
+	ErrInvalidLocationID     = errors.New("X-Location-ID must be the ID of an existing location")
+	ErrInvalidBuckets        = errors.New("buckets must be increasing positive order totals separated by commas, e.g. 5,10,20")
+	ErrEmptyUpdate           = errors.New("update must set at least one field")
+	ErrInvalidModifierGroup  = errors.New("modifier group needs a name and uniquely named modifiers")
+	ErrModifierGroupNotFound = errors.New("modifier group not found")
+	ErrInvalidModifier       = errors.New("invalid modifier selection")
+	ErrInvalidAPIKey         = errors.New("missing or invalid API key")
+	ErrInvalidStdDevs        = errors.New("std_devs must be a positive number")
+	ErrInvalidBaselineDays   = errors.New("baseline_days must be an integer between 2 and 365")
+	ErrInventoryTransaction  = errors.New("failed to record inventory transactions, no inventory was changed")
+	ErrInvalidExpiryDate     = errors.New("expires_on must be a date in YYYY-MM-DD format")
+	ErrOrderNotFound         = errors.New("order not found")
+	ErrMenuItemNotFound      = errors.New("menu item not found")
+	ErrInvalidOrderItem      = errors.New("order items need a menu_item_id and a quantity greater than 0")
+	ErrInvalidBulkAssign     = errors.New("bulk assign needs an ingredient_id, a quantity greater than 0 and menu_item_ids")
+	ErrInvalidActiveFilter   = errors.New("active must be true or false")
+	ErrCustomerInactive      = errors.New("customer is inactive")
+	ErrInvalidSalesTarget    = errors.New("every day in the range needs a positive target, and target dates must lie in the range")
+	ErrInvalidImportHeader   = errors.New("CSV header must contain the columns name, quantity, unit, cost_per_unit and reorder_level")
+	ErrInvalidReportFormat   = errors.New("format must be json or csv")
+	ErrInvalidReorderStatus  = errors.New("status must be open, fulfilled or all")
+	ErrInvalidDiscount       = errors.New("discount_amount must be between 0 and the order total")
+	ErrInvalidJSON           = errors.New("special instructions or customizations must be valid JSON")
 )
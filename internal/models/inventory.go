@@ -13,10 +13,71 @@ type Inventory struct {
 	CostPerUnit  float64         `json:"cost_per_unit,omitempty"`
 	ReOrderLevel float64         `json:"reorder_level,omitempty"`
 	SupplierInfo json.RawMessage `json:"supplier_info,omitempty"`
+	Unlimited    bool            `json:"unlimited"` // Stock is not tracked or deducted for unlimited ingredients
 	CreatedAt    time.Time       `json:"created_at"`
 	UpdatedAt    time.Time       `json:"updated_at"`
 }
 
+// InventoryUnits lists the values of the unit_type enum
+var InventoryUnits = map[string]bool{
+	"g":     true,
+	"ml":    true,
+	"shots": true,
+	"items": true,
+}
+
+// InventoryImportRow is a parsed row of a POST /inventory/import CSV
+type InventoryImportRow struct {
+	Line         int // Line of the row in the CSV, the header being line 1
+	Name         string
+	Quantity     float64
+	Unit         string
+	CostPerUnit  float64
+	ReOrderLevel float64
+	ParseError   string // Why the row could not be parsed, failing it
+}
+
+// InventoryImportResponse summarizes a POST /inventory/import; failed rows are skipped
+type InventoryImportResponse struct {
+	Created  int                      `json:"created"`
+	Updated  int                      `json:"updated"`
+	Failed   int                      `json:"failed"`
+	Failures []InventoryImportFailure `json:"failures"`
+}
+
+type InventoryImportFailure struct {
+	Line   int    `json:"line"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ReorderRequest - For GET /inventory/reorder-requests, raised when an order takes an ingredient
+// below its reorder level and fulfilled by a restock back to it
+type ReorderRequest struct {
+	ID           int        `json:"id"`
+	IngredientID int        `json:"ingredient_id"`
+	Name         string     `json:"name"`
+	Unit         string     `json:"unit"`
+	Quantity     float64    `json:"quantity"` // Stock when the request was raised
+	ReorderLevel float64    `json:"reorder_level"`
+	OnHand       float64    `json:"on_hand"`
+	OrderID      int        `json:"order_id,omitempty"`
+	Status       string     `json:"status"` // open or fulfilled
+	CreatedAt    time.Time  `json:"created_at"`
+	FulfilledAt  *time.Time `json:"fulfilled_at,omitempty"`
+}
+
+// InventoryUpdateRequest - For PATCH /inventory/{id}, only the fields that are set are changed
+type InventoryUpdateRequest struct {
+	Name         *string          `json:"name,omitempty"`
+	Quantity     *float64         `json:"quantity,omitempty"`
+	Unit         *string          `json:"unit,omitempty"`
+	CostPerUnit  *float64         `json:"cost_per_unit,omitempty"`
+	ReOrderLevel *float64         `json:"reorder_level,omitempty"`
+	SupplierInfo *json.RawMessage `json:"supplier_info,omitempty"`
+	Unlimited    *bool            `json:"unlimited,omitempty"`
+}
+
 type InventoryTransactions struct {
 	ID              int       `json:"id"`
 	IngredientID    int       `json:"ingredient_id"`
@@ -34,6 +95,7 @@ type InventoryItem struct {
 	Quantity    float64 `json:"quantity"`
 	Unit        string  `json:"unit"`
 	CostPerUnit float64 `json:"cost_per_unit,omitempty"`
+	TotalValue  float64 `json:"total_value"` // quantity * cost_per_unit
 }
 
 // PaginatedInventoryResponse contains the paginated results and metadata
@@ -52,3 +114,129 @@ type InventoryUsage struct {
 	QuantityUsed   float64 `json:"quantity_used"`
 	RemainingStock float64 `json:"remaining_stock"`
 }
+
+// ShoppingListItem is a single ingredient that has to be purchased to cover the forecast
+type ShoppingListItem struct {
+	IngredientID   int     `json:"ingredient_id"`
+	Name           string  `json:"name"`
+	Unit           string  `json:"unit"`
+	CurrentStock   float64 `json:"current_stock"`
+	ProjectedUsage float64 `json:"projected_usage"`
+	QuantityToBuy  float64 `json:"quantity_to_buy"`
+	Supplier       string  `json:"-"`
+}
+
+// SupplierShoppingList groups shopping list items by supplier
+type SupplierShoppingList struct {
+	Supplier string             `json:"supplier"`
+	Items    []ShoppingListItem `json:"items"`
+}
+
+// ShoppingListResponse - For GET /inventory/shopping-list
+type ShoppingListResponse struct {
+	ForecastDays int                    `json:"forecast_days"`
+	LookbackDays int                    `json:"lookback_days"`
+	Suppliers    []SupplierShoppingList `json:"suppliers"`
+}
+
+// MenuItemRevenue is the recent revenue of a single menu item
+type MenuItemRevenue struct {
+	MenuItemID int    `json:"menu_item_id"`
+	Name       string `json:"name"`
+	Quantity   int    `json:"quantity_sold"`
+	Revenue    Money  `json:"revenue"`
+}
+
+// RevenueAtRiskResponse - For GET /inventory/{id}/revenue-at-risk
+type RevenueAtRiskResponse struct {
+	IngredientID  int               `json:"ingredient_id"`
+	Name          string            `json:"name"`
+	Quantity      float64           `json:"quantity"`
+	ReOrderLevel  float64           `json:"reorder_level"`
+	LowStock      bool              `json:"low_stock"`
+	PeriodDays    int               `json:"period_days"`
+	MenuItems     []MenuItemRevenue `json:"menu_items"`
+	RevenueAtRisk Money             `json:"revenue_at_risk"`
+}
+
+// InventoryTransaction is a row of the inventory ledger
+type InventoryTransaction struct {
+	ID              int       `json:"id"`
+	IngredientID    int       `json:"ingredient_id"`
+	IngredientName  string    `json:"ingredient_name"`
+	TransactionType string    `json:"transaction_type"`
+	Delta           float64   `json:"delta"`
+	ReferenceID     int       `json:"reference_id,omitempty"`
+	Notes           string    `json:"notes,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// InventoryAlert is an ingredient at or below its reorder level
+type InventoryAlert struct {
+	IngredientID  int     `json:"ingredient_id"`
+	Name          string  `json:"name"`
+	Unit          string  `json:"unit"`
+	CurrentStock  float64 `json:"current_stock"`
+	ReorderLevel  float64 `json:"reorder_level"`
+	DaysRemaining float64 `json:"days_remaining,omitempty"` // At recent average daily usage, 0 without usage history
+}
+
+// ReorderPriority is a below-reorder ingredient ranked for purchasing - For GET /inventory/reorder-priority
+type ReorderPriority struct {
+	IngredientID  int     `json:"ingredient_id"`
+	Name          string  `json:"name"`
+	Unit          string  `json:"unit"`
+	CurrentStock  float64 `json:"current_stock"`
+	ReorderLevel  float64 `json:"reorder_level"`
+	DaysRemaining float64 `json:"days_remaining,omitempty"` // At recent average daily usage, 0 without usage history
+	LeadTimeDays  float64 `json:"lead_time_days"`           // supplier_info.lead_time_days, else the default
+	RevenueAtRisk Money   `json:"revenue_at_risk"`          // Recent revenue of menu items using the ingredient
+	Score         float64 `json:"score"`                    // 0 to 100, highest first
+}
+
+// StockCoverage is how long an ingredient's stock lasts at recent usage - For GET /inventory/coverage
+type StockCoverage struct {
+	IngredientID int      `json:"ingredient_id"`
+	Name         string   `json:"name"`
+	Unit         string   `json:"unit"`
+	CurrentStock float64  `json:"current_stock"`
+	DailyUsage   float64  `json:"daily_usage"`   // Average of recent order usage
+	CoverageDays *float64 `json:"coverage_days"` // null when the ingredient isn't used, i.e. infinite coverage
+}
+
+// RestockRequest - For POST /inventory/{id}/restock
+type RestockRequest struct {
+	Quantity  float64 `json:"quantity"`
+	Notes     string  `json:"notes,omitempty"`
+	ExpiresOn string  `json:"expires_on,omitempty"` // YYYY-MM-DD, records the restock as a lot for GET /inventory/expiry-risk
+}
+
+type RestockResponse struct {
+	IngredientID  int     `json:"ingredient_id"`
+	QuantityAdded float64 `json:"quantity_added"`
+	OnHand        float64 `json:"on_hand"`
+}
+
+// ExpiryRiskResponse - For GET /inventory/expiry-risk
+type ExpiryRiskResponse struct {
+	UsageDays      int           `json:"usage_days"` // Window of recent usage the projection is based on
+	Lots           []ExpiringLot `json:"lots"`       // Soonest expiry first
+	TotalWasteCost Money         `json:"total_waste_cost"`
+}
+
+// ExpiringLot is a lot of an ingredient that is projected to expire before it is used up
+type ExpiringLot struct {
+	LotID           int     `json:"lot_id"`
+	IngredientID    int     `json:"ingredient_id"`
+	Name            string  `json:"name"`
+	Unit            string  `json:"unit"`
+	Quantity        float64 `json:"quantity"` // Part of the lot still in stock
+	ExpiresOn       string  `json:"expires_on"`
+	DaysUntilExpiry int     `json:"days_until_expiry"` // Negative once expired
+	DailyUsage      float64 `json:"daily_usage"`
+	ProjectedWaste  float64 `json:"projected_waste"`
+	WasteCost       *Money  `json:"waste_cost"` // null when the ingredient has no cost
+
+	OnHand      float64  `json:"-"`
+	CostPerUnit *float64 `json:"-"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "context"
+
+// DefaultLocationID is the location of requests without an X-Location-ID header
+const DefaultLocationID = 1
+
+type locationIDKey struct{}
+
+// WithLocationID returns a context scoped to a location
+func WithLocationID(ctx context.Context, locationID int) context.Context {
+	return context.WithValue(ctx, locationIDKey{}, locationID)
+}
+
+// LocationIDFromContext returns the location a request is scoped to, or DefaultLocationID
+func LocationIDFromContext(ctx context.Context) int {
+	if locationID, ok := ctx.Value(locationIDKey{}).(int); ok {
+		return locationID
+	}
+	return DefaultLocationID
+}
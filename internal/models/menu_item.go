@@ -5,22 +5,43 @@ import (
 )
 
 type MenuItems struct {
-	ID          int                   `json:"id"`
-	Name        string                `json:"name"`
-	Description string                `json:"description,omitempty"`
-	Price       float64               `json:"price"`
-	Category    []string              `json:"category,omitempty"`
-	IsActive    bool                  `json:"is_active"`
-	Ingredients []MenuItemIngredients `json:"ingredients"`
-	CreatedAt   time.Time             `json:"created_at"`
-	UpdatedAt   time.Time             `json:"updated_at"`
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Price       Money    `json:"price"`
+	Category    []string `json:"category,omitempty"`
+	IsActive    bool     `json:"is_active"`
+	PrepTime    float64  `json:"prep_time_minutes,omitempty"`
+	SeasonStart string   `json:"season_start,omitempty"` // YYYY-MM-DD
+	SeasonEnd   string   `json:"season_end,omitempty"`   // YYYY-MM-DD
+	// Stock tracked items (pre-packaged goods) decrement their own StockQuantity when ordered instead of their ingredients
+	StockTracked  bool                  `json:"stock_tracked"`
+	StockQuantity int                   `json:"stock_quantity,omitempty"`
+	Available     bool                  `json:"available"` // Computed: one unit can be made from current stock
+	Ingredients   []MenuItemIngredients `json:"ingredients"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+}
+
+// MenuFilters narrows GET /menu; zero values don't filter
+type MenuFilters struct {
+	Category string   // Items whose categories contain this one
+	Active   *bool    // Items with this is_active
+	MinPrice *float64 // Items priced at least this
+	MaxPrice *float64 // Items priced at most this
+	Query    string   // Items whose name or description contains this text
+}
+
+// IsEmpty reports whether no filter is set
+func (f MenuFilters) IsEmpty() bool {
+	return f.Category == "" && f.Active == nil && f.MinPrice == nil && f.MaxPrice == nil && f.Query == ""
 }
 
 type PriceHistory struct {
 	ID         int       `json:"id"`
 	MenuItemID int       `json:"menu_item_id"`
-	OldPrice   float64   `json:"old_price"`
-	NewPrice   float64   `json:"new_price"`
+	OldPrice   Money     `json:"old_price"`
+	NewPrice   Money     `json:"new_price"`
 	ChangedAt  time.Time `json:"updated_at"`
 }
 
@@ -28,3 +49,146 @@ type MenuItemIngredients struct {
 	IngredientID int     `json:"ingredient_id"`
 	Quantity     float64 `json:"quantity"`
 }
+
+// ModifierGroup is a structured customization of a menu item, e.g. Size with the modifiers S, M and L.
+// Order items select one modifier of a group by setting the group name to the modifier name in their
+// customizations, e.g. {"size": "L"}; names match case-insensitively.
+type ModifierGroup struct {
+	ID         int        `json:"id"`
+	MenuItemID int        `json:"menu_item_id"`
+	Name       string     `json:"name"`
+	Required   bool       `json:"required"` // Orders must select a modifier of required groups
+	Modifiers  []Modifier `json:"modifiers"`
+}
+
+type Modifier struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	PriceDelta Money  `json:"price_delta"` // Added to the unit price when selected
+}
+
+// UnavailableMenuItem is an active menu item that can not be made from current stock
+type UnavailableMenuItem struct {
+	MenuItemID          int                   `json:"menu_item_id"`
+	Name                string                `json:"name"`
+	MissingFraction     float64               `json:"missing_fraction"` // Largest share of a required ingredient that is missing
+	LimitingIngredients []IngredientShortfall `json:"limiting_ingredients"`
+}
+
+// SeasonalChange records a menu item activated or deactivated by its season window
+type SeasonalChange struct {
+	MenuItemID int    `json:"menu_item_id"`
+	Name       string `json:"name"`
+	IsActive   bool   `json:"is_active"`
+}
+
+// MenuTreeResponse - For GET /menu/tree, the active menu grouped by category
+type MenuTreeResponse struct {
+	Categories []MenuCategoryNode `json:"categories"`
+}
+
+// MenuCategoryNode holds the active items of one category; an item in several categories
+// appears under each of them
+type MenuCategoryNode struct {
+	Category  string      `json:"category"` // "uncategorized" for items without a category
+	ItemCount int         `json:"item_count"`
+	Items     []MenuItems `json:"items"`
+}
+
+// MenuItemIngredientTree is a menu item composed with the stock status of each of its ingredients
+type MenuItemIngredientTree struct {
+	MenuItemID  int                  `json:"menu_item_id"`
+	Name        string               `json:"name"`
+	Price       Money                `json:"price"`
+	IsActive    bool                 `json:"is_active"`
+	Ingredients []IngredientTreeNode `json:"ingredients"`
+}
+
+type IngredientTreeNode struct {
+	IngredientID int     `json:"ingredient_id"`
+	Name         string  `json:"name"`
+	Quantity     float64 `json:"quantity"` // Required per menu item
+	Unit         string  `json:"unit"`
+	Stock        float64 `json:"stock"`
+	ReorderLevel float64 `json:"reorder_level"`
+	Unlimited    bool    `json:"unlimited"`
+	BelowReorder bool    `json:"below_reorder_level"`
+}
+
+// PriceWhatIfRequest - For POST /menu/{id}/price-whatif
+type PriceWhatIfRequest struct {
+	NewPrice Money `json:"new_price"`
+	Days     int   `json:"days,omitempty"` // Length of the past period, defaults to 30
+}
+
+// PriceWhatIfResponse compares an item's actual revenue over the past period with the
+// revenue the same quantity would have brought at the new price
+type PriceWhatIfResponse struct {
+	MenuItemID       int     `json:"menu_item_id"`
+	Name             string  `json:"name"`
+	CurrentPrice     Money   `json:"current_price"`
+	NewPrice         Money   `json:"new_price"`
+	Days             int     `json:"days"`
+	QuantitySold     int     `json:"quantity_sold"`
+	ActualRevenue    Money   `json:"actual_revenue"`
+	ProjectedRevenue Money   `json:"projected_revenue"`
+	Difference       Money   `json:"difference"`
+	DifferencePct    float64 `json:"difference_pct"`
+}
+
+// RemovalImpactResponse - For GET /menu/{id}/removal-impact, what retiring a menu item would affect
+type RemovalImpactResponse struct {
+	MenuItemID       int    `json:"menu_item_id"`
+	Name             string `json:"name"`
+	Days             int    `json:"days"` // Window of the recent sales
+	RecentOrderCount int    `json:"recent_order_count"`
+	RecentQuantity   int    `json:"recent_quantity"`
+	RecentRevenue    Money  `json:"recent_revenue"`
+	// Orders not yet delivered or cancelled that contain the item; removal is blocked while there are any
+	OpenOrderIDs      []int              `json:"open_order_ids"`
+	Blocked           bool               `json:"blocked"`
+	UnusedIngredients []UnusedIngredient `json:"unused_ingredients"` // Used by no other active menu item
+}
+
+type UnusedIngredient struct {
+	IngredientID int    `json:"ingredient_id"`
+	Name         string `json:"name"`
+}
+
+// BreakEvenResponse - For GET /menu/{id}/break-even
+type BreakEvenResponse struct {
+	MenuItemID         int     `json:"menu_item_id"`
+	Name               string  `json:"name"`
+	Price              Money   `json:"price"`
+	UnitCost           float64 `json:"unit_cost"`           // Production cost from recipe and ingredient costs
+	ContributionMargin float64 `json:"contribution_margin"` // Price minus unit cost
+	FixedCost          float64 `json:"fixed_cost"`
+	BreakEvenUnits     int     `json:"break_even_units"`
+}
+
+// MenuItemWithoutRecipe is an active menu item with no ingredients, so orders of it never deduct stock
+type MenuItemWithoutRecipe struct {
+	MenuItemID int       `json:"menu_item_id"`
+	Name       string    `json:"name"`
+	Price      Money     `json:"price"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CategoryNormalizationResponse - For POST /admin/menu/normalize-categories
+type CategoryNormalizationResponse struct {
+	ItemsUpdated int               `json:"items_updated"`
+	Merges       map[string]string `json:"merges"` // Original spelling to the category it was merged into, "" when blank and dropped
+}
+
+// BulkAssignIngredientRequest - For POST /menu/ingredients/bulk-assign
+type BulkAssignIngredientRequest struct {
+	IngredientID int     `json:"ingredient_id"`
+	Quantity     float64 `json:"quantity"` // Per unit of each menu item
+	MenuItemIDs  []int   `json:"menu_item_ids"`
+}
+
+type BulkAssignIngredientResponse struct {
+	IngredientID int   `json:"ingredient_id"`
+	Assigned     []int `json:"assigned"`
+	Skipped      []int `json:"skipped"` // Already used the ingredient, their quantity is left as is
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"math"
+	"strconv"
+)
+
+// Money is a monetary amount. It keeps full float precision internally
+// and is rounded to two decimal places only when serialized to JSON.
+type Money float64
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	rounded := math.Round(float64(m)*100) / 100
+	return []byte(strconv.FormatFloat(rounded, 'f', 2, 64)), nil
+}
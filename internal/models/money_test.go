@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMoneyMarshalsTwoDecimals(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{0.1 + 0.2, "0.30"},
+		{19.989999999999998, "19.99"},
+		{3 * 1.1, "3.30"},
+		{5, "5.00"},
+		{-1.255, "-1.25"},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(tt.money)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", float64(tt.money), err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%v) = %s, want %s", float64(tt.money), got, tt.want)
+		}
+	}
+
+	// Money fields of responses are serialized the same way
+	item := MenuItemRevenue{Revenue: 0.1 + 0.2}
+	got, err := json.Marshal(item)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if want := `"revenue":0.30`; !strings.Contains(string(got), want) {
+		t.Errorf("Marshal = %s, want %s", got, want)
+	}
+}
@@ -1,20 +1,29 @@
 package models
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Order struct {
 	ID                  int             `json:"id"`
+	Code                string          `json:"code,omitempty"`          // Human-readable code, e.g. NYC-20240615-0042
+	LocationCode        string          `json:"location_code,omitempty"` // Store the order was placed at
 	CustomerID          int             `json:"customer_id"`
 	Status              string          `json:"status"`
 	PaymentMethod       string          `json:"payment_method,omitempty"`
-	TotalPrice          float64         `json:"total_price"`
+	TotalPrice          Money           `json:"total_price"`     // After DiscountAmount
+	DiscountAmount      Money           `json:"discount_amount"` // Taken off the items' total
 	SpecialInstructions json.RawMessage `json:"special_instructions,omitempty"`
 	Items               []OrderItem     `json:"items"`
 	CreatedAt           time.Time       `json:"created_at"`
 	UpdatedAt           time.Time       `json:"updated_at"`
+	// Computed on order listings for orders still being worked on (not delivered or cancelled)
+	ElapsedSeconds *int64 `json:"elapsed_seconds,omitempty"` // Now minus CreatedAt
+	Urgency        string `json:"urgency,omitempty"`         // green, yellow or red by ElapsedSeconds
 }
 
 type OrderItem struct {
@@ -23,14 +32,91 @@ type OrderItem struct {
 	MenuItemID     int             `json:"menu_item_id"`
 	Quantity       int             `json:"quantity"`
 	Customizations json.RawMessage `json:"customizations,omitempty"`
-	PriceAtOrder   float64         `json:"price_at_order"`
+	PriceAtOrder   Money           `json:"price_at_order"`
+	ModifierDelta  Money           `json:"modifier_delta"` // Part of PriceAtOrder added by modifiers
+}
+
+// OrderStatuses lists the values of the order_status enum
+var OrderStatuses = map[string]bool{
+	"pending":   true,
+	"accepted":  true,
+	"preparing": true,
+	"ready":     true,
+	"delivered": true,
+	"cancelled": true,
+}
+
+// OrderStatusTransitions is the order state machine: the statuses each status may move to
+// Orders may skip "accepted" and go straight to "preparing"; any status before "delivered" may be cancelled.
+var OrderStatusTransitions = map[string][]string{
+	"pending":   {"accepted", "preparing", "cancelled"},
+	"accepted":  {"preparing", "cancelled"},
+	"preparing": {"ready", "cancelled"},
+	"ready":     {"delivered", "cancelled"},
+	"delivered": {},
+	"cancelled": {},
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, next := range OrderStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
 }
 
 type OrderFilters struct {
-	Status     string    `json:"status"`      // e.g., "pending", "completed"
-	StartDate  time.Time `json:"start_date"`  // Filter orders after this date
-	EndDate    time.Time `json:"end_date"`    // Filter orders before this date
-	CustomerID int       `json:"customer_id"` // Optional: filter by customer
+	Status        string    `json:"status"`      // e.g., "pending", "completed"
+	StartDate     time.Time `json:"start_date"`  // Filter orders after this date
+	EndDate       time.Time `json:"end_date"`    // Filter orders before this date
+	CustomerID    int       `json:"customer_id"` // Optional: filter by customer
+	Customization string    `json:"-"`           // Orders with an item customization key or value containing this text
+	Limit         int       `json:"-"`           // Page size of GET /orders
+	Cursor        string    `json:"-"`           // NextCursor of the previous page of GET /orders
+}
+
+// OrderListResponse - For GET /orders, newest orders first
+type OrderListResponse struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"` // Empty on the last page
+	TotalCount int     `json:"total_count"`           // Orders matching the filters across all pages
+}
+
+// OrderCursor is the position of the last order of a page: orders are listed by created_at, then id, descending
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// Encode returns the cursor as an opaque URL-safe string
+func (c OrderCursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeOrderCursor parses a cursor produced by OrderCursor.Encode
+func DecodeOrderCursor(cursor string) (OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return OrderCursor{}, ErrInvalidCursor
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return OrderCursor{}, ErrInvalidCursor
+	}
+	createdAt, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return OrderCursor{}, ErrInvalidCursor
+	}
+	orderID, err := strconv.Atoi(id)
+	if err != nil || orderID <= 0 {
+		return OrderCursor{}, ErrInvalidCursor
+	}
+
+	return OrderCursor{CreatedAt: time.Unix(0, createdAt), ID: orderID}, nil
 }
 
 type BatchOrderRequest struct {
@@ -44,18 +130,121 @@ type BatchOrderResponse struct {
 }
 
 type ProcessedOrder struct {
-	OrderID      int     `json:"order_id"`
-	CustomerName string  `json:"customer_name"`
-	Status       string  `json:"status"`
-	Total        float64 `json:"total"`
-	Rejected     bool    `json:"rejected,omitempty"`
-	RejectReason string  `json:"reject_reason,omitempty"`
+	OrderID      int    `json:"order_id"`
+	CustomerName string `json:"customer_name"`
+	Status       string `json:"status"`
+	Total        Money  `json:"total"`
+	Rejected     bool   `json:"rejected,omitempty"`
+	RejectReason string `json:"reject_reason,omitempty"`
 }
 
 type BatchSummary struct {
 	TotalOrders   int              `json:"total_orders"`
 	Accepted      int              `json:"accepted"`
 	Rejected      int              `json:"rejected"`
-	TotalRevenue  float64          `json:"total_revenue"`
+	TotalRevenue  Money            `json:"total_revenue"`
 	InventoryUsed []InventoryUsage `json:"inventory_used"`
 }
+
+// BatchFeasibilityResponse represents the result of a dry-run inventory check for a batch
+type BatchFeasibilityResponse struct {
+	Orders     []OrderFeasibility    `json:"orders"`
+	Summary    FeasibilitySummary    `json:"summary"`
+	Shortfalls []IngredientShortfall `json:"shortfalls"`
+}
+
+type OrderFeasibility struct {
+	Index      int                   `json:"index"`
+	CustomerID int                   `json:"customer_id"`
+	Feasible   bool                  `json:"feasible"`
+	Reason     string                `json:"reason,omitempty"`
+	Shortfalls []IngredientShortfall `json:"shortfalls,omitempty"`
+}
+
+type FeasibilitySummary struct {
+	TotalOrders int `json:"total_orders"`
+	Feasible    int `json:"feasible"`
+	Infeasible  int `json:"infeasible"`
+}
+
+// IngredientShortfall is short of an ingredient, or of the stock of a stock tracked menu item
+type IngredientShortfall struct {
+	IngredientID int     `json:"ingredient_id,omitempty"`
+	MenuItemID   int     `json:"menu_item_id,omitempty"`
+	Name         string  `json:"name"`
+	Required     float64 `json:"required"`
+	Available    float64 `json:"available"`
+	Shortfall    float64 `json:"shortfall"`
+}
+
+// BulkStatusRequest - For POST /orders/bulk-status
+type BulkStatusRequest struct {
+	Status  string       `json:"status"`
+	Filters OrderFilters `json:"filters"`
+}
+
+// BulkStatusResponse reports which matching orders were transitioned
+type BulkStatusResponse struct {
+	TargetStatus    string         `json:"target_status"`
+	Matched         int            `json:"matched"`
+	Succeeded       int            `json:"succeeded"`
+	Skipped         int            `json:"skipped"`
+	UpdatedOrderIDs []int          `json:"updated_order_ids"`
+	SkippedOrders   []SkippedOrder `json:"skipped_orders"`
+}
+
+type SkippedOrder struct {
+	OrderID       int    `json:"order_id"`
+	CurrentStatus string `json:"current_status"`
+	Reason        string `json:"reason"`
+}
+
+// OrderStatusHistory is an entry of an order's status timeline
+type OrderStatusHistory struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	Status    string    `json:"status"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// OrderInventoryTransactionsResponse - For GET /orders/{id}/inventory-transactions
+type OrderInventoryTransactionsResponse struct {
+	OrderID      int                               `json:"order_id"`
+	Transactions map[string][]InventoryTransaction `json:"transactions"` // Keyed by transaction type, oldest first
+}
+
+// OrderStatusRequest - For PATCH /orders/{id}/status
+type OrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+type OrderStatusResponse struct {
+	OrderID        int    `json:"order_id"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+}
+
+// BatchGetRequest - For POST /orders/batch-get
+type BatchGetRequest struct {
+	OrderIDs []int `json:"order_ids"`
+}
+
+type BatchGetResponse struct {
+	Orders   []Order `json:"orders"`
+	NotFound []int   `json:"not_found"`
+}
+
+// QueueETAResponse - For GET /orders/{id}/queue-eta
+type QueueETAResponse struct {
+	OrderID          int       `json:"order_id"`
+	Status           string    `json:"status"`
+	CreatedAt        time.Time `json:"created_at"`
+	OrdersAhead      int       `json:"orders_ahead"`
+	MinutesAhead     float64   `json:"minutes_ahead"`    // Prep work queued before this order
+	OwnPrepMinutes   float64   `json:"own_prep_minutes"` // Prep work of this order
+	PrepStations     int       `json:"prep_stations"`
+	EstimatedMinutes float64   `json:"estimated_minutes"`
+	EstimatedReadyAt time.Time `json:"estimated_ready_at"`
+	ElapsedSeconds   *int64    `json:"elapsed_seconds,omitempty"` // Omitted for delivered and cancelled orders
+	Urgency          string    `json:"urgency,omitempty"`
+}
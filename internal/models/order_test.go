@@ -0,0 +1,45 @@
+package models
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"pending", "accepted", true},
+		{"pending", "preparing", true},
+		{"accepted", "preparing", true},
+		{"preparing", "ready", true},
+		{"ready", "delivered", true},
+		{"pending", "cancelled", true},
+		{"ready", "cancelled", true},
+
+		{"pending", "ready", false},
+		{"pending", "delivered", false},
+		{"preparing", "accepted", false},
+		{"delivered", "cancelled", false},
+		{"cancelled", "pending", false},
+		{"pending", "pending", false},
+		{"pending", "unknown", false},
+		{"unknown", "pending", false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestOrderStatusTransitionsUseKnownStatuses(t *testing.T) {
+	for from, targets := range OrderStatusTransitions {
+		if !OrderStatuses[from] {
+			t.Errorf("transitions from unknown status %q", from)
+		}
+		for _, to := range targets {
+			if !OrderStatuses[to] {
+				t.Errorf("transition from %q to unknown status %q", from, to)
+			}
+		}
+	}
+}
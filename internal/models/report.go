@@ -6,9 +6,9 @@ import (
 
 // TotalSalesResponse - For GET /reports/total-sales
 type TotalSalesResponse struct {
-	TotalSales float64 `json:"total_sales"`
-	StartDate  string  `json:"start_date,omitempty"`
-	EndDate    string  `json:"end_date,omitempty"`
+	TotalSales Money  `json:"total_sales"`
+	StartDate  string `json:"start_date,omitempty"`
+	EndDate    string `json:"end_date,omitempty"`
 }
 
 // PopularItem - For GET /reports/popular-items
@@ -20,18 +20,141 @@ type PopularItem struct {
 	Percentage    float64 `json:"percentage,omitempty"` // Can be calculated client-side
 }
 
+// OrderRateResponse - For GET /reports/order-rate
+type OrderRateResponse struct {
+	Window          string  `json:"window"`
+	OrderCount      int     `json:"order_count"`
+	OrdersPerMinute float64 `json:"orders_per_minute"`
+}
+
+// CostVarianceResponse - For GET /reports/cost-variance
+type CostVarianceResponse struct {
+	StartDate   string                   `json:"start_date"`
+	EndDate     string                   `json:"end_date"`
+	Ingredients []IngredientCostVariance `json:"ingredients"`
+	MenuItems   []MenuItemCostImpact     `json:"menu_items"`
+}
+
+// IngredientCostVariance is the change in cost per unit of an ingredient over the period
+type IngredientCostVariance struct {
+	IngredientID    int     `json:"ingredient_id"`
+	Name            string  `json:"name"`
+	Unit            string  `json:"unit"`
+	StartCost       float64 `json:"start_cost"`
+	EndCost         float64 `json:"end_cost"`
+	Variance        float64 `json:"variance"`
+	VariancePercent float64 `json:"variance_percent,omitempty"`
+	Changes         int     `json:"changes"`
+}
+
+// MenuItemCostImpact is the change in production cost of a menu item caused by ingredient cost changes
+type MenuItemCostImpact struct {
+	MenuItemID int     `json:"menu_item_id"`
+	Name       string  `json:"name"`
+	Price      Money   `json:"price"`
+	CostChange float64 `json:"cost_change"`
+}
+
+// RestockHistoryResponse - For GET /reports/restock-history
+type RestockHistoryResponse struct {
+	Restocks  []RestockTransaction   `json:"restocks"`
+	Suppliers []SupplierRestockStats `json:"suppliers"`
+}
+
+type RestockTransaction struct {
+	ID             int       `json:"id"`
+	IngredientID   int       `json:"ingredient_id"`
+	IngredientName string    `json:"ingredient_name"`
+	Supplier       string    `json:"supplier"`
+	Quantity       float64   `json:"quantity"`
+	Notes          string    `json:"notes,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SupplierRestockStats aggregates how often and how much a supplier restocks
+type SupplierRestockStats struct {
+	Supplier           string    `json:"supplier"`
+	RestockCount       int       `json:"restock_count"`
+	TotalQuantity      float64   `json:"total_quantity"`
+	AverageQuantity    float64   `json:"average_quantity"`
+	AverageDaysBetween float64   `json:"average_days_between,omitempty"`
+	FirstRestock       time.Time `json:"first_restock"`
+	LastRestock        time.Time `json:"last_restock"`
+}
+
+// SalesPerLaborHourRequest - For POST /reports/sales-per-labor-hour
+type SalesPerLaborHourRequest struct {
+	Days []LaborDay `json:"days"`
+}
+
+// LaborDay is the staffing input for a single day
+type LaborDay struct {
+	Date       string  `json:"date"` // YYYY-MM-DD
+	LaborHours float64 `json:"labor_hours"`
+}
+
+type SalesPerLaborHourResponse struct {
+	Days              []LaborDayProductivity `json:"days"`
+	TotalSales        Money                  `json:"total_sales"`
+	TotalLaborHours   float64                `json:"total_labor_hours"`
+	SalesPerLaborHour Money                  `json:"sales_per_labor_hour"`
+}
+
+type LaborDayProductivity struct {
+	Date              string  `json:"date"`
+	Sales             Money   `json:"sales"`
+	OrderCount        int     `json:"order_count"`
+	LaborHours        float64 `json:"labor_hours"`
+	SalesPerLaborHour Money   `json:"sales_per_labor_hour"`
+}
+
+// TargetAttainmentRequest - For POST /reports/target-attainment. Every day from StartDate to EndDate
+// is measured against DailyTarget unless Targets sets its own.
+type TargetAttainmentRequest struct {
+	StartDate   string      `json:"start_date"` // YYYY-MM-DD
+	EndDate     string      `json:"end_date"`   // YYYY-MM-DD
+	DailyTarget Money       `json:"daily_target"`
+	Targets     []DayTarget `json:"targets,omitempty"`
+}
+
+// DayTarget overrides the daily target of a single day
+type DayTarget struct {
+	Date   string `json:"date"` // YYYY-MM-DD
+	Target Money  `json:"target"`
+}
+
+type TargetAttainmentResponse struct {
+	StartDate         string          `json:"start_date"`
+	EndDate           string          `json:"end_date"`
+	TotalSales        Money           `json:"total_sales"`
+	TotalTarget       Money           `json:"total_target"`
+	AttainmentPercent float64         `json:"attainment_percent"`
+	Days              []DayAttainment `json:"days"`
+}
+
+// DayAttainment compares the sales of a day, and the running total up to it, with their targets
+type DayAttainment struct {
+	Date                        string  `json:"date"`
+	Sales                       Money   `json:"sales"`
+	Target                      Money   `json:"target"`
+	AttainmentPercent           float64 `json:"attainment_percent"`
+	CumulativeSales             Money   `json:"cumulative_sales"`
+	CumulativeTarget            Money   `json:"cumulative_target"`
+	CumulativeAttainmentPercent float64 `json:"cumulative_attainment_percent"`
+}
+
 // PeriodReport represents the report for ordered items by time period
 type PeriodReport struct {
-	Period     interface{} `json:"period"` // Can be int (day) or string (month name)
+	Period     interface{} `json:"period"` // Day of month, ISO week or year number, or month name
 	OrderCount int         `json:"order_count"`
-	TotalSales float64     `json:"total_sales"`
+	TotalSales Money       `json:"total_sales"`
 }
 
 // PeriodReportResponse is the full response structure
 type PeriodReportResponse struct {
-	PeriodType string         `json:"period_type"` // "day" or "month"
+	PeriodType string         `json:"period_type"` // "day", "week", "month" or "year"
 	Month      string         `json:"month,omitempty"`
-	Year       int            `json:"year,omitempty"`
+	Year       int            `json:"year,omitempty"` // ISO week-numbering year for weeks, unset for years
 	Reports    []PeriodReport `json:"reports"`
 }
 
@@ -47,7 +170,7 @@ type SearchMenuItem struct {
 	ID          int     `json:"id"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Price       Money   `json:"price"`
 	Relevance   float64 `json:"relevance,omitempty"`
 }
 
@@ -55,15 +178,16 @@ type SearchOrder struct {
 	ID           int      `json:"id"`
 	CustomerName string   `json:"customer_name"`
 	Items        []string `json:"items"`
-	Total        float64  `json:"total"`
+	Total        Money    `json:"total"`
 	Status       string   `json:"status"`
 	Relevance    float64  `json:"relevance,omitempty"`
 }
 
 type SearchCustomer struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email,omitempty"`
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Email     string  `json:"email,omitempty"`
+	Relevance float64 `json:"relevance,omitempty"`
 }
 
 type PaginatedInventory struct {
@@ -86,10 +210,218 @@ type ReportFilters struct {
 	PageSize  int       `json:"page_size,omitempty"`
 }
 
-// SalesTrend - For future sales analytics
+// SalesTrendResponse - For GET /reports/sales-trend
+type SalesTrendResponse struct {
+	StartDate   string       `json:"start_date"`
+	EndDate     string       `json:"end_date"`
+	Granularity string       `json:"granularity"`
+	TotalSales  Money        `json:"total_sales"`
+	OrderCount  int          `json:"order_count"`
+	AvgOrder    Money        `json:"average_order_value"`
+	Trend       []SalesTrend `json:"trend"`
+}
+
+// SalesTrend is the sales of non-cancelled orders in a day, or in the bucket of a sales trend
 type SalesTrend struct {
 	Date       time.Time `json:"date"`
-	TotalSales float64   `json:"total_sales"`
+	TotalSales Money     `json:"total_sales"`
 	OrderCount int       `json:"order_count"`
-	AvgOrder   float64   `json:"average_order_value"`
+	AvgOrder   Money     `json:"average_order_value"`
+}
+
+type RefundTrendResponse struct {
+	StartDate   string              `json:"start_date"`
+	EndDate     string              `json:"end_date"`
+	Granularity string              `json:"granularity"`
+	GrossSales  Money               `json:"gross_sales"`
+	Refunds     Money               `json:"refunds"`
+	NetRevenue  Money               `json:"net_revenue"`
+	RefundRate  float64             `json:"refund_rate_pct"`
+	Buckets     []RefundTrendBucket `json:"buckets"`
+}
+
+// RefundTrendBucket holds sales and refunds for one day, week or month
+type RefundTrendBucket struct {
+	Period     string  `json:"period"` // start of the bucket, YYYY-MM-DD
+	GrossSales Money   `json:"gross_sales"`
+	Refunds    Money   `json:"refunds"`
+	NetRevenue Money   `json:"net_revenue"`
+	RefundRate float64 `json:"refund_rate_pct"`
+}
+
+// LowMarginResponse - For GET /reports/low-margin
+type LowMarginResponse struct {
+	ThresholdPercent float64          `json:"threshold_percent"`
+	Items            []MenuItemMargin `json:"items"`        // Below the threshold, lowest margin first
+	UnknownCost      []MenuItemMargin `json:"unknown_cost"` // Items without ingredients or with unpriced ingredients
+}
+
+// MenuItemMargin is the gross margin of a menu item at current ingredient costs
+type MenuItemMargin struct {
+	MenuItemID     int     `json:"menu_item_id"`
+	Name           string  `json:"name"`
+	Price          Money   `json:"price"`
+	ProductionCost float64 `json:"production_cost,omitempty"`
+	MarginPercent  float64 `json:"margin_percent,omitempty"`
+	CostKnown      bool    `json:"-"`
+}
+
+// StaffingRecommendationResponse - For GET /reports/staffing-recommendation
+type StaffingRecommendationResponse struct {
+	Date           string           `json:"date"`
+	Weekday        string           `json:"weekday"`
+	OrdersPerStaff int              `json:"orders_per_staff"`
+	LookbackWeeks  int              `json:"lookback_weeks"` // Same weekdays the load is taken from
+	Hours          []HourlyStaffing `json:"hours"`
+}
+
+// HourlyStaffing is the historical load of an hour of the day and the staff it needs
+type HourlyStaffing struct {
+	Hour             int     `json:"hour"`
+	AvgOrders        float64 `json:"avg_orders"`
+	PeakOrders       int     `json:"peak_orders"`
+	RecommendedStaff int     `json:"recommended_staff"` // Keeps peak orders per staffer within the target
+}
+
+// ProfitableHoursResponse - For GET /reports/profitable-hours
+type ProfitableHoursResponse struct {
+	StartDate string         `json:"start_date"`
+	EndDate   string         `json:"end_date"`
+	Hours     []HourlyProfit `json:"hours"` // Most profitable hour first
+}
+
+// HourlyProfit is the gross profit earned in an hour of the day over a date range
+type HourlyProfit struct {
+	Hour           int   `json:"hour"`
+	OrderCount     int   `json:"order_count"`
+	Revenue        Money `json:"revenue"`
+	IngredientCost Money `json:"ingredient_cost"` // At current ingredient costs
+	GrossProfit    Money `json:"gross_profit"`
+}
+
+// MenuContributionResponse - For GET /reports/menu-contribution
+type MenuContributionResponse struct {
+	StartDate string                 `json:"start_date"`
+	EndDate   string                 `json:"end_date"`
+	Items     []MenuItemContribution `json:"items"` // Largest contribution first
+}
+
+// MenuItemContribution is the total margin a menu item earned over a date range: the per-unit
+// margin times the units sold
+type MenuItemContribution struct {
+	MenuItemID     int    `json:"menu_item_id"`
+	Name           string `json:"name"`
+	UnitsSold      int    `json:"units_sold"`
+	Revenue        Money  `json:"revenue"`
+	IngredientCost Money  `json:"ingredient_cost"` // At current ingredient costs
+	UnitMargin     Money  `json:"unit_margin"`
+	Contribution   Money  `json:"contribution"`
+}
+
+// SalesAnomalyResponse - For GET /reports/anomalies
+type SalesAnomalyResponse struct {
+	Date         string             `json:"date"`
+	StdDevs      float64            `json:"std_devs"`      // How far from the mean a day must be to be flagged
+	BaselineDays int                `json:"baseline_days"` // Trailing days the mean and deviation are taken over
+	Anomaly      bool               `json:"anomaly"`       // Sales or order count is flagged
+	Sales        SalesAnomalyMetric `json:"sales"`
+	Orders       SalesAnomalyMetric `json:"orders"`
+}
+
+// SalesAnomalyMetric compares a day's value with the trailing baseline
+type SalesAnomalyMetric struct {
+	Value   float64  `json:"value"`
+	Mean    float64  `json:"mean"`
+	StdDev  float64  `json:"std_dev"`
+	ZScore  *float64 `json:"z_score"`           // null when the baseline doesn't vary
+	Anomaly string   `json:"anomaly,omitempty"` // "spike" or "drop"
+}
+
+// OrderSizeDistributionResponse - For GET /reports/order-size-distribution
+type OrderSizeDistributionResponse struct {
+	TotalOrders int               `json:"total_orders"`
+	Buckets     []OrderSizeBucket `json:"buckets"`
+}
+
+// OrderSizeBucket counts the non-cancelled orders with a total from Min up to, but not including, Max
+type OrderSizeBucket struct {
+	Label      string `json:"label"` // e.g. "5-10", the last bucket is open ended: "20+"
+	Min        Money  `json:"min"`
+	Max        *Money `json:"max"` // null for the last bucket
+	OrderCount int    `json:"order_count"`
+}
+
+// SalesByPaymentResponse - For GET /reports/sales-by-payment
+type SalesByPaymentResponse struct {
+	StartDate string               `json:"start_date"`
+	EndDate   string               `json:"end_date"`
+	Methods   []PaymentMethodSales `json:"methods"`
+}
+
+// PaymentMethodSales is the takings of a payment method; orders without one are "unspecified"
+type PaymentMethodSales struct {
+	PaymentMethod string `json:"payment_method"`
+	TotalSales    Money  `json:"total_sales"`
+	OrderCount    int    `json:"order_count"`
+}
+
+// RepeatRateResponse - For GET /reports/repeat-rate
+type RepeatRateResponse struct {
+	StartDate          string  `json:"start_date"`
+	EndDate            string  `json:"end_date"`
+	TotalOrders        int     `json:"total_orders"`  // Non-cancelled orders with a customer
+	RepeatOrders       int     `json:"repeat_orders"` // Placed by a customer with an earlier order
+	RepeatRate         float64 `json:"repeat_rate_pct"`
+	NewCustomers       int     `json:"new_customers"`       // First order placed in the period
+	ReturningCustomers int     `json:"returning_customers"` // Ordered before the period too
+}
+
+// DiscountSummaryResponse - For GET /reports/discount-summary
+type DiscountSummaryResponse struct {
+	StartDate        string  `json:"start_date"`
+	EndDate          string  `json:"end_date"`
+	TotalOrders      int     `json:"total_orders"` // Non-cancelled orders
+	DiscountedOrders int     `json:"discounted_orders"`
+	TotalDiscounts   Money   `json:"total_discounts"`
+	AverageDiscount  Money   `json:"average_discount"` // Per order, discounted or not
+	DiscountRate     float64 `json:"discount_rate_pct"`
+}
+
+// CustomerSpendingResponse - For GET /reports/customers/{id}/spending
+type CustomerSpendingResponse struct {
+	CustomerID        int        `json:"customer_id"`
+	TotalOrders       int        `json:"total_orders"`
+	TotalSpent        Money      `json:"total_spent"`
+	AverageOrderValue Money      `json:"average_order_value"`
+	FirstOrderAt      *time.Time `json:"first_order_at,omitempty"`
+	LastOrderAt       *time.Time `json:"last_order_at,omitempty"`
+}
+
+// PriceAuditResponse - For GET /admin/orders/price-audit
+type PriceAuditResponse struct {
+	StartDate  string          `json:"start_date"`
+	EndDate    string          `json:"end_date"`
+	Mismatches []PriceMismatch `json:"mismatches"`
+}
+
+// TotalMismatch is an order whose stored total_price differs from the sum of its items - For GET /admin/orders/total-mismatches
+type TotalMismatch struct {
+	OrderID         int       `json:"order_id"`
+	StoredTotal     Money     `json:"stored_total"`
+	RecomputedTotal Money     `json:"recomputed_total"` // Sum of quantity * price_at_order less discount_amount
+	Difference      Money     `json:"difference"`       // stored minus recomputed total
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// PriceMismatch is an order item whose stored price differs from the menu price when it was ordered
+type PriceMismatch struct {
+	OrderID       int       `json:"order_id"`
+	OrderItemID   int       `json:"order_item_id"`
+	MenuItemID    int       `json:"menu_item_id"`
+	Name          string    `json:"name"`
+	PriceAtOrder  Money     `json:"price_at_order"`
+	ModifierDelta Money     `json:"modifier_delta"`
+	ExpectedPrice Money     `json:"expected_price"`
+	Difference    Money     `json:"difference"` // price_at_order minus modifier_delta minus expected price
+	OrderedAt     time.Time `json:"ordered_at"`
 }
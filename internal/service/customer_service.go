@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/internal/models"
+)
+
+type CustomerService interface {
+	GetVisitFrequency(ctx context.Context, id int) (models.CustomerFrequencyResponse, error)
+	GetRecommendations(ctx context.Context, id int, limit int) (models.CustomerRecommendationsResponse, error)
+}
+
+// CustomerServiceConfig holds the tunable settings of the customer service
+type CustomerServiceConfig struct {
+	AtRiskAfterDays int // Days without an order after which a customer is flagged as at risk
+}
+
+// DefaultCustomerServiceConfig is used for settings that are not configured
+var DefaultCustomerServiceConfig = CustomerServiceConfig{
+	AtRiskAfterDays: 30,
+}
+
+type customerService struct {
+	customerRepo dal.CustomerRepository
+	config       CustomerServiceConfig
+	now          func() time.Time
+}
+
+func NewCustomerService(customerRepo dal.CustomerRepository, config CustomerServiceConfig) CustomerService {
+	if config.AtRiskAfterDays <= 0 {
+		config.AtRiskAfterDays = DefaultCustomerServiceConfig.AtRiskAfterDays
+	}
+	return &customerService{customerRepo: customerRepo, config: config, now: time.Now}
+}
+
+func (s *customerService) GetVisitFrequency(ctx context.Context, id int) (models.CustomerFrequencyResponse, error) {
+	if id <= 0 {
+		return models.CustomerFrequencyResponse{}, models.ErrCustomerNotFound
+	}
+
+	dates, err := s.customerRepo.GetOrderDates(ctx, id)
+	if err != nil {
+		return models.CustomerFrequencyResponse{}, err
+	}
+
+	response := models.CustomerFrequencyResponse{
+		CustomerID:          id,
+		OrderCount:          len(dates),
+		AtRiskThresholdDays: s.config.AtRiskAfterDays,
+	}
+	if len(dates) == 0 {
+		return response, nil
+	}
+
+	first, last := dates[0], dates[len(dates)-1]
+	response.FirstOrderAt = &first
+	response.LastOrderAt = &last
+
+	// The average of consecutive intervals reduces to the overall span over the number of gaps
+	if len(dates) > 1 {
+		response.AvgDaysBetween = roundDays(last.Sub(first) / time.Duration(len(dates)-1))
+	}
+	response.DaysSinceLastOrder = roundDays(s.now().Sub(last))
+	response.AtRisk = response.DaysSinceLastOrder > float64(s.config.AtRiskAfterDays)
+
+	return response, nil
+}
+
+// GetRecommendations suggests menu items the customer hasn't ordered, preferring those ordered by customers
+// with overlapping histories and falling back to globally popular items for customers without any
+func (s *customerService) GetRecommendations(ctx context.Context, id int, limit int) (models.CustomerRecommendationsResponse, error) {
+	if id <= 0 {
+		return models.CustomerRecommendationsResponse{}, models.ErrCustomerNotFound
+	}
+	if limit <= 0 || limit > 100 {
+		return models.CustomerRecommendationsResponse{}, models.ErrInvalidLimit
+	}
+
+	response := models.CustomerRecommendationsResponse{CustomerID: id, Source: "similar_customers"}
+	items, err := s.customerRepo.GetSimilarCustomerItems(ctx, id, limit)
+	if err != nil {
+		return models.CustomerRecommendationsResponse{}, err
+	}
+	if len(items) == 0 {
+		response.Source = "popular"
+		items, err = s.customerRepo.GetPopularItemsNotOrdered(ctx, id, limit)
+		if err != nil {
+			return models.CustomerRecommendationsResponse{}, err
+		}
+	}
+	if items == nil {
+		items = []models.RecommendedItem{}
+	}
+	response.Items = items
+
+	return response, nil
+}
+
+// roundDays converts a duration to days rounded to 2 decimals
+func roundDays(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*100) / 100
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/internal/models"
+)
+
+// fakeCustomerRepo serves fixed order dates. Methods the tests don't use are left to the embedded nil interface.
+type fakeCustomerRepo struct {
+	dal.CustomerRepository
+	orderDates []time.Time
+	similar    []models.RecommendedItem
+	popular    []models.RecommendedItem
+}
+
+func (r *fakeCustomerRepo) GetOrderDates(ctx context.Context, customerID int) ([]time.Time, error) {
+	return r.orderDates, nil
+}
+
+func (r *fakeCustomerRepo) GetSimilarCustomerItems(ctx context.Context, customerID int, limit int) ([]models.RecommendedItem, error) {
+	return r.similar, nil
+}
+
+func (r *fakeCustomerRepo) GetPopularItemsNotOrdered(ctx context.Context, customerID int, limit int) ([]models.RecommendedItem, error) {
+	return r.popular, nil
+}
+
+func TestGetVisitFrequency(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2031, month, d, 9, 0, 0, 0, time.UTC) }
+	repo := &fakeCustomerRepo{orderDates: []time.Time{day(time.January, 1), day(time.January, 11), day(time.January, 31)}}
+
+	tests := []struct {
+		atRiskAfterDays int
+		want            bool
+	}{
+		{30, true},
+		{45, false},
+	}
+	for _, tt := range tests {
+		s := NewCustomerService(repo, CustomerServiceConfig{AtRiskAfterDays: tt.atRiskAfterDays}).(*customerService)
+		s.now = func() time.Time { return day(time.March, 10) }
+
+		response, err := s.GetVisitFrequency(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("GetVisitFrequency: %v", err)
+		}
+		// 30 days over 2 gaps, and 38 days from January 31 to March 10
+		if response.OrderCount != 3 || response.AvgDaysBetween != 15 || response.DaysSinceLastOrder != 38 {
+			t.Errorf("GetVisitFrequency = %+v, want 3 orders 15 days apart, the last 38 days ago", response)
+		}
+		if response.AtRisk != tt.want {
+			t.Errorf("at risk after %d days = %v, want %v", tt.atRiskAfterDays, response.AtRisk, tt.want)
+		}
+	}
+
+	s := NewCustomerService(repo, DefaultCustomerServiceConfig)
+	if _, err := s.GetVisitFrequency(context.Background(), 0); err != models.ErrCustomerNotFound {
+		t.Errorf("GetVisitFrequency(0) error = %v, want ErrCustomerNotFound", err)
+	}
+}
+
+func TestGetRecommendationsFallsBackToPopularItems(t *testing.T) {
+	similar := []models.RecommendedItem{{MenuItemID: 2, Name: "Mocha", Score: 2}}
+	popular := []models.RecommendedItem{{MenuItemID: 1, Name: "Latte", Score: 3}}
+
+	tests := []struct {
+		name       string
+		repo       *fakeCustomerRepo
+		wantSource string
+		wantItem   int
+	}{
+		{"regular", &fakeCustomerRepo{similar: similar, popular: popular}, "similar_customers", 2},
+		{"new", &fakeCustomerRepo{popular: popular}, "popular", 1},
+	}
+	for _, tt := range tests {
+		s := NewCustomerService(tt.repo, CustomerServiceConfig{})
+		response, err := s.GetRecommendations(context.Background(), 7, 5)
+		if err != nil {
+			t.Fatalf("%s: GetRecommendations: %v", tt.name, err)
+		}
+		if response.Source != tt.wantSource || len(response.Items) != 1 || response.Items[0].MenuItemID != tt.wantItem {
+			t.Errorf("%s: response = %+v, want item %d from %s", tt.name, response, tt.wantItem, tt.wantSource)
+		}
+	}
+
+	s := NewCustomerService(&fakeCustomerRepo{}, CustomerServiceConfig{})
+	if response, err := s.GetRecommendations(context.Background(), 7, 5); err != nil || response.Items == nil {
+		t.Errorf("GetRecommendations without orders anywhere = %+v, %v, want an empty list", response, err)
+	}
+	if _, err := s.GetRecommendations(context.Background(), 7, 0); err != models.ErrInvalidLimit {
+		t.Errorf("GetRecommendations(limit 0) error = %v, want ErrInvalidLimit", err)
+	}
+}
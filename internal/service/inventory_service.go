@@ -2,6 +2,13 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
 	"frappuccino/internal/dal"
 	"frappuccino/internal/models"
@@ -12,10 +19,37 @@ type InventoryService interface {
 	GetIngredient(ctx context.Context, id int) (models.Inventory, error)
 	ListIngredients(ctx context.Context) ([]models.Inventory, error)
 	UpdateIngredient(ctx context.Context, id int, ingredient models.Inventory) error
+	PatchIngredient(ctx context.Context, id int, update models.InventoryUpdateRequest) error
 	DeleteIngredient(ctx context.Context, id int) error
 	GetLeftOversWithPagination(ctx context.Context, sortBy string, page int, pageSize int) (models.PaginatedInventoryResponse, error)
+	GetShoppingList(ctx context.Context, forecastDays int) (models.ShoppingListResponse, error)
+	GetRevenueAtRisk(ctx context.Context, id int, days int) (models.RevenueAtRiskResponse, error)
+	GetUnusedIngredients(ctx context.Context) ([]models.Inventory, error)
+	RestockIngredient(ctx context.Context, id int, request models.RestockRequest) (models.RestockResponse, error)
+	GetLowStockItems(ctx context.Context) ([]models.InventoryAlert, error)
+	GetReorderPriority(ctx context.Context) ([]models.ReorderPriority, error)
+	GetStockCoverage(ctx context.Context) ([]models.StockCoverage, error)
+	GetExpiryRisk(ctx context.Context) (models.ExpiryRiskResponse, error)
+	StreamTransactions(ctx context.Context, startDate, endDate time.Time, fn func(models.InventoryTransaction) error) error
+	ImportIngredients(ctx context.Context, rows []models.InventoryImportRow) (*models.InventoryImportResponse, error)
+	GetReorderRequests(ctx context.Context, status string) ([]models.ReorderRequest, error)
 }
 
+// shoppingListLookbackDays is the window of recent usage the shopping list forecast is based on
+const shoppingListLookbackDays = 30
+
+// alertUsageDays is the window of recent usage low stock alerts estimate days remaining from
+const alertUsageDays = 30
+
+// defaultLeadTimeDays is the supplier lead time assumed when supplier_info has no lead_time_days
+const defaultLeadTimeDays = 3
+
+// Weights of the reorder priority score
+const (
+	reorderUrgencyWeight    = 0.6
+	reorderImportanceWeight = 0.4
+)
+
 type inventoryService struct {
 	inventoryRepo dal.InventoryRepository
 }
@@ -64,6 +98,26 @@ func (s *inventoryService) UpdateIngredient(ctx context.Context, id int, ingredi
 	return s.inventoryRepo.UpdateIngredient(ctx, id, ingredient)
 }
 
+func (s *inventoryService) PatchIngredient(ctx context.Context, id int, update models.InventoryUpdateRequest) error {
+	if id <= 0 {
+		return models.ErrInvalidOrderID
+	}
+	if update.Quantity != nil && *update.Quantity < 0 {
+		return models.ErrInvalidQuantity
+	}
+	if update.CostPerUnit != nil && *update.CostPerUnit < 0 {
+		return models.ErrInvalidCostPerUnit
+	}
+	if update.ReOrderLevel != nil && *update.ReOrderLevel < 0 {
+		return models.ErrInvalidReOrderLevel
+	}
+	err := s.inventoryRepo.PatchIngredient(ctx, id, update)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrIngredientNotFound
+	}
+	return err
+}
+
 func (s *inventoryService) DeleteIngredient(ctx context.Context, id int) error {
 	if id <= 0 {
 		return models.ErrInvalidOrderID
@@ -72,7 +126,7 @@ func (s *inventoryService) DeleteIngredient(ctx context.Context, id int) error {
 }
 
 func (s *inventoryService) GetLeftOversWithPagination(ctx context.Context, sortBy string, page int, pageSize int) (models.PaginatedInventoryResponse, error) {
-	if !(sortBy == "price" || sortBy == "quantity") {
+	if !(sortBy == "price" || sortBy == "quantity" || sortBy == "value") {
 		return models.PaginatedInventoryResponse{}, models.ErrInvalidSortByValue
 	}
 	if pageSize <= 0 {
@@ -83,3 +137,289 @@ func (s *inventoryService) GetLeftOversWithPagination(ctx context.Context, sortB
 	}
 	return s.inventoryRepo.GetLeftOversWithPagination(ctx, sortBy, page, pageSize)
 }
+
+func (s *inventoryService) GetShoppingList(ctx context.Context, forecastDays int) (models.ShoppingListResponse, error) {
+	if forecastDays <= 0 {
+		return models.ShoppingListResponse{}, models.ErrInvalidForecastDays
+	}
+
+	items, err := s.inventoryRepo.GetShoppingList(ctx, forecastDays, shoppingListLookbackDays)
+	if err != nil {
+		return models.ShoppingListResponse{}, err
+	}
+
+	// Group items by supplier, keeping the order returned by the repository
+	response := models.ShoppingListResponse{
+		ForecastDays: forecastDays,
+		LookbackDays: shoppingListLookbackDays,
+		Suppliers:    []models.SupplierShoppingList{},
+	}
+	supplierIndex := make(map[string]int)
+	for _, item := range items {
+		idx, ok := supplierIndex[item.Supplier]
+		if !ok {
+			idx = len(response.Suppliers)
+			supplierIndex[item.Supplier] = idx
+			response.Suppliers = append(response.Suppliers, models.SupplierShoppingList{Supplier: item.Supplier})
+		}
+		response.Suppliers[idx].Items = append(response.Suppliers[idx].Items, item)
+	}
+
+	return response, nil
+}
+
+func (s *inventoryService) GetRevenueAtRisk(ctx context.Context, id int, days int) (models.RevenueAtRiskResponse, error) {
+	if id <= 0 {
+		return models.RevenueAtRiskResponse{}, models.ErrIngredientNotFound
+	}
+	if days <= 0 {
+		return models.RevenueAtRiskResponse{}, models.ErrInvalidDays
+	}
+	return s.inventoryRepo.GetRevenueAtRisk(ctx, id, days)
+}
+
+func (s *inventoryService) RestockIngredient(ctx context.Context, id int, request models.RestockRequest) (models.RestockResponse, error) {
+	if id <= 0 {
+		return models.RestockResponse{}, models.ErrIngredientNotFound
+	}
+	if request.Quantity <= 0 {
+		return models.RestockResponse{}, models.ErrInvalidRestockQty
+	}
+
+	var expiresOn *time.Time
+	if request.ExpiresOn != "" {
+		date, err := time.Parse("2006-01-02", request.ExpiresOn)
+		if err != nil {
+			return models.RestockResponse{}, models.ErrInvalidExpiryDate
+		}
+		expiresOn = &date
+	}
+
+	onHand, err := s.inventoryRepo.RestockIngredient(ctx, id, request.Quantity, strings.TrimSpace(request.Notes), expiresOn)
+	if err != nil {
+		return models.RestockResponse{}, err
+	}
+
+	return models.RestockResponse{
+		IngredientID:  id,
+		QuantityAdded: request.Quantity,
+		OnHand:        onHand,
+	}, nil
+}
+
+func (s *inventoryService) GetUnusedIngredients(ctx context.Context) ([]models.Inventory, error) {
+	return s.inventoryRepo.GetUnusedIngredients(ctx)
+}
+
+func (s *inventoryService) GetLowStockItems(ctx context.Context) ([]models.InventoryAlert, error) {
+	alerts, err := s.inventoryRepo.GetLowStockItems(ctx, alertUsageDays)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range alerts {
+		alerts[i].DaysRemaining = math.Round(alerts[i].DaysRemaining*10) / 10
+	}
+	return alerts, nil
+}
+
+// GetReorderPriority ranks ingredients at or below their reorder level. Each gets a score from 0 to 100:
+//
+//	urgency    = min(lead_time_days / days_remaining, 2) / 2
+//	importance = revenue_at_risk / highest revenue_at_risk in the list
+//	score      = 100 * (0.6*urgency + 0.4*importance)
+//
+// Urgency reaches 1 once the stock lasts half the lead time or less, i.e. the ingredient runs out well
+// before a new delivery can arrive; without usage history days remaining is unknown and urgency is 0.
+// Importance weighs ingredients by the recent revenue of the menu items that can't be sold without them.
+func (s *inventoryService) GetReorderPriority(ctx context.Context) ([]models.ReorderPriority, error) {
+	candidates, err := s.inventoryRepo.GetReorderCandidates(ctx, alertUsageDays, defaultLeadTimeDays)
+	if err != nil {
+		return nil, err
+	}
+	if candidates == nil {
+		return []models.ReorderPriority{}, nil
+	}
+
+	var maxRevenue models.Money
+	for _, candidate := range candidates {
+		if candidate.RevenueAtRisk > maxRevenue {
+			maxRevenue = candidate.RevenueAtRisk
+		}
+	}
+
+	for i := range candidates {
+		var urgency, importance float64
+		if candidates[i].DaysRemaining > 0 {
+			urgency = math.Min(candidates[i].LeadTimeDays/candidates[i].DaysRemaining, 2) / 2
+		}
+		if maxRevenue > 0 {
+			importance = float64(candidates[i].RevenueAtRisk / maxRevenue)
+		}
+		score := 100 * (reorderUrgencyWeight*urgency + reorderImportanceWeight*importance)
+		candidates[i].Score = math.Round(score*100) / 100
+		candidates[i].DaysRemaining = math.Round(candidates[i].DaysRemaining*10) / 10
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates, nil
+}
+
+// GetStockCoverage returns each tracked ingredient's days of stock at its average daily usage
+// over the last alertUsageDays
+func (s *inventoryService) GetStockCoverage(ctx context.Context) ([]models.StockCoverage, error) {
+	coverage, err := s.inventoryRepo.GetStockCoverage(ctx, alertUsageDays)
+	if err != nil {
+		return nil, err
+	}
+	if coverage == nil {
+		return []models.StockCoverage{}, nil
+	}
+	return coverage, nil
+}
+
+// GetExpiryRisk projects which lots expire before they are used up at the average daily usage over the
+// last alertUsageDays. Stock on hand is taken to be the newest lots, and lots are used soonest expiry first.
+func (s *inventoryService) GetExpiryRisk(ctx context.Context) (models.ExpiryRiskResponse, error) {
+	lots, err := s.inventoryRepo.GetInventoryLots(ctx, alertUsageDays)
+	if err != nil {
+		return models.ExpiryRiskResponse{}, err
+	}
+
+	response := models.ExpiryRiskResponse{
+		UsageDays: alertUsageDays,
+		Lots:      []models.ExpiringLot{},
+	}
+
+	// Lots arrive grouped by ingredient, newest first
+	for start := 0; start < len(lots); {
+		end := start
+		for end < len(lots) && lots[end].IngredientID == lots[start].IngredientID {
+			end++
+		}
+		response.Lots = append(response.Lots, projectLotWaste(lots[start:end])...)
+		start = end
+	}
+
+	sort.SliceStable(response.Lots, func(i, j int) bool {
+		return response.Lots[i].DaysUntilExpiry < response.Lots[j].DaysUntilExpiry
+	})
+	for _, lot := range response.Lots {
+		if lot.WasteCost != nil {
+			response.TotalWasteCost += *lot.WasteCost
+		}
+	}
+
+	return response, nil
+}
+
+// projectLotWaste takes the lots of one ingredient, newest first, and returns those projected to be at
+// least partly wasted, soonest expiry first
+func projectLotWaste(lots []models.ExpiringLot) []models.ExpiringLot {
+	// Older lots have been used up first, so only the newest lots up to the stock on hand remain
+	remaining := lots[0].OnHand
+	var inStock []models.ExpiringLot
+	for _, lot := range lots {
+		if remaining <= 0 {
+			break
+		}
+		lot.Quantity = math.Min(lot.Quantity, remaining)
+		remaining -= lot.Quantity
+		inStock = append(inStock, lot)
+	}
+
+	sort.SliceStable(inStock, func(i, j int) bool {
+		return inStock[i].DaysUntilExpiry < inStock[j].DaysUntilExpiry
+	})
+
+	var atRisk []models.ExpiringLot
+	used := 0.0
+	for _, lot := range inStock {
+		// What can be used before this lot expires, after the lots expiring earlier
+		usable := lot.DailyUsage*math.Max(float64(lot.DaysUntilExpiry), 0) - used
+		consumed := math.Max(0, math.Min(usable, lot.Quantity))
+		used += consumed
+
+		waste := math.Round((lot.Quantity-consumed)*1000) / 1000
+		if waste <= 0 {
+			continue
+		}
+		lot.ProjectedWaste = waste
+		if lot.CostPerUnit != nil {
+			cost := models.Money(math.Round(waste**lot.CostPerUnit*100) / 100)
+			lot.WasteCost = &cost
+		}
+		atRisk = append(atRisk, lot)
+	}
+	return atRisk
+}
+
+func (s *inventoryService) StreamTransactions(ctx context.Context, startDate, endDate time.Time, fn func(models.InventoryTransaction) error) error {
+	if !startDate.IsZero() && !endDate.IsZero() && startDate.After(endDate) {
+		return models.ErrInvalidDateRange
+	}
+	return s.inventoryRepo.StreamTransactions(ctx, startDate, endDate, fn)
+}
+
+// ImportIngredients validates stocktake rows and upserts the valid ones; invalid rows are
+// reported as failures, by line, without stopping the import
+func (s *inventoryService) ImportIngredients(ctx context.Context, rows []models.InventoryImportRow) (*models.InventoryImportResponse, error) {
+	response := &models.InventoryImportResponse{Failures: []models.InventoryImportFailure{}}
+
+	valid := make([]models.InventoryImportRow, 0, len(rows))
+	for _, row := range rows {
+		row.Name = strings.TrimSpace(row.Name)
+		row.Unit = strings.ToLower(strings.TrimSpace(row.Unit))
+
+		var reason string
+		switch {
+		case row.ParseError != "":
+			reason = row.ParseError
+		case row.Name == "":
+			reason = "name is required"
+		case row.Quantity < 0:
+			reason = models.ErrInvalidQuantity.Error()
+		case !models.InventoryUnits[row.Unit]:
+			reason = fmt.Sprintf("unit must be g, ml, shots or items, got %q", row.Unit)
+		case row.CostPerUnit < 0:
+			reason = models.ErrInvalidCostPerUnit.Error()
+		case row.ReOrderLevel < 0:
+			reason = models.ErrInvalidReOrderLevel.Error()
+		}
+		if reason != "" {
+			response.Failures = append(response.Failures, models.InventoryImportFailure{Line: row.Line, Name: row.Name, Reason: reason})
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	created, updated, failures, err := s.inventoryRepo.ImportIngredients(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Created = created
+	response.Updated = updated
+	response.Failures = append(response.Failures, failures...)
+	sort.Slice(response.Failures, func(i, j int) bool {
+		return response.Failures[i].Line < response.Failures[j].Line
+	})
+	response.Failed = len(response.Failures)
+	return response, nil
+}
+
+// GetReorderRequests lists reorder requests by status: open (the default), fulfilled or all
+func (s *inventoryService) GetReorderRequests(ctx context.Context, status string) ([]models.ReorderRequest, error) {
+	switch status {
+	case "":
+		status = "open"
+	case "all":
+		status = ""
+	case "open", "fulfilled":
+	default:
+		return nil, models.ErrInvalidReorderStatus
+	}
+	return s.inventoryRepo.GetReorderRequests(ctx, status)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"frappuccino/internal/dal"
+	"frappuccino/internal/models"
+)
+
+// fakeInventoryRepo serves fixed results. Methods the tests don't use are left to the embedded nil interface.
+type fakeInventoryRepo struct {
+	dal.InventoryRepository
+	shoppingList []models.ShoppingListItem
+	candidates   []models.ReorderPriority
+	lots         []models.ExpiringLot
+}
+
+func (r *fakeInventoryRepo) GetShoppingList(ctx context.Context, forecastDays int, lookbackDays int) ([]models.ShoppingListItem, error) {
+	return r.shoppingList, nil
+}
+
+func (r *fakeInventoryRepo) GetReorderCandidates(ctx context.Context, usageDays int, defaultLeadTimeDays float64) ([]models.ReorderPriority, error) {
+	return r.candidates, nil
+}
+
+func (r *fakeInventoryRepo) GetInventoryLots(ctx context.Context, usageDays int) ([]models.ExpiringLot, error) {
+	return r.lots, nil
+}
+
+func TestGetShoppingListGroupsBySupplier(t *testing.T) {
+	repo := &fakeInventoryRepo{shoppingList: []models.ShoppingListItem{
+		{IngredientID: 1, Name: "Milk", Supplier: "Dairy Co", QuantityToBuy: 40},
+		{IngredientID: 2, Name: "Cream", Supplier: "Dairy Co", QuantityToBuy: 5},
+		{IngredientID: 3, Name: "Sugar", Supplier: "Sweet Ltd", QuantityToBuy: 28},
+	}}
+	s := NewInventoryService(repo)
+
+	response, err := s.GetShoppingList(context.Background(), 14)
+	if err != nil {
+		t.Fatalf("GetShoppingList: %v", err)
+	}
+	if response.ForecastDays != 14 || response.LookbackDays != shoppingListLookbackDays {
+		t.Errorf("forecast and lookback days = %d, %d, want 14, %d", response.ForecastDays, response.LookbackDays, shoppingListLookbackDays)
+	}
+	if len(response.Suppliers) != 2 {
+		t.Fatalf("suppliers = %+v, want Dairy Co and Sweet Ltd", response.Suppliers)
+	}
+	dairy, sweet := response.Suppliers[0], response.Suppliers[1]
+	if dairy.Supplier != "Dairy Co" || len(dairy.Items) != 2 || dairy.Items[0].Name != "Milk" || dairy.Items[1].Name != "Cream" {
+		t.Errorf("first supplier = %+v, want Dairy Co with milk and cream", dairy)
+	}
+	if sweet.Supplier != "Sweet Ltd" || len(sweet.Items) != 1 || sweet.Items[0].QuantityToBuy != 28 {
+		t.Errorf("second supplier = %+v, want Sweet Ltd with 28 sugar", sweet)
+	}
+
+	if _, err := s.GetShoppingList(context.Background(), 0); err != models.ErrInvalidForecastDays {
+		t.Errorf("GetShoppingList(0) error = %v, want ErrInvalidForecastDays", err)
+	}
+}
+
+func TestGetLeftOversRejectsUnknownSort(t *testing.T) {
+	s := NewInventoryService(&fakeInventoryRepo{})
+	if _, err := s.GetLeftOversWithPagination(context.Background(), "total_value; DROP TABLE inventory", 1, 10); err != models.ErrInvalidSortByValue {
+		t.Errorf("GetLeftOversWithPagination error = %v, want %v", err, models.ErrInvalidSortByValue)
+	}
+}
+
+func TestGetReorderPriorityRanksUrgencyAndImportance(t *testing.T) {
+	repo := &fakeInventoryRepo{candidates: []models.ReorderPriority{
+		{IngredientID: 1, Name: "Vanilla", DaysRemaining: 20, LeadTimeDays: 2, RevenueAtRisk: 100},
+		{IngredientID: 2, Name: "Cinnamon", DaysRemaining: 0, LeadTimeDays: 5, RevenueAtRisk: 50},
+		{IngredientID: 3, Name: "Syrup", DaysRemaining: 1, LeadTimeDays: 4, RevenueAtRisk: 10},
+		{IngredientID: 4, Name: "Milk", DaysRemaining: 1.04, LeadTimeDays: 3, RevenueAtRisk: 100},
+	}}
+	s := NewInventoryService(repo)
+
+	priorities, err := s.GetReorderPriority(context.Background())
+	if err != nil {
+		t.Fatalf("GetReorderPriority: %v", err)
+	}
+	// Milk runs out before delivery and sells the most; syrup runs out but sells little; vanilla sells
+	// as much as milk but lasts well past its lead time; cinnamon has no usage history to be urgent
+	want := []struct {
+		name  string
+		score float64
+	}{
+		{"Milk", 100},
+		{"Syrup", 64},
+		{"Vanilla", 43},
+		{"Cinnamon", 20},
+	}
+	if len(priorities) != len(want) {
+		t.Fatalf("priorities = %+v, want %d", priorities, len(want))
+	}
+	for i, w := range want {
+		if priorities[i].Name != w.name || priorities[i].Score != w.score {
+			t.Errorf("rank %d = %s scoring %v, want %s scoring %v", i+1, priorities[i].Name, priorities[i].Score, w.name, w.score)
+		}
+	}
+	if priorities[0].DaysRemaining != 1 {
+		t.Errorf("milk days remaining = %v, want it rounded to 1", priorities[0].DaysRemaining)
+	}
+}
+
+func TestGetExpiryRiskFlagsSlowlyUsedStock(t *testing.T) {
+	cost := 0.02
+	repo := &fakeInventoryRepo{lots: []models.ExpiringLot{
+		// 4 ml of cream a day uses 20 of the 100 ml before they expire in 5 days
+		{LotID: 1, IngredientID: 1, Name: "Cream", Quantity: 100, DaysUntilExpiry: 5, DailyUsage: 4, OnHand: 100, CostPerUnit: &cost},
+		// Only 100 g of the older beans lot is left, and both lots are used before they expire
+		{LotID: 2, IngredientID: 2, Name: "Beans", Quantity: 200, DaysUntilExpiry: 60, DailyUsage: 20, OnHand: 300},
+		{LotID: 3, IngredientID: 2, Name: "Beans", Quantity: 500, DaysUntilExpiry: 10, DailyUsage: 20, OnHand: 300},
+		// Expired milk is wasted whole; without a cost its waste isn't priced
+		{LotID: 4, IngredientID: 3, Name: "Milk", Quantity: 50, DaysUntilExpiry: -1, DailyUsage: 30, OnHand: 50},
+	}}
+	s := NewInventoryService(repo)
+
+	response, err := s.GetExpiryRisk(context.Background())
+	if err != nil {
+		t.Fatalf("GetExpiryRisk: %v", err)
+	}
+	if len(response.Lots) != 2 {
+		t.Fatalf("lots = %+v, want the milk and the cream", response.Lots)
+	}
+	milk, cream := response.Lots[0], response.Lots[1]
+	if milk.LotID != 4 || milk.ProjectedWaste != 50 || milk.WasteCost != nil {
+		t.Errorf("first lot = %+v, want all 50 of the milk wasted without a cost", milk)
+	}
+	if cream.LotID != 1 || cream.ProjectedWaste != 80 || cream.WasteCost == nil || *cream.WasteCost != 1.60 {
+		t.Errorf("second lot = %+v, want 80 of the cream wasted at 1.60", cream)
+	}
+	if response.TotalWasteCost != 1.60 {
+		t.Errorf("total waste cost = %v, want 1.60", response.TotalWasteCost)
+	}
+}
@@ -2,29 +2,211 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"frappuccino/internal/dal"
 	"frappuccino/internal/models"
 )
 
 type MenuService interface {
-	GetAllMenu(ctx context.Context) ([]models.MenuItems, error)
+	GetAllMenu(ctx context.Context) ([]models.MenuItems, []string, error)
+	RefreshMenu(ctx context.Context) ([]models.MenuItems, []string, error)
+	GetMenuFiltered(ctx context.Context, filters models.MenuFilters) ([]models.MenuItems, []string, error)
+	GetMenuTree(ctx context.Context) (*models.MenuTreeResponse, []string, error)
 	GetMenuItemByID(ctx context.Context, id int) (models.MenuItems, error)
 	CreateMenuItem(ctx context.Context, item models.MenuItems) (int, error)
 	UpdateMenuItem(ctx context.Context, id int, item models.MenuItems) error
 	DeleteMenuItem(ctx context.Context, id int) error
+	GetUnavailableMenuItems(ctx context.Context) ([]models.UnavailableMenuItem, error)
+	ApplySeasonWindows(ctx context.Context, now time.Time) ([]models.SeasonalChange, error)
+	GetIngredientTree(ctx context.Context, id int) (*models.MenuItemIngredientTree, error)
+	PreviewPriceChange(ctx context.Context, id int, request models.PriceWhatIfRequest) (*models.PriceWhatIfResponse, error)
+	GetBreakEven(ctx context.Context, id int, fixedCost float64) (*models.BreakEvenResponse, error)
+	NormalizeCategories(ctx context.Context) (*models.CategoryNormalizationResponse, error)
+	GetMenuItemsWithoutRecipe(ctx context.Context) ([]models.MenuItemWithoutRecipe, error)
+	GetModifierGroups(ctx context.Context, menuItemID int) ([]models.ModifierGroup, error)
+	GetPriceHistory(ctx context.Context, menuItemID int) ([]models.PriceHistory, error)
+	GetRemovalImpact(ctx context.Context, id int, days int) (*models.RemovalImpactResponse, error)
+	CreateModifierGroup(ctx context.Context, menuItemID int, group models.ModifierGroup) (int, error)
+	UpdateModifierGroup(ctx context.Context, menuItemID, groupID int, group models.ModifierGroup) error
+	DeleteModifierGroup(ctx context.Context, menuItemID, groupID int) error
+	BulkAssignIngredient(ctx context.Context, request models.BulkAssignIngredientRequest) (*models.BulkAssignIngredientResponse, error)
 }
 
+// priceWhatIfDefaultDays is the past period a price change is previewed against
+const priceWhatIfDefaultDays = 30
+
 type menuService struct {
 	menuRepo dal.MenuRepository
+	cache    *menuCache
+}
+
+// NewMenuService creates a menu service whose full menu listing is cached for cacheTTL;
+// a zero cacheTTL disables caching
+func NewMenuService(menuRepo dal.MenuRepository, cacheTTL time.Duration) MenuService {
+	return &menuService{menuRepo: menuRepo, cache: &menuCache{ttl: cacheTTL}}
+}
+
+// menuCache holds the last complete menu listing of each location until it expires or the menu changes
+type menuCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[int]menuCacheEntry
+	// generation counts invalidations, so a listing read before a menu change is not cached after it
+	generation uint64
+}
+
+type menuCacheEntry struct {
+	items   []models.MenuItems
+	expires time.Time
+}
+
+func (c *menuCache) get(locationID int) ([]models.MenuItems, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[locationID]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.items, true
+}
+
+// currentGeneration returns the generation to pass to set for a listing about to be read
+func (c *menuCache) currentGeneration() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// set caches a listing read at the given generation, unless the cache was invalidated since
+func (c *menuCache) set(locationID int, items []models.MenuItems, generation uint64) {
+	if c.ttl <= 0 {
+		return
+	}
+	if items == nil {
+		items = []models.MenuItems{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[int]menuCacheEntry)
+	}
+	c.entries[locationID] = menuCacheEntry{items: items, expires: time.Now().Add(c.ttl)}
+}
+
+// invalidate clears every location, since admin changes such as category normalization span them all
+func (c *menuCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.generation++
+}
+
+// GetAllMenu serves the menu from cache when possible. Stock changes with every order, so the
+// available flags of cached items are read fresh. The returned items share their slices with the
+// cache and must not be modified.
+func (s *menuService) GetAllMenu(ctx context.Context) ([]models.MenuItems, []string, error) {
+	cached, ok := s.cache.get(models.LocationIDFromContext(ctx))
+	if !ok {
+		return s.RefreshMenu(ctx)
+	}
+
+	availability, err := s.menuRepo.GetMenuAvailability(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	items := make([]models.MenuItems, len(cached))
+	for i, item := range cached {
+		item.Available = availability[item.ID]
+		items[i] = item
+	}
+	return items, nil, nil
 }
 
-func NewMenuService(menuRepo dal.MenuRepository) MenuService {
-	return &menuService{menuRepo: menuRepo}
+// RefreshMenu reads the menu from the database and caches it. Listings with warnings are
+// incomplete and are not cached.
+func (s *menuService) RefreshMenu(ctx context.Context) ([]models.MenuItems, []string, error) {
+	generation := s.cache.currentGeneration()
+	items, warnings, err := s.menuRepo.GetAllMenu(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(warnings) == 0 {
+		s.cache.set(models.LocationIDFromContext(ctx), items, generation)
+	}
+	return items, warnings, nil
 }
 
-func (s *menuService) GetAllMenu(ctx context.Context) ([]models.MenuItems, error) {
-	return s.menuRepo.GetAllMenu(ctx)
+// GetMenuFiltered reads the matching menu items from the database; filtered listings are not cached
+func (s *menuService) GetMenuFiltered(ctx context.Context, filters models.MenuFilters) ([]models.MenuItems, []string, error) {
+	if (filters.MinPrice != nil && *filters.MinPrice < 0) || (filters.MaxPrice != nil && *filters.MaxPrice < 0) {
+		return nil, nil, fmt.Errorf("%w: price values cannot be negative", models.ErrInvalidPriceRange)
+	}
+	if filters.MinPrice != nil && filters.MaxPrice != nil && *filters.MinPrice > *filters.MaxPrice {
+		return nil, nil, fmt.Errorf("%w: minPrice cannot be greater than maxPrice", models.ErrInvalidPriceRange)
+	}
+	filters.Category = strings.ToLower(strings.TrimSpace(filters.Category))
+	filters.Query = strings.TrimSpace(filters.Query)
+	return s.menuRepo.GetMenuFiltered(ctx, filters)
+}
+
+// uncategorizedMenuCategory groups menu tree items that have no category
+const uncategorizedMenuCategory = "uncategorized"
+
+// GetMenuTree groups the active items of the (cached) menu by category, categories and
+// their items sorted by name
+func (s *menuService) GetMenuTree(ctx context.Context) (*models.MenuTreeResponse, []string, error) {
+	items, warnings, err := s.GetAllMenu(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byCategory := make(map[string][]models.MenuItems)
+	for _, item := range items {
+		if !item.IsActive {
+			continue
+		}
+		// An item listing a category twice appears once under it
+		seen := make(map[string]bool, len(item.Category))
+		for _, category := range item.Category {
+			if category == "" || seen[category] {
+				continue
+			}
+			seen[category] = true
+			byCategory[category] = append(byCategory[category], item)
+		}
+		if len(seen) == 0 {
+			byCategory[uncategorizedMenuCategory] = append(byCategory[uncategorizedMenuCategory], item)
+		}
+	}
+
+	response := &models.MenuTreeResponse{Categories: make([]models.MenuCategoryNode, 0, len(byCategory))}
+	for category, categoryItems := range byCategory {
+		sort.SliceStable(categoryItems, func(i, j int) bool {
+			return categoryItems[i].Name < categoryItems[j].Name
+		})
+		response.Categories = append(response.Categories, models.MenuCategoryNode{
+			Category:  category,
+			ItemCount: len(categoryItems),
+			Items:     categoryItems,
+		})
+	}
+	sort.Slice(response.Categories, func(i, j int) bool {
+		return response.Categories[i].Category < response.Categories[j].Category
+	})
+
+	return response, warnings, nil
 }
 
 func (s *menuService) GetMenuItemByID(ctx context.Context, id int) (models.MenuItems, error) {
@@ -41,7 +223,22 @@ func (s *menuService) CreateMenuItem(ctx context.Context, item models.MenuItems)
 	if item.Price <= 0 {
 		return 0, models.ErrInvalidMenuItemPrice
 	}
-	return s.menuRepo.CreateMenuItem(ctx, item)
+	if item.PrepTime < 0 {
+		return 0, models.ErrInvalidPrepTime
+	}
+	if item.StockQuantity < 0 {
+		return 0, models.ErrInvalidQuantity
+	}
+	if err := validateSeason(item); err != nil {
+		return 0, err
+	}
+
+	id, err := s.menuRepo.CreateMenuItem(ctx, item)
+	if err != nil {
+		return 0, err
+	}
+	s.cache.invalidate()
+	return id, nil
 }
 
 func (s *menuService) UpdateMenuItem(ctx context.Context, id int, item models.MenuItems) error {
@@ -54,12 +251,415 @@ func (s *menuService) UpdateMenuItem(ctx context.Context, id int, item models.Me
 	if item.Price <= 0 {
 		return models.ErrInvalidMenuItemPrice
 	}
-	return s.menuRepo.UpdateMenuItem(ctx, id, item)
+	if item.PrepTime < 0 {
+		return models.ErrInvalidPrepTime
+	}
+	if item.StockQuantity < 0 {
+		return models.ErrInvalidQuantity
+	}
+	if err := validateSeason(item); err != nil {
+		return err
+	}
+
+	if err := s.menuRepo.UpdateMenuItem(ctx, id, item); err != nil {
+		return err
+	}
+	s.cache.invalidate()
+	return nil
 }
 
 func (s *menuService) DeleteMenuItem(ctx context.Context, id int) error {
 	if id <= 0 {
 		return models.ErrInvalidMenuItemID
 	}
-	return s.menuRepo.DeleteMenuItem(ctx, id)
+
+	if err := s.menuRepo.DeleteMenuItem(ctx, id); err != nil {
+		return err
+	}
+	s.cache.invalidate()
+	return nil
+}
+
+func (s *menuService) GetUnavailableMenuItems(ctx context.Context) ([]models.UnavailableMenuItem, error) {
+	items, err := s.menuRepo.GetUnavailableMenuItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Items closest to being available come first
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].MissingFraction < items[j].MissingFraction
+	})
+
+	return items, nil
+}
+
+func (s *menuService) ApplySeasonWindows(ctx context.Context, now time.Time) ([]models.SeasonalChange, error) {
+	changes, err := s.menuRepo.ApplySeasonWindows(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		s.cache.invalidate()
+	}
+
+	for _, change := range changes {
+		if change.IsActive {
+			log.Printf("seasonal menu item %d (%s) activated", change.MenuItemID, change.Name)
+		} else {
+			log.Printf("seasonal menu item %d (%s) deactivated", change.MenuItemID, change.Name)
+		}
+	}
+
+	return changes, nil
+}
+
+func (s *menuService) GetIngredientTree(ctx context.Context, id int) (*models.MenuItemIngredientTree, error) {
+	if id <= 0 {
+		return nil, models.ErrInvalidMenuItemID
+	}
+
+	item, err := s.menuRepo.GetMenuItemByID(ctx, id)
+	if err == models.ErrMenuItemNotFound {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ingredients, err := s.menuRepo.GetIngredientTree(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MenuItemIngredientTree{
+		MenuItemID:  item.ID,
+		Name:        item.Name,
+		Price:       item.Price,
+		IsActive:    item.IsActive,
+		Ingredients: ingredients,
+	}, nil
+}
+
+func (s *menuService) PreviewPriceChange(ctx context.Context, id int, request models.PriceWhatIfRequest) (*models.PriceWhatIfResponse, error) {
+	if id <= 0 {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	if request.NewPrice <= 0 {
+		return nil, models.ErrInvalidMenuItemPrice
+	}
+	if request.Days == 0 {
+		request.Days = priceWhatIfDefaultDays
+	}
+	if request.Days < 0 {
+		return nil, models.ErrInvalidDays
+	}
+
+	item, err := s.menuRepo.GetMenuItemByID(ctx, id)
+	if err == models.ErrMenuItemNotFound {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	quantity, actual, err := s.menuRepo.GetItemSales(ctx, id, request.Days)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.PriceWhatIfResponse{
+		MenuItemID:       item.ID,
+		Name:             item.Name,
+		CurrentPrice:     item.Price,
+		NewPrice:         request.NewPrice,
+		Days:             request.Days,
+		QuantitySold:     quantity,
+		ActualRevenue:    actual,
+		ProjectedRevenue: request.NewPrice * models.Money(quantity),
+	}
+	response.Difference = response.ProjectedRevenue - response.ActualRevenue
+	if actual > 0 {
+		response.DifferencePct = math.Round(float64(response.Difference/actual)*10000) / 100
+	}
+
+	return response, nil
+}
+
+// removalImpactDefaultDays is the past period of sales a removal impact reports
+const removalImpactDefaultDays = 30
+
+func (s *menuService) GetRemovalImpact(ctx context.Context, id int, days int) (*models.RemovalImpactResponse, error) {
+	if id <= 0 {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	if days == 0 {
+		days = removalImpactDefaultDays
+	}
+	if days < 0 {
+		return nil, models.ErrInvalidDays
+	}
+
+	item, err := s.menuRepo.GetMenuItemByID(ctx, id)
+	if err == models.ErrMenuItemNotFound {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	impact, err := s.menuRepo.GetRemovalImpact(ctx, id, days)
+	if err != nil {
+		return nil, err
+	}
+	impact.Name = item.Name
+	impact.Days = days
+	return &impact, nil
+}
+
+func (s *menuService) GetBreakEven(ctx context.Context, id int, fixedCost float64) (*models.BreakEvenResponse, error) {
+	if id <= 0 {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	if fixedCost < 0 {
+		return nil, models.ErrInvalidFixedCost
+	}
+
+	item, err := s.menuRepo.GetMenuItemByID(ctx, id)
+	if err == models.ErrMenuItemNotFound {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	unitCost, known, err := s.menuRepo.GetUnitCost(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !known {
+		return nil, models.ErrUnknownUnitCost
+	}
+
+	contribution := float64(item.Price) - unitCost
+	if contribution <= 0 {
+		return nil, models.ErrNoContribution
+	}
+
+	return &models.BreakEvenResponse{
+		MenuItemID:         item.ID,
+		Name:               item.Name,
+		Price:              item.Price,
+		UnitCost:           math.Round(unitCost*100) / 100,
+		ContributionMargin: math.Round(contribution*100) / 100,
+		FixedCost:          fixedCost,
+		BreakEvenUnits:     int(math.Ceil(fixedCost / contribution)),
+	}, nil
+}
+
+// RunSeasonScheduler applies season windows immediately and then on every interval until ctx is done.
+// now is injected so the schedule can be driven by a fake clock.
+func RunSeasonScheduler(ctx context.Context, menuService MenuService, interval time.Duration, now func() time.Time) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := menuService.ApplySeasonWindows(ctx, now()); err != nil {
+			log.Printf("failed to apply season windows: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// NormalizeCategories lowercases and trims every menu item category so spellings such as
+// "Coffee" and " COFFEE" merge into "coffee", dropping blanks and duplicates within an item
+func (s *menuService) NormalizeCategories(ctx context.Context) (*models.CategoryNormalizationResponse, error) {
+	merges := make(map[string]string)
+	updated, err := s.menuRepo.RewriteCategories(ctx, func(categories []string) []string {
+		normalized := make([]string, 0, len(categories))
+		seen := make(map[string]bool)
+		for _, category := range categories {
+			clean := strings.ToLower(strings.TrimSpace(category))
+			if clean != category {
+				merges[category] = clean
+			}
+			if clean == "" || seen[clean] {
+				continue
+			}
+			seen[clean] = true
+			normalized = append(normalized, clean)
+		}
+		return normalized
+	})
+	if err != nil {
+		return nil, err
+	}
+	if updated > 0 {
+		s.cache.invalidate()
+	}
+
+	return &models.CategoryNormalizationResponse{
+		ItemsUpdated: updated,
+		Merges:       merges,
+	}, nil
+}
+
+func (s *menuService) GetMenuItemsWithoutRecipe(ctx context.Context) ([]models.MenuItemWithoutRecipe, error) {
+	return s.menuRepo.GetMenuItemsWithoutRecipe(ctx)
+}
+
+// GetPriceHistory returns the price changes of a menu item, newest first; an empty list if it never changed
+func (s *menuService) GetPriceHistory(ctx context.Context, menuItemID int) ([]models.PriceHistory, error) {
+	if menuItemID <= 0 {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	return s.menuRepo.GetPriceHistory(ctx, menuItemID)
+}
+
+func (s *menuService) GetModifierGroups(ctx context.Context, menuItemID int) ([]models.ModifierGroup, error) {
+	if menuItemID <= 0 {
+		return nil, models.ErrInvalidMenuItemID
+	}
+
+	groups, err := s.menuRepo.GetModifierGroups(ctx, menuItemID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrInvalidMenuItemID
+	}
+	if err != nil {
+		return nil, err
+	}
+	if groups == nil {
+		groups = []models.ModifierGroup{}
+	}
+	return groups, nil
+}
+
+func (s *menuService) CreateModifierGroup(ctx context.Context, menuItemID int, group models.ModifierGroup) (int, error) {
+	if menuItemID <= 0 {
+		return 0, models.ErrInvalidMenuItemID
+	}
+	if err := validateModifierGroup(&group); err != nil {
+		return 0, err
+	}
+	group.ID = 0
+	group.MenuItemID = menuItemID
+
+	id, err := s.menuRepo.CreateModifierGroup(ctx, group)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrInvalidMenuItemID
+	}
+	return id, err
+}
+
+func (s *menuService) UpdateModifierGroup(ctx context.Context, menuItemID, groupID int, group models.ModifierGroup) error {
+	if menuItemID <= 0 {
+		return models.ErrInvalidMenuItemID
+	}
+	if groupID <= 0 {
+		return models.ErrModifierGroupNotFound
+	}
+	if err := validateModifierGroup(&group); err != nil {
+		return err
+	}
+	group.ID = groupID
+	group.MenuItemID = menuItemID
+	return s.menuRepo.UpdateModifierGroup(ctx, group)
+}
+
+func (s *menuService) DeleteModifierGroup(ctx context.Context, menuItemID, groupID int) error {
+	if menuItemID <= 0 {
+		return models.ErrInvalidMenuItemID
+	}
+	if groupID <= 0 {
+		return models.ErrModifierGroupNotFound
+	}
+	return s.menuRepo.DeleteModifierGroup(ctx, menuItemID, groupID)
+}
+
+// validateModifierGroup trims the group and modifier names and requires them to be set, with modifier
+// names unique within the group since orders select modifiers by name
+func validateModifierGroup(group *models.ModifierGroup) error {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return models.ErrInvalidModifierGroup
+	}
+
+	seen := make(map[string]bool, len(group.Modifiers))
+	for i := range group.Modifiers {
+		name := strings.TrimSpace(group.Modifiers[i].Name)
+		if name == "" || seen[strings.ToLower(name)] {
+			return models.ErrInvalidModifierGroup
+		}
+		seen[strings.ToLower(name)] = true
+		group.Modifiers[i].Name = name
+	}
+	return nil
+}
+
+func validateSeason(item models.MenuItems) error {
+	var start, end time.Time
+	var err error
+	if item.SeasonStart != "" {
+		if start, err = time.Parse("2006-01-02", item.SeasonStart); err != nil {
+			return models.ErrInvalidSeason
+		}
+	}
+	if item.SeasonEnd != "" {
+		if end, err = time.Parse("2006-01-02", item.SeasonEnd); err != nil {
+			return models.ErrInvalidSeason
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && start.After(end) {
+		return models.ErrInvalidSeason
+	}
+	return nil
+}
+
+// BulkAssignIngredient links an ingredient to many menu items at once, skipping the ones already using it
+func (s *menuService) BulkAssignIngredient(ctx context.Context, request models.BulkAssignIngredientRequest) (*models.BulkAssignIngredientResponse, error) {
+	if request.IngredientID <= 0 || request.Quantity <= 0 || len(request.MenuItemIDs) == 0 {
+		return nil, models.ErrInvalidBulkAssign
+	}
+	for _, id := range request.MenuItemIDs {
+		if id <= 0 {
+			return nil, models.ErrInvalidBulkAssign
+		}
+	}
+
+	assigned, err := s.menuRepo.BulkAssignIngredient(ctx, request.IngredientID, request.Quantity, request.MenuItemIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(assigned) > 0 {
+		s.cache.invalidate()
+	}
+
+	response := &models.BulkAssignIngredientResponse{
+		IngredientID: request.IngredientID,
+		Assigned:     []int{},
+		Skipped:      []int{},
+	}
+	isAssigned := make(map[int]bool, len(assigned))
+	for _, id := range assigned {
+		isAssigned[id] = true
+	}
+	seen := make(map[int]bool, len(request.MenuItemIDs))
+	for _, id := range request.MenuItemIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if isAssigned[id] {
+			response.Assigned = append(response.Assigned, id)
+		} else {
+			response.Skipped = append(response.Skipped, id)
+		}
+	}
+
+	return response, nil
 }
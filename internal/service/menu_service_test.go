@@ -0,0 +1,422 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/internal/models"
+)
+
+// fakeMenuRepo serves a fixed menu and counts the full listings it is asked for. Methods the
+// tests don't use are left to the embedded nil interface.
+type fakeMenuRepo struct {
+	dal.MenuRepository
+	items        []models.MenuItems
+	availability map[int]bool
+	unavailable  []models.UnavailableMenuItem
+	// Sales of every item in GetItemSales
+	quantitySold int
+	revenue      models.Money
+	unitCost     *float64 // nil when unknown
+	listings     int
+	// warnings are reported with every listing, as when ingredients fail to load
+	warnings []string
+	// onList runs while a listing is being read, before it is returned
+	onList func()
+}
+
+func (r *fakeMenuRepo) GetAllMenu(ctx context.Context) ([]models.MenuItems, []string, error) {
+	r.listings++
+	items := append([]models.MenuItems(nil), r.items...)
+	if r.onList != nil {
+		r.onList()
+	}
+	return items, r.warnings, nil
+}
+
+func (r *fakeMenuRepo) GetMenuAvailability(ctx context.Context) (map[int]bool, error) {
+	return r.availability, nil
+}
+
+func (r *fakeMenuRepo) GetUnavailableMenuItems(ctx context.Context) ([]models.UnavailableMenuItem, error) {
+	return r.unavailable, nil
+}
+
+func (r *fakeMenuRepo) GetMenuItemByID(ctx context.Context, id int) (models.MenuItems, error) {
+	for _, item := range r.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return models.MenuItems{}, models.ErrMenuItemNotFound
+}
+
+func (r *fakeMenuRepo) GetItemSales(ctx context.Context, menuItemID int, days int) (int, models.Money, error) {
+	return r.quantitySold, r.revenue, nil
+}
+
+func (r *fakeMenuRepo) GetUnitCost(ctx context.Context, menuItemID int) (float64, bool, error) {
+	if r.unitCost == nil {
+		return 0, false, nil
+	}
+	return *r.unitCost, true, nil
+}
+
+func (r *fakeMenuRepo) RewriteCategories(ctx context.Context, rewrite func(categories []string) []string) (int, error) {
+	updated := 0
+	for i := range r.items {
+		rewritten := rewrite(r.items[i].Category)
+		if !reflect.DeepEqual(rewritten, r.items[i].Category) {
+			r.items[i].Category = rewritten
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (r *fakeMenuRepo) UpdateMenuItem(ctx context.Context, id int, item models.MenuItems) error {
+	for i := range r.items {
+		if r.items[i].ID == id {
+			item.ID = id
+			r.items[i] = item
+		}
+	}
+	return nil
+}
+
+func newFakeMenuRepo() *fakeMenuRepo {
+	return &fakeMenuRepo{
+		items:        []models.MenuItems{{ID: 1, Name: "Latte", Price: 3.50, IsActive: true, Available: true}},
+		availability: map[int]bool{1: true},
+	}
+}
+
+func TestGetAllMenuServesCachedListing(t *testing.T) {
+	repo := newFakeMenuRepo()
+	s := NewMenuService(repo, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		items, _, err := s.GetAllMenu(ctx)
+		if err != nil {
+			t.Fatalf("GetAllMenu: %v", err)
+		}
+		if len(items) != 1 || items[0].Name != "Latte" {
+			t.Fatalf("GetAllMenu = %+v, want the latte", items)
+		}
+	}
+	if repo.listings != 1 {
+		t.Errorf("menu listed %d times, want 1", repo.listings)
+	}
+}
+
+func TestGetAllMenuReadsAvailabilityFresh(t *testing.T) {
+	repo := newFakeMenuRepo()
+	s := NewMenuService(repo, time.Minute)
+	ctx := context.Background()
+
+	if _, _, err := s.GetAllMenu(ctx); err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	repo.availability = map[int]bool{1: false}
+
+	items, _, err := s.GetAllMenu(ctx)
+	if err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	if items[0].Available {
+		t.Error("cached item still available after its stock ran out")
+	}
+	if repo.listings != 1 {
+		t.Errorf("menu listed %d times, want 1", repo.listings)
+	}
+}
+
+func TestUpdateMenuItemInvalidatesCache(t *testing.T) {
+	repo := newFakeMenuRepo()
+	s := NewMenuService(repo, time.Minute)
+	ctx := context.Background()
+
+	if _, _, err := s.GetAllMenu(ctx); err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	if err := s.UpdateMenuItem(ctx, 1, models.MenuItems{Name: "Oat Latte", Price: 4.00}); err != nil {
+		t.Fatalf("UpdateMenuItem: %v", err)
+	}
+
+	items, _, err := s.GetAllMenu(ctx)
+	if err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	if items[0].Name != "Oat Latte" {
+		t.Errorf("GetAllMenu name = %q after update, want %q", items[0].Name, "Oat Latte")
+	}
+	if repo.listings != 2 {
+		t.Errorf("menu listed %d times, want 2", repo.listings)
+	}
+}
+
+func TestRefreshMenuDoesNotCacheListingReadBeforeChange(t *testing.T) {
+	repo := newFakeMenuRepo()
+	s := NewMenuService(repo, time.Minute)
+	ctx := context.Background()
+
+	// The menu changes while the first listing is being read
+	repo.onList = func() {
+		repo.onList = nil
+		if err := s.UpdateMenuItem(ctx, 1, models.MenuItems{Name: "Oat Latte", Price: 4.00}); err != nil {
+			t.Fatalf("UpdateMenuItem: %v", err)
+		}
+	}
+	if _, _, err := s.RefreshMenu(ctx); err != nil {
+		t.Fatalf("RefreshMenu: %v", err)
+	}
+
+	items, _, err := s.GetAllMenu(ctx)
+	if err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	if items[0].Name != "Oat Latte" {
+		t.Errorf("GetAllMenu name = %q, want %q: the stale listing was cached", items[0].Name, "Oat Latte")
+	}
+}
+
+func TestGetAllMenuReturnsPartialListingUncached(t *testing.T) {
+	repo := newFakeMenuRepo()
+	repo.warnings = []string{"ingredients for menu item 1 could not be loaded: connection reset"}
+	s := NewMenuService(repo, time.Minute)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		items, warnings, err := s.GetAllMenu(ctx)
+		if err != nil {
+			t.Fatalf("GetAllMenu: %v", err)
+		}
+		if len(items) != 1 || len(warnings) != 1 {
+			t.Fatalf("GetAllMenu = %+v, %v, want the latte with the warning", items, warnings)
+		}
+	}
+	if repo.listings != 2 {
+		t.Errorf("menu listed %d times, want 2: the incomplete listing was cached", repo.listings)
+	}
+}
+
+func TestMenuCacheIsPerLocation(t *testing.T) {
+	cache := &menuCache{ttl: time.Minute}
+	cache.set(1, []models.MenuItems{{ID: 1}}, cache.currentGeneration())
+
+	if _, ok := cache.get(2); ok {
+		t.Error("location 2 served location 1's menu")
+	}
+	if items, ok := cache.get(1); !ok || len(items) != 1 {
+		t.Errorf("get(1) = %v, %v, want the cached item", items, ok)
+	}
+}
+
+func TestMenuCacheDisabledWithoutTTL(t *testing.T) {
+	cache := &menuCache{}
+	cache.set(1, []models.MenuItems{{ID: 1}}, cache.currentGeneration())
+
+	if _, ok := cache.get(1); ok {
+		t.Error("cache without a TTL served a listing")
+	}
+}
+
+// seasonMenuRepo reports a seasonal item as activated once the day it is applied for reaches opens
+type seasonMenuRepo struct {
+	fakeMenuRepo
+	opens   time.Time
+	applied []time.Time
+}
+
+func (r *seasonMenuRepo) ApplySeasonWindows(ctx context.Context, today time.Time) ([]models.SeasonalChange, error) {
+	r.applied = append(r.applied, today)
+	if today.Before(r.opens) {
+		return nil, nil
+	}
+	return []models.SeasonalChange{{MenuItemID: 1, Name: "Pumpkin Spice Latte", IsActive: true}}, nil
+}
+
+func TestRunSeasonSchedulerUsesClock(t *testing.T) {
+	repo := &seasonMenuRepo{fakeMenuRepo: *newFakeMenuRepo(), opens: time.Date(2031, 9, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMenuService(repo, time.Minute)
+	clock := time.Date(2031, 8, 31, 12, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+
+	// A cancelled context stops the scheduler after its immediate run
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := s.GetAllMenu(ctx); err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	RunSeasonScheduler(ctx, s, time.Hour, now)
+	if _, _, err := s.GetAllMenu(ctx); err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	if repo.listings != 1 {
+		t.Errorf("menu listed %d times before the window opened, want 1", repo.listings)
+	}
+
+	clock = clock.Add(12 * time.Hour)
+	RunSeasonScheduler(ctx, s, time.Hour, now)
+	if _, _, err := s.GetAllMenu(ctx); err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	if repo.listings != 2 {
+		t.Errorf("menu listed %d times after the window opened, want 2: the activation must clear the cache", repo.listings)
+	}
+
+	want := []time.Time{time.Date(2031, 8, 31, 12, 0, 0, 0, time.UTC), time.Date(2031, 9, 1, 0, 0, 0, 0, time.UTC)}
+	if len(repo.applied) != len(want) || !repo.applied[0].Equal(want[0]) || !repo.applied[1].Equal(want[1]) {
+		t.Errorf("season windows applied for %v, want %v", repo.applied, want)
+	}
+}
+
+func TestGetUnavailableMenuItemsClosestFirst(t *testing.T) {
+	repo := newFakeMenuRepo()
+	repo.unavailable = []models.UnavailableMenuItem{
+		{MenuItemID: 1, Name: "Latte", MissingFraction: 0.75},
+		{MenuItemID: 2, Name: "Espresso", MissingFraction: 0.25},
+		{MenuItemID: 3, Name: "Mocha", MissingFraction: 1},
+	}
+	s := NewMenuService(repo, time.Minute)
+
+	items, err := s.GetUnavailableMenuItems(context.Background())
+	if err != nil {
+		t.Fatalf("GetUnavailableMenuItems: %v", err)
+	}
+	for i, want := range []int{2, 1, 3} {
+		if items[i].MenuItemID != want {
+			t.Errorf("item %d = %d, want %d", i, items[i].MenuItemID, want)
+		}
+	}
+}
+
+func TestPreviewPriceChangeProjectsRevenue(t *testing.T) {
+	repo := newFakeMenuRepo()
+	// 40 lattes sold, some before the last price change
+	repo.quantitySold, repo.revenue = 40, 136
+	s := NewMenuService(repo, time.Minute)
+
+	response, err := s.PreviewPriceChange(context.Background(), 1, models.PriceWhatIfRequest{NewPrice: 4})
+	if err != nil {
+		t.Fatalf("PreviewPriceChange: %v", err)
+	}
+	if response.Days != priceWhatIfDefaultDays || response.CurrentPrice != 3.50 || response.QuantitySold != 40 {
+		t.Errorf("PreviewPriceChange = %+v, want 40 sold at 3.50 over %d days", response, priceWhatIfDefaultDays)
+	}
+	// 40 at 4.00 is 160, 24 more than the 136 taken
+	if response.ActualRevenue != 136 || response.ProjectedRevenue != 160 || response.Difference != 24 || response.DifferencePct != 17.65 {
+		t.Errorf("revenue = %v projected against %v, %v or %v%%, want 160 against 136, 24 or 17.65%%",
+			response.ProjectedRevenue, response.ActualRevenue, response.Difference, response.DifferencePct)
+	}
+
+	if _, err := s.PreviewPriceChange(context.Background(), 2, models.PriceWhatIfRequest{NewPrice: 4}); err != models.ErrInvalidMenuItemID {
+		t.Errorf("PreviewPriceChange of an unknown item error = %v, want ErrInvalidMenuItemID", err)
+	}
+}
+
+func TestGetBreakEvenUnits(t *testing.T) {
+	repo := newFakeMenuRepo()
+	s := NewMenuService(repo, time.Minute)
+	ctx := context.Background()
+
+	// A 3.50 latte costing 1.25 to make contributes 2.25, so 100.00 takes 44.4 lattes
+	unitCost := 1.25
+	repo.unitCost = &unitCost
+	response, err := s.GetBreakEven(ctx, 1, 100)
+	if err != nil {
+		t.Fatalf("GetBreakEven: %v", err)
+	}
+	if response.UnitCost != 1.25 || response.ContributionMargin != 2.25 || response.BreakEvenUnits != 45 {
+		t.Errorf("GetBreakEven = %+v, want 45 units at a margin of 2.25", response)
+	}
+
+	unitCost = 3.50
+	if _, err := s.GetBreakEven(ctx, 1, 100); err != models.ErrNoContribution {
+		t.Errorf("GetBreakEven at cost error = %v, want ErrNoContribution", err)
+	}
+	repo.unitCost = nil
+	if _, err := s.GetBreakEven(ctx, 1, 100); err != models.ErrUnknownUnitCost {
+		t.Errorf("GetBreakEven without a cost error = %v, want ErrUnknownUnitCost", err)
+	}
+}
+
+func TestNormalizeCategoriesMergesSpellings(t *testing.T) {
+	repo := newFakeMenuRepo()
+	repo.items = []models.MenuItems{
+		{ID: 1, Name: "Latte", Category: []string{"Coffee", " hot "}},
+		{ID: 2, Name: "Mocha", Category: []string{"COFFEE", "coffee", "Chocolate", ""}},
+		{ID: 3, Name: "Tea", Category: []string{"tea"}},
+	}
+	s := NewMenuService(repo, time.Minute)
+	ctx := context.Background()
+	if _, _, err := s.GetAllMenu(ctx); err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+
+	response, err := s.NormalizeCategories(ctx)
+	if err != nil {
+		t.Fatalf("NormalizeCategories: %v", err)
+	}
+	want := [][]string{{"coffee", "hot"}, {"coffee", "chocolate"}, {"tea"}}
+	for i, item := range repo.items {
+		if !reflect.DeepEqual(item.Category, want[i]) {
+			t.Errorf("%s categories = %q, want %q", item.Name, item.Category, want[i])
+		}
+	}
+	wantMerges := map[string]string{"Coffee": "coffee", " hot ": "hot", "COFFEE": "coffee", "Chocolate": "chocolate"}
+	if response.ItemsUpdated != 2 || !reflect.DeepEqual(response.Merges, wantMerges) {
+		t.Errorf("NormalizeCategories = %+v, want 2 items updated with merges %v", response, wantMerges)
+	}
+
+	// The cached menu still has the old spellings
+	if _, _, err := s.GetAllMenu(ctx); err != nil {
+		t.Fatalf("GetAllMenu: %v", err)
+	}
+	if repo.listings != 2 {
+		t.Errorf("menu listed %d times, want 2", repo.listings)
+	}
+}
+
+func TestGetMenuTreeListsItemsUnderEachCategory(t *testing.T) {
+	repo := &fakeMenuRepo{items: []models.MenuItems{
+		{ID: 1, Name: "Latte", Category: []string{"coffee", "hot"}, IsActive: true},
+		{ID: 2, Name: "Iced Latte", Category: []string{"coffee", "cold", "coffee"}, IsActive: true},
+		{ID: 3, Name: "Chai", Category: []string{"tea", "hot"}, IsActive: true},
+		{ID: 4, Name: "Mocha", Category: []string{"coffee"}, IsActive: false},
+		{ID: 5, Name: "Cookie", IsActive: true},
+	}}
+	s := NewMenuService(repo, 0)
+
+	tree, _, err := s.GetMenuTree(context.Background())
+	if err != nil {
+		t.Fatalf("GetMenuTree: %v", err)
+	}
+	// Items in several categories appear under each, once; inactive items are left out
+	want := map[string][]int{
+		"coffee":        {2, 1},
+		"cold":          {2},
+		"hot":           {3, 1},
+		"tea":           {3},
+		"uncategorized": {5},
+	}
+	var categories []string
+	for _, node := range tree.Categories {
+		categories = append(categories, node.Category)
+		var ids []int
+		for _, item := range node.Items {
+			ids = append(ids, item.ID)
+		}
+		if !reflect.DeepEqual(ids, want[node.Category]) || node.ItemCount != len(ids) {
+			t.Errorf("%s = %d items %v, want %v", node.Category, node.ItemCount, ids, want[node.Category])
+		}
+	}
+	if !reflect.DeepEqual(categories, []string{"coffee", "cold", "hot", "tea", "uncategorized"}) {
+		t.Errorf("categories = %v, want them sorted by name", categories)
+	}
+}
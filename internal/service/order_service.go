@@ -1,35 +1,130 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
 
 	"frappuccino/internal/dal"
 	"frappuccino/internal/models"
 )
 
 type OrderService interface {
-	CreateOrder(ctx context.Context, order models.Order) (int, error)
+	CreateOrder(ctx context.Context, order models.Order, idempotencyKey string) (int, bool, error)
 	GetOrder(ctx context.Context, id int) (models.Order, error)
-	ListOrders(ctx context.Context, filters models.OrderFilters) ([]models.Order, error)
+	ListOrders(ctx context.Context, filters models.OrderFilters) (models.OrderListResponse, error)
 	UpdateOrder(ctx context.Context, id int, order models.Order) error
 	DeleteOrder(ctx context.Context, id int) error
 	CloseOrder(ctx context.Context, id int) error
 	GetOrderedItemsReport(ctx context.Context, startDate, endDate string) (map[string]int, error)
 	ProcessBatchOrders(ctx context.Context, orders []models.Order) (models.BatchOrderResponse, error)
+	CheckBatchFeasibility(ctx context.Context, orders []models.Order) (models.BatchFeasibilityResponse, error)
+	GetStaleOrders(ctx context.Context, status string, olderThan time.Duration) ([]models.Order, error)
+	BulkUpdateStatus(ctx context.Context, status string, filters models.OrderFilters) (models.BulkStatusResponse, error)
+	GetQueueETA(ctx context.Context, id int) (models.QueueETAResponse, error)
+	GetOrdersByIDs(ctx context.Context, ids []int) (models.BatchGetResponse, error)
+	UpdateOrderStatus(ctx context.Context, id int, status string) (models.OrderStatusResponse, error)
+	GetOrderStatusHistory(ctx context.Context, id int) ([]models.OrderStatusHistory, error)
+	CancelOrder(ctx context.Context, id int) error
+	GetOrderInventoryTransactions(ctx context.Context, id int) (*models.OrderInventoryTransactionsResponse, error)
+}
+
+// Page sizes of ListOrders
+const (
+	defaultListOrdersLimit = 50
+	maxListOrdersLimit     = 100
+)
+
+// maxIdempotencyKeyLength caps the Idempotency-Key header of order creation
+const maxIdempotencyKeyLength = 255
+
+// maxBatchGetOrders caps the number of order IDs fetched by a single batch-get
+const maxBatchGetOrders = 100
+
+// JSONLimits bounds the size and nesting depth of free-form JSON fields
+// (special_instructions and customizations) accepted on orders
+type JSONLimits struct {
+	MaxBytes int
+	MaxDepth int
+}
+
+// DefaultJSONLimits are used when no limits are configured
+var DefaultJSONLimits = JSONLimits{
+	MaxBytes: 4096,
+	MaxDepth: 5,
+}
+
+// OrderServiceConfig holds the tunable settings of the order service
+type OrderServiceConfig struct {
+	JSONLimits         JSONLimits
+	PrepStations       int     // Number of orders prepared in parallel
+	DefaultPrepMinutes float64 // Prep time of menu items that don't define one
+	// RejectClientTimestamps fails requests that set created_at or updated_at instead of
+	// silently dropping them; timestamps are always generated by the database
+	RejectClientTimestamps bool
+	// Orders waiting at least this long are yellow, then red, on listings; green before
+	YellowAfterSeconds int
+	RedAfterSeconds    int
+}
+
+// DefaultOrderServiceConfig is used for settings that are not configured
+var DefaultOrderServiceConfig = OrderServiceConfig{
+	JSONLimits:         DefaultJSONLimits,
+	PrepStations:       2,
+	DefaultPrepMinutes: 3,
+	YellowAfterSeconds: 300,
+	RedAfterSeconds:    600,
 }
 
 type orderService struct {
 	orderRepo dal.OrderRepository
+	config    OrderServiceConfig
 }
 
-func NewOrderService(orderRepo dal.OrderRepository) OrderService {
-	return &orderService{orderRepo: orderRepo}
+func NewOrderService(orderRepo dal.OrderRepository, config OrderServiceConfig) OrderService {
+	if config.JSONLimits.MaxBytes <= 0 {
+		config.JSONLimits.MaxBytes = DefaultJSONLimits.MaxBytes
+	}
+	if config.JSONLimits.MaxDepth <= 0 {
+		config.JSONLimits.MaxDepth = DefaultJSONLimits.MaxDepth
+	}
+	if config.PrepStations <= 0 {
+		config.PrepStations = DefaultOrderServiceConfig.PrepStations
+	}
+	if config.DefaultPrepMinutes <= 0 {
+		config.DefaultPrepMinutes = DefaultOrderServiceConfig.DefaultPrepMinutes
+	}
+	if config.YellowAfterSeconds <= 0 || config.RedAfterSeconds <= config.YellowAfterSeconds {
+		config.YellowAfterSeconds = DefaultOrderServiceConfig.YellowAfterSeconds
+		config.RedAfterSeconds = DefaultOrderServiceConfig.RedAfterSeconds
+	}
+	return &orderService{orderRepo: orderRepo, config: config}
 }
 
-func (s *orderService) CreateOrder(ctx context.Context, order models.Order) (int, error) {
+// CreateOrder creates an order; replayed is set when idempotencyKey matches a recent order, whose id is returned
+func (s *orderService) CreateOrder(ctx context.Context, order models.Order, idempotencyKey string) (int, bool, error) {
 	// Validate order
 	if len(order.Items) == 0 {
-		return 0, models.ErrEmptyOrder
+		return 0, false, models.ErrEmptyOrder
+	}
+	if err := validateOrderItems(order.Items); err != nil {
+		return 0, false, err
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return 0, false, models.ErrInvalidIdempotencyKey
+	}
+	if err := s.validateOrderJSON(order); err != nil {
+		return 0, false, err
+	}
+	if err := s.clearClientTimestamps(&order); err != nil {
+		return 0, false, err
+	}
+	if order.DiscountAmount < 0 {
+		return 0, false, models.ErrInvalidDiscount
 	}
 
 	// Set default status if not provided
@@ -37,7 +132,31 @@ func (s *orderService) CreateOrder(ctx context.Context, order models.Order) (int
 		order.Status = "pending"
 	}
 
-	return s.orderRepo.CreateOrder(ctx, order)
+	return s.orderRepo.CreateOrder(ctx, order, idempotencyKey)
+}
+
+// validateOrderItems rejects items without a menu item or with a quantity below 1
+func validateOrderItems(items []models.OrderItem) error {
+	for _, item := range items {
+		if item.MenuItemID <= 0 || item.Quantity <= 0 {
+			return models.ErrInvalidOrderItem
+		}
+	}
+	return nil
+}
+
+// clearClientTimestamps zeroes created_at and updated_at decoded from a request body so
+// clients can't backdate orders, or rejects them when RejectClientTimestamps is set
+func (s *orderService) clearClientTimestamps(order *models.Order) error {
+	if order.CreatedAt.IsZero() && order.UpdatedAt.IsZero() {
+		return nil
+	}
+	if s.config.RejectClientTimestamps {
+		return models.ErrClientTimestamps
+	}
+	order.CreatedAt = time.Time{}
+	order.UpdatedAt = time.Time{}
+	return nil
 }
 
 func (s *orderService) GetOrder(ctx context.Context, id int) (models.Order, error) {
@@ -47,13 +166,51 @@ func (s *orderService) GetOrder(ctx context.Context, id int) (models.Order, erro
 	return s.orderRepo.GetOrderByID(ctx, id)
 }
 
-func (s *orderService) ListOrders(ctx context.Context, filters models.OrderFilters) ([]models.Order, error) {
+func (s *orderService) ListOrders(ctx context.Context, filters models.OrderFilters) (models.OrderListResponse, error) {
 	// Validate date range if both are provided
 	if !filters.StartDate.IsZero() && !filters.EndDate.IsZero() && filters.StartDate.After(filters.EndDate) {
-		return nil, models.ErrInvalidDateRange
+		return models.OrderListResponse{}, models.ErrInvalidDateRange
+	}
+	if filters.Limit == 0 {
+		filters.Limit = defaultListOrdersLimit
+	}
+	if filters.Limit < 0 || filters.Limit > maxListOrdersLimit {
+		return models.OrderListResponse{}, models.ErrInvalidLimit
+	}
+
+	response, err := s.orderRepo.GetAllOrders(ctx, filters)
+	if err != nil {
+		return models.OrderListResponse{}, err
+	}
+	s.setElapsed(response.Orders, time.Now())
+	return response, nil
+}
+
+// setElapsed fills in how long each order still being worked on has waited and its urgency
+func (s *orderService) setElapsed(orders []models.Order, now time.Time) {
+	for i := range orders {
+		orders[i].ElapsedSeconds, orders[i].Urgency = s.elapsed(orders[i].Status, orders[i].CreatedAt, now)
 	}
+}
 
-	return s.orderRepo.GetAllOrders(ctx, filters)
+// elapsed returns the seconds since createdAt and their urgency, or nothing for delivered and cancelled orders
+func (s *orderService) elapsed(status string, createdAt, now time.Time) (*int64, string) {
+	if status == "delivered" || status == "cancelled" {
+		return nil, ""
+	}
+
+	seconds := int64(now.Sub(createdAt).Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+	urgency := "green"
+	switch {
+	case seconds >= int64(s.config.RedAfterSeconds):
+		urgency = "red"
+	case seconds >= int64(s.config.YellowAfterSeconds):
+		urgency = "yellow"
+	}
+	return &seconds, urgency
 }
 
 func (s *orderService) UpdateOrder(ctx context.Context, id int, order models.Order) error {
@@ -63,6 +220,21 @@ func (s *orderService) UpdateOrder(ctx context.Context, id int, order models.Ord
 	if len(order.Items) == 0 {
 		return models.ErrEmptyOrder
 	}
+	if err := validateOrderItems(order.Items); err != nil {
+		return err
+	}
+	if err := s.validateOrderJSON(order); err != nil {
+		return err
+	}
+	if err := s.clearClientTimestamps(&order); err != nil {
+		return err
+	}
+	if order.Status != "" && !models.OrderStatuses[order.Status] {
+		return models.ErrInvalidOrderStatus
+	}
+	if order.DiscountAmount < 0 {
+		return models.ErrInvalidDiscount
+	}
 
 	return s.orderRepo.UpdateOrder(ctx, id, order)
 }
@@ -85,17 +257,242 @@ func (s *orderService) GetOrderedItemsReport(ctx context.Context, startDate, end
 	return s.orderRepo.GetNumberOfOrderedItems(ctx, startDate, endDate)
 }
 
+func (s *orderService) UpdateOrderStatus(ctx context.Context, id int, status string) (models.OrderStatusResponse, error) {
+	if id <= 0 {
+		return models.OrderStatusResponse{}, models.ErrInvalidOrderID
+	}
+	if !models.OrderStatuses[status] {
+		return models.OrderStatusResponse{}, models.ErrInvalidOrderStatus
+	}
+	return s.orderRepo.UpdateOrderStatus(ctx, id, status)
+}
+
+func (s *orderService) CancelOrder(ctx context.Context, id int) error {
+	if id <= 0 {
+		return models.ErrInvalidOrderID
+	}
+	return s.orderRepo.CancelOrder(ctx, id)
+}
+
+func (s *orderService) GetOrderStatusHistory(ctx context.Context, id int) ([]models.OrderStatusHistory, error) {
+	if id <= 0 {
+		return nil, models.ErrInvalidOrderID
+	}
+	return s.orderRepo.GetOrderStatusHistory(ctx, id)
+}
+
+func (s *orderService) GetOrderInventoryTransactions(ctx context.Context, id int) (*models.OrderInventoryTransactionsResponse, error) {
+	if id <= 0 {
+		return nil, models.ErrInvalidOrderID
+	}
+
+	transactions, err := s.orderRepo.GetOrderInventoryTransactions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.OrderInventoryTransactionsResponse{
+		OrderID:      id,
+		Transactions: make(map[string][]models.InventoryTransaction),
+	}
+	for _, t := range transactions {
+		response.Transactions[t.TransactionType] = append(response.Transactions[t.TransactionType], t)
+	}
+
+	return response, nil
+}
+
 func (s *orderService) ProcessBatchOrders(ctx context.Context, orders []models.Order) (models.BatchOrderResponse, error) {
 	if len(orders) == 0 {
 		return models.BatchOrderResponse{}, models.ErrEmptyBatch
 	}
 
 	// Validate each order in the batch
-	for _, order := range orders {
+	for i, order := range orders {
 		if len(order.Items) == 0 {
 			return models.BatchOrderResponse{}, models.ErrEmptyOrder
 		}
+		if err := validateOrderItems(order.Items); err != nil {
+			return models.BatchOrderResponse{}, err
+		}
+		if err := s.validateOrderJSON(order); err != nil {
+			return models.BatchOrderResponse{}, err
+		}
+		if err := s.clearClientTimestamps(&orders[i]); err != nil {
+			return models.BatchOrderResponse{}, err
+		}
+	}
+
+	response, err := s.orderRepo.BatchProcessOrders(ctx, orders)
+	if err != nil {
+		return models.BatchOrderResponse{}, err
+	}
+
+	for _, processed := range response.ProcessedOrders {
+		if processed.Rejected {
+			log.Printf("batch order for %s rejected: %s request_id=%s", processed.CustomerName, processed.RejectReason, models.RequestIDFromContext(ctx))
+		}
+	}
+
+	return response, nil
+}
+
+func (s *orderService) CheckBatchFeasibility(ctx context.Context, orders []models.Order) (models.BatchFeasibilityResponse, error) {
+	if len(orders) == 0 {
+		return models.BatchFeasibilityResponse{}, models.ErrEmptyBatch
+	}
+
+	for _, order := range orders {
+		if len(order.Items) == 0 {
+			return models.BatchFeasibilityResponse{}, models.ErrEmptyOrder
+		}
+		if err := validateOrderItems(order.Items); err != nil {
+			return models.BatchFeasibilityResponse{}, err
+		}
+	}
+
+	return s.orderRepo.CheckBatchFeasibility(ctx, orders)
+}
+
+func (s *orderService) GetStaleOrders(ctx context.Context, status string, olderThan time.Duration) ([]models.Order, error) {
+	if !models.OrderStatuses[status] {
+		return nil, models.ErrInvalidOrderStatus
+	}
+	if olderThan <= 0 {
+		return nil, models.ErrInvalidOlderThan
+	}
+	orders, err := s.orderRepo.GetStaleOrders(ctx, status, olderThan)
+	if err != nil {
+		return nil, err
+	}
+	s.setElapsed(orders, time.Now())
+	return orders, nil
+}
+
+func (s *orderService) BulkUpdateStatus(ctx context.Context, status string, filters models.OrderFilters) (models.BulkStatusResponse, error) {
+	if !models.OrderStatuses[status] {
+		return models.BulkStatusResponse{}, models.ErrInvalidOrderStatus
+	}
+	if filters.Status != "" && !models.OrderStatuses[filters.Status] {
+		return models.BulkStatusResponse{}, models.ErrInvalidOrderStatus
+	}
+	if !filters.StartDate.IsZero() && !filters.EndDate.IsZero() && filters.StartDate.After(filters.EndDate) {
+		return models.BulkStatusResponse{}, models.ErrInvalidDateRange
+	}
+	return s.orderRepo.BulkUpdateStatus(ctx, status, filters)
+}
+
+func (s *orderService) GetOrdersByIDs(ctx context.Context, ids []int) (models.BatchGetResponse, error) {
+	if len(ids) == 0 || len(ids) > maxBatchGetOrders {
+		return models.BatchGetResponse{}, models.ErrInvalidOrderIDs
+	}
+	for _, id := range ids {
+		if id <= 0 {
+			return models.BatchGetResponse{}, models.ErrInvalidOrderIDs
+		}
+	}
+
+	orders, err := s.orderRepo.GetOrdersByIDs(ctx, ids)
+	if err != nil {
+		return models.BatchGetResponse{}, err
+	}
+
+	found := make(map[int]bool, len(orders))
+	for _, order := range orders {
+		found[order.ID] = true
+	}
+
+	response := models.BatchGetResponse{
+		Orders:   orders,
+		NotFound: []int{},
+	}
+	if response.Orders == nil {
+		response.Orders = []models.Order{}
+	}
+	for _, id := range ids {
+		if !found[id] {
+			response.NotFound = append(response.NotFound, id)
+			found[id] = true // report duplicates once
+		}
+	}
+
+	return response, nil
+}
+
+func (s *orderService) GetQueueETA(ctx context.Context, id int) (models.QueueETAResponse, error) {
+	if id <= 0 {
+		return models.QueueETAResponse{}, models.ErrInvalidOrderID
+	}
+
+	eta, err := s.orderRepo.GetQueuePosition(ctx, id, s.config.DefaultPrepMinutes)
+	if err != nil {
+		return models.QueueETAResponse{}, err
+	}
+
+	eta.PrepStations = s.config.PrepStations
+	switch eta.Status {
+	case "pending", "accepted", "preparing":
+		// Work ahead plus the order itself is shared across the prep stations
+		eta.EstimatedMinutes = (eta.MinutesAhead + eta.OwnPrepMinutes) / float64(eta.PrepStations)
+	default:
+		// Ready, delivered and cancelled orders are no longer in the queue
+		eta.OrdersAhead = 0
+		eta.MinutesAhead = 0
+	}
+	now := time.Now()
+	eta.EstimatedReadyAt = now.Add(time.Duration(eta.EstimatedMinutes * float64(time.Minute)))
+	eta.ElapsedSeconds, eta.Urgency = s.elapsed(eta.Status, eta.CreatedAt, now)
+
+	return eta, nil
+}
+
+// validateOrderJSON checks special instructions and item customizations against the configured limits
+func (s *orderService) validateOrderJSON(order models.Order) error {
+	if err := validateJSONField(order.SpecialInstructions, s.config.JSONLimits); err != nil {
+		return err
+	}
+	for _, item := range order.Items {
+		if err := validateJSONField(item.Customizations, s.config.JSONLimits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateJSONField(raw json.RawMessage, limits JSONLimits) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if len(raw) > limits.MaxBytes {
+		return models.ErrJSONTooLarge
+	}
+	// The token walk below stops quietly at the end of a truncated value
+	if !json.Valid(raw) {
+		return models.ErrInvalidJSON
+	}
+
+	// Walk the tokens to find the deepest nesting of objects and arrays
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return models.ErrInvalidJSON
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > limits.MaxDepth {
+				return models.ErrJSONTooDeep
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
 	}
 
-	return s.orderRepo.BatchProcessOrders(ctx, orders)
+	return nil
 }
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/internal/models"
+)
+
+// fakeOrderRepo records the orders that reach it. Methods the tests don't use are left to the
+// embedded nil interface.
+type fakeOrderRepo struct {
+	dal.OrderRepository
+	created []models.Order
+	queue   models.QueueETAResponse
+	orders  map[int]models.Order
+	ledger  []models.InventoryTransaction
+}
+
+func (r *fakeOrderRepo) CreateOrder(ctx context.Context, order models.Order, idempotencyKey string) (int, bool, error) {
+	r.created = append(r.created, order)
+	return len(r.created), false, nil
+}
+
+func (r *fakeOrderRepo) GetQueuePosition(ctx context.Context, id int, defaultPrepMinutes float64) (models.QueueETAResponse, error) {
+	return r.queue, nil
+}
+
+func (r *fakeOrderRepo) GetOrdersByIDs(ctx context.Context, ids []int) ([]models.Order, error) {
+	var orders []models.Order
+	for _, id := range ids {
+		if order, ok := r.orders[id]; ok {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (r *fakeOrderRepo) GetOrderInventoryTransactions(ctx context.Context, id int) ([]models.InventoryTransaction, error) {
+	return r.ledger, nil
+}
+
+func TestCreateOrderLimitsJSONFields(t *testing.T) {
+	repo := &fakeOrderRepo{}
+	s := NewOrderService(repo, OrderServiceConfig{JSONLimits: JSONLimits{MaxBytes: 64, MaxDepth: 3}})
+
+	tests := []struct {
+		name           string
+		instructions   string
+		customizations string
+		want           error
+	}{
+		{"within limits", `{"note": "extra hot"}`, `{"milk": {"type": "oat"}}`, nil},
+		{"oversized instructions", `{"note": "` + strings.Repeat("a", 64) + `"}`, ``, models.ErrJSONTooLarge},
+		{"oversized customizations", ``, `["` + strings.Repeat("a", 64) + `"]`, models.ErrJSONTooLarge},
+		{"deeply nested instructions", `{"a": {"b": {"c": {"d": 1}}}}`, ``, models.ErrJSONTooDeep},
+		{"deeply nested customizations", ``, `[[[[1]]]]`, models.ErrJSONTooDeep},
+		{"invalid JSON", `{"note": `, ``, models.ErrInvalidJSON},
+	}
+	for _, tt := range tests {
+		order := models.Order{Items: []models.OrderItem{{MenuItemID: 1, Quantity: 1}}}
+		if tt.instructions != "" {
+			order.SpecialInstructions = []byte(tt.instructions)
+		}
+		if tt.customizations != "" {
+			order.Items[0].Customizations = []byte(tt.customizations)
+		}
+		if _, _, err := s.CreateOrder(context.Background(), order, ""); err != tt.want {
+			t.Errorf("%s: CreateOrder error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if len(repo.created) != 1 {
+		t.Errorf("%d orders reached the repository, want only the one within limits", len(repo.created))
+	}
+}
+
+func TestOrderItemsNeedMenuItemAndPositiveQuantity(t *testing.T) {
+	// The repository only implements CreateOrder, so any invalid order getting past validation fails the test
+	repo := &fakeOrderRepo{}
+	s := NewOrderService(repo, DefaultOrderServiceConfig)
+	ctx := context.Background()
+	valid := models.Order{Items: []models.OrderItem{{MenuItemID: 1, Quantity: 1}}}
+
+	for _, item := range []models.OrderItem{
+		{MenuItemID: 1, Quantity: 0},
+		{MenuItemID: 1, Quantity: -2},
+		{MenuItemID: 0, Quantity: 1},
+	} {
+		order := models.Order{Items: []models.OrderItem{{MenuItemID: 2, Quantity: 1}, item}}
+		if _, _, err := s.CreateOrder(ctx, order, ""); err != models.ErrInvalidOrderItem {
+			t.Errorf("CreateOrder with %+v error = %v, want ErrInvalidOrderItem", item, err)
+		}
+		if err := s.UpdateOrder(ctx, 1, order); err != models.ErrInvalidOrderItem {
+			t.Errorf("UpdateOrder with %+v error = %v, want ErrInvalidOrderItem", item, err)
+		}
+		// One invalid order rejects the whole batch
+		if _, err := s.ProcessBatchOrders(ctx, []models.Order{valid, order}); err != models.ErrInvalidOrderItem {
+			t.Errorf("ProcessBatchOrders with %+v error = %v, want ErrInvalidOrderItem", item, err)
+		}
+		if _, err := s.CheckBatchFeasibility(ctx, []models.Order{valid, order}); err != models.ErrInvalidOrderItem {
+			t.Errorf("CheckBatchFeasibility with %+v error = %v, want ErrInvalidOrderItem", item, err)
+		}
+	}
+	if len(repo.created) != 0 {
+		t.Errorf("%d orders reached the repository, want none", len(repo.created))
+	}
+}
+
+func TestGetQueueETASharesWorkAcrossStations(t *testing.T) {
+	repo := &fakeOrderRepo{queue: models.QueueETAResponse{
+		OrderID:        4,
+		Status:         "pending",
+		CreatedAt:      time.Now(),
+		OrdersAhead:    2,
+		MinutesAhead:   11,
+		OwnPrepMinutes: 4,
+	}}
+	config := DefaultOrderServiceConfig
+	config.PrepStations = 3
+	s := NewOrderService(repo, config)
+
+	eta, err := s.GetQueueETA(context.Background(), 4)
+	if err != nil {
+		t.Fatalf("GetQueueETA: %v", err)
+	}
+	// 11 minutes ahead plus the order's own 4, over 3 stations
+	if eta.EstimatedMinutes != 5 || eta.PrepStations != 3 {
+		t.Errorf("GetQueueETA = %+v, want 5 minutes over 3 stations", eta)
+	}
+	if until := time.Until(eta.EstimatedReadyAt); until < 4*time.Minute || until > 5*time.Minute {
+		t.Errorf("EstimatedReadyAt is %v away, want 5 minutes", until)
+	}
+
+	// Orders out of the queue have nothing ahead of them
+	repo.queue.Status = "ready"
+	eta, err = s.GetQueueETA(context.Background(), 4)
+	if err != nil {
+		t.Fatalf("GetQueueETA: %v", err)
+	}
+	if eta.EstimatedMinutes != 0 || eta.OrdersAhead != 0 {
+		t.Errorf("GetQueueETA of a ready order = %+v, want no wait", eta)
+	}
+}
+
+func TestGetOrdersByIDsReportsMissingIDs(t *testing.T) {
+	repo := &fakeOrderRepo{orders: map[int]models.Order{1: {ID: 1}, 3: {ID: 3}}}
+	s := NewOrderService(repo, DefaultOrderServiceConfig)
+
+	response, err := s.GetOrdersByIDs(context.Background(), []int{1, 2, 3, 4, 2})
+	if err != nil {
+		t.Fatalf("GetOrdersByIDs: %v", err)
+	}
+	if len(response.Orders) != 2 || response.Orders[0].ID != 1 || response.Orders[1].ID != 3 {
+		t.Errorf("orders = %+v, want 1 and 3", response.Orders)
+	}
+	// Duplicated missing IDs are reported once
+	if len(response.NotFound) != 2 || response.NotFound[0] != 2 || response.NotFound[1] != 4 {
+		t.Errorf("not found = %v, want [2 4]", response.NotFound)
+	}
+
+	for _, ids := range [][]int{nil, {1, 0}} {
+		if _, err := s.GetOrdersByIDs(context.Background(), ids); err != models.ErrInvalidOrderIDs {
+			t.Errorf("GetOrdersByIDs(%v) error = %v, want ErrInvalidOrderIDs", ids, err)
+		}
+	}
+}
+
+func TestGetOrderInventoryTransactionsGroupsByType(t *testing.T) {
+	repo := &fakeOrderRepo{ledger: []models.InventoryTransaction{
+		{ID: 1, TransactionType: "order_usage", Delta: -300},
+		{ID: 2, TransactionType: "order_usage", Delta: -18},
+		{ID: 3, TransactionType: "order_deletion", Delta: 300},
+	}}
+	s := NewOrderService(repo, DefaultOrderServiceConfig)
+
+	response, err := s.GetOrderInventoryTransactions(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("GetOrderInventoryTransactions: %v", err)
+	}
+	usage, deletion := response.Transactions["order_usage"], response.Transactions["order_deletion"]
+	if response.OrderID != 7 || len(usage) != 2 || len(deletion) != 1 || deletion[0].ID != 3 {
+		t.Errorf("response = %+v, want two usages and one deletion of order 7", response)
+	}
+
+	if _, err := s.GetOrderInventoryTransactions(context.Background(), 0); err != models.ErrInvalidOrderID {
+		t.Errorf("error = %v, want ErrInvalidOrderID", err)
+	}
+}
+
+func TestCreateOrderDropsClientTimestamps(t *testing.T) {
+	backdated := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	order := models.Order{
+		Items:     []models.OrderItem{{MenuItemID: 1, Quantity: 1}},
+		CreatedAt: backdated,
+		UpdatedAt: backdated,
+	}
+
+	repo := &fakeOrderRepo{}
+	s := NewOrderService(repo, DefaultOrderServiceConfig)
+	if _, _, err := s.CreateOrder(context.Background(), order, ""); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if created := repo.created[0]; !created.CreatedAt.IsZero() || !created.UpdatedAt.IsZero() {
+		t.Errorf("timestamps = %v, %v, want them left to the database", created.CreatedAt, created.UpdatedAt)
+	}
+
+	config := DefaultOrderServiceConfig
+	config.RejectClientTimestamps = true
+	s = NewOrderService(&fakeOrderRepo{}, config)
+	if _, _, err := s.CreateOrder(context.Background(), order, ""); err != models.ErrClientTimestamps {
+		t.Errorf("CreateOrder error = %v, want ErrClientTimestamps", err)
+	}
+}
+
+func TestSetElapsedClassifiesUrgency(t *testing.T) {
+	s := NewOrderService(&fakeOrderRepo{}, OrderServiceConfig{YellowAfterSeconds: 60, RedAfterSeconds: 180}).(*orderService)
+	now := time.Date(2031, time.March, 3, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		status      string
+		age         time.Duration
+		wantSeconds int64
+		wantUrgency string
+	}{
+		{"pending", 30 * time.Second, 30, "green"},
+		{"preparing", time.Minute, 60, "yellow"},
+		{"preparing", 179 * time.Second, 179, "yellow"},
+		{"ready", 3 * time.Minute, 180, "red"},
+		// A clock ahead of the database doesn't give negative ages
+		{"pending", -5 * time.Second, 0, "green"},
+	}
+	orders := make([]models.Order, len(tests))
+	for i, tt := range tests {
+		orders[i] = models.Order{Status: tt.status, CreatedAt: now.Add(-tt.age)}
+	}
+	orders = append(orders,
+		models.Order{Status: "delivered", CreatedAt: now.Add(-time.Hour)},
+		models.Order{Status: "cancelled", CreatedAt: now.Add(-time.Hour)},
+	)
+
+	s.setElapsed(orders, now)
+	for i, tt := range tests {
+		got := orders[i]
+		if got.ElapsedSeconds == nil {
+			t.Errorf("%s order %v old has no elapsed time, want %d seconds", tt.status, tt.age, tt.wantSeconds)
+			continue
+		}
+		if *got.ElapsedSeconds != tt.wantSeconds || got.Urgency != tt.wantUrgency {
+			t.Errorf("%s order %v old = %d seconds, %q, want %d, %q", tt.status, tt.age, *got.ElapsedSeconds, got.Urgency, tt.wantSeconds, tt.wantUrgency)
+		}
+	}
+	for _, got := range orders[len(tests):] {
+		if got.ElapsedSeconds != nil {
+			t.Errorf("%s order elapsed = %d seconds, want none", got.Status, *got.ElapsedSeconds)
+		}
+		if got.Urgency != "" {
+			t.Errorf("%s order urgency = %q, want none", got.Status, got.Urgency)
+		}
+	}
+}
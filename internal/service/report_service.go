@@ -3,6 +3,10 @@ package service
 import (
 	"context"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"frappuccino/internal/dal"
@@ -12,16 +16,98 @@ import (
 type ReportService interface {
 	GetTotalSales(ctx context.Context, startDate, endDate string) (*models.TotalSalesResponse, error)
 	GetPopularItems(ctx context.Context, limit int) ([]models.PopularItem, error)
+	RefreshPopularItems(ctx context.Context, limit int) ([]models.PopularItem, error)
 	GetOrderedItemsByPeriod(ctx context.Context, period string, month time.Month, year int) (*models.PeriodReportResponse, error)
 	Search(ctx context.Context, query string, filter string, minPrice float64, maxPrice float64) (*models.SearchResult, error)
+	GetOrderRate(ctx context.Context, window time.Duration) (*models.OrderRateResponse, error)
+	GetCostVariance(ctx context.Context, startDate, endDate time.Time) (*models.CostVarianceResponse, error)
+	GetRestockHistory(ctx context.Context, ingredientID int, startDate, endDate time.Time) (*models.RestockHistoryResponse, error)
+	GetSalesPerLaborHour(ctx context.Context, days []models.LaborDay) (*models.SalesPerLaborHourResponse, error)
+	GetTargetAttainment(ctx context.Context, request models.TargetAttainmentRequest) (*models.TargetAttainmentResponse, error)
+	GetSalesTrend(ctx context.Context, granularity string, startDate, endDate time.Time) (*models.SalesTrendResponse, error)
+	GetRefundTrend(ctx context.Context, granularity string, startDate, endDate time.Time) (*models.RefundTrendResponse, error)
+	GetLowMarginItems(ctx context.Context, threshold float64) (*models.LowMarginResponse, error)
+	GetPriceAudit(ctx context.Context, startDate, endDate time.Time) (*models.PriceAuditResponse, error)
+	GetTotalMismatches(ctx context.Context) ([]models.TotalMismatch, error)
+	GetStaffingRecommendation(ctx context.Context, date time.Time, ordersPerStaff int) (*models.StaffingRecommendationResponse, error)
+	GetProfitableHours(ctx context.Context, startDate, endDate time.Time) (*models.ProfitableHoursResponse, error)
+	GetSalesAnomalies(ctx context.Context, date time.Time, stdDevs float64, baselineDays int) (*models.SalesAnomalyResponse, error)
+	GetMenuContribution(ctx context.Context, startDate, endDate time.Time) (*models.MenuContributionResponse, error)
+	GetOrderSizeDistribution(ctx context.Context, bounds []float64) (*models.OrderSizeDistributionResponse, error)
+	GetSalesByPaymentMethod(ctx context.Context, startDate, endDate time.Time) (*models.SalesByPaymentResponse, error)
+	GetRepeatRate(ctx context.Context, startDate, endDate time.Time) (*models.RepeatRateResponse, error)
+	GetCustomerSpending(ctx context.Context, customerID int) (*models.CustomerSpendingResponse, error)
+	GetDiscountSummary(ctx context.Context, startDate, endDate time.Time) (*models.DiscountSummaryResponse, error)
 }
 
+// staffingLookbackWeeks is how many past occurrences of a weekday staffing recommendations are based on
+const staffingLookbackWeeks = 8
+
+// maxAnomalyBaselineDays caps the trailing window sales anomalies are measured against
+const maxAnomalyBaselineDays = 365
+
+// maxOrderSizeBuckets caps the bounds an order size distribution may be split at
+const maxOrderSizeBuckets = 20
+
 type reportService struct {
-	repo dal.ReportRepository
+	repo         dal.ReportRepository
+	popularCache *popularItemsCache
+}
+
+// NewReportService creates a report service whose popular items are cached for popularCacheTTL;
+// a zero popularCacheTTL disables caching
+func NewReportService(repo dal.ReportRepository, popularCacheTTL time.Duration) ReportService {
+	return &reportService{repo: repo, popularCache: &popularItemsCache{ttl: popularCacheTTL}}
+}
+
+// popularItemsCache holds the popular items per location and limit until they expire, so dashboards
+// polling the endpoint don't scan every order each time
+type popularItemsCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[popularItemsKey]popularItemsEntry
+}
+
+type popularItemsKey struct {
+	locationID int
+	limit      int
 }
 
-func NewReportService(repo dal.ReportRepository) ReportService {
-	return &reportService{repo: repo}
+type popularItemsEntry struct {
+	items   []models.PopularItem
+	expires time.Time
+}
+
+func (c *popularItemsCache) get(key popularItemsKey) ([]models.PopularItem, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.items, true
+}
+
+func (c *popularItemsCache) set(key popularItemsKey, items []models.PopularItem) {
+	if c.ttl <= 0 {
+		return
+	}
+	if items == nil {
+		items = []models.PopularItem{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[popularItemsKey]popularItemsEntry)
+	}
+	// Expired entries of other keys are dropped so the map stays small
+	now := time.Now()
+	for cached, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, cached)
+		}
+	}
+	c.entries[key] = popularItemsEntry{items: items, expires: now.Add(c.ttl)}
 }
 
 func (s *reportService) GetTotalSales(ctx context.Context, startDate, endDate string) (*models.TotalSalesResponse, error) {
@@ -31,13 +117,39 @@ func (s *reportService) GetTotalSales(ctx context.Context, startDate, endDate st
 	}
 
 	return &models.TotalSalesResponse{
-		TotalSales: total,
+		TotalSales: models.Money(total),
 		StartDate:  startDate,
 		EndDate:    endDate,
 	}, nil
 }
 
+func (s *reportService) GetOrderRate(ctx context.Context, window time.Duration) (*models.OrderRateResponse, error) {
+	if window <= 0 {
+		return nil, models.ErrInvalidWindow
+	}
+
+	count, err := s.repo.GetOrderCountInWindow(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OrderRateResponse{
+		Window:          window.String(),
+		OrderCount:      count,
+		OrdersPerMinute: float64(count) / window.Minutes(),
+	}, nil
+}
+
+// GetPopularItems serves the popular items from cache when possible. The returned items are shared and must not be modified.
 func (s *reportService) GetPopularItems(ctx context.Context, limit int) ([]models.PopularItem, error) {
+	if items, ok := s.popularCache.get(popularItemsKey{models.LocationIDFromContext(ctx), limit}); ok {
+		return items, nil
+	}
+	return s.RefreshPopularItems(ctx, limit)
+}
+
+// RefreshPopularItems recomputes the popular items from the orders and caches them
+func (s *reportService) RefreshPopularItems(ctx context.Context, limit int) ([]models.PopularItem, error) {
 	items, err := s.repo.GetPopularItems(ctx, limit)
 	if err != nil {
 		return nil, err
@@ -56,6 +168,7 @@ func (s *reportService) GetPopularItems(ctx context.Context, limit int) ([]model
 		}
 	}
 
+	s.popularCache.set(popularItemsKey{models.LocationIDFromContext(ctx), limit}, items)
 	return items, nil
 }
 
@@ -82,10 +195,10 @@ func (s *reportService) Search(
 
 	// Validate price range
 	if minPrice < 0 || maxPrice < 0 {
-		return nil, fmt.Errorf("price values cannot be negative")
+		return nil, fmt.Errorf("%w: price values cannot be negative", models.ErrInvalidPriceRange)
 	}
 	if maxPrice > 0 && minPrice > maxPrice {
-		return nil, fmt.Errorf("minPrice cannot be greater than maxPrice")
+		return nil, fmt.Errorf("%w: minPrice cannot be greater than maxPrice", models.ErrInvalidPriceRange)
 	}
 
 	result, err := s.repo.GetFullTextSearch(ctx, query, filter, minPrice, maxPrice)
@@ -95,3 +208,593 @@ func (s *reportService) Search(
 
 	return &result, nil
 }
+
+func (s *reportService) GetCostVariance(ctx context.Context, startDate, endDate time.Time) (*models.CostVarianceResponse, error) {
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	ingredients, menuItems, err := s.repo.GetCostVariance(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CostVarianceResponse{
+		StartDate:   startDate.Format("2006-01-02"),
+		EndDate:     endDate.Format("2006-01-02"),
+		Ingredients: ingredients,
+		MenuItems:   menuItems,
+	}, nil
+}
+
+func (s *reportService) GetRestockHistory(ctx context.Context, ingredientID int, startDate, endDate time.Time) (*models.RestockHistoryResponse, error) {
+	if !startDate.IsZero() && !endDate.IsZero() && startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	restocks, err := s.repo.GetRestockHistory(ctx, ingredientID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Aggregate per supplier; restocks are ordered by time
+	suppliers := []models.SupplierRestockStats{}
+	supplierIndex := make(map[string]int)
+	for _, restock := range restocks {
+		idx, ok := supplierIndex[restock.Supplier]
+		if !ok {
+			idx = len(suppliers)
+			supplierIndex[restock.Supplier] = idx
+			suppliers = append(suppliers, models.SupplierRestockStats{
+				Supplier:     restock.Supplier,
+				FirstRestock: restock.CreatedAt,
+			})
+		}
+		suppliers[idx].RestockCount++
+		suppliers[idx].TotalQuantity += restock.Quantity
+		suppliers[idx].LastRestock = restock.CreatedAt
+	}
+
+	for i := range suppliers {
+		stats := &suppliers[i]
+		stats.AverageQuantity = stats.TotalQuantity / float64(stats.RestockCount)
+		if stats.RestockCount > 1 {
+			stats.AverageDaysBetween = stats.LastRestock.Sub(stats.FirstRestock).Hours() / 24 / float64(stats.RestockCount-1)
+		}
+	}
+
+	return &models.RestockHistoryResponse{
+		Restocks:  restocks,
+		Suppliers: suppliers,
+	}, nil
+}
+
+func (s *reportService) GetSalesPerLaborHour(ctx context.Context, days []models.LaborDay) (*models.SalesPerLaborHourResponse, error) {
+	if len(days) == 0 {
+		return nil, models.ErrEmptyStaffing
+	}
+
+	// Validate input and find the covered range
+	laborHours := make(map[string]float64, len(days))
+	var startDate, endDate time.Time
+	for _, day := range days {
+		date, err := time.Parse("2006-01-02", day.Date)
+		if err != nil {
+			return nil, models.ErrInvalidDate
+		}
+		if day.LaborHours <= 0 {
+			return nil, models.ErrInvalidLaborHours
+		}
+		laborHours[day.Date] += day.LaborHours
+		if startDate.IsZero() || date.Before(startDate) {
+			startDate = date
+		}
+		if endDate.IsZero() || date.After(endDate) {
+			endDate = date
+		}
+	}
+
+	trends, err := s.repo.GetDailySales(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	salesByDay := make(map[string]models.SalesTrend, len(trends))
+	for _, trend := range trends {
+		salesByDay[trend.Date.Format("2006-01-02")] = trend
+	}
+
+	response := &models.SalesPerLaborHourResponse{Days: []models.LaborDayProductivity{}}
+	for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+		key := date.Format("2006-01-02")
+		hours, staffed := laborHours[key]
+		if !staffed {
+			continue
+		}
+
+		sales := salesByDay[key]
+		response.Days = append(response.Days, models.LaborDayProductivity{
+			Date:              key,
+			Sales:             sales.TotalSales,
+			OrderCount:        sales.OrderCount,
+			LaborHours:        hours,
+			SalesPerLaborHour: sales.TotalSales / models.Money(hours),
+		})
+		response.TotalSales += sales.TotalSales
+		response.TotalLaborHours += hours
+	}
+	response.SalesPerLaborHour = response.TotalSales / models.Money(response.TotalLaborHours)
+
+	return response, nil
+}
+
+// maxTargetAttainmentDays bounds the range of a target attainment report
+const maxTargetAttainmentDays = 366
+
+func (s *reportService) GetTargetAttainment(ctx context.Context, request models.TargetAttainmentRequest) (*models.TargetAttainmentResponse, error) {
+	startDate, err := time.Parse("2006-01-02", request.StartDate)
+	if err != nil {
+		return nil, models.ErrInvalidDate
+	}
+	endDate, err := time.Parse("2006-01-02", request.EndDate)
+	if err != nil {
+		return nil, models.ErrInvalidDate
+	}
+	if endDate.Before(startDate) || endDate.Sub(startDate) >= maxTargetAttainmentDays*24*time.Hour {
+		return nil, models.ErrInvalidDateRange
+	}
+	if request.DailyTarget < 0 {
+		return nil, models.ErrInvalidSalesTarget
+	}
+
+	targets := make(map[string]models.Money, len(request.Targets))
+	for _, target := range request.Targets {
+		date, err := time.Parse("2006-01-02", target.Date)
+		if err != nil {
+			return nil, models.ErrInvalidDate
+		}
+		if target.Target <= 0 || date.Before(startDate) || date.After(endDate) {
+			return nil, models.ErrInvalidSalesTarget
+		}
+		targets[target.Date] = target.Target
+	}
+
+	trends, err := s.repo.GetDailySales(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	salesByDay := make(map[string]models.Money, len(trends))
+	for _, trend := range trends {
+		salesByDay[trend.Date.Format("2006-01-02")] = trend.TotalSales
+	}
+
+	response := &models.TargetAttainmentResponse{
+		StartDate: request.StartDate,
+		EndDate:   request.EndDate,
+		Days:      []models.DayAttainment{},
+	}
+	for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+		key := date.Format("2006-01-02")
+		target, ok := targets[key]
+		if !ok {
+			target = request.DailyTarget
+		}
+		if target <= 0 {
+			return nil, models.ErrInvalidSalesTarget
+		}
+
+		sales := salesByDay[key]
+		response.TotalSales += sales
+		response.TotalTarget += target
+		response.Days = append(response.Days, models.DayAttainment{
+			Date:                        key,
+			Sales:                       sales,
+			Target:                      target,
+			AttainmentPercent:           attainmentPercent(sales, target),
+			CumulativeSales:             response.TotalSales,
+			CumulativeTarget:            response.TotalTarget,
+			CumulativeAttainmentPercent: attainmentPercent(response.TotalSales, response.TotalTarget),
+		})
+	}
+	response.AttainmentPercent = attainmentPercent(response.TotalSales, response.TotalTarget)
+
+	return response, nil
+}
+
+// attainmentPercent returns sales as a percentage of a positive target, rounded to 2 decimals
+func attainmentPercent(sales, target models.Money) float64 {
+	return math.Round(float64(sales/target)*10000) / 100
+}
+
+func (s *reportService) GetSalesTrend(ctx context.Context, granularity string, startDate, endDate time.Time) (*models.SalesTrendResponse, error) {
+	validGranularities := map[string]bool{"day": true, "week": true, "month": true}
+	if !validGranularities[granularity] {
+		return nil, models.ErrInvalidGranularity
+	}
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	trend, err := s.repo.GetSalesTrend(ctx, startDate, endDate, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.SalesTrendResponse{
+		StartDate:   startDate.Format("2006-01-02"),
+		EndDate:     endDate.Format("2006-01-02"),
+		Granularity: granularity,
+		Trend:       []models.SalesTrend{},
+	}
+	for _, bucket := range trend {
+		response.Trend = append(response.Trend, bucket)
+		response.TotalSales += bucket.TotalSales
+		response.OrderCount += bucket.OrderCount
+	}
+	if response.OrderCount > 0 {
+		response.AvgOrder = response.TotalSales / models.Money(response.OrderCount)
+	}
+
+	return response, nil
+}
+
+func (s *reportService) GetRefundTrend(ctx context.Context, granularity string, startDate, endDate time.Time) (*models.RefundTrendResponse, error) {
+	validGranularities := map[string]bool{"day": true, "week": true, "month": true}
+	if !validGranularities[granularity] {
+		return nil, models.ErrInvalidGranularity
+	}
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	buckets, err := s.repo.GetRefundTrend(ctx, granularity, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.RefundTrendResponse{
+		StartDate:   startDate.Format("2006-01-02"),
+		EndDate:     endDate.Format("2006-01-02"),
+		Granularity: granularity,
+		Buckets:     []models.RefundTrendBucket{},
+	}
+	for _, bucket := range buckets {
+		bucket.NetRevenue = bucket.GrossSales - bucket.Refunds
+		bucket.RefundRate = refundRate(bucket.GrossSales, bucket.Refunds)
+		response.Buckets = append(response.Buckets, bucket)
+
+		response.GrossSales += bucket.GrossSales
+		response.Refunds += bucket.Refunds
+	}
+	response.NetRevenue = response.GrossSales - response.Refunds
+	response.RefundRate = refundRate(response.GrossSales, response.Refunds)
+
+	return response, nil
+}
+
+func (s *reportService) GetLowMarginItems(ctx context.Context, threshold float64) (*models.LowMarginResponse, error) {
+	if threshold < 0 || threshold > 100 {
+		return nil, models.ErrInvalidThreshold
+	}
+
+	margins, err := s.repo.GetMenuItemMargins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.LowMarginResponse{
+		ThresholdPercent: threshold,
+		Items:            []models.MenuItemMargin{},
+		UnknownCost:      []models.MenuItemMargin{},
+	}
+	for _, margin := range margins {
+		if !margin.CostKnown {
+			margin.ProductionCost = 0
+			response.UnknownCost = append(response.UnknownCost, margin)
+			continue
+		}
+
+		// Items priced at zero have no margin to speak of
+		if margin.Price > 0 {
+			margin.MarginPercent = math.Round((1-margin.ProductionCost/float64(margin.Price))*10000) / 100
+		}
+		if margin.MarginPercent < threshold {
+			response.Items = append(response.Items, margin)
+		}
+	}
+
+	sort.Slice(response.Items, func(i, j int) bool {
+		return response.Items[i].MarginPercent < response.Items[j].MarginPercent
+	})
+
+	return response, nil
+}
+
+func (s *reportService) GetStaffingRecommendation(ctx context.Context, date time.Time, ordersPerStaff int) (*models.StaffingRecommendationResponse, error) {
+	if ordersPerStaff <= 0 {
+		return nil, models.ErrInvalidOrdersPerStaff
+	}
+
+	// Only the weeks before the date count, so a past date isn't compared against itself
+	until := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	since := until.AddDate(0, 0, -7*staffingLookbackWeeks)
+	hours, err := s.repo.GetHourlyLoad(ctx, date.Weekday(), since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.StaffingRecommendationResponse{
+		Date:           date.Format("2006-01-02"),
+		Weekday:        date.Weekday().String(),
+		OrdersPerStaff: ordersPerStaff,
+		LookbackWeeks:  staffingLookbackWeeks,
+		Hours:          []models.HourlyStaffing{},
+	}
+	for _, hour := range hours {
+		hour.AvgOrders = math.Round(hour.AvgOrders/staffingLookbackWeeks*100) / 100
+		hour.RecommendedStaff = (hour.PeakOrders + ordersPerStaff - 1) / ordersPerStaff
+		response.Hours = append(response.Hours, hour)
+	}
+
+	return response, nil
+}
+
+func (s *reportService) GetPriceAudit(ctx context.Context, startDate, endDate time.Time) (*models.PriceAuditResponse, error) {
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	mismatches, err := s.repo.GetPriceMismatches(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	if mismatches == nil {
+		mismatches = []models.PriceMismatch{}
+	}
+
+	return &models.PriceAuditResponse{
+		StartDate:  startDate.Format("2006-01-02"),
+		EndDate:    endDate.Format("2006-01-02"),
+		Mismatches: mismatches,
+	}, nil
+}
+
+func (s *reportService) GetTotalMismatches(ctx context.Context) ([]models.TotalMismatch, error) {
+	mismatches, err := s.repo.GetTotalMismatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mismatches == nil {
+		return []models.TotalMismatch{}, nil
+	}
+	return mismatches, nil
+}
+
+func (s *reportService) GetProfitableHours(ctx context.Context, startDate, endDate time.Time) (*models.ProfitableHoursResponse, error) {
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	hours, err := s.repo.GetHourlyProfit(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	if hours == nil {
+		hours = []models.HourlyProfit{}
+	}
+
+	for i := range hours {
+		hours[i].GrossProfit = hours[i].Revenue - hours[i].IngredientCost
+	}
+	sort.SliceStable(hours, func(i, j int) bool {
+		return hours[i].GrossProfit > hours[j].GrossProfit
+	})
+
+	return &models.ProfitableHoursResponse{
+		StartDate: startDate.Format("2006-01-02"),
+		EndDate:   endDate.Format("2006-01-02"),
+		Hours:     hours,
+	}, nil
+}
+
+// GetSalesAnomalies flags the date's sales and order count when they are at least stdDevs standard
+// deviations away from the mean of the baselineDays days before it
+func (s *reportService) GetSalesAnomalies(ctx context.Context, date time.Time, stdDevs float64, baselineDays int) (*models.SalesAnomalyResponse, error) {
+	if stdDevs <= 0 || math.IsNaN(stdDevs) || math.IsInf(stdDevs, 0) {
+		return nil, models.ErrInvalidStdDevs
+	}
+	if baselineDays < 2 || baselineDays > maxAnomalyBaselineDays {
+		return nil, models.ErrInvalidBaselineDays
+	}
+
+	sales, orders, err := s.repo.GetSalesBaseline(ctx, date, baselineDays)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.SalesAnomalyResponse{
+		Date:         date.Format("2006-01-02"),
+		StdDevs:      stdDevs,
+		BaselineDays: baselineDays,
+		Sales:        scoreAnomaly(sales, stdDevs),
+		Orders:       scoreAnomaly(orders, stdDevs),
+	}
+	response.Anomaly = response.Sales.Anomaly != "" || response.Orders.Anomaly != ""
+
+	return response, nil
+}
+
+// scoreAnomaly sets the z-score of the metric and flags it as a spike or drop beyond stdDevs
+func scoreAnomaly(metric models.SalesAnomalyMetric, stdDevs float64) models.SalesAnomalyMetric {
+	if metric.StdDev > 0 {
+		z := (metric.Value - metric.Mean) / metric.StdDev
+		switch {
+		case z >= stdDevs:
+			metric.Anomaly = "spike"
+		case z <= -stdDevs:
+			metric.Anomaly = "drop"
+		}
+		z = math.Round(z*100) / 100
+		metric.ZScore = &z
+	}
+	metric.Mean = math.Round(metric.Mean*100) / 100
+	metric.StdDev = math.Round(metric.StdDev*100) / 100
+	return metric
+}
+
+// GetMenuContribution ranks the menu items sold between the dates by their total margin, so an item
+// with a thin margin but high volume can outrank a high-margin item that rarely sells
+func (s *reportService) GetMenuContribution(ctx context.Context, startDate, endDate time.Time) (*models.MenuContributionResponse, error) {
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	items, err := s.repo.GetMenuItemContributions(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []models.MenuItemContribution{}
+	}
+
+	for i := range items {
+		items[i].Contribution = items[i].Revenue - items[i].IngredientCost
+		if items[i].UnitsSold > 0 {
+			items[i].UnitMargin = items[i].Contribution / models.Money(items[i].UnitsSold)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Contribution > items[j].Contribution
+	})
+
+	return &models.MenuContributionResponse{
+		StartDate: startDate.Format("2006-01-02"),
+		EndDate:   endDate.Format("2006-01-02"),
+		Items:     items,
+	}, nil
+}
+
+// GetOrderSizeDistribution buckets orders by total price. bounds are the increasing upper bounds of all
+// but the last bucket, so 5,10,20 gives 0-5, 5-10, 10-20 and 20+.
+func (s *reportService) GetOrderSizeDistribution(ctx context.Context, bounds []float64) (*models.OrderSizeDistributionResponse, error) {
+	if len(bounds) == 0 || len(bounds) > maxOrderSizeBuckets {
+		return nil, models.ErrInvalidBuckets
+	}
+	for i, bound := range bounds {
+		if bound <= 0 || (i > 0 && bound <= bounds[i-1]) {
+			return nil, models.ErrInvalidBuckets
+		}
+	}
+
+	lowerBounds := append([]float64{0}, bounds...)
+	counts, err := s.repo.GetOrderSizeCounts(ctx, lowerBounds)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.OrderSizeDistributionResponse{Buckets: make([]models.OrderSizeBucket, len(lowerBounds))}
+	for i, lower := range lowerBounds {
+		bucket := models.OrderSizeBucket{
+			Min:        models.Money(lower),
+			OrderCount: counts[i+1],
+			Label:      formatBound(lower) + "+",
+		}
+		if i+1 < len(lowerBounds) {
+			upper := models.Money(lowerBounds[i+1])
+			bucket.Max = &upper
+			bucket.Label = formatBound(lower) + "-" + formatBound(lowerBounds[i+1])
+		}
+		response.Buckets[i] = bucket
+		response.TotalOrders += bucket.OrderCount
+	}
+
+	return response, nil
+}
+
+// formatBound prints a bucket bound without trailing zeros, e.g. 5 or 7.5
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
+
+func (s *reportService) GetSalesByPaymentMethod(ctx context.Context, startDate, endDate time.Time) (*models.SalesByPaymentResponse, error) {
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	methods, err := s.repo.GetSalesByPaymentMethod(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	if methods == nil {
+		methods = []models.PaymentMethodSales{}
+	}
+
+	return &models.SalesByPaymentResponse{
+		StartDate: startDate.Format("2006-01-02"),
+		EndDate:   endDate.Format("2006-01-02"),
+		Methods:   methods,
+	}, nil
+}
+
+// GetRepeatRate returns the share of the period's orders placed by customers who had ordered before,
+// with the number of new and returning customers
+func (s *reportService) GetRepeatRate(ctx context.Context, startDate, endDate time.Time) (*models.RepeatRateResponse, error) {
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	response, err := s.repo.GetRepeatOrderCounts(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	response.StartDate = startDate.Format("2006-01-02")
+	response.EndDate = endDate.Format("2006-01-02")
+	if response.TotalOrders > 0 {
+		response.RepeatRate = math.Round(float64(response.RepeatOrders)/float64(response.TotalOrders)*10000) / 100
+	}
+
+	return &response, nil
+}
+
+// GetDiscountSummary returns the discounts given over the period, the average discount per order
+// and the share of orders that had one
+func (s *reportService) GetDiscountSummary(ctx context.Context, startDate, endDate time.Time) (*models.DiscountSummaryResponse, error) {
+	if startDate.After(endDate) {
+		return nil, models.ErrInvalidDateRange
+	}
+
+	response, err := s.repo.GetDiscountTotals(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	response.StartDate = startDate.Format("2006-01-02")
+	response.EndDate = endDate.Format("2006-01-02")
+	if response.TotalOrders > 0 {
+		response.AverageDiscount = response.TotalDiscounts / models.Money(response.TotalOrders)
+		response.DiscountRate = math.Round(float64(response.DiscountedOrders)/float64(response.TotalOrders)*10000) / 100
+	}
+
+	return &response, nil
+}
+
+func (s *reportService) GetCustomerSpending(ctx context.Context, customerID int) (*models.CustomerSpendingResponse, error) {
+	if customerID <= 0 {
+		return nil, models.ErrInvalidCustomerID
+	}
+
+	spending, err := s.repo.GetCustomerSpending(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spending, nil
+}
+
+// refundRate returns refunds as a percentage of gross sales, rounded to 2 decimals
+func refundRate(grossSales, refunds models.Money) float64 {
+	if grossSales <= 0 {
+		return 0
+	}
+	return math.Round(float64(refunds/grossSales)*10000) / 100
+}
@@ -0,0 +1,588 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"frappuccino/internal/dal"
+	"frappuccino/internal/models"
+)
+
+// fakeReportRepo serves fixed report rows. Methods the tests don't use are left to the embedded nil interface.
+type fakeReportRepo struct {
+	dal.ReportRepository
+	orderCount   int
+	restocks     []models.RestockTransaction
+	dailySales   []models.SalesTrend
+	refunds      []models.RefundTrendBucket
+	margins      []models.MenuItemMargin
+	hourlyLoad   []models.HourlyStaffing
+	hourlyProfit []models.HourlyProfit
+	sizeCounts   map[int]int
+	contribution []models.MenuItemContribution
+	baseline     [2]models.SalesAnomalyMetric
+	repeatCounts models.RepeatRateResponse
+	discounts    models.DiscountSummaryResponse
+	popular      []models.PopularItem
+	// popularCalls counts the GetPopularItems queries
+	popularCalls int
+	// searchedPrices is the price band GetFullTextSearch was last asked for
+	searchedPrices [2]float64
+	// loadQuery is the weekday and range GetHourlyLoad was last asked for
+	loadQuery struct {
+		weekday      time.Weekday
+		since, until time.Time
+	}
+}
+
+func (r *fakeReportRepo) GetOrderCountInWindow(ctx context.Context, window time.Duration) (int, error) {
+	return r.orderCount, nil
+}
+
+func (r *fakeReportRepo) GetRestockHistory(ctx context.Context, ingredientID int, startDate, endDate time.Time) ([]models.RestockTransaction, error) {
+	return r.restocks, nil
+}
+
+func (r *fakeReportRepo) GetDailySales(ctx context.Context, startDate, endDate time.Time) ([]models.SalesTrend, error) {
+	return r.dailySales, nil
+}
+
+func (r *fakeReportRepo) GetRefundTrend(ctx context.Context, granularity string, startDate, endDate time.Time) ([]models.RefundTrendBucket, error) {
+	return r.refunds, nil
+}
+
+func (r *fakeReportRepo) GetMenuItemMargins(ctx context.Context) ([]models.MenuItemMargin, error) {
+	return r.margins, nil
+}
+
+func (r *fakeReportRepo) GetHourlyLoad(ctx context.Context, weekday time.Weekday, since, until time.Time) ([]models.HourlyStaffing, error) {
+	r.loadQuery.weekday, r.loadQuery.since, r.loadQuery.until = weekday, since, until
+	return r.hourlyLoad, nil
+}
+
+func (r *fakeReportRepo) GetHourlyProfit(ctx context.Context, startDate, endDate time.Time) ([]models.HourlyProfit, error) {
+	return r.hourlyProfit, nil
+}
+
+func (r *fakeReportRepo) GetFullTextSearch(ctx context.Context, query string, filter string, minPrice, maxPrice float64) (models.SearchResult, error) {
+	r.searchedPrices = [2]float64{minPrice, maxPrice}
+	return models.SearchResult{}, nil
+}
+
+func (r *fakeReportRepo) GetOrderSizeCounts(ctx context.Context, bounds []float64) (map[int]int, error) {
+	return r.sizeCounts, nil
+}
+
+func (r *fakeReportRepo) GetPopularItems(ctx context.Context, limit int) ([]models.PopularItem, error) {
+	r.popularCalls++
+	// A fresh copy each time, as the service fills in the percentages
+	return append([]models.PopularItem(nil), r.popular...), nil
+}
+
+func (r *fakeReportRepo) GetMenuItemContributions(ctx context.Context, startDate, endDate time.Time) ([]models.MenuItemContribution, error) {
+	return r.contribution, nil
+}
+
+func (r *fakeReportRepo) GetSalesBaseline(ctx context.Context, date time.Time, baselineDays int) (models.SalesAnomalyMetric, models.SalesAnomalyMetric, error) {
+	return r.baseline[0], r.baseline[1], nil
+}
+
+func (r *fakeReportRepo) GetRepeatOrderCounts(ctx context.Context, startDate, endDate time.Time) (models.RepeatRateResponse, error) {
+	return r.repeatCounts, nil
+}
+
+func (r *fakeReportRepo) GetDiscountTotals(ctx context.Context, startDate, endDate time.Time) (models.DiscountSummaryResponse, error) {
+	return r.discounts, nil
+}
+
+func TestGetOrderRate(t *testing.T) {
+	s := NewReportService(&fakeReportRepo{orderCount: 30}, 0)
+
+	response, err := s.GetOrderRate(context.Background(), 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GetOrderRate: %v", err)
+	}
+	if response.Window != "15m0s" || response.OrderCount != 30 || response.OrdersPerMinute != 2 {
+		t.Errorf("GetOrderRate = %+v, want 30 orders in 15m0s at 2 per minute", response)
+	}
+
+	if _, err := s.GetOrderRate(context.Background(), 0); err != models.ErrInvalidWindow {
+		t.Errorf("GetOrderRate(0) error = %v, want ErrInvalidWindow", err)
+	}
+}
+
+func TestGetRestockHistoryAggregatesSuppliers(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2031, time.March, d, 9, 0, 0, 0, time.UTC) }
+	repo := &fakeReportRepo{restocks: []models.RestockTransaction{
+		{IngredientID: 1, Supplier: "Dairy Co", Quantity: 500, CreatedAt: day(1)},
+		{IngredientID: 2, Supplier: "Sweet Ltd", Quantity: 200, CreatedAt: day(3)},
+		{IngredientID: 1, Supplier: "Dairy Co", Quantity: 300, CreatedAt: day(5)},
+		{IngredientID: 3, Supplier: "Dairy Co", Quantity: 100, CreatedAt: day(11)},
+	}}
+	s := NewReportService(repo, 0)
+
+	response, err := s.GetRestockHistory(context.Background(), 0, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("GetRestockHistory: %v", err)
+	}
+	if len(response.Restocks) != 4 || len(response.Suppliers) != 2 {
+		t.Fatalf("GetRestockHistory = %+v, want 4 restocks from 2 suppliers", response)
+	}
+	dairy, sweet := response.Suppliers[0], response.Suppliers[1]
+	if dairy.Supplier != "Dairy Co" || dairy.RestockCount != 3 || dairy.TotalQuantity != 900 || dairy.AverageQuantity != 300 ||
+		dairy.AverageDaysBetween != 5 || !dairy.FirstRestock.Equal(day(1)) || !dairy.LastRestock.Equal(day(11)) {
+		t.Errorf("Dairy Co = %+v, want 3 restocks averaging 300 every 5 days", dairy)
+	}
+	if sweet.Supplier != "Sweet Ltd" || sweet.RestockCount != 1 || sweet.AverageQuantity != 200 || sweet.AverageDaysBetween != 0 {
+		t.Errorf("Sweet Ltd = %+v, want 1 restock of 200", sweet)
+	}
+
+	if _, err := s.GetRestockHistory(context.Background(), 0, day(5), day(1)); err != models.ErrInvalidDateRange {
+		t.Errorf("GetRestockHistory error = %v, want ErrInvalidDateRange", err)
+	}
+}
+
+func TestGetSalesPerLaborHour(t *testing.T) {
+	repo := &fakeReportRepo{dailySales: []models.SalesTrend{
+		{Date: time.Date(2031, time.March, 3, 0, 0, 0, 0, time.UTC), TotalSales: 400, OrderCount: 20},
+		{Date: time.Date(2031, time.March, 4, 0, 0, 0, 0, time.UTC), TotalSales: 80, OrderCount: 4},
+		// Sales of unstaffed days are left out
+		{Date: time.Date(2031, time.March, 5, 0, 0, 0, 0, time.UTC), TotalSales: 999, OrderCount: 9},
+	}}
+	s := NewReportService(repo, 0)
+
+	response, err := s.GetSalesPerLaborHour(context.Background(), []models.LaborDay{
+		{Date: "2031-03-03", LaborHours: 5},
+		{Date: "2031-03-03", LaborHours: 3}, // a second shift of the same day
+		{Date: "2031-03-04", LaborHours: 4},
+		{Date: "2031-03-06", LaborHours: 2}, // staffed without sales
+	})
+	if err != nil {
+		t.Fatalf("GetSalesPerLaborHour: %v", err)
+	}
+	want := []models.LaborDayProductivity{
+		{Date: "2031-03-03", Sales: 400, OrderCount: 20, LaborHours: 8, SalesPerLaborHour: 50},
+		{Date: "2031-03-04", Sales: 80, OrderCount: 4, LaborHours: 4, SalesPerLaborHour: 20},
+		{Date: "2031-03-06", Sales: 0, OrderCount: 0, LaborHours: 2, SalesPerLaborHour: 0},
+	}
+	if len(response.Days) != len(want) {
+		t.Fatalf("days = %+v, want %d days", response.Days, len(want))
+	}
+	for i, day := range response.Days {
+		if day != want[i] {
+			t.Errorf("day %d = %+v, want %+v", i, day, want[i])
+		}
+	}
+	if response.TotalSales != 480 || response.TotalLaborHours != 14 || response.SalesPerLaborHour != 480.0/14 {
+		t.Errorf("totals = %v over %v hours at %v, want 480 over 14", response.TotalSales, response.TotalLaborHours, response.SalesPerLaborHour)
+	}
+
+	if _, err := s.GetSalesPerLaborHour(context.Background(), []models.LaborDay{{Date: "2031-03-03", LaborHours: 0}}); err != models.ErrInvalidLaborHours {
+		t.Errorf("GetSalesPerLaborHour error = %v, want ErrInvalidLaborHours", err)
+	}
+}
+
+func TestGetRefundTrendNetAndRate(t *testing.T) {
+	repo := &fakeReportRepo{refunds: []models.RefundTrendBucket{
+		{Period: "2021-01-01", GrossSales: 150, Refunds: 15},
+		{Period: "2021-02-01", GrossSales: 200, Refunds: 20},
+		{Period: "2021-03-01", GrossSales: 0, Refunds: 5},
+	}}
+	s := NewReportService(repo, 0)
+	start, end := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.March, 31, 0, 0, 0, 0, time.UTC)
+
+	response, err := s.GetRefundTrend(context.Background(), "month", start, end)
+	if err != nil {
+		t.Fatalf("GetRefundTrend: %v", err)
+	}
+	want := []struct {
+		net  models.Money
+		rate float64
+	}{{135, 10}, {180, 10}, {-5, 0}}
+	for i, bucket := range response.Buckets {
+		if bucket.NetRevenue != want[i].net || bucket.RefundRate != want[i].rate {
+			t.Errorf("bucket %s = net %v at %v%%, want net %v at %v%%", bucket.Period, bucket.NetRevenue, bucket.RefundRate, want[i].net, want[i].rate)
+		}
+	}
+	// 40 of 350 refunded
+	if response.GrossSales != 350 || response.Refunds != 40 || response.NetRevenue != 310 || response.RefundRate != 11.43 {
+		t.Errorf("totals = %+v, want 310 net of 350 at 11.43%%", response)
+	}
+
+	if _, err := s.GetRefundTrend(context.Background(), "hour", start, end); err != models.ErrInvalidGranularity {
+		t.Errorf("GetRefundTrend error = %v, want ErrInvalidGranularity", err)
+	}
+}
+
+func TestGetLowMarginItemsFlagsItemsBelowThreshold(t *testing.T) {
+	repo := &fakeReportRepo{margins: []models.MenuItemMargin{
+		{MenuItemID: 1, Name: "Latte", Price: 4, ProductionCost: 2, CostKnown: true},      // 50%
+		{MenuItemID: 2, Name: "Mocha", Price: 5, ProductionCost: 4.5, CostKnown: true},    // 10%
+		{MenuItemID: 3, Name: "Cake", Price: 4, ProductionCost: 3.4, CostKnown: true},     // 15%
+		{MenuItemID: 4, Name: "Tea", Price: 2, ProductionCost: 0, CostKnown: false},       // unknown
+		{MenuItemID: 5, Name: "Water", Price: 0, ProductionCost: 0.1, CostKnown: true},    // free
+		{MenuItemID: 6, Name: "Espresso", Price: 3, ProductionCost: 2.4, CostKnown: true}, // 20%
+	}}
+	s := NewReportService(repo, 0)
+
+	response, err := s.GetLowMarginItems(context.Background(), 20)
+	if err != nil {
+		t.Fatalf("GetLowMarginItems: %v", err)
+	}
+	want := []struct {
+		id     int
+		margin float64
+	}{{5, 0}, {2, 10}, {3, 15}}
+	if len(response.Items) != len(want) {
+		t.Fatalf("items = %+v, want water, mocha and cake", response.Items)
+	}
+	for i, item := range response.Items {
+		if item.MenuItemID != want[i].id || item.MarginPercent != want[i].margin {
+			t.Errorf("item %d = %+v, want menu item %d at %v%%", i, item, want[i].id, want[i].margin)
+		}
+	}
+	if len(response.UnknownCost) != 1 || response.UnknownCost[0].MenuItemID != 4 {
+		t.Errorf("unknown cost = %+v, want the tea", response.UnknownCost)
+	}
+
+	if _, err := s.GetLowMarginItems(context.Background(), 120); err != models.ErrInvalidThreshold {
+		t.Errorf("GetLowMarginItems error = %v, want ErrInvalidThreshold", err)
+	}
+}
+
+func TestGetStaffingRecommendation(t *testing.T) {
+	// Orders summed and at their peak over the 8 past Mondays
+	repo := &fakeReportRepo{hourlyLoad: []models.HourlyStaffing{
+		{Hour: 8, AvgOrders: 80, PeakOrders: 14},
+		{Hour: 12, AvgOrders: 20, PeakOrders: 5},
+		{Hour: 15, AvgOrders: 48, PeakOrders: 6},
+	}}
+	s := NewReportService(repo, 0)
+	monday := time.Date(2031, time.March, 10, 15, 30, 0, 0, time.UTC)
+
+	response, err := s.GetStaffingRecommendation(context.Background(), monday, 6)
+	if err != nil {
+		t.Fatalf("GetStaffingRecommendation: %v", err)
+	}
+	if repo.loadQuery.weekday != time.Monday || !repo.loadQuery.since.Equal(time.Date(2031, time.January, 13, 0, 0, 0, 0, time.UTC)) ||
+		!repo.loadQuery.until.Equal(time.Date(2031, time.March, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("load read for %+v, want the 8 Mondays before March 10", repo.loadQuery)
+	}
+	want := []models.HourlyStaffing{
+		{Hour: 8, AvgOrders: 10, PeakOrders: 14, RecommendedStaff: 3},
+		{Hour: 12, AvgOrders: 2.5, PeakOrders: 5, RecommendedStaff: 1},
+		{Hour: 15, AvgOrders: 6, PeakOrders: 6, RecommendedStaff: 1},
+	}
+	if len(response.Hours) != len(want) {
+		t.Fatalf("hours = %+v, want %d hours", response.Hours, len(want))
+	}
+	for i, hour := range response.Hours {
+		if hour != want[i] {
+			t.Errorf("hour %d = %+v, want %+v", i, hour, want[i])
+		}
+	}
+
+	if _, err := s.GetStaffingRecommendation(context.Background(), monday, 0); err != models.ErrInvalidOrdersPerStaff {
+		t.Errorf("GetStaffingRecommendation error = %v, want ErrInvalidOrdersPerStaff", err)
+	}
+}
+
+func TestGetProfitableHoursMostProfitableFirst(t *testing.T) {
+	repo := &fakeReportRepo{hourlyProfit: []models.HourlyProfit{
+		{Hour: 8, OrderCount: 30, Revenue: 120, IngredientCost: 60},
+		{Hour: 14, OrderCount: 10, Revenue: 100, IngredientCost: 20},
+		{Hour: 17, OrderCount: 5, Revenue: 20, IngredientCost: 5},
+	}}
+	s := NewReportService(repo, 0)
+	day := time.Date(2031, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	response, err := s.GetProfitableHours(context.Background(), day, day)
+	if err != nil {
+		t.Fatalf("GetProfitableHours: %v", err)
+	}
+	// The busiest hour isn't the most profitable
+	want := []struct {
+		hour   int
+		profit models.Money
+	}{{14, 80}, {8, 60}, {17, 15}}
+	for i, hour := range response.Hours {
+		if hour.Hour != want[i].hour || hour.GrossProfit != want[i].profit {
+			t.Errorf("hour %d = %+v, want hour %d with a profit of %v", i, hour, want[i].hour, want[i].profit)
+		}
+	}
+}
+
+func TestSearchForwardsPriceBand(t *testing.T) {
+	repo := &fakeReportRepo{}
+	s := NewReportService(repo, 0)
+
+	if _, err := s.Search(context.Background(), "latte", "menu", 4, 6); err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if repo.searchedPrices != [2]float64{4, 6} {
+		t.Errorf("searched prices %v, want [4 6]", repo.searchedPrices)
+	}
+
+	for _, band := range [][2]float64{{6, 4}, {-1, 4}} {
+		if _, err := s.Search(context.Background(), "latte", "menu", band[0], band[1]); !errors.Is(err, models.ErrInvalidPriceRange) {
+			t.Errorf("Search(%v) error = %v, want ErrInvalidPriceRange", band, err)
+		}
+	}
+}
+
+func TestGetOrderSizeDistributionLabelsBuckets(t *testing.T) {
+	// Bucket 0, totals below the first bound, can't happen as orders aren't negative
+	repo := &fakeReportRepo{sizeCounts: map[int]int{1: 4, 2: 7, 4: 2}}
+	s := NewReportService(repo, 0)
+
+	response, err := s.GetOrderSizeDistribution(context.Background(), []float64{5, 7.5, 20})
+	if err != nil {
+		t.Fatalf("GetOrderSizeDistribution: %v", err)
+	}
+	want := []struct {
+		label string
+		count int
+	}{{"0-5", 4}, {"5-7.5", 7}, {"7.5-20", 0}, {"20+", 2}}
+	if len(response.Buckets) != len(want) || response.TotalOrders != 13 {
+		t.Fatalf("response = %+v, want %d buckets of 13 orders", response, len(want))
+	}
+	for i, w := range want {
+		if got := response.Buckets[i]; got.Label != w.label || got.OrderCount != w.count {
+			t.Errorf("bucket %d = %+v, want %s with %d orders", i, got, w.label, w.count)
+		}
+	}
+	if last := response.Buckets[3]; last.Min != 20 || last.Max != nil {
+		t.Errorf("last bucket = %+v, want open ended from 20", last)
+	}
+
+	for _, bounds := range [][]float64{nil, {10, 5}, {0, 5}} {
+		if _, err := s.GetOrderSizeDistribution(context.Background(), bounds); err != models.ErrInvalidBuckets {
+			t.Errorf("GetOrderSizeDistribution(%v) error = %v, want ErrInvalidBuckets", bounds, err)
+		}
+	}
+}
+
+func TestGetPopularItemsCachesUntilRefreshed(t *testing.T) {
+	repo := &fakeReportRepo{popular: []models.PopularItem{{MenuItemID: 1, TotalQuantity: 3}, {MenuItemID: 2, TotalQuantity: 1}}}
+	s := NewReportService(repo, time.Hour)
+	ctx := context.Background()
+
+	if _, err := s.GetPopularItems(ctx, 5); err != nil {
+		t.Fatalf("GetPopularItems: %v", err)
+	}
+	// New orders aren't seen until the cache is refreshed
+	repo.popular = []models.PopularItem{{MenuItemID: 2, TotalQuantity: 4}}
+	items, err := s.GetPopularItems(ctx, 5)
+	if err != nil {
+		t.Fatalf("GetPopularItems: %v", err)
+	}
+	if repo.popularCalls != 1 || len(items) != 2 || items[0].MenuItemID != 1 || items[0].Percentage != 75 {
+		t.Errorf("cached items = %+v after %d queries, want the first result at 75%% from one query", items, repo.popularCalls)
+	}
+
+	items, err = s.RefreshPopularItems(ctx, 5)
+	if err != nil {
+		t.Fatalf("RefreshPopularItems: %v", err)
+	}
+	if repo.popularCalls != 2 || len(items) != 1 || items[0].MenuItemID != 2 || items[0].Percentage != 100 {
+		t.Errorf("refreshed items = %+v after %d queries, want item 2 at 100%% from a second query", items, repo.popularCalls)
+	}
+	if items, _ := s.GetPopularItems(ctx, 5); repo.popularCalls != 2 || len(items) != 1 || items[0].MenuItemID != 2 {
+		t.Errorf("items after refresh = %+v after %d queries, want the refreshed items from cache", items, repo.popularCalls)
+	}
+
+	// Each location and limit has its own entry
+	s.GetPopularItems(models.WithLocationID(ctx, 2), 5)
+	s.GetPopularItems(ctx, 10)
+	if repo.popularCalls != 4 {
+		t.Errorf("ran %d queries, want one more for the other location and one for the other limit", repo.popularCalls)
+	}
+
+	// A zero TTL disables caching
+	repo.popularCalls = 0
+	uncached := NewReportService(repo, 0)
+	uncached.GetPopularItems(ctx, 5)
+	uncached.GetPopularItems(ctx, 5)
+	if repo.popularCalls != 2 {
+		t.Errorf("ran %d queries without a cache, want 2", repo.popularCalls)
+	}
+}
+
+func TestGetMenuContributionRanksByTotalMargin(t *testing.T) {
+	repo := &fakeReportRepo{contribution: []models.MenuItemContribution{
+		{MenuItemID: 1, Name: "Truffle", UnitsSold: 2, Revenue: 20, IngredientCost: 4},
+		{MenuItemID: 2, Name: "Drip", UnitsSold: 100, Revenue: 200, IngredientCost: 150},
+		{MenuItemID: 3, Name: "Latte", UnitsSold: 30, Revenue: 120, IngredientCost: 60},
+		{MenuItemID: 4, Name: "Muffin", UnitsSold: 60, Revenue: 120, IngredientCost: 110},
+	}}
+	s := NewReportService(repo, 0)
+	start := time.Date(2031, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	response, err := s.GetMenuContribution(context.Background(), start, start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("GetMenuContribution: %v", err)
+	}
+	// The truffle has the best unit margin and drip coffee the most sales, but the latte earns the most
+	want := []struct {
+		name         string
+		unitMargin   models.Money
+		contribution models.Money
+	}{
+		{"Latte", 2, 60},
+		{"Drip", 0.50, 50},
+		{"Truffle", 8, 16},
+		{"Muffin", 10.0 / 60, 10},
+	}
+	if len(response.Items) != len(want) {
+		t.Fatalf("items = %+v, want %d", response.Items, len(want))
+	}
+	for i, w := range want {
+		got := response.Items[i]
+		if got.Name != w.name || got.Contribution != w.contribution || got.UnitMargin != w.unitMargin {
+			t.Errorf("rank %d = %+v, want %s contributing %v at %v a unit", i+1, got, w.name, w.contribution, w.unitMargin)
+		}
+	}
+	if response.StartDate != "2031-03-01" || response.EndDate != "2031-04-01" {
+		t.Errorf("period = %s to %s, want 2031-03-01 to 2031-04-01", response.StartDate, response.EndDate)
+	}
+
+	if _, err := s.GetMenuContribution(context.Background(), start, start.AddDate(0, 0, -1)); err != models.ErrInvalidDateRange {
+		t.Errorf("reversed range error = %v, want ErrInvalidDateRange", err)
+	}
+}
+
+func TestGetSalesAnomaliesFlagsOutlierDay(t *testing.T) {
+	day := time.Date(2031, time.March, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		sales       models.SalesAnomalyMetric
+		orders      models.SalesAnomalyMetric
+		wantSales   string
+		wantOrders  string
+		wantAnomaly bool
+	}{
+		{"normal", models.SalesAnomalyMetric{Value: 21, Mean: 20, StdDev: 2}, models.SalesAnomalyMetric{Value: 3, Mean: 2.5, StdDev: 0.5}, "", "", false},
+		{"spike", models.SalesAnomalyMetric{Value: 100, Mean: 20, StdDev: 2}, models.SalesAnomalyMetric{Value: 2, Mean: 2.5, StdDev: 0.5}, "spike", "", true},
+		{"drop", models.SalesAnomalyMetric{Value: 14, Mean: 20, StdDev: 2}, models.SalesAnomalyMetric{Value: 1, Mean: 2.5, StdDev: 0.5}, "drop", "drop", true},
+		// A baseline that doesn't vary has no z-score to flag
+		{"flat", models.SalesAnomalyMetric{Value: 100, Mean: 20}, models.SalesAnomalyMetric{Value: 9, Mean: 2}, "", "", false},
+	}
+	for _, tt := range tests {
+		s := NewReportService(&fakeReportRepo{baseline: [2]models.SalesAnomalyMetric{tt.sales, tt.orders}}, 0)
+		response, err := s.GetSalesAnomalies(context.Background(), day, 3, 28)
+		if err != nil {
+			t.Fatalf("%s: GetSalesAnomalies: %v", tt.name, err)
+		}
+		if response.Sales.Anomaly != tt.wantSales || response.Orders.Anomaly != tt.wantOrders || response.Anomaly != tt.wantAnomaly {
+			t.Errorf("%s: response = %+v, want sales %q and orders %q", tt.name, response, tt.wantSales, tt.wantOrders)
+		}
+		if (response.Sales.ZScore == nil) != (tt.sales.StdDev == 0) {
+			t.Errorf("%s: sales z-score = %v, want one only when the baseline varies", tt.name, response.Sales.ZScore)
+		}
+	}
+
+	s := NewReportService(&fakeReportRepo{}, 0)
+	if _, err := s.GetSalesAnomalies(context.Background(), day, 0, 28); err != models.ErrInvalidStdDevs {
+		t.Errorf("zero deviations error = %v, want ErrInvalidStdDevs", err)
+	}
+	if _, err := s.GetSalesAnomalies(context.Background(), day, 3, 1); err != models.ErrInvalidBaselineDays {
+		t.Errorf("one baseline day error = %v, want ErrInvalidBaselineDays", err)
+	}
+}
+
+func TestGetRepeatRate(t *testing.T) {
+	start := time.Date(2031, time.March, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		counts models.RepeatRateResponse
+		want   float64
+	}{
+		{models.RepeatRateResponse{TotalOrders: 5, RepeatOrders: 2, NewCustomers: 3, ReturningCustomers: 1}, 40},
+		{models.RepeatRateResponse{TotalOrders: 3, RepeatOrders: 2, NewCustomers: 1, ReturningCustomers: 1}, 66.67},
+		{models.RepeatRateResponse{}, 0},
+	}
+	for _, tt := range tests {
+		s := NewReportService(&fakeReportRepo{repeatCounts: tt.counts}, 0)
+		response, err := s.GetRepeatRate(context.Background(), start, start.AddDate(0, 0, 7))
+		if err != nil {
+			t.Fatalf("GetRepeatRate: %v", err)
+		}
+		if response.RepeatRate != tt.want || response.NewCustomers != tt.counts.NewCustomers || response.StartDate != "2031-03-01" {
+			t.Errorf("GetRepeatRate of %+v = %+v, want a rate of %v", tt.counts, response, tt.want)
+		}
+	}
+}
+
+func TestGetTargetAttainment(t *testing.T) {
+	repo := &fakeReportRepo{dailySales: []models.SalesTrend{
+		{Date: time.Date(2031, time.March, 3, 0, 0, 0, 0, time.UTC), TotalSales: 150},
+		{Date: time.Date(2031, time.March, 4, 0, 0, 0, 0, time.UTC), TotalSales: 120},
+	}}
+	s := NewReportService(repo, 0)
+
+	response, err := s.GetTargetAttainment(context.Background(), models.TargetAttainmentRequest{
+		StartDate:   "2031-03-03",
+		EndDate:     "2031-03-05",
+		DailyTarget: 200,
+		Targets:     []models.DayTarget{{Date: "2031-03-04", Target: 100}},
+	})
+	if err != nil {
+		t.Fatalf("GetTargetAttainment: %v", err)
+	}
+	// The 4th beats its lowered target, and the 5th sells nothing
+	want := []models.DayAttainment{
+		{Date: "2031-03-03", Sales: 150, Target: 200, AttainmentPercent: 75, CumulativeSales: 150, CumulativeTarget: 200, CumulativeAttainmentPercent: 75},
+		{Date: "2031-03-04", Sales: 120, Target: 100, AttainmentPercent: 120, CumulativeSales: 270, CumulativeTarget: 300, CumulativeAttainmentPercent: 90},
+		{Date: "2031-03-05", Sales: 0, Target: 200, AttainmentPercent: 0, CumulativeSales: 270, CumulativeTarget: 500, CumulativeAttainmentPercent: 54},
+	}
+	if !reflect.DeepEqual(response.Days, want) {
+		t.Errorf("days = %+v, want %+v", response.Days, want)
+	}
+	if response.TotalSales != 270 || response.TotalTarget != 500 || response.AttainmentPercent != 54 {
+		t.Errorf("totals = %v of %v at %v%%, want 270 of 500 at 54%%", response.TotalSales, response.TotalTarget, response.AttainmentPercent)
+	}
+
+	for _, request := range []models.TargetAttainmentRequest{
+		{StartDate: "2031-03-03", EndDate: "2031-03-05"},
+		{StartDate: "2031-03-03", EndDate: "2031-03-05", DailyTarget: 200, Targets: []models.DayTarget{{Date: "2031-03-09", Target: 100}}},
+	} {
+		if _, err := s.GetTargetAttainment(context.Background(), request); err != models.ErrInvalidSalesTarget {
+			t.Errorf("GetTargetAttainment(%+v) error = %v, want ErrInvalidSalesTarget", request, err)
+		}
+	}
+}
+
+func TestGetDiscountSummaryAveragesOverAllOrders(t *testing.T) {
+	repo := &fakeReportRepo{discounts: models.DiscountSummaryResponse{TotalOrders: 8, DiscountedOrders: 2, TotalDiscounts: 6}}
+	s := NewReportService(repo, 0)
+	start := time.Date(2031, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2031, time.March, 31, 0, 0, 0, 0, time.UTC)
+
+	response, err := s.GetDiscountSummary(context.Background(), start, end)
+	if err != nil {
+		t.Fatalf("GetDiscountSummary: %v", err)
+	}
+	// The orders without a discount bring the average down
+	if response.AverageDiscount != 0.75 || response.DiscountRate != 25 {
+		t.Errorf("average = %v at %v%%, want 0.75 at 25%%", response.AverageDiscount, response.DiscountRate)
+	}
+	if response.StartDate != "2031-03-01" || response.EndDate != "2031-03-31" {
+		t.Errorf("period = %s to %s, want 2031-03-01 to 2031-03-31", response.StartDate, response.EndDate)
+	}
+
+	// No orders leave the average and rate at zero
+	repo.discounts = models.DiscountSummaryResponse{}
+	response, err = s.GetDiscountSummary(context.Background(), start, end)
+	if err != nil {
+		t.Fatalf("GetDiscountSummary: %v", err)
+	}
+	if response.AverageDiscount != 0 || response.DiscountRate != 0 {
+		t.Errorf("average = %v at %v%%, want zeroes", response.AverageDiscount, response.DiscountRate)
+	}
+
+	if _, err := s.GetDiscountSummary(context.Background(), end, start); err != models.ErrInvalidDateRange {
+		t.Errorf("reversed range error = %v, want ErrInvalidDateRange", err)
+	}
+}